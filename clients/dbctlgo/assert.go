@@ -0,0 +1,145 @@
+package dbctlgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// RowDiff is a row, document or key the database holds differently than its golden
+// file: missing, extra or changed.
+type RowDiff struct {
+	Kind     string                 `json:"kind"`
+	Expected map[string]interface{} `json:"expected,omitempty"`
+	Actual   map[string]interface{} `json:"actual,omitempty"`
+	// Columns are the columns a changed row differs in
+	Columns []string `json:"columns,omitempty"`
+}
+
+// TableDiff is a table, collection or set of keys whose content differs from its
+// golden file.
+type TableDiff struct {
+	Table string `json:"table"`
+	// File is the golden file of the table, within the golden directory
+	File string    `json:"file"`
+	Key  []string  `json:"key,omitempty"`
+	Rows []RowDiff `json:"rows"`
+}
+
+// AssertDBResponse is the response object of comparing a database with golden files
+type AssertDBResponse struct {
+	Tables []TableDiff `json:"tables"`
+	// Diff is Tables written out the way a failing test shows them
+	Diff string `json:"diff"`
+	// Files are the golden files rewritten with WithGoldenUpdate
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// DiffDB compares the content of the database at uri with the golden files in dir
+// and returns how it differs, written out a line per row, empty when it matches.
+// Golden files are in the formats fixtures are loaded in: csv, json or yaml table
+// fixtures for postgres, json documents for mongodb and commands for redis. With
+// WithGoldenUpdate the files are rewritten with the content of the database
+// instead.
+func DiffDB(uri, dir string, opts ...Option) (string, error) {
+	cfg, err := configFrom(opts)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := httpDoAssertDBRequest(uri, dir, cfg)
+	if err != nil {
+		return "", fmt.Errorf("compare database failed: %w", err)
+	}
+
+	for rel, content := range res.Files {
+		// the server names the files it was sent, nothing outside of dir
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			return "", fmt.Errorf("golden file %q is not in %s", rel, dir)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(rel)), []byte(content), 0o644); err != nil {
+			return "", fmt.Errorf("update golden files failed: %w", err)
+		}
+	}
+	return res.Diff, nil
+}
+
+// AssertDBMatches fails the test when the content of the database at uri differs
+// from the golden files in dir, showing the missing, extra and changed rows. With
+// WithGoldenUpdate, or DBCTL_UPDATE_GOLDEN=true, it rewrites the files instead.
+func AssertDBMatches(t *testing.T, uri, dir string, opts ...Option) {
+	t.Helper()
+
+	diff, err := DiffDB(uri, dir, opts...)
+	if err != nil {
+		t.Fatalf("failed to compare %s with %s: %v", uri, dir, err)
+	}
+	if diff != "" {
+		t.Errorf("database does not match the golden files in %s:\n%s", dir, diff)
+	}
+}
+
+func httpDoAssertDBRequest(uri, dir string, cfg *config) (*AssertDBResponse, error) {
+	bodyBuf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(bodyBuf)
+
+	goldenFiles, err := getFilesList(dir, "")
+	if err != nil {
+		return nil, fmt.Errorf("read golden files failed: %w", err)
+	}
+
+	for _, f := range goldenFiles {
+		if err := addFileToWriter(bodyWriter, "golden", f); err != nil {
+			return nil, err
+		}
+	}
+
+	kv := map[string]string{
+		"uri":    uri,
+		"dir":    dir,
+		"update": strconv.FormatBool(cfg.updateGolden),
+	}
+	for k, v := range kv {
+		if err := bodyWriter.WriteField(k, v); err != nil {
+			return nil, err
+		}
+	}
+	for _, column := range cfg.ignoredColumns {
+		if err := bodyWriter.WriteField("ignore", column); err != nil {
+			return nil, err
+		}
+	}
+
+	contentType := bodyWriter.FormDataContentType()
+	if err := bodyWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.getHostURL()+"/assert", bodyBuf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	rawRes, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rawRes.Body.Close()
+
+	if err := checkForError(rawRes); err != nil {
+		return nil, err
+	}
+
+	var res AssertDBResponse
+	if err := json.NewDecoder(rawRes.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
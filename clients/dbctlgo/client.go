@@ -15,6 +15,7 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -33,6 +34,9 @@ const (
 	DatabaseMongoDB = "mongodb"
 )
 
+// isolationSchema asks for a schema of a shared database rather than a database
+const isolationSchema = "schema"
+
 // MustCreatePostgresDB create a postgres database and return connection string or fail the test
 func MustCreatePostgresDB(t *testing.T, opts ...Option) string {
 	return MustCreateDB(t, DatabasePostgres, opts...)
@@ -48,6 +52,44 @@ func MustCreateMongoDB(t *testing.T, ops ...Option) string {
 	return MustCreateDB(t, DatabaseMongoDB, ops...)
 }
 
+// MustCreatePostgresDBWithReplicas create a postgres database and return the
+// connection string of the primary and of each replica or fail the test. The
+// instance has to be started with replicas, the replica uris are read only.
+func MustCreatePostgresDBWithReplicas(t *testing.T, opts ...Option) (string, []string) {
+	uri, replicas, err := CreatePostgresDBWithReplicas(opts...)
+	if err != nil {
+		t.Fatalf("failed to create %s database: %v", DatabasePostgres, err)
+	}
+
+	t.Cleanup(func() {
+		logQueriesOnFailure(t, DatabasePostgres, uri, opts)
+		if err := RemoveDB(DatabasePostgres, uri, opts...); err != nil {
+			t.Errorf("failed to remove %s database: %v", DatabasePostgres, err)
+		}
+	})
+
+	return uri, replicas
+}
+
+// MustCreateDBWithCA create a database and return its connection string and the
+// certificate of the authority to verify the instance with, PEM encoded, or fail the
+// test. The certificate is empty unless the instance was started with --tls.
+func MustCreateDBWithCA(t *testing.T, dbType string, opts ...Option) (string, string) {
+	uri, ca, err := CreateDBWithCA(dbType, opts...)
+	if err != nil {
+		t.Fatalf("failed to create %s database: %v", dbType, err)
+	}
+
+	t.Cleanup(func() {
+		logQueriesOnFailure(t, dbType, uri, opts)
+		if err := RemoveDB(dbType, uri, opts...); err != nil {
+			t.Errorf("failed to remove %s database: %v", dbType, err)
+		}
+	})
+
+	return uri, ca
+}
+
 // MustCreateDB create a database and return connection string or fail the test
 // it will also remove the database after the test is finished
 func MustCreateDB(t *testing.T, dbType string, opts ...Option) string {
@@ -57,6 +99,8 @@ func MustCreateDB(t *testing.T, dbType string, opts ...Option) string {
 	}
 
 	t.Cleanup(func() {
+		logQueriesOnFailure(t, dbType, uri, opts)
+
 		// the same options have to be used here, the database was created through
 		// the server they point at.
 		// report, do not abort: the remaining cleanup functions still have to run
@@ -68,6 +112,31 @@ func MustCreateDB(t *testing.T, dbType string, opts ...Option) string {
 	return uri
 }
 
+// logQueriesOnFailure logs the queries the database at uri ran when the test
+// failed and the client was asked to, before the database is removed with them.
+func logQueriesOnFailure(t *testing.T, dbType, uri string, opts []Option) {
+	if !t.Failed() || dbType != DatabasePostgres {
+		return
+	}
+
+	cfg, err := configFrom(opts)
+	if err != nil || !cfg.queryLogOnFailure {
+		return
+	}
+
+	entries, err := QueryLog(uri, opts...)
+	if err != nil {
+		t.Logf("failed to read the queries of %s: %v", uri, err)
+		return
+	}
+
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(e.Text + "\n")
+	}
+	t.Logf("queries of %s:\n%s", uri, b.String())
+}
+
 // RemoveDB remove a database using connection string
 func RemoveDB(dbType, uri string, opts ...Option) error {
 	cfg, err := configFrom(opts)
@@ -97,20 +166,53 @@ func configFrom(opts []Option) (*config, error) {
 // CreateDB create a database and return connection string
 // it up to the caller to remove the database by calling RemoveDB
 func CreateDB(dbType string, opts ...Option) (string, error) {
+	res, err := createDB(dbType, opts)
+	if err != nil {
+		return "", err
+	}
+	return res.URI, nil
+}
+
+// CreatePostgresDBWithReplicas create a postgres database and return the connection
+// string of the primary and of each replica of the instance, none when it was
+// started without replicas. The database is removed through the primary uri, by
+// calling RemoveDB.
+func CreatePostgresDBWithReplicas(opts ...Option) (string, []string, error) {
+	res, err := createDB(DatabasePostgres, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	return res.URI, res.ReplicaURIs, nil
+}
+
+// CreateDBWithCA create a database and return its connection string and the
+// certificate of the authority to verify the instance with, PEM encoded. The
+// certificate is empty unless the instance was started with --tls, the clients
+// that can not read it from the path the uri names, such as redis ones, load it
+// into the root CAs of their tls.Config.
+func CreateDBWithCA(dbType string, opts ...Option) (string, string, error) {
+	res, err := createDB(dbType, opts)
+	if err != nil {
+		return "", "", err
+	}
+	return res.URI, res.CA, nil
+}
+
+func createDB(dbType string, opts []Option) (*CreateDBResponse, error) {
 	if dbType != DatabaseRedis && dbType != DatabasePostgres && dbType != DatabaseMongoDB {
-		return "", ErrInvalidDatabaseType
+		return nil, ErrInvalidDatabaseType
 	}
 
 	cfg, err := configFrom(opts)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	var migrationsPath, fixturesPath string
 	if cfg.migrations != "" {
 		s, err := filepath.Abs(cfg.migrations)
 		if err != nil {
-			return "", fmt.Errorf("get migraions absolute path failed, %w", err)
+			return nil, fmt.Errorf("get migraions absolute path failed, %w", err)
 		}
 		migrationsPath = s
 	}
@@ -118,11 +220,20 @@ func CreateDB(dbType string, opts ...Option) (string, error) {
 	if cfg.fixtures != "" {
 		s, err := filepath.Abs(cfg.fixtures)
 		if err != nil {
-			return "", fmt.Errorf("get fixtures absolute path failed, %w", err)
+			return nil, fmt.Errorf("get fixtures absolute path failed, %w", err)
 		}
 		fixturesPath = s
 	}
 
+	var grants string
+	if cfg.grants != "" {
+		b, err := os.ReadFile(cfg.grants)
+		if err != nil {
+			return nil, fmt.Errorf("read grants failed, %w", err)
+		}
+		grants = string(b)
+	}
+
 	req := &CreateDBRequest{
 		Type:                  dbType,
 		Migrations:            migrationsPath,
@@ -133,14 +244,19 @@ func CreateDB(dbType string, opts ...Option) (string, error) {
 		InstancePass:          cfg.instancePass,
 		InstancePort:          cfg.instancePort,
 		InstanceUser:          cfg.instanceUser,
+		RestrictedRole:        cfg.restrictedRole,
+		Grants:                grants,
+	}
+	if cfg.schemaIsolation {
+		req.Isolation = isolationSchema
 	}
 
 	res, err := httpDoCreateDBRequest(req, cfg.getHostURL())
 	if err != nil {
-		return "", fmt.Errorf("create %s database failed: %w", dbType, err)
+		return nil, fmt.Errorf("create %s database failed: %w", dbType, err)
 	}
 
-	return res.URI, nil
+	return res, nil
 }
 
 // ErrorMessage is representing rest api error object
@@ -164,11 +280,26 @@ type CreateDBRequest struct {
 	InstanceUser string `json:"instance_user"`
 	InstancePass string `json:"instance_pass"`
 	InstanceName string `json:"instance_name"`
+
+	// RestrictedRole hands a postgres database out with a role of its own, with
+	// the privileges Grants give it or owning the database.
+	RestrictedRole bool   `json:"restricted_role"`
+	Grants         string `json:"grants"`
+
+	// Isolation is what a postgres database is handed out as, a database of its
+	// own when empty or a schema of a shared one.
+	Isolation string `json:"isolation"`
 }
 
 // CreateDBResponse is the response object for creating a database
 type CreateDBResponse struct {
 	URI string `json:"uri"`
+	// ReplicaURIs are the uris of the database on the replicas of a postgres
+	// instance started with them, read only.
+	ReplicaURIs []string `json:"replica_uris,omitempty"`
+	// CA is the certificate of the authority to verify an instance started with
+	// TLS with, PEM encoded.
+	CA string `json:"ca,omitempty"`
 }
 
 // RemoveDBRequest is the request object for removing a database
@@ -210,6 +341,9 @@ func httpDoCreateDBRequest(r *CreateDBRequest, baseURL string) (*CreateDBRespons
 		"instance_pass":           r.InstancePass,
 		"instance_name":           r.InstanceName,
 		"with_default_migrations": strconv.FormatBool(r.WithDefaultMigrations),
+		"restricted_role":         strconv.FormatBool(r.RestrictedRole),
+		"grants":                  r.Grants,
+		"isolation":               r.Isolation,
 	}
 
 	for _, f := range migrationFiles {
@@ -23,6 +23,22 @@ type config struct {
 	instancePass   string
 	instanceDBName string
 
+	// whether to log the queries a postgres database ran when its test fails
+	queryLogOnFailure bool
+
+	// whether a postgres database is handed out with a role of its own, with the
+	// privileges of the grants file when one is given
+	restrictedRole bool
+	grants         string
+
+	// whether a postgres database is handed out as a schema of a shared database
+	schemaIsolation bool
+
+	// the columns left out of comparing a database with golden files, and whether
+	// the golden files are rewritten instead
+	ignoredColumns []string
+	updateGolden   bool
+
 	// host and port of the host, where the dbctl testing server is running
 	hostAddress string
 	hostPort    uint32
@@ -35,6 +51,9 @@ const (
 	EnvHost = "DBCTL_HOST"
 	// EnvPort is the port of the dbctl api server
 	EnvPort = "DBCTL_PORT"
+	// EnvUpdateGolden rewrites the golden files AssertDBMatches compares with, when
+	// true
+	EnvUpdateGolden = "DBCTL_UPDATE_GOLDEN"
 )
 
 // The instance details are left empty on purpose: the server knows the defaults of
@@ -59,6 +78,14 @@ func (c *config) fromEnv() error {
 		c.hostPort = uint32(p)
 	}
 
+	if update := os.Getenv(EnvUpdateGolden); update != "" {
+		u, err := strconv.ParseBool(update)
+		if err != nil {
+			return fmt.Errorf("%s is not a valid boolean: %q", EnvUpdateGolden, update)
+		}
+		c.updateGolden = u
+	}
+
 	return nil
 }
 
@@ -119,6 +146,71 @@ func WithMigrationsFileRegex(regex string) Option {
 	}
 }
 
+// WithQueryLogOnFailure configures the client to log the queries a postgres
+// database created by a Must function ran when its test fails, so that a failing
+// test tells which SQL ran. The instance has to be started with --log-queries.
+func WithQueryLogOnFailure() Option {
+	return func(cfg *config) error {
+		cfg.queryLogOnFailure = true
+		return nil
+	}
+}
+
+// WithRestrictedRole configures the client to have a postgres database handed out
+// with a role of its own, owning only that database, instead of the superuser of
+// the instance. Statements the application role could not run then fail in the
+// test, not in staging. The role goes with the database.
+func WithRestrictedRole() Option {
+	return func(cfg *config) error {
+		cfg.restrictedRole = true
+		return nil
+	}
+}
+
+// WithGrants configures the client to have a postgres database handed out with a
+// role of its own, with the privileges the SQL file at path grants it. The file
+// names the role :role, :"role" or :'role', the way psql takes variables.
+func WithGrants(path string) Option {
+	return func(cfg *config) error {
+		cfg.restrictedRole = true
+		cfg.grants = path
+		return nil
+	}
+}
+
+// WithSchemaIsolation configures the client to have a postgres database handed out
+// as a schema of a database shared with other tests, which is cheaper to create
+// than a database for suites running thousands of small tests. The uri confines
+// the connections to the schema through their search_path, tables have to be
+// named without their schema.
+func WithSchemaIsolation() Option {
+	return func(cfg *config) error {
+		cfg.schemaIsolation = true
+		return nil
+	}
+}
+
+// WithIgnoredColumns configures the client to leave columns out of comparing a
+// database with golden files, such as timestamps and generated ids. A column is
+// named alone to leave it out of every table, or as table.column. For mongodb they
+// are fields, for redis patterns of keys.
+func WithIgnoredColumns(columns ...string) Option {
+	return func(cfg *config) error {
+		cfg.ignoredColumns = append(cfg.ignoredColumns, columns...)
+		return nil
+	}
+}
+
+// WithGoldenUpdate configures the client to rewrite the golden files with the
+// content of the database when update is true, instead of comparing them. It is
+// meant to be given the -update flag of the tests.
+func WithGoldenUpdate(update bool) Option {
+	return func(cfg *config) error {
+		cfg.updateGolden = update
+		return nil
+	}
+}
+
 // getHostURL returns the host url.
 func (c *config) getHostURL() string {
 	return "http://" + net.JoinHostPort(c.hostAddress, fmt.Sprintf("%d", c.hostPort))
@@ -1,6 +1,9 @@
 package dbctlgo
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 // Options used to be applied to the package level default, which meant the
 // migrations of one test silently became the migrations of every test after it.
@@ -18,7 +21,7 @@ func TestOptionsDoNotLeakIntoTheDefaults(t *testing.T) {
 		t.Fatal("expected creating a database with a missing migrations directory to fail")
 	}
 
-	if *defaultConfig != before {
+	if !reflect.DeepEqual(*defaultConfig, before) {
 		t.Fatalf("options leaked into the package defaults: %+v", *defaultConfig)
 	}
 }
@@ -0,0 +1,49 @@
+package dbctlgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// QueryLogEntry is an entry of the query log of a postgres database: a statement,
+// its parameters or what postgres had to say about it.
+type QueryLogEntry struct {
+	Database string `json:"database"`
+	Severity string `json:"severity"`
+	// Text is the entry as postgres wrote it, every line of the statement included.
+	Text string `json:"text"`
+}
+
+// QueryLog returns what the query log of the postgres instance holds for the
+// database at uri, in the order it was logged. The instance has to be started with
+// --log-queries.
+func QueryLog(uri string, opts ...Option) ([]QueryLogEntry, error) {
+	cfg, err := configFrom(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := cfg.getHostURL() + "/logs/queries?" + url.Values{"uri": {uri}}.Encode()
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRes, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("read query log failed: %w", err)
+	}
+	defer rawRes.Body.Close()
+
+	if err := checkForError(rawRes); err != nil {
+		return nil, fmt.Errorf("read query log failed: %w", err)
+	}
+
+	var entries []QueryLogEntry
+	if err := json.NewDecoder(rawRes.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("read query log failed: %w", err)
+	}
+	return entries, nil
+}
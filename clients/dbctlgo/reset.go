@@ -0,0 +1,72 @@
+package dbctlgo
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+// ResetDB returns the database at uri to the state it was created in, without
+// removing it: its tables, keys or collections are emptied but for what its
+// migrations track, and the fixtures it was created with are applied again. The
+// fixtures given with WithFixtures are applied instead, when there are any. It is
+// meant for a database shared by several subtests.
+func ResetDB(uri string, opts ...Option) error {
+	cfg, err := configFrom(opts)
+	if err != nil {
+		return err
+	}
+
+	if err := httpDoResetDBRequest(uri, cfg.fixtures, cfg.getHostURL()); err != nil {
+		return fmt.Errorf("reset database failed: %w", err)
+	}
+	return nil
+}
+
+// MustResetDB resets the database at uri or fails the test.
+func MustResetDB(t *testing.T, uri string, opts ...Option) {
+	if err := ResetDB(uri, opts...); err != nil {
+		t.Fatalf("failed to reset database %s: %v", uri, err)
+	}
+}
+
+func httpDoResetDBRequest(uri, fixtures, baseURL string) error {
+	bodyBuf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(bodyBuf)
+
+	fixtureFiles, err := getFilesList(fixtures, "")
+	if err != nil {
+		return fmt.Errorf("read fixtures failed: %w", err)
+	}
+
+	for _, f := range fixtureFiles {
+		if err := addFileToWriter(bodyWriter, "fixtures", f); err != nil {
+			return err
+		}
+	}
+
+	if err := bodyWriter.WriteField("uri", uri); err != nil {
+		return err
+	}
+
+	contentType := bodyWriter.FormDataContentType()
+	if err := bodyWriter.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/reset", bodyBuf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	rawRes, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rawRes.Body.Close()
+
+	return checkForError(rawRes)
+}
@@ -0,0 +1,141 @@
+package dbctlgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// SnapshotRequest is the request object of the snapshot endpoints
+type SnapshotRequest struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	URI  string `json:"uri,omitempty"`
+}
+
+// CreateSnapshot saves the state of the database at uri as a snapshot called name,
+// to return to it later with RestoreSnapshot or to branch from it with BranchSnapshot.
+// Snapshots outlive the database they were taken of, remove them with RemoveSnapshot.
+func CreateSnapshot(dbType, uri, name string, opts ...Option) error {
+	if dbType != DatabaseRedis && dbType != DatabasePostgres && dbType != DatabaseMongoDB {
+		return ErrInvalidDatabaseType
+	}
+
+	cfg, err := configFrom(opts)
+	if err != nil {
+		return err
+	}
+
+	req := &SnapshotRequest{Type: dbType, Name: name, URI: uri}
+	if err := httpDoSnapshotRequest(http.MethodPost, cfg.getHostURL()+"/snapshots", req, nil); err != nil {
+		return fmt.Errorf("create %s snapshot failed: %w", dbType, err)
+	}
+	return nil
+}
+
+// RestoreSnapshot replaces the content of the database at uri with the snapshot
+// called name.
+func RestoreSnapshot(dbType, uri, name string, opts ...Option) error {
+	if dbType != DatabaseRedis && dbType != DatabasePostgres && dbType != DatabaseMongoDB {
+		return ErrInvalidDatabaseType
+	}
+
+	cfg, err := configFrom(opts)
+	if err != nil {
+		return err
+	}
+
+	req := &SnapshotRequest{Type: dbType, Name: name, URI: uri}
+	if err := httpDoSnapshotRequest(http.MethodPost, cfg.getHostURL()+"/snapshots/restore", req, nil); err != nil {
+		return fmt.Errorf("restore %s snapshot failed: %w", dbType, err)
+	}
+	return nil
+}
+
+// BranchSnapshot creates a new database holding the snapshot called name and
+// returns its connection string. It is up to the caller to remove the database by
+// calling RemoveDB.
+func BranchSnapshot(dbType, name string, opts ...Option) (string, error) {
+	if dbType != DatabaseRedis && dbType != DatabasePostgres && dbType != DatabaseMongoDB {
+		return "", ErrInvalidDatabaseType
+	}
+
+	cfg, err := configFrom(opts)
+	if err != nil {
+		return "", err
+	}
+
+	var res CreateDBResponse
+	req := &SnapshotRequest{Type: dbType, Name: name}
+	if err := httpDoSnapshotRequest(http.MethodPost, cfg.getHostURL()+"/snapshots/branch", req, &res); err != nil {
+		return "", fmt.Errorf("branch %s snapshot failed: %w", dbType, err)
+	}
+	return res.URI, nil
+}
+
+// MustBranchSnapshot branches the snapshot called name into a new database and
+// returns its connection string or fails the test, the database is removed after
+// the test is finished.
+func MustBranchSnapshot(t *testing.T, dbType, name string, opts ...Option) string {
+	uri, err := BranchSnapshot(dbType, name, opts...)
+	if err != nil {
+		t.Fatalf("failed to branch %s snapshot %s: %v", dbType, name, err)
+	}
+
+	t.Cleanup(func() {
+		logQueriesOnFailure(t, dbType, uri, opts)
+		if err := RemoveDB(dbType, uri, opts...); err != nil {
+			t.Errorf("failed to remove %s database: %v", dbType, err)
+		}
+	})
+
+	return uri
+}
+
+// RemoveSnapshot removes the snapshot called name.
+func RemoveSnapshot(dbType, name string, opts ...Option) error {
+	if dbType != DatabaseRedis && dbType != DatabasePostgres && dbType != DatabaseMongoDB {
+		return ErrInvalidDatabaseType
+	}
+
+	cfg, err := configFrom(opts)
+	if err != nil {
+		return err
+	}
+
+	req := &SnapshotRequest{Type: dbType, Name: name}
+	if err := httpDoSnapshotRequest(http.MethodDelete, cfg.getHostURL()+"/snapshots", req, nil); err != nil {
+		return fmt.Errorf("remove %s snapshot failed: %w", dbType, err)
+	}
+	return nil
+}
+
+func httpDoSnapshotRequest(method, endpoint string, r *SnapshotRequest, out interface{}) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rawRes, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rawRes.Body.Close()
+
+	if err := checkForError(rawRes); err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(rawRes.Body).Decode(out)
+}
@@ -0,0 +1,68 @@
+package dbctlgo
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestBranchSnapshot(t *testing.T) {
+	var got SnapshotRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/snapshots/branch" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(CreateDBResponse{URI: "postgres://localhost/dbctl_1"})
+	}))
+	defer srv.Close()
+
+	uri, err := BranchSnapshot(DatabasePostgres, "seeded", withServer(t, srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri != "postgres://localhost/dbctl_1" {
+		t.Fatalf("unexpected uri %q", uri)
+	}
+	if got.Type != DatabasePostgres || got.Name != "seeded" {
+		t.Fatalf("unexpected request %+v", got)
+	}
+}
+
+func TestSnapshotErrorsAreReturned(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(ErrorMessage{Error: `snapshot not found: no postgres snapshot called "seeded"`})
+	}))
+	defer srv.Close()
+
+	err := RestoreSnapshot(DatabasePostgres, "postgres://localhost/dbctl_1", "seeded", withServer(t, srv))
+	if err == nil || err.Error() != `restore postgres snapshot failed: snapshot not found: no postgres snapshot called "seeded"` {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := CreateSnapshot("mysql", "", "seeded"); err != ErrInvalidDatabaseType {
+		t.Fatalf("expected ErrInvalidDatabaseType, got %v", err)
+	}
+}
+
+func withServer(t *testing.T, srv *httptest.Server) Option {
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := strconv.ParseUint(port, 10, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WithHost(host, uint32(p))
+}
@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/mirzakhany/dbctl/internal/apiserver"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
 	"github.com/mirzakhany/dbctl/internal/utils"
 	"github.com/spf13/cobra"
 )
@@ -20,6 +23,10 @@ func GetTestingAPIServerCmd() *cobra.Command {
 
 	c.Flags().StringP("port", "p", apiserver.DefaultPort, "testing server default port")
 	c.Flags().BoolP("testing", "t", false, "run in testing mode with containerized server")
+	c.Flags().Bool("restricted-roles", false, "hand every postgres database out with a role of its own, owning only that database")
+	c.Flags().String("grants", "", "SQL file granting the privileges of the roles postgres databases are handed out with, naming the role :role (implies --restricted-roles)")
+	c.Flags().Int("pool-size", 0, "postgres databases kept ready for each template recently asked for, handed out without cloning while the test waits")
+	c.Flags().StringSlice("pool-target", nil, "databases kept ready for a template, as hash=count, overriding --pool-size for it")
 	return c
 }
 
@@ -39,10 +46,49 @@ func runTestingAPIServer(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("invalid testing args, %w", err)
 	}
 
+	restrictedRoles, err := cmd.Flags().GetBool("restricted-roles")
+	if err != nil {
+		return fmt.Errorf("invalid restricted-roles args, %w", err)
+	}
+
+	grantsPath, err := cmd.Flags().GetString("grants")
+	if err != nil {
+		return fmt.Errorf("invalid grants args, %w", err)
+	}
+
+	roles := apiserver.Roles{Restricted: restrictedRoles}
+	if grantsPath != "" {
+		// read here, the containerized server can not reach the files of the host
+		grants, err := os.ReadFile(grantsPath)
+		if err != nil {
+			return fmt.Errorf("read grants failed: %w", err)
+		}
+		roles = apiserver.Roles{Restricted: true, Grants: string(grants)}
+	}
+
+	poolSize, err := cmd.Flags().GetInt("pool-size")
+	if err != nil {
+		return fmt.Errorf("invalid pool-size args, %w", err)
+	}
+
+	poolTargets, err := cmd.Flags().GetStringSlice("pool-target")
+	if err != nil {
+		return fmt.Errorf("invalid pool-target args, %w", err)
+	}
+
+	targets, err := pg.ParsePoolTargets(strings.Join(poolTargets, ","))
+	if err != nil {
+		return fmt.Errorf("invalid pool-target args, %w", err)
+	}
+	pool := pg.PoolConfig{Size: poolSize}
+	if len(targets) > 0 {
+		pool.Targets = targets
+	}
+
 	if testing {
-		return apiserver.RunAPIServerContainer(utils.ContextWithOsSignal(), port, label, 20*time.Second)
+		return apiserver.RunAPIServerContainer(utils.ContextWithOsSignal(), port, label, roles, pool, 20*time.Second)
 	}
 
-	server := apiserver.NewServer(port, label)
+	server := apiserver.NewServer(port, label, roles, pool)
 	return server.Start(utils.ContextWithOsSignal())
 }
@@ -0,0 +1,121 @@
+package assert
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/database/mongodb"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	rs "github.com/mirzakhany/dbctl/internal/database/redis"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// GetAssertCmd represents the assert command
+func GetAssertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "assert [pg mdb rs] -e <dir>",
+		Short: "Compare the content of a running database with golden files",
+		Long: `Compare the rows, documents or keys of a database of a running instance with
+golden files, in the formats fixtures are loaded in, and show how they differ:
+
+	dbctl assert pg --db dbctl_1700000000 -e ./testdata/expected --ignore created_at
+	dbctl assert mdb --db shop -e ./testdata/expected --ignore orders._id
+	dbctl assert rs --db 3 -e ./testdata/expected
+
+For postgres a golden file is a csv, json or yaml table fixture and the table is
+compared on the columns it lists, every row of it. For mongodb it is a json file of
+the documents of the collection it is named after, compared on their top level
+fields. For redis it is a file of commands building the keys it compares.
+
+Rows are matched by their primary key, or _id, when the golden file lists it. A
+missing row is shown with -, an extra one with + and a changed one with ~. The
+command exits with 1 when the database differs.
+
+--ignore leaves a column out, in every table, or in one as table.column; for redis
+it takes patterns of keys. --update rewrites the golden files with what the
+database holds instead of comparing.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			differs, err := runAssert(cmd, args)
+			if err != nil {
+				return err
+			}
+			if differs {
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().String("db", "", "Database to compare, by name, index or uri, the database of the instance by default")
+	cmd.Flags().StringP("expected", "e", "", "Directory of the golden files")
+	cmd.Flags().StringSlice("ignore", nil, "Columns or fields not compared, as column or table.column, or redis key patterns")
+	cmd.Flags().Bool("update", false, "Rewrite the golden files with the content of the database")
+	_ = cmd.MarkFlagRequired("expected")
+	return cmd
+}
+
+func runAssert(cmd *cobra.Command, args []string) (bool, error) {
+	dbType := "pg"
+	if len(args) == 1 {
+		dbType = strings.ToLower(args[0])
+	}
+
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return false, fmt.Errorf("invalid label args, %w", err)
+	}
+
+	db, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return false, fmt.Errorf("invalid db args, %w", err)
+	}
+
+	expected, err := cmd.Flags().GetString("expected")
+	if err != nil {
+		return false, fmt.Errorf("invalid expected args, %w", err)
+	}
+
+	ignore, err := cmd.Flags().GetStringSlice("ignore")
+	if err != nil {
+		return false, fmt.Errorf("invalid ignore args, %w", err)
+	}
+
+	update, err := cmd.Flags().GetBool("update")
+	if err != nil {
+		return false, fmt.Errorf("invalid update args, %w", err)
+	}
+
+	ctx := utils.ContextWithOsSignal()
+
+	var asserter database.Asserter
+	switch dbType {
+	case "pg", "postgres":
+		asserter, err = pg.Running(ctx, label)
+	case "mdb", "mongo", "mongodb":
+		asserter, err = mongodb.Running(ctx, label)
+	case "rs", "redis":
+		asserter, err = rs.Running(ctx, label)
+	default:
+		return false, errors.New("invalid type args, can be postgres(pg), mongodb(mdb) or redis(rs)")
+	}
+	if err != nil {
+		return false, err
+	}
+
+	tables, err := asserter.AssertDB(ctx, database.AssertRequest{DB: db, Dir: expected, Ignore: ignore, Update: update})
+	if err != nil {
+		return false, err
+	}
+
+	if update {
+		fmt.Printf("golden files in %s updated\n", expected)
+		return false, nil
+	}
+	database.FormatDiff(os.Stdout, expected, tables)
+	return len(tables) > 0, nil
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mirzakhany/dbctl/internal/cache"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	"github.com/spf13/cobra"
+)
+
+// GetCacheCmd represents the cache command
+func GetCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache dbctl keeps between runs",
+		Long: `Postgres instances started with --template-cache keep a dump of every template they
+build from migrations in the cache directory, $` + cache.EnvDir + ` or the dbctl directory of
+your user cache directory, and restore them when a later instance misses them. Export and import move that cache between
+machines, such as from one CI pipeline run to the next.`,
+	}
+
+	cmd.AddCommand(getPathCmd())
+	cmd.AddCommand(getExportCmd())
+	cmd.AddCommand(getImportCmd())
+	return cmd
+}
+
+func getPathCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "Print the cache directory",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			dir, err := cache.Dir()
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(dir)
+			return nil
+		},
+	}
+}
+
+func getExportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "export [file]",
+		Short: "Write the cache to a .tar.gz file, or to stdout when no file or - is given",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runExport,
+	}
+}
+
+func getImportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import [file]",
+		Short: "Read a cache written by export from a file, or from stdin when no file or - is given",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runImport,
+	}
+}
+
+func runExport(_ *cobra.Command, args []string) error {
+	dir, err := cache.Dir()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 || args[0] == "-" {
+		return cache.Export(os.Stdout, dir)
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := cache.Export(f, dir); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runImport(_ *cobra.Command, args []string) error {
+	dir, err := cache.Dir()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		r = f
+	}
+
+	n, err := cache.Import(r, dir)
+	if err != nil {
+		return err
+	}
+
+	templates, err := cache.TemplatesDir()
+	if err != nil {
+		return err
+	}
+	if err := pg.OwnTemplateCache(templates); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d files into %s\n", n, dir)
+	return nil
+}
@@ -1,15 +1,40 @@
 package describe
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+
+	"github.com/mirzakhany/dbctl/internal/schemadoc"
+	"github.com/spf13/cobra"
+)
 
 // GetDescribeCmd represents the describe command
 func GetDescribeCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "describe",
 		Short: "Describe a database instance",
-		Long:  `Describe a database instance in detail, including its tables, indexes, and foreign keys.`,
+		Long: `Describe a database instance in detail: the tables, indexes, foreign keys and
+comments of postgres, the collections, indexes and validators of mongodb, and the
+keys of redis counted by type and pattern.
+
+Descriptions are written as text, json or markdown, postgres ones as mermaid or dot
+diagrams as well, to generate the documentation of a schema in CI.`,
 	}
 
 	cmd.AddCommand(GetDescribePgCmd())
+	cmd.AddCommand(GetDescribeMongoCmd())
+	cmd.AddCommand(GetDescribeRedisCmd())
 	return cmd
 }
+
+// getFormat reads the format flag, checked before connecting to anything.
+func getFormat(cmd *cobra.Command) (string, error) {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return "", fmt.Errorf("invalid format args, %w", err)
+	}
+
+	if err := schemadoc.CheckFormat(format); err != nil {
+		return "", fmt.Errorf("invalid format args, %w", err)
+	}
+	return format, nil
+}
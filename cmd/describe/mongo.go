@@ -0,0 +1,56 @@
+package describe
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mirzakhany/dbctl/internal/database/mongodb"
+	"github.com/mirzakhany/dbctl/internal/schemadoc"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// GetDescribeMongoCmd represents the describe mongodb command
+func GetDescribeMongoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Aliases: []string{"mdb", "mongo"},
+		Use:     "mongodb",
+		Short:   "Describe a mongodb database instance",
+		Long: `Describe the collections of a database of the running mongodb instance: their
+type, estimated number of documents, indexes and validator, and the pipeline of views.`,
+		RunE: describeMongo,
+	}
+
+	cmd.Flags().String("db", "", "Database to describe, by name or uri, the database of the instance by default")
+	cmd.Flags().String("format", schemadoc.FormatText, "Output format, text, json or markdown")
+	return cmd
+}
+
+func describeMongo(cmd *cobra.Command, _ []string) error {
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return fmt.Errorf("invalid label args, %w", err)
+	}
+
+	db, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return fmt.Errorf("invalid db args, %w", err)
+	}
+
+	format, err := getFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	ctx := utils.ContextWithOsSignal()
+	instance, err := mongodb.Running(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	s, err := instance.Schema(ctx, db)
+	if err != nil {
+		return err
+	}
+	return schemadoc.MongoDB(os.Stdout, s, format)
+}
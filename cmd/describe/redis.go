@@ -0,0 +1,57 @@
+package describe
+
+import (
+	"fmt"
+	"os"
+
+	rs "github.com/mirzakhany/dbctl/internal/database/redis"
+	"github.com/mirzakhany/dbctl/internal/schemadoc"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// GetDescribeRedisCmd represents the describe redis command
+func GetDescribeRedisCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Aliases: []string{"rs"},
+		Use:     "redis",
+		Short:   "Describe a redis database instance",
+		Long: `Describe the keys of a database of the running redis instance, counted by type
+and by pattern: the parts of keys that look like ids, numbers, uuids and long hex
+strings, are replaced with a *, user:1 and user:2 are both counted as user:*.`,
+		RunE: describeRedis,
+	}
+
+	cmd.Flags().String("db", "", "Database to describe, by index or uri, the database of the instance by default")
+	cmd.Flags().String("format", schemadoc.FormatText, "Output format, text, json or markdown")
+	return cmd
+}
+
+func describeRedis(cmd *cobra.Command, _ []string) error {
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return fmt.Errorf("invalid label args, %w", err)
+	}
+
+	db, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return fmt.Errorf("invalid db args, %w", err)
+	}
+
+	format, err := getFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	ctx := utils.ContextWithOsSignal()
+	instance, err := rs.Running(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	ks, err := instance.KeySpace(ctx, db)
+	if err != nil {
+		return err
+	}
+	return schemadoc.Redis(os.Stdout, ks, format)
+}
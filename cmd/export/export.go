@@ -0,0 +1,156 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database/mongodb"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	rs "github.com/mirzakhany/dbctl/internal/database/redis"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// GetExportCmd represents the export command
+func GetExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [pg mdb rs] -o <dir>",
+		Short: "Export the data of a running database as fixtures",
+		Long: `Export the rows, documents or keys of a database of a running instance as
+fixtures, to load into the databases created for tests:
+
+	dbctl export pg --tables users,orders --where "created_at > now() - interval '7 days'" -o ./fixtures
+	dbctl export mdb --db shop --where 'orders: {"status": "paid"}' -o ./fixtures
+	dbctl export rs --tables 'session:*' -o ./fixtures
+
+For postgres a file is written per table, numbered in the order their foreign keys
+load them in: INSERT statements, or csv table fixtures with --format csv. Every table
+is exported when none is given, but the ones migration tools track migrations in.
+For mongodb a json file is written per collection, as extended json, and for redis
+a file of commands building the keys, with --tables as patterns of keys.
+
+A --where condition is scoped to one table or collection with its name, such as
+'users: id < 100', and is applied to every one of them otherwise. Conditions are SQL
+for postgres and extended json filters for mongodb.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runExport,
+	}
+
+	cmd.Flags().String("db", "", "Database to export, by name, index or uri, the database of the instance by default")
+	cmd.Flags().StringSlice("tables", nil, "Tables, collections or redis key patterns to export, all by default")
+	cmd.Flags().StringArray("where", nil, "Condition on the rows or documents to export, 'table: condition' for one table")
+	cmd.Flags().String("format", pg.ExportSQL, "Format of postgres fixtures, sql or csv")
+	cmd.Flags().StringP("output", "o", "", "Directory to write the fixtures to")
+	_ = cmd.MarkFlagRequired("output")
+	return cmd
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	dbType := "pg"
+	if len(args) == 1 {
+		dbType = strings.ToLower(args[0])
+	}
+
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return fmt.Errorf("invalid label args, %w", err)
+	}
+
+	db, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return fmt.Errorf("invalid db args, %w", err)
+	}
+
+	tables, err := cmd.Flags().GetStringSlice("tables")
+	if err != nil {
+		return fmt.Errorf("invalid tables args, %w", err)
+	}
+
+	where, err := cmd.Flags().GetStringArray("where")
+	if err != nil {
+		return fmt.Errorf("invalid where args, %w", err)
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("invalid format args, %w", err)
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("invalid output args, %w", err)
+	}
+
+	if cmd.Flags().Changed("format") && dbType != "pg" && dbType != "postgres" {
+		return errors.New("invalid format args, only postgres fixtures have a format")
+	}
+
+	ctx := utils.ContextWithOsSignal()
+
+	switch dbType {
+	case "pg", "postgres":
+		instance, err := pg.Running(ctx, label)
+		if err != nil {
+			return err
+		}
+
+		exported, err := instance.Export(ctx, pg.ExportRequest{DB: db, Tables: tables, Where: where, Format: format, Dir: output})
+		if err != nil {
+			return err
+		}
+		for _, t := range exported {
+			if t.File == "" {
+				fmt.Printf("%s: no rows\n", t.Table)
+				continue
+			}
+			fmt.Printf("%s: %d rows to %s\n", t.Table, t.Rows, t.File)
+		}
+	case "mdb", "mongo", "mongodb":
+		instance, err := mongodb.Running(ctx, label)
+		if err != nil {
+			return err
+		}
+
+		exported, err := instance.Export(ctx, mongodb.ExportRequest{DB: db, Collections: tables, Where: where, Dir: output})
+		if err != nil {
+			return err
+		}
+		for _, c := range exported {
+			if c.File == "" {
+				fmt.Printf("%s: no documents\n", c.Collection)
+				continue
+			}
+			fmt.Printf("%s: %d documents to %s\n", c.Collection, c.Documents, c.File)
+		}
+	case "rs", "redis":
+		if len(where) > 0 {
+			return errors.New("invalid where args, redis keys are picked by pattern with --tables")
+		}
+
+		instance, err := rs.Running(ctx, label)
+		if err != nil {
+			return err
+		}
+
+		exported, err := instance.Export(ctx, rs.ExportRequest{DB: db, Patterns: tables, Dir: output})
+		if err != nil {
+			return err
+		}
+		if exported.File == "" {
+			fmt.Printf("database %d: no keys\n", exported.Database)
+			return nil
+		}
+
+		types := make([]string, 0, len(exported.Types))
+		for typ, n := range exported.Types {
+			types = append(types, fmt.Sprintf("%d %s", n, typ))
+		}
+		sort.Strings(types)
+		fmt.Printf("database %d: %d keys (%s) to %s\n", exported.Database, exported.Keys, strings.Join(types, ", "), exported.File)
+	default:
+		return errors.New("invalid type args, can be postgres(pg), mongodb(mdb) or redis(rs)")
+	}
+	return nil
+}
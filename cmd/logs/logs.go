@@ -0,0 +1,103 @@
+package logs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/container"
+	"github.com/mirzakhany/dbctl/internal/database"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// GetLogsCmd represents the logs command
+func GetLogsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs [pg mdb rs]",
+		Short: "Show the logs of a running database",
+		Long: `Show the output of a running database, or with --queries the statements a
+postgres instance started with --log-queries ran:
+
+	dbctl logs pg -f
+	dbctl logs pg --queries --db dbctl_1697040000000000000 -f
+
+--db keeps the statements of one database, by name or uri, such as the database a
+failing test was given.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runLogs,
+	}
+
+	cmd.Flags().BoolP("follow", "f", false, "Keep showing the logs as they are written")
+	cmd.Flags().Bool("queries", false, "Show the statements postgres ran, it has to be started with --log-queries")
+	cmd.Flags().String("db", "", "Database to show the statements of, by name or uri, every database by default")
+	return cmd
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	dbType := "pg"
+	if len(args) == 1 {
+		dbType = strings.ToLower(args[0])
+	}
+
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return fmt.Errorf("invalid label args, %w", err)
+	}
+
+	follow, err := cmd.Flags().GetBool("follow")
+	if err != nil {
+		return fmt.Errorf("invalid follow args, %w", err)
+	}
+
+	queries, err := cmd.Flags().GetBool("queries")
+	if err != nil {
+		return fmt.Errorf("invalid queries args, %w", err)
+	}
+
+	db, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return fmt.Errorf("invalid db args, %w", err)
+	}
+
+	var typ string
+	switch dbType {
+	case "pg", "postgres":
+		typ = database.TypePostgres
+	case "mdb", "mongo", "mongodb":
+		typ = database.TypeMongoDB
+	case "rs", "redis":
+		typ = database.TypeRedis
+	default:
+		return errors.New("invalid type args, can be postgres(pg), mongodb(mdb) or redis(rs)")
+	}
+
+	if queries && typ != database.TypePostgres {
+		return errors.New("invalid queries args, only postgres logs its queries")
+	}
+	if db != "" && !queries {
+		return errors.New("invalid db args, the statements of a database are shown with --queries")
+	}
+
+	ctx := utils.ContextWithOsSignal()
+
+	if !queries {
+		instance, err := database.FindInstance(ctx, typ, label)
+		if err != nil {
+			return err
+		}
+		return container.Logs(ctx, instance.ID, follow, os.Stdout, os.Stderr)
+	}
+
+	instance, err := pg.Running(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	return instance.QueryLog(ctx, db, follow, func(e pg.QueryLogEntry) error {
+		_, err := fmt.Println(e.Text)
+		return err
+	})
+}
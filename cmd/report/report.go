@@ -0,0 +1,159 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	"github.com/mirzakhany/dbctl/internal/table"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// queryWidth is the most of a statement shown in a table.
+const queryWidth = 80
+
+// GetReportCmd represents the report command
+func GetReportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Report on what the test databases of a running instance did",
+	}
+
+	cmd.AddCommand(getQueriesCmd())
+	return cmd
+}
+
+func getQueriesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queries",
+		Short: "Show the slowest and most frequent statements of every test database",
+		Long: `Show the statements of every database the api server handed out that took the
+longest in total and that ran most often, to catch N+1 queries and missing indexes
+after a test run. Statements differing only by their constants are taken as one.
+Postgres has to be started with --query-stats:
+
+	dbctl start pg --query-stats --label ci -d
+	go test ./...
+	dbctl report queries --label ci --top 10 --format json
+
+The statistics of a test database outlive it, they are reported once it is removed
+too. --reset forgets them after the report, to report on the next run alone.`,
+		Args: cobra.NoArgs,
+		RunE: runQueries,
+	}
+
+	cmd.Flags().String("db", "", "Test database to report on, by name or uri, every one by default")
+	cmd.Flags().Int("top", 5, "Number of statements shown per database and list")
+	cmd.Flags().String("format", "table", "Format of the report, table or json")
+	cmd.Flags().Bool("reset", false, "Forget the statistics once reported")
+	return cmd
+}
+
+func runQueries(cmd *cobra.Command, _ []string) error {
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return fmt.Errorf("invalid label args, %w", err)
+	}
+
+	db, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return fmt.Errorf("invalid db args, %w", err)
+	}
+
+	top, err := cmd.Flags().GetInt("top")
+	if err != nil {
+		return fmt.Errorf("invalid top args, %w", err)
+	}
+	if top < 1 {
+		return errors.New("invalid top args, it has to be at least 1")
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("invalid format args, %w", err)
+	}
+	if format != "table" && format != "json" {
+		return fmt.Errorf("invalid format args, %q is not one of table or json", format)
+	}
+
+	reset, err := cmd.Flags().GetBool("reset")
+	if err != nil {
+		return fmt.Errorf("invalid reset args, %w", err)
+	}
+
+	ctx := utils.ContextWithOsSignal()
+	instance, err := pg.Running(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	report, err := instance.QueryReport(ctx, db, top)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		if report == nil {
+			report = []pg.DatabaseQueries{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printReport(report)
+	}
+
+	if reset {
+		return instance.ResetQueryStats(ctx)
+	}
+	return nil
+}
+
+func printReport(report []pg.DatabaseQueries) {
+	if len(report) == 0 {
+		fmt.Println("No statements of test databases found")
+		return
+	}
+
+	for i, db := range report {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s, created %s\n", db.Database, db.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+
+		fmt.Println("Slowest:")
+		printStats(db.Slowest)
+		fmt.Println("Most frequent:")
+		printStats(db.Frequent)
+	}
+}
+
+func printStats(stats []pg.QueryStat) {
+	t := table.New(os.Stdout)
+	t.AddRow("Calls", "Total", "Mean", "Rows", "Query")
+	for _, s := range stats {
+		t.AddRow(strconv.FormatInt(s.Calls, 10), formatMS(s.TotalMS), formatMS(s.MeanMS),
+			strconv.FormatInt(s.Rows, 10), shortQuery(s.Query))
+	}
+	t.Print()
+}
+
+func formatMS(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 2, 64) + "ms"
+}
+
+// shortQuery puts a statement on one line, cut to queryWidth.
+func shortQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if r := []rune(query); len(r) > queryWidth {
+		return string(r[:queryWidth-3]) + "..."
+	}
+	return query
+}
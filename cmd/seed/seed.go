@@ -0,0 +1,134 @@
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
+	"github.com/mirzakhany/dbctl/internal/table"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// GetSeedCmd represents the seed command
+func GetSeedCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "seed {pg}",
+		Short: "Generate rows in the tables of a running database",
+		Long: `Generate rows in the tables of the running instance, following its migrated
+schema: the type, NOT NULL, CHECK and UNIQUE constraints, enums and foreign keys of
+every column. Tables are filled after the ones they refer to, and rows refer to the
+rows already there or just generated.
+
+	dbctl seed pg --rows users=1000,orders=50000
+
+Columns with a default are left to it. An overrides file shapes the values of some
+columns, by table and column:
+
+	users:
+	  email:
+	    regex: '[a-z]{6,10}@acme\.test'
+	  role:
+	    values: [admin, member, guest]
+	  deleted_at:
+	    null: 0.9
+	orders:
+	  total:
+	    min: 5
+	    max: 500`,
+		Args: cobra.ExactArgs(1),
+		RunE: runSeed,
+	}
+
+	cmd.Flags().String("rows", "", "Number of rows to generate by table, such as users=1000,orders=50000")
+	cmd.Flags().StringP("overrides", "o", "", "Path to a yaml or json file shaping the values of columns, by table and column")
+	cmd.Flags().String("db", "", "Database to seed, by name or uri, the database of the instance by default")
+	cmd.Flags().Int64("seed", fixtures.DefaultSeed, "Seed of the random data, the same seed generates the same rows")
+	return cmd
+}
+
+func runSeed(cmd *cobra.Command, args []string) error {
+	if !utils.OneOf(strings.ToLower(args[0]), "pg", "postgres") {
+		return errors.New("invalid type args, only postgres(pg) can be seeded")
+	}
+
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return fmt.Errorf("invalid label args, %w", err)
+	}
+
+	rowsArg, err := cmd.Flags().GetString("rows")
+	if err != nil {
+		return fmt.Errorf("invalid rows args, %w", err)
+	}
+
+	rows, err := parseRows(rowsArg)
+	if err != nil {
+		return fmt.Errorf("invalid rows args, %w", err)
+	}
+
+	overridesPath, err := cmd.Flags().GetString("overrides")
+	if err != nil {
+		return fmt.Errorf("invalid overrides args, %w", err)
+	}
+
+	overrides, err := pg.ReadSeedOverrides(overridesPath)
+	if err != nil {
+		return err
+	}
+
+	db, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return fmt.Errorf("invalid db args, %w", err)
+	}
+
+	seed, err := cmd.Flags().GetInt64("seed")
+	if err != nil {
+		return fmt.Errorf("invalid seed args, %w", err)
+	}
+
+	ctx := utils.ContextWithOsSignal()
+	instance, err := pg.Running(ctx, label)
+	if err != nil {
+		return err
+	}
+
+	seeded, err := instance.Seed(ctx, &pg.SeedRequest{DB: db, Rows: rows, Overrides: overrides, Seed: seed})
+	if err != nil {
+		return err
+	}
+
+	t := table.New(os.Stdout)
+	t.AddRow("Table", "Rows")
+	for _, s := range seeded {
+		t.AddRow(s.Table, strconv.Itoa(s.Rows))
+	}
+	t.Print()
+	return nil
+}
+
+// parseRows parses the number of rows by table, such as users=1000,orders=50000.
+func parseRows(arg string) (map[string]int, error) {
+	if strings.TrimSpace(arg) == "" {
+		return nil, errors.New("name a table and its number of rows, such as --rows users=1000")
+	}
+
+	out := make(map[string]int)
+	for _, part := range strings.Split(arg, ",") {
+		name, count, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%q is not table=rows", part)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%q is not a number of rows", count)
+		}
+		out[strings.TrimSpace(name)] = n
+	}
+	return out, nil
+}
@@ -0,0 +1,346 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/database/mongodb"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	rs "github.com/mirzakhany/dbctl/internal/database/redis"
+	"github.com/mirzakhany/dbctl/internal/table"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// GetSnapshotCmd represents the snapshot command
+func GetSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Aliases: []string{"snap"},
+		Use:     "snapshot",
+		Short:   "Save the state of a database and return to it later",
+		Long: `Snapshots are named copies of a database kept on the running instance. Take one
+of the state a test left behind, restore it to go back to that state, or branch it
+into a database of its own to poke at without touching the snapshot.
+
+Postgres snapshots are databases cloned from the source, mongodb and redis ones are
+copied on the server into a database of their own.`,
+	}
+
+	cmd.AddCommand(getCreateCmd())
+	cmd.AddCommand(getRestoreCmd())
+	cmd.AddCommand(getBranchCmd())
+	cmd.AddCommand(getListCmd())
+	cmd.AddCommand(getRemoveCmd())
+	return cmd
+}
+
+func getCreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create {pg rs mdb} <name>",
+		Short: "Take a snapshot of a database",
+		Long: `Take a snapshot of a database of the running instance, the database of the
+instance itself unless --db names another one: a database name or uri for postgres
+and mongodb, a database index or uri for redis.`,
+		Args: cobra.ExactArgs(2),
+		RunE: runCreate,
+	}
+
+	cmd.Flags().String("db", "", "Database to snapshot, by name, index or uri")
+	return cmd
+}
+
+func getRestoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore [pg rs mdb] <name>",
+		Short: "Replace a database with a snapshot",
+		Long: `Replace a database with a copy of a snapshot, the database the snapshot was
+taken of unless --db names another one. The snapshot is kept and can be restored
+again. Without a type, the running instances are searched for the snapshot.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: runRestore,
+	}
+
+	cmd.Flags().String("db", "", "Database to restore into, by name, index or uri")
+	return cmd
+}
+
+func getBranchCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "branch [pg rs mdb] <name>",
+		Short: "Create a new database holding a snapshot and print its uri",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  runBranch,
+	}
+}
+
+func getListCmd() *cobra.Command {
+	return &cobra.Command{
+		Aliases: []string{"list"},
+		Use:     "ls [pg rs mdb]",
+		Short:   "List the snapshots of the running instances",
+		Args:    cobra.MaximumNArgs(1),
+		RunE:    runList,
+	}
+}
+
+func getRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Aliases: []string{"remove"},
+		Use:     "rm [pg rs mdb] <name>",
+		Short:   "Remove a snapshot",
+		Args:    cobra.RangeArgs(1, 2),
+		RunE:    runRemove,
+	}
+}
+
+func runCreate(cmd *cobra.Command, args []string) error {
+	dbType, err := parseType(args[0])
+	if err != nil {
+		return err
+	}
+
+	db, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return fmt.Errorf("invalid db args, %w", err)
+	}
+
+	ctx := utils.ContextWithOsSignal()
+	snapshotter, err := running(ctx, cmd, dbType)
+	if err != nil {
+		return err
+	}
+
+	s, err := snapshotter.CreateSnapshot(ctx, args[1], db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshot %s of %s %s created\n", s.Name, s.Type, s.Source)
+	return nil
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	db, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return fmt.Errorf("invalid db args, %w", err)
+	}
+
+	ctx := utils.ContextWithOsSignal()
+	snapshotter, s, err := find(ctx, cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if err := snapshotter.RestoreSnapshot(ctx, s.Name, db); err != nil {
+		return err
+	}
+
+	target := s.Source
+	if db != "" {
+		target = db
+	}
+	fmt.Printf("Restored snapshot %s into %s %s\n", s.Name, s.Type, target)
+	return nil
+}
+
+func runBranch(cmd *cobra.Command, args []string) error {
+	ctx := utils.ContextWithOsSignal()
+	snapshotter, s, err := find(ctx, cmd, args)
+	if err != nil {
+		return err
+	}
+
+	res, err := snapshotter.BranchSnapshot(ctx, s.Name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(res.URI)
+	return nil
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	ctx := utils.ContextWithOsSignal()
+
+	var types []string
+	if len(args) == 1 {
+		dbType, err := parseType(args[0])
+		if err != nil {
+			return err
+		}
+		types = []string{dbType}
+	}
+
+	snapshots, err := list(ctx, cmd, types)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Println("No snapshots found")
+		return nil
+	}
+
+	t := table.New(os.Stdout)
+	t.AddRow("Name", "Type", "Source", "Created")
+	for _, s := range snapshots {
+		created := "-"
+		if !s.CreatedAt.IsZero() {
+			created = s.CreatedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		t.AddRow(s.Name, s.Type, orDash(s.Source), created)
+	}
+	t.Print()
+	return nil
+}
+
+func runRemove(cmd *cobra.Command, args []string) error {
+	ctx := utils.ContextWithOsSignal()
+	snapshotter, s, err := find(ctx, cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if err := snapshotter.RemoveSnapshot(ctx, s.Name); err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed snapshot %s\n", s.Name)
+	return nil
+}
+
+// find returns the snapshot named by the last of args and the instance keeping it.
+// Without a type in args every running instance is searched, a name found on more
+// than one of them has to be told apart by its type.
+func find(ctx context.Context, cmd *cobra.Command, args []string) (database.Snapshotter, *database.Snapshot, error) {
+	name := args[len(args)-1]
+
+	var types []string
+	if len(args) == 2 {
+		dbType, err := parseType(args[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		types = []string{dbType}
+	}
+
+	snapshots, err := list(ctx, cmd, types)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var found []database.Snapshot
+	for _, s := range snapshots {
+		if s.Name == name {
+			found = append(found, s)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, nil, fmt.Errorf("%w: no snapshot called %q, see 'dbctl snapshot ls'", database.ErrSnapshotNotFound, name)
+	case 1:
+		snapshotter, err := running(ctx, cmd, found[0].Type)
+		if err != nil {
+			return nil, nil, err
+		}
+		return snapshotter, &found[0], nil
+	default:
+		return nil, nil, fmt.Errorf("more than one snapshot is called %q, name its type as well, such as 'dbctl snapshot %s pg %s'",
+			name, cmd.Name(), name)
+	}
+}
+
+// list returns the snapshots of the running instances of types, of every running
+// instance when types is empty.
+func list(ctx context.Context, cmd *cobra.Command, types []string) ([]database.Snapshot, error) {
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return nil, fmt.Errorf("invalid label args, %w", err)
+	}
+
+	if len(types) == 0 {
+		instances, err := database.FindInstances(ctx, label)
+		if err != nil {
+			return nil, err
+		}
+		if len(instances) == 0 {
+			return nil, fmt.Errorf("%w, start one with 'dbctl start'", database.ErrNoInstance)
+		}
+
+		for dbType := range instances {
+			types = append(types, dbType)
+		}
+		sort.Strings(types)
+	}
+
+	var out []database.Snapshot
+	for _, dbType := range types {
+		snapshotter, err := running(ctx, cmd, dbType)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshots, err := snapshotter.Snapshots(ctx)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, snapshots...)
+	}
+	return out, nil
+}
+
+func running(ctx context.Context, cmd *cobra.Command, dbType string) (database.Snapshotter, error) {
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return nil, fmt.Errorf("invalid label args, %w", err)
+	}
+
+	// a failed lookup must not turn into a non nil interface holding a nil controller
+	switch dbType {
+	case database.TypePostgres:
+		db, err := pg.Running(ctx, label)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case database.TypeRedis:
+		db, err := rs.Running(ctx, label)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	default:
+		db, err := mongodb.Running(ctx, label)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+}
+
+// parseType turns the database types the commands accept, the same ones as start
+// and stop, into the type names of the database package.
+func parseType(arg string) (string, error) {
+	switch strings.ToLower(arg) {
+	case "pg", "postgres":
+		return database.TypePostgres, nil
+	case "rs", "redis":
+		return database.TypeRedis, nil
+	case "mdb", "mongo", "mongodb":
+		return database.TypeMongoDB, nil
+	}
+	return "", errors.New("invalid type args, can be postgres(pg), redis(rs) or mongodb(mdb)")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,133 @@
+package squash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database/mongodb"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// GetSquashCmd represents the squash command
+func GetSquashCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "squash [pg mdb] -m <migrations> -o <baseline>",
+		Short: "Squash migrations into a single baseline",
+		Long: `Squash a directory of migrations into a single baseline that builds the same
+schema, to replace the migrations it was built from:
+
+	dbctl squash -m ./migrations -o ./baseline.sql
+
+For postgres the migrations are applied to a throwaway database, whose schema is
+dumped with pg_dump --schema-only along with the rows of the tables migration tools
+track applied migrations in, such as schema_migrations. For mongodb the baseline is
+a script creating the collections, views, indexes and validators of the migrated
+database; documents the migrations insert are left out.
+
+The baseline is then applied to another database and compared with the full replay
+of the migrations, and only written when both match.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runSquash,
+	}
+
+	cmd.Flags().StringP("migrations", "m", "", "Path to the migrations to squash")
+	cmd.Flags().StringP("output", "o", "", "Path to write the baseline to, stdout by default")
+	cmd.Flags().StringSlice("tracking-table", nil, "Tables migrations are tracked in whose rows the postgres baseline keeps, next to the ones of common migration tools")
+	cmd.Flags().StringP("version", "v", "", "Database version of the throwaway instance, when none is running")
+	_ = cmd.MarkFlagRequired("migrations")
+	return cmd
+}
+
+func runSquash(cmd *cobra.Command, args []string) error {
+	dbType := "pg"
+	if len(args) == 1 {
+		dbType = strings.ToLower(args[0])
+	}
+
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return fmt.Errorf("invalid label args, %w", err)
+	}
+
+	migrations, err := cmd.Flags().GetString("migrations")
+	if err != nil {
+		return fmt.Errorf("invalid migrations args, %w", err)
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("invalid output args, %w", err)
+	}
+
+	tracking, err := cmd.Flags().GetStringSlice("tracking-table")
+	if err != nil {
+		return fmt.Errorf("invalid tracking-table args, %w", err)
+	}
+
+	version, err := cmd.Flags().GetString("version")
+	if err != nil {
+		return fmt.Errorf("invalid version args, %w", err)
+	}
+
+	ctx := utils.ContextWithOsSignal()
+
+	// the logs of a throwaway instance go to stderr, out of the way of a baseline
+	// written to stdout
+	var baseline []byte
+	var summary string
+	switch dbType {
+	case "pg", "postgres":
+		instance, stop, err := pg.RunningOrThrowaway(ctx, label, version, os.Stderr)
+		if err != nil {
+			return err
+		}
+		defer stop()
+
+		b, err := instance.Squash(ctx, migrations, tracking)
+		if err != nil {
+			return err
+		}
+		baseline = b.SQL
+		summary = fmt.Sprintf("Squashed %d migrations", len(b.Files))
+		if len(b.Tracking) > 0 {
+			summary += fmt.Sprintf(", with the rows of %s", strings.Join(b.Tracking, ", "))
+		}
+	case "mdb", "mongo", "mongodb":
+		if len(tracking) > 0 {
+			return errors.New("invalid tracking-table args, mongodb migrations are not tracked in tables")
+		}
+
+		instance, stop, err := mongodb.RunningOrThrowaway(ctx, label, version, os.Stderr)
+		if err != nil {
+			return err
+		}
+		defer stop()
+
+		b, err := instance.Squash(ctx, migrations)
+		if err != nil {
+			return err
+		}
+		baseline = b.Script
+		summary = fmt.Sprintf("Squashed %d migrations", len(b.Files))
+	default:
+		return errors.New("invalid type args, can be postgres(pg) or mongodb(mdb)")
+	}
+
+	if output == "" || output == "-" {
+		if _, err := os.Stdout.Write(baseline); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, summary+", the baseline builds what they do")
+		return nil
+	}
+
+	if err := os.WriteFile(output, baseline, 0o644); err != nil {
+		return fmt.Errorf("write baseline failed: %w", err)
+	}
+	fmt.Printf("%s into %s, it builds what they do\n", summary, output)
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/mirzakhany/dbctl/internal/database/mongodb"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
 	"github.com/mirzakhany/dbctl/internal/utils"
 	"github.com/spf13/cobra"
 )
@@ -25,6 +26,8 @@ func GetMongoDBCmd() *cobra.Command {
 	cmd.Flags().StringP("version", "v", "", "Database version, default 7.0")
 	cmd.Flags().StringP("migrations", "m", "", "Path to migration files, will be applied if provided")
 	cmd.Flags().StringP("fixtures", "f", "", "Path to fixture files, it can be a file or directory. Files in directory will be sorted by name before applying.")
+	cmd.Flags().Int64("seed", fixtures.DefaultSeed, "Seed of the random data of the fixtures written as go templates (.tmpl), the same seed renders the same data")
+	cmd.Flags().String("from-dump", "", "Path to the output of mongodump to restore before migrations and fixtures: a directory or an archive, gzipped or not")
 
 	return cmd
 }
@@ -80,14 +83,37 @@ func runMongoDB(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("invalid fixtures args, %w", err)
 	}
 
+	seed, err := cmd.Flags().GetInt64("seed")
+	if err != nil {
+		return fmt.Errorf("invalid seed args, %w", err)
+	}
+
+	dumpPath, err := cmd.Flags().GetString("from-dump")
+	if err != nil {
+		return fmt.Errorf("invalid from-dump args, %w", err)
+	}
+
+	withTLS, err := cmd.Flags().GetBool("tls")
+	if err != nil {
+		return fmt.Errorf("invalid tls args, %w", err)
+	}
+
+	tlsClientCert, err := cmd.Flags().GetBool("tls-client-cert")
+	if err != nil {
+		return fmt.Errorf("invalid tls-client-cert args, %w", err)
+	}
+
 	db, err := mongodb.New(
 		mongodb.WithHost(user, pass, name, port),
 		mongodb.WithVersion(mongoVersion),
 		mongodb.WithLogger(io.Discard),
 		mongodb.WithMigrations(migrationsPath),
 		mongodb.WithFixtures(fixturesPath),
+		mongodb.WithSeed(seed),
+		mongodb.WithDump(dumpPath),
 		mongodb.WithUI(withUI),
 		mongodb.WithLabel(label),
+		mongodb.WithTLS(withTLS, tlsClientCert),
 	)
 	if err != nil {
 		return err
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/mirzakhany/dbctl/internal/cache"
 	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
 	"github.com/mirzakhany/dbctl/internal/utils"
 	"github.com/spf13/cobra"
 )
@@ -25,6 +27,13 @@ func GetPgCmd() *cobra.Command {
 	cmd.Flags().StringP("version", "v", "", fmt.Sprintf("Database version, default %s", pg.DefaultVersion))
 	cmd.Flags().StringP("migrations", "m", "", "Path to migration files, will be applied if provided")
 	cmd.Flags().StringP("fixtures", "f", "", "Path to fixture files, its can be a file or directory.files in directory will be sorted by name before applying.")
+	cmd.Flags().Int64("seed", fixtures.DefaultSeed, "Seed of the random data of the fixtures written as go templates (.tmpl), the same seed renders the same data")
+	cmd.Flags().String("from-dump", "", "Path to a dump to restore before migrations and fixtures: a pg_dump custom, directory or tar dump, or plain SQL, gzipped or not")
+	cmd.Flags().Bool("template-cache", false, "Keep the templates built from migrations in the cache directory, to restore them rather than build them again after a restart")
+	cmd.Flags().Int("replicas", 0, "Number of streaming replicas to start next to the primary, read only")
+	cmd.Flags().Duration("replica-delay", 0, "Delay the replicas apply the changes of the primary with, to simulate replication lag: 500ms, 2s")
+	cmd.Flags().Bool("log-queries", false, "Log every statement along with its database, to read back with 'dbctl logs pg --queries'")
+	cmd.Flags().Bool("query-stats", false, "Preload pg_stat_statements, to report the slowest and most frequent statements of the test databases with 'dbctl report queries'")
 
 	return cmd
 }
@@ -80,14 +89,74 @@ func runPostgres(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("invalid fixtures args, %w", err)
 	}
 
+	seed, err := cmd.Flags().GetInt64("seed")
+	if err != nil {
+		return fmt.Errorf("invalid seed args, %w", err)
+	}
+
+	dumpPath, err := cmd.Flags().GetString("from-dump")
+	if err != nil {
+		return fmt.Errorf("invalid from-dump args, %w", err)
+	}
+
+	withTemplateCache, err := cmd.Flags().GetBool("template-cache")
+	if err != nil {
+		return fmt.Errorf("invalid template-cache args, %w", err)
+	}
+
+	replicas, err := cmd.Flags().GetInt("replicas")
+	if err != nil {
+		return fmt.Errorf("invalid replicas args, %w", err)
+	}
+
+	replicaDelay, err := cmd.Flags().GetDuration("replica-delay")
+	if err != nil {
+		return fmt.Errorf("invalid replica-delay args, %w", err)
+	}
+
+	logQueries, err := cmd.Flags().GetBool("log-queries")
+	if err != nil {
+		return fmt.Errorf("invalid log-queries args, %w", err)
+	}
+
+	queryStats, err := cmd.Flags().GetBool("query-stats")
+	if err != nil {
+		return fmt.Errorf("invalid query-stats args, %w", err)
+	}
+
+	withTLS, err := cmd.Flags().GetBool("tls")
+	if err != nil {
+		return fmt.Errorf("invalid tls args, %w", err)
+	}
+
+	tlsClientCert, err := cmd.Flags().GetBool("tls-client-cert")
+	if err != nil {
+		return fmt.Errorf("invalid tls-client-cert args, %w", err)
+	}
+
+	var templateCache string
+	if withTemplateCache {
+		templateCache, err = cache.TemplatesDir()
+		if err != nil {
+			return err
+		}
+	}
+
 	db, err := pg.New(
 		pg.WithHost(user, pass, name, port),
 		pg.WithVersion(pgVersion),
 		pg.WithLogger(io.Discard),
 		pg.WithMigrations(migrationsPath),
 		pg.WithFixtures(fixturesPath),
+		pg.WithSeed(seed),
+		pg.WithDump(dumpPath),
 		pg.WithUI(withUI),
 		pg.WithLabel(label),
+		pg.WithTemplateCache(templateCache),
+		pg.WithReplicas(replicas, replicaDelay),
+		pg.WithQueryLog(logQueries),
+		pg.WithQueryStats(queryStats),
+		pg.WithTLS(withTLS, tlsClientCert),
 	)
 	if err != nil {
 		return err
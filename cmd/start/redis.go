@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/mirzakhany/dbctl/internal/database/redis"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
 	"github.com/mirzakhany/dbctl/internal/utils"
 	"github.com/spf13/cobra"
 )
@@ -24,6 +25,7 @@ func GetRedisCmd() *cobra.Command {
 	cmd.Flags().String("pass", "", "Database password")
 	cmd.Flags().StringP("version", "v", "", "Database version, default 7.0.4 for docker engine")
 	cmd.Flags().StringP("fixtures", "f", "", "Path to fixture files, .lua files are evaluated as scripts, other files hold one redis command per line")
+	cmd.Flags().Int64("seed", fixtures.DefaultSeed, "Seed of the random data of the fixtures written as go templates (.tmpl), the same seed renders the same data")
 
 	return cmd
 }
@@ -69,12 +71,29 @@ func runRedis(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("invalid fixtures args, %w", err)
 	}
 
+	seed, err := cmd.Flags().GetInt64("seed")
+	if err != nil {
+		return fmt.Errorf("invalid seed args, %w", err)
+	}
+
+	withTLS, err := cmd.Flags().GetBool("tls")
+	if err != nil {
+		return fmt.Errorf("invalid tls args, %w", err)
+	}
+
+	tlsClientCert, err := cmd.Flags().GetBool("tls-client-cert")
+	if err != nil {
+		return fmt.Errorf("invalid tls-client-cert args, %w", err)
+	}
+
 	db, err := redis.New(
 		redis.WithHost(user, pass, dbIndex, port),
 		redis.WithVersion(redisVersion),
 		redis.WithLogger(io.Discard),
 		redis.WithLabel(label),
 		redis.WithFixtures(fixturesPath),
+		redis.WithSeed(seed),
+		redis.WithTLS(withTLS, tlsClientCert),
 	)
 	if err != nil {
 		return err
@@ -13,6 +13,8 @@ func GetStartCmd() *cobra.Command {
 
 	cmd.PersistentFlags().BoolP("detach", "d", false, "Detached mode: Run database in the background")
 	cmd.PersistentFlags().Bool("ui", false, "Run ui component if available for chosen database")
+	cmd.PersistentFlags().Bool("tls", false, "Serve over TLS with a throwaway certificate authority and server certificate, the uris verify the server with it")
+	cmd.PersistentFlags().Bool("tls-client-cert", false, "Generate a client certificate too, signed by the same authority (requires --tls)")
 
 	cmd.AddCommand(GetPgCmd())
 	cmd.AddCommand(GetRedisCmd())
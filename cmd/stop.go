@@ -4,12 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/mirzakhany/dbctl/internal/cache"
+	"github.com/mirzakhany/dbctl/internal/certs"
 	"github.com/mirzakhany/dbctl/internal/container"
 	"github.com/mirzakhany/dbctl/internal/database"
 	"github.com/mirzakhany/dbctl/internal/database/mongodb"
 	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
 	"github.com/mirzakhany/dbctl/internal/database/redis"
+	"github.com/mirzakhany/dbctl/internal/logger"
 	"github.com/mirzakhany/dbctl/internal/utils"
 	"github.com/spf13/cobra"
 )
@@ -44,6 +48,11 @@ func runStop(cmd *cobra.Command, args []string) error {
 
 	ctx := utils.ContextWithOsSignal()
 
+	// the networks of instances with replicas go once their containers are gone
+	defer pruneNetworks(ctx)
+	// and so do the certificates of the instances started with TLS
+	defer pruneCertificates(ctx)
+
 	if utils.Contain(args, "pg", "postgres") {
 		items, err := pg.Instances(ctx, label)
 		if err != nil {
@@ -144,6 +153,35 @@ func removeByLabel(ctx context.Context, label string) (int, error) {
 	return effected, nil
 }
 
+func pruneNetworks(ctx context.Context) {
+	if err := container.PruneNetworks(ctx); err != nil {
+		logger.Warn(fmt.Sprintf("Removing unused networks failed: %v", err))
+	}
+}
+
+func pruneCertificates(ctx context.Context) {
+	root, err := cache.TLSDir()
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Removing certificates of stopped instances failed: %v", err))
+		return
+	}
+
+	running, err := container.List(ctx, nil)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Removing certificates of stopped instances failed: %v", err))
+		return
+	}
+
+	names := make([]string, 0, len(running))
+	for _, c := range running {
+		names = append(names, strings.TrimPrefix(c.Name, "/"))
+	}
+
+	if err := certs.Prune(root, names); err != nil {
+		logger.Warn(fmt.Sprintf("Removing certificates of stopped instances failed: %v", err))
+	}
+}
+
 func itsDBType(a string) bool {
 	return utils.OneOf(a, "pg", "postgres", "rs", "redis", "mongodb", "mdb")
 }
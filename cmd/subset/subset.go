@@ -0,0 +1,154 @@
+package subset
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// GetSubsetCmd represents the subset command
+func GetSubsetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "subset --source <uri> --root <table [where condition]>",
+		Short: "Extract a referentially intact subset of a postgres database",
+		Long: `Extract a subset of the rows of a source postgres database, such as a local
+restored copy of production, as fixtures or straight into a running instance:
+
+	dbctl subset --source postgres://localhost:5432/shop --root "orders where created_at > now() - interval '7 days'" -o ./fixtures
+	dbctl subset --source postgres://localhost:5432/shop --root "users where id < 100" --masks masks.yaml --load
+
+The subset starts from the rows of the roots and follows foreign keys both ways:
+the rows they refer to are taken, and the rows referring to them, down from the
+roots. The rows a row refers to do not bring in every row referring to them, a
+subset of orders takes their customers but not every order of those customers.
+
+A masks file scrubs personal data, by table and column:
+
+	users:
+	  email: {fake: email}
+	  name: {fake: name}
+	  phone: {sql: "left(phone, 3) || '****'"}
+	  notes: {null: true}
+
+fake takes the kinds of fake data of fixture templates, regex a regular expression
+the values match, value a fixed value, null NULL and sql an expression on the source
+row. Columns of keys can not be masked, that would break the subset.`,
+		Args: cobra.NoArgs,
+		RunE: runSubset,
+	}
+
+	cmd.Flags().String("source", "", "Uri of the postgres database to take the rows from")
+	cmd.Flags().StringArray("root", nil, "Table the subset starts from, with an optional condition: 'orders where id < 100'")
+	cmd.Flags().String("masks", "", "Path to a yaml or json file masking the values of columns, by table and column")
+	cmd.Flags().Int64("seed", 1, "Seed of the fake values of masks, the same seed masks the same way")
+	cmd.Flags().String("format", pg.ExportSQL, "Format of the fixtures, sql or csv")
+	cmd.Flags().StringP("output", "o", "", "Directory to write the fixtures to")
+	cmd.Flags().Bool("load", false, "Load the subset into a database of the running instance")
+	cmd.Flags().String("db", "", "Database to load the subset into, by name or uri, the database of the instance by default")
+	_ = cmd.MarkFlagRequired("source")
+	_ = cmd.MarkFlagRequired("root")
+	return cmd
+}
+
+func runSubset(cmd *cobra.Command, _ []string) error {
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return fmt.Errorf("invalid label args, %w", err)
+	}
+
+	source, err := cmd.Flags().GetString("source")
+	if err != nil {
+		return fmt.Errorf("invalid source args, %w", err)
+	}
+
+	roots, err := cmd.Flags().GetStringArray("root")
+	if err != nil {
+		return fmt.Errorf("invalid root args, %w", err)
+	}
+
+	masksPath, err := cmd.Flags().GetString("masks")
+	if err != nil {
+		return fmt.Errorf("invalid masks args, %w", err)
+	}
+
+	masks, err := pg.ReadSubsetMasks(masksPath)
+	if err != nil {
+		return err
+	}
+
+	seed, err := cmd.Flags().GetInt64("seed")
+	if err != nil {
+		return fmt.Errorf("invalid seed args, %w", err)
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("invalid format args, %w", err)
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("invalid output args, %w", err)
+	}
+
+	load, err := cmd.Flags().GetBool("load")
+	if err != nil {
+		return fmt.Errorf("invalid load args, %w", err)
+	}
+
+	db, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return fmt.Errorf("invalid db args, %w", err)
+	}
+
+	if output == "" && !load {
+		return errors.New("invalid output args, write the subset to a directory with -o or load it with --load")
+	}
+	if db != "" && !load {
+		return errors.New("invalid db args, the database to load the subset into takes --load")
+	}
+
+	ctx := utils.ContextWithOsSignal()
+
+	// the instance is looked up first, not to read a subset there is nowhere to load
+	var instance *pg.Postgres
+	if load {
+		if instance, err = pg.Running(ctx, label); err != nil {
+			return err
+		}
+	}
+
+	// a subset only loaded goes through a directory of its own
+	if output == "" {
+		if output, err = os.MkdirTemp("", "dbctl-subset-*"); err != nil {
+			return fmt.Errorf("create subset directory failed: %w", err)
+		}
+		defer os.RemoveAll(output)
+	}
+
+	tables, err := pg.Subset(ctx, pg.SubsetRequest{Source: source, Roots: roots, Masks: masks, Seed: seed, Format: format, Dir: output})
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, t := range tables {
+		total += t.Rows
+		fmt.Printf("%s: %d rows\n", t.Table, t.Rows)
+	}
+
+	if !load {
+		fmt.Printf("Wrote %d rows of %d tables to %s\n", total, len(tables), output)
+		return nil
+	}
+
+	if err := instance.LoadFixtures(ctx, db, output); err != nil {
+		return fmt.Errorf("load subset failed: %w", err)
+	}
+	fmt.Printf("Loaded %d rows of %d tables\n", total, len(tables))
+	return nil
+}
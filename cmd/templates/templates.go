@@ -0,0 +1,245 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	"github.com/mirzakhany/dbctl/internal/table"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// GetTemplatesCmd represents the templates command
+func GetTemplatesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Aliases: []string{"tpl"},
+		Use:     "templates",
+		Short:   "Manage the template databases of a running postgres instance",
+		Long: `Every distinct set of migrations sent to the api server is built once into a
+template database, the databases created after it are cloned from that template.
+Templates are never removed on their own, use these commands to clean up the ones
+left behind by migrations that changed since.`,
+	}
+
+	cmd.AddCommand(getListCmd())
+	cmd.AddCommand(getInspectCmd())
+	cmd.AddCommand(getRemoveCmd())
+	cmd.AddCommand(getPruneCmd())
+	return cmd
+}
+
+func getListCmd() *cobra.Command {
+	return &cobra.Command{
+		Aliases: []string{"ls"},
+		Use:     "list",
+		Short:   "List the templates, most recently used first",
+		Args:    cobra.NoArgs,
+		RunE:    runList,
+	}
+}
+
+func getInspectCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect <hash>",
+		Short: "Show the details of a template, including the migrations it was built from",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runInspect,
+	}
+}
+
+func getRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Aliases: []string{"remove"},
+		Use:     "rm <hash>...",
+		Short:   "Remove templates by their hash, a unique prefix of it is enough",
+		Args:    cobra.MinimumNArgs(1),
+		RunE:    runRemove,
+	}
+}
+
+func getPruneCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove the templates that were not used recently",
+		Long: `Remove every template but the --keep most recently used ones. With --older-than
+only the templates that were not used for at least that long are removed.`,
+		Args: cobra.NoArgs,
+		RunE: runPrune,
+	}
+
+	cmd.Flags().Int("keep", 0, "Number of most recently used templates to keep")
+	cmd.Flags().String("older-than", "", "Only remove templates not used for this long, such as 12h, 7d or 2w")
+	return cmd
+}
+
+func running(ctx context.Context, cmd *cobra.Command) (*pg.Postgres, error) {
+	label, err := cmd.Flags().GetString("label")
+	if err != nil {
+		return nil, fmt.Errorf("invalid label args, %w", err)
+	}
+
+	return pg.Running(ctx, label)
+}
+
+func runList(cmd *cobra.Command, _ []string) error {
+	ctx := utils.ContextWithOsSignal()
+	db, err := running(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	templates, err := db.Templates(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(templates) == 0 {
+		fmt.Println("No templates found")
+		return nil
+	}
+
+	t := table.New(os.Stdout)
+	t.AddRow("Hash", "Size", "Created", "Last used", "Hits", "Files")
+	for _, tpl := range templates {
+		t.AddRow(shortHash(tpl.Hash), formatSize(tpl.Size), formatTime(tpl.CreatedAt),
+			formatTime(tpl.LastUsedAt), strconv.Itoa(tpl.Hits), summarizeFiles(tpl.Files))
+	}
+	t.Print()
+	return nil
+}
+
+func runInspect(cmd *cobra.Command, args []string) error {
+	ctx := utils.ContextWithOsSignal()
+	db, err := running(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	tpl, err := db.Template(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Name:       %s\n", tpl.Name)
+	fmt.Printf("Hash:       %s\n", tpl.Hash)
+	fmt.Printf("Size:       %s\n", formatSize(tpl.Size))
+	fmt.Printf("Created:    %s\n", formatTime(tpl.CreatedAt))
+	fmt.Printf("Last used:  %s\n", formatTime(tpl.LastUsedAt))
+	fmt.Printf("Hits:       %d\n", tpl.Hits)
+	if tpl.Base != "" {
+		fmt.Printf("Based on:   %s\n", shortHash(tpl.Base))
+	}
+	fmt.Printf("Files:      %d\n", len(tpl.Files))
+	for _, f := range tpl.Files {
+		fmt.Printf("  %s\n", f)
+	}
+	return nil
+}
+
+func runRemove(cmd *cobra.Command, args []string) error {
+	ctx := utils.ContextWithOsSignal()
+	db, err := running(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range args {
+		tpl, err := db.RemoveTemplate(ctx, hash)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", tpl.Name)
+	}
+	return nil
+}
+
+func runPrune(cmd *cobra.Command, _ []string) error {
+	keep, err := cmd.Flags().GetInt("keep")
+	if err != nil {
+		return fmt.Errorf("invalid keep args, %w", err)
+	}
+
+	if keep < 0 {
+		return errors.New("invalid keep args, it can not be negative")
+	}
+
+	rawAge, err := cmd.Flags().GetString("older-than")
+	if err != nil {
+		return fmt.Errorf("invalid older-than args, %w", err)
+	}
+
+	var olderThan time.Duration
+	if rawAge != "" {
+		olderThan, err = utils.ParseAge(rawAge)
+		if err != nil {
+			return fmt.Errorf("invalid older-than args, %w", err)
+		}
+	}
+
+	ctx := utils.ContextWithOsSignal()
+	db, err := running(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	pruned, err := db.PruneTemplates(ctx, keep, olderThan)
+	for _, tpl := range pruned {
+		fmt.Printf("Removed %s\n", tpl.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pruned %d templates\n", len(pruned))
+	return nil
+}
+
+// shortHash shortens a template hash the way docker shortens container ids, any
+// unique prefix is accepted back.
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// summarizeFiles keeps a long list of migrations to one line, inspect shows them all.
+func summarizeFiles(files []string) string {
+	switch len(files) {
+	case 0:
+		return "-"
+	case 1:
+		return files[0]
+	case 2:
+		return strings.Join(files, ", ")
+	default:
+		return fmt.Sprintf("%s .. %s (%d)", files[0], files[len(files)-1], len(files))
+	}
+}
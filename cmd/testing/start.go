@@ -2,6 +2,7 @@ package testing
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/mirzakhany/dbctl/internal/apiserver"
@@ -52,8 +53,41 @@ func GetStartTestingCmd(rootCmd *cobra.Command) *cobra.Command {
 				return fmt.Errorf("invalid api-port args, %w", err)
 			}
 
+			restrictedRoles, err := cobraCmd.Flags().GetBool("restricted-roles")
+			if err != nil {
+				return fmt.Errorf("invalid restricted-roles args, %w", err)
+			}
+
+			grants, err := cobraCmd.Flags().GetString("grants")
+			if err != nil {
+				return fmt.Errorf("invalid grants args, %w", err)
+			}
+
 			// run api server
-			rootCmd.SetArgs([]string{"api-server", "-t", "-p", apiPort})
+			serverArgs := []string{"api-server", "-t", "-p", apiPort}
+			if restrictedRoles {
+				serverArgs = append(serverArgs, "--restricted-roles")
+			}
+			if grants != "" {
+				serverArgs = append(serverArgs, "--grants", grants)
+			}
+
+			poolSize, err := cobraCmd.Flags().GetInt("pool-size")
+			if err != nil {
+				return fmt.Errorf("invalid pool-size args, %w", err)
+			}
+			if poolSize > 0 {
+				serverArgs = append(serverArgs, "--pool-size", strconv.Itoa(poolSize))
+			}
+
+			poolTargets, err := cobraCmd.Flags().GetStringSlice("pool-target")
+			if err != nil {
+				return fmt.Errorf("invalid pool-target args, %w", err)
+			}
+			for _, target := range poolTargets {
+				serverArgs = append(serverArgs, "--pool-target", target)
+			}
+			rootCmd.SetArgs(serverArgs)
 			if err := rootCmd.Execute(); err != nil {
 				return fmt.Errorf("starting api server failed: %w", err)
 			}
@@ -65,6 +99,11 @@ func GetStartTestingCmd(rootCmd *cobra.Command) *cobra.Command {
 
 	cmd.Flags().String("api-port", apiserver.DefaultPort, "port the api server listens on, pick another one to run several projects at once")
 
+	cmd.Flags().Bool("restricted-roles", false, "hand every postgres database out with a role of its own, owning only that database")
+	cmd.Flags().String("grants", "", "SQL file granting the privileges of the roles postgres databases are handed out with, naming the role :role (implies --restricted-roles)")
+	cmd.Flags().Int("pool-size", 0, "postgres databases kept ready for each template recently asked for, handed out without cloning while the test waits")
+	cmd.Flags().StringSlice("pool-target", nil, "databases kept ready for a template, as hash=count, overriding --pool-size for it")
+
 	cmd.Flags().SetInterspersed(false)
 	return cmd
 }
@@ -9,6 +9,7 @@ require (
 	github.com/lib/pq v1.10.0
 	github.com/spf13/cobra v1.5.0
 	go.mongodb.org/mongo-driver v1.17.3
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
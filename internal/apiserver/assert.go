@@ -0,0 +1,125 @@
+package apiserver
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+)
+
+// AssertDBResponse is the response body of comparing a database with golden files.
+type AssertDBResponse struct {
+	Tables []database.TableDiff `json:"tables"`
+	// Diff is Tables written out the way a failing test shows them, empty when the
+	// database matches its golden files
+	Diff string `json:"diff"`
+	// Files are the golden files rewritten with update, by their path within the
+	// golden directory
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// AssertDB compares the database at uri with the golden files sent with the
+// request, leaving out the columns of ignore. With update the files are rewritten
+// with what the database holds instead, and sent back for the client to save.
+// The paths of the diff are shown within dir, the directory the client keeps the
+// golden files in.
+func (s *Server) AssertDB(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	uri, dbType := r.FormValue("uri"), r.FormValue("type")
+	if uri == "" {
+		JSONError(w, http.StatusBadRequest, "uri is required")
+		return
+	}
+	if dbType == "" {
+		dbType = typeOfURI(uri)
+	}
+	if err := validateType(dbType); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	update := false
+	if v := r.FormValue("update"); v != "" {
+		var err error
+		if update, err = strconv.ParseBool(v); err != nil {
+			JSONError(w, http.StatusBadRequest, "update is either true or false")
+			return
+		}
+	}
+
+	goldenDir, err := os.MkdirTemp("/tmp", "golden-*")
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.RemoveAll(goldenDir)
+
+	if err := readMulipartFiles(r, "golden", goldenDir); err != nil {
+		JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries, err := os.ReadDir(goldenDir); err != nil || len(entries) == 0 {
+		JSONError(w, http.StatusBadRequest, "golden files are required")
+		return
+	}
+
+	db, err := s.testDatabase(r.Context(), dbType, uri)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := database.AssertRequest{DB: uri, Dir: goldenDir, Ignore: r.Form["ignore"], Update: update}
+	tables, err := db.AssertDB(r.Context(), req)
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := AssertDBResponse{Tables: tables}
+	if res.Tables == nil {
+		res.Tables = []database.TableDiff{}
+	}
+
+	var diff strings.Builder
+	database.FormatDiff(&diff, r.FormValue("dir"), tables)
+	res.Diff = diff.String()
+
+	if update {
+		if res.Files, err = readGoldenFiles(goldenDir); err != nil {
+			JSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	JSON(w, http.StatusOK, res)
+}
+
+// readGoldenFiles returns the content of the files in dir, by their path within it.
+func readGoldenFiles(dir string) (map[string]string, error) {
+	out := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		out[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	return out, err
+}
@@ -0,0 +1,53 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+)
+
+func TestAssertDBRejectsInvalidRequests(t *testing.T) {
+	s := NewServer(DefaultPort, "", Roles{}, pg.PoolConfig{})
+
+	for _, body := range []string{
+		"",
+		"uri=mysql://localhost/dbctl_1",
+		"uri=postgres://localhost/dbctl_1&update=maybe",
+		"uri=postgres://localhost/dbctl_1",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/assert", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		res := httptest.NewRecorder()
+		s.AssertDB(res, req)
+
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", body, res.Code)
+		}
+	}
+}
+
+func TestReadGoldenFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "billing"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"users.csv": "id\n1\n", "billing/invoices.yaml": "- id: 1\n"} {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := readGoldenFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files["users.csv"] != "id\n1\n" || files["billing/invoices.yaml"] != "- id: 1\n" {
+		t.Fatalf("unexpected files %v", files)
+	}
+}
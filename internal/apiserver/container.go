@@ -11,13 +11,14 @@ import (
 
 	"github.com/mirzakhany/dbctl/internal/container"
 	"github.com/mirzakhany/dbctl/internal/database"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
 	"github.com/mirzakhany/dbctl/internal/logger"
 )
 
 const labelAPIServer = "apiserver"
 
 // RunAPIServerContainer runs a container with the apiserver image
-func RunAPIServerContainer(ctx context.Context, port, label string, timeout time.Duration) error {
+func RunAPIServerContainer(ctx context.Context, port, label string, roles Roles, pool pg.PoolConfig, timeout time.Duration) error {
 	var rnd, err = rand.Int(rand.Reader, big.NewInt(20))
 	if err != nil {
 		return err
@@ -43,6 +44,12 @@ func RunAPIServerContainer(ctx context.Context, port, label string, timeout time
 	if label != "" {
 		env[EnvLabel] = label
 	}
+	for k, v := range roles.env() {
+		env[k] = v
+	}
+	for k, v := range poolEnv(pool) {
+		env[k] = v
+	}
 
 	req := container.CreateRequest{
 		Image:        "mirzakhani/dbctl:latest",
@@ -0,0 +1,46 @@
+package apiserver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+)
+
+// QueryLog answers with the statements a postgres database ran, the database being
+// given by its uri, for a client to show the queries of a failing test. The
+// instance has to be started with --log-queries.
+func (s *Server) QueryLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	uri := r.URL.Query().Get("uri")
+	if uri == "" {
+		JSONError(w, http.StatusBadRequest, "uri is required")
+		return
+	}
+
+	pgDB, err := pg.New(pg.WithInstance(s.instanceFor(r.Context(), database.TypePostgres)), pg.WithURI(uri))
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries := []pg.QueryLogEntry{}
+	err = pgDB.QueryLog(r.Context(), uri, false, func(e pg.QueryLogEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if errors.Is(err, pg.ErrQueryLogOff) {
+		JSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	JSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,186 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/database/mongodb"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	rs "github.com/mirzakhany/dbctl/internal/database/redis"
+)
+
+// fixtureStore keeps the fixtures each database was created with, by the uri it was
+// handed out with, so that resetting it applies them again without the client
+// sending them once more.
+type fixtureStore struct {
+	mu   sync.Mutex
+	dirs map[string]string
+}
+
+func newFixtureStore() *fixtureStore {
+	return &fixtureStore{dirs: map[string]string{}}
+}
+
+// keep takes dir over for uri, it reports whether it did. A directory without any
+// fixture is not kept.
+func (f *fixtureStore) keep(uri, dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if old, ok := f.dirs[uri]; ok {
+		_ = os.RemoveAll(old)
+	}
+	f.dirs[uri] = dir
+	return true
+}
+
+func (f *fixtureStore) get(uri string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dirs[uri]
+}
+
+// forget removes the fixtures of uri, once its database is gone.
+func (f *fixtureStore) forget(uri string) {
+	f.mu.Lock()
+	dir, ok := f.dirs[uri]
+	delete(f.dirs, uri)
+	f.mu.Unlock()
+
+	if ok {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// clear removes the fixtures of every database, when the server stops.
+func (f *fixtureStore) clear() {
+	f.mu.Lock()
+	dirs := f.dirs
+	f.dirs = map[string]string{}
+	f.mu.Unlock()
+
+	for _, dir := range dirs {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// ResetDBRequest is the request body for resetting a database
+type ResetDBRequest struct {
+	// Type is taken from the scheme of the uri when left out
+	Type string `json:"type"`
+	URI  string `json:"uri"`
+}
+
+// ResetDB returns a database to the state it was created in: it is emptied, but
+// what its migrations built, and its fixtures are applied again. The fixtures sent
+// with the request are applied instead of the ones it was created with, when there
+// are any.
+func (s *Server) ResetDB(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	req := &ResetDBRequest{Type: r.FormValue("type"), URI: r.FormValue("uri")}
+	if req.URI == "" {
+		JSONError(w, http.StatusBadRequest, "uri is required")
+		return
+	}
+
+	if req.Type == "" {
+		req.Type = typeOfURI(req.URI)
+	}
+	if err := validateType(req.Type); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fixturesDir, err := os.MkdirTemp("/tmp", "fixtures-*")
+	if err != nil {
+		JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.RemoveAll(fixturesDir)
+
+	if err := readMulipartFiles(r, "fixtures", fixturesDir); err != nil {
+		JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fixtures := s.fixtures.get(req.URI)
+	if entries, err := os.ReadDir(fixturesDir); err == nil && len(entries) > 0 {
+		fixtures = fixturesDir
+	}
+
+	db, err := s.testDatabase(r.Context(), req.Type, req.URI)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := db.ResetDB(r.Context(), req.URI, fixtures); err != nil {
+		JSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	JSON(w, http.StatusNoContent, nil)
+}
+
+// testDatabase is what the api server does with a database it handed out, besides
+// removing it.
+type testDatabase interface {
+	database.Resetter
+	database.Asserter
+}
+
+// testDatabase returns the database at uri, of dbType, on the instance of the server.
+func (s *Server) testDatabase(ctx context.Context, dbType, uri string) (testDatabase, error) {
+	instance := s.instanceFor(ctx, dbType)
+
+	switch dbType {
+	case database.TypePostgres:
+		pgDB, err := pg.New(pg.WithInstance(instance), pg.WithURI(uri))
+		if err != nil {
+			return nil, err
+		}
+		return pgDB, nil
+	case database.TypeRedis:
+		rsDB, err := rs.New(rs.WithInstance(instance), rs.WithURI(uri))
+		if err != nil {
+			return nil, err
+		}
+		return rsDB, nil
+	default:
+		mongoDbDB, err := mongodb.New(mongodb.WithInstance(instance), mongodb.WithURI(uri))
+		if err != nil {
+			return nil, err
+		}
+		return mongoDbDB, nil
+	}
+}
+
+// typeOfURI returns the database type a uri is of by its scheme, empty when it is
+// none dbctl knows.
+func typeOfURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		return database.TypePostgres
+	case "redis", "rediss":
+		return database.TypeRedis
+	case "mongodb", "mongodb+srv":
+		return database.TypeMongoDB
+	}
+	return ""
+}
@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -34,8 +35,76 @@ const (
 	// EnvInstances holds the instances discovered when the server was started, used
 	// when the server itself cannot reach docker
 	EnvInstances = "DBCTL_INSTANCES"
+	// EnvRestrictedRoles and EnvGrants hold the Roles of the server
+	EnvRestrictedRoles = "DBCTL_RESTRICTED_ROLES"
+	EnvGrants          = "DBCTL_GRANTS"
+	// EnvPoolSize and EnvPoolTargets hold the pool of the server, the targets
+	// written as pg.ParsePoolTargets takes them
+	EnvPoolSize    = "DBCTL_POOL_SIZE"
+	EnvPoolTargets = "DBCTL_POOL_TARGETS"
 )
 
+// Roles is how the server hands postgres databases out, with the credentials of
+// the instance or with a role of their own.
+type Roles struct {
+	// Restricted hands every postgres database out with a role of its own, not
+	// only the ones requested with one
+	Restricted bool
+	// Grants are the privileges of the roles of the requests that bring none
+	Grants string
+}
+
+// env is the environment telling the containerized server about r.
+func (r Roles) env() map[string]string {
+	env := map[string]string{}
+	if r.Restricted {
+		env[EnvRestrictedRoles] = "true"
+	}
+	if r.Grants != "" {
+		env[EnvGrants] = r.Grants
+	}
+	return env
+}
+
+// poolEnv is the environment telling the containerized server about its pool.
+func poolEnv(cfg pg.PoolConfig) map[string]string {
+	env := map[string]string{}
+	if cfg.Size > 0 {
+		env[EnvPoolSize] = strconv.Itoa(cfg.Size)
+	}
+	if len(cfg.Targets) > 0 {
+		targets := make([]string, 0, len(cfg.Targets))
+		for name, n := range cfg.Targets {
+			targets = append(targets, fmt.Sprintf("%s=%d", name, n))
+		}
+		sort.Strings(targets)
+		env[EnvPoolTargets] = strings.Join(targets, ",")
+	}
+	return env
+}
+
+// poolFromEnv reads the pool of the containerized server from its environment.
+func poolFromEnv() pg.PoolConfig {
+	var cfg pg.PoolConfig
+	if raw := os.Getenv(EnvPoolSize); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil {
+			logger.Error("ignoring unreadable "+EnvPoolSize, err)
+		} else {
+			cfg.Size = size
+		}
+	}
+	if raw := os.Getenv(EnvPoolTargets); raw != "" {
+		targets, err := pg.ParsePoolTargets(raw)
+		if err != nil {
+			logger.Error("ignoring unreadable "+EnvPoolTargets, err)
+		} else {
+			cfg.Targets = targets
+		}
+	}
+	return cfg
+}
+
 // Server is the testing server
 type Server struct {
 	port  string
@@ -43,17 +112,35 @@ type Server struct {
 
 	// instances discovered when the server started, by database type
 	instances map[string]*database.Instance
+
+	roles Roles
+
+	// pool keeps postgres databases ready to hand out, none are when it is nil
+	pool *pg.Pool
+
+	// fixtures are the fixtures of the databases handed out, to reset them with
+	fixtures *fixtureStore
 }
 
 // NewServer creates a new testing server. The label scopes which instances the
-// server manages.
-func NewServer(port, label string) *Server {
+// server manages, pool is how many postgres databases it keeps ready.
+func NewServer(port, label string, roles Roles, pool pg.PoolConfig) *Server {
 	// the containerized server is configured through the environment
 	if label == "" {
 		label = os.Getenv(EnvLabel)
 	}
+	if roles == (Roles{}) {
+		roles = Roles{Restricted: isTrue(os.Getenv(EnvRestrictedRoles)), Grants: os.Getenv(EnvGrants)}
+	}
 
-	s := &Server{port: port, label: label}
+	if !pool.Enabled() {
+		pool = poolFromEnv()
+	}
+
+	s := &Server{port: port, label: label, roles: roles, fixtures: newFixtureStore()}
+	if pool.Enabled() {
+		s.pool = pg.NewPool(pool)
+	}
 
 	// the containerized server has no access to docker, it is told about the
 	// instances that were running when it was started instead.
@@ -75,6 +162,28 @@ func (s *Server) Start(ctx context.Context) error {
 
 	mux.Handle("/create", http.HandlerFunc(s.CreateDB))
 	mux.Handle("/remove", http.HandlerFunc(s.RemoveDB))
+	mux.Handle("/reset", http.HandlerFunc(s.ResetDB))
+	mux.Handle("/assert", http.HandlerFunc(s.AssertDB))
+	mux.Handle("/snapshots", http.HandlerFunc(s.Snapshots))
+	mux.Handle("/snapshots/restore", http.HandlerFunc(s.RestoreSnapshot))
+	mux.Handle("/snapshots/branch", http.HandlerFunc(s.BranchSnapshot))
+	mux.Handle("/logs/queries", http.HandlerFunc(s.QueryLog))
+	mux.Handle("/status", http.HandlerFunc(s.Status))
+	defer s.fixtures.clear()
+
+	// the pool goes with the server, the databases it kept ready with it
+	if s.pool != nil {
+		poolCtx, stopPool := context.WithCancel(ctx)
+		poolDone := make(chan struct{})
+		go func() {
+			s.pool.Run(poolCtx)
+			close(poolDone)
+		}()
+		defer func() {
+			stopPool()
+			<-poolDone
+		}()
+	}
 
 	// The server creates and drops databases for whoever reaches it, so it stays on
 	// loopback. In a container it has to listen on every interface to be reachable
@@ -131,11 +240,30 @@ type CreateDBRequest struct {
 	InstanceUser string `json:"instance_user"`
 	InstancePass string `json:"instance_pass"`
 	InstanceName string `json:"instance_name"`
+
+	// RestrictedRole hands a postgres database out with a role of its own, with
+	// the privileges Grants give it or owning the database.
+	RestrictedRole bool   `json:"restricted_role"`
+	Grants         string `json:"grants"`
+
+	// Isolation is what a postgres database is handed out as, a database of its
+	// own or a schema of a shared one.
+	Isolation string `json:"isolation"`
+
+	// instance is the running instance the database is created on, when the
+	// caller did not point at another one
+	instance *database.Instance
 }
 
 // CreateDBResponse is the response body for creating a database
 type CreateDBResponse struct {
 	URI string `json:"uri"`
+	// ReplicaURIs are the uris of the database on the replicas of a postgres
+	// instance started with them, read only.
+	ReplicaURIs []string `json:"replica_uris,omitempty"`
+	// CA is the certificate of the authority to verify an instance started with
+	// TLS with, PEM encoded.
+	CA string `json:"ca,omitempty"`
 }
 
 // CreateDB creates a new database
@@ -152,6 +280,11 @@ func (s *Server) CreateDB(w http.ResponseWriter, r *http.Request) {
 		InstanceHost: r.FormValue("instance_host"),
 
 		WithDefaultMigrations: isTrue(r.FormValue("with_default_migrations")),
+
+		RestrictedRole: isTrue(r.FormValue("restricted_role")) || r.FormValue("grants") != "",
+		Grants:         r.FormValue("grants"),
+
+		Isolation: r.FormValue("isolation"),
 	}
 
 	if p := r.FormValue("instance_port"); p != "" {
@@ -174,6 +307,37 @@ func (s *Server) CreateDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.RestrictedRole && req.Type != database.TypePostgres {
+		JSONError(w, http.StatusBadRequest, fmt.Sprintf("restricted roles are only supported by %s", database.TypePostgres))
+		return
+	}
+
+	switch req.Isolation {
+	case "", database.IsolationDatabase:
+	case database.IsolationSchema:
+		if req.Type != database.TypePostgres {
+			JSONError(w, http.StatusBadRequest, fmt.Sprintf("schema isolation is only supported by %s", database.TypePostgres))
+			return
+		}
+	default:
+		JSONError(w, http.StatusBadRequest, fmt.Sprintf("isolation is either %s or %s, not %q",
+			database.IsolationDatabase, database.IsolationSchema, req.Isolation))
+		return
+	}
+
+	// the roles of the server apply to postgres alone, other types have none
+	if req.Type == database.TypePostgres {
+		req.RestrictedRole = req.RestrictedRole || s.roles.Restricted
+		if req.Grants == "" {
+			req.Grants = s.roles.Grants
+		}
+	}
+
+	if req.RestrictedRole && req.Isolation == database.IsolationSchema {
+		JSONError(w, http.StatusBadRequest, "restricted roles own a database of their own, they are not supported with schema isolation")
+		return
+	}
+
 	migrationsDir, err := os.MkdirTemp("/tmp", "migrations-*")
 	if err != nil {
 		JSONError(w, http.StatusInternalServerError, err.Error())
@@ -186,7 +350,13 @@ func (s *Server) CreateDB(w http.ResponseWriter, r *http.Request) {
 		JSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	defer os.RemoveAll(fixturesDir)
+	// the fixtures are kept for resetting the database, once it was created
+	keepFixtures := false
+	defer func() {
+		if !keepFixtures {
+			_ = os.RemoveAll(fixturesDir)
+		}
+	}()
 
 	// read migrations
 	if err := readMulipartFiles(r, "migrations", migrationsDir); err != nil {
@@ -206,16 +376,16 @@ func (s *Server) CreateDB(w http.ResponseWriter, r *http.Request) {
 	// client does not have to be told which port dbctl picked.
 	s.applyInstance(r.Context(), req)
 
-	var uri string
+	var res *database.CreateDBResponse
 	var createErr error
 
 	switch req.Type {
 	case database.TypePostgres:
-		uri, createErr = createPostgresDB(r.Context(), req)
+		res, createErr = createPostgresDB(r.Context(), req, s.pool)
 	case database.TypeRedis:
-		uri, createErr = createRedisDB(r.Context(), req)
+		res, createErr = createRedisDB(r.Context(), req)
 	case database.TypeMongoDB:
-		uri, createErr = createMongoDBDB(r.Context(), req)
+		res, createErr = createMongoDBDB(r.Context(), req)
 	}
 
 	if createErr != nil {
@@ -223,7 +393,8 @@ func (s *Server) CreateDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	JSON(w, http.StatusOK, CreateDBResponse{URI: uri})
+	keepFixtures = s.fixtures.keep(res.URI, fixturesDir)
+	JSON(w, http.StatusOK, CreateDBResponse{URI: res.URI, ReplicaURIs: res.ReplicaURIs, CA: res.CA})
 }
 
 // instanceFor returns the running instance of a type, so that a client does not
@@ -251,6 +422,11 @@ func (s *Server) applyInstance(ctx context.Context, r *CreateDBRequest) {
 		return
 	}
 
+	// the certificates of an instance started with TLS go with it
+	if r.InstancePort == 0 || r.InstancePort == instance.Port {
+		r.instance = instance
+	}
+
 	if r.InstancePort == 0 {
 		r.InstancePort = instance.Port
 	}
@@ -387,14 +563,18 @@ func (s *Server) RemoveDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the connection details of the uri win over the ones of the running instance,
+	// which is where the certificates of an instance started with TLS come from
+	instance := s.instanceFor(r.Context(), req.Type)
+
 	var err error
 	switch req.Type {
 	case database.TypePostgres:
-		err = removePostgresDB(r.Context(), req)
+		err = removePostgresDB(r.Context(), instance, req)
 	case database.TypeRedis:
-		err = removeRedisDB(r.Context(), req)
+		err = removeRedisDB(r.Context(), instance, req)
 	case database.TypeMongoDB:
-		err = removeMongoDBDB(r.Context(), req)
+		err = removeMongoDBDB(r.Context(), instance, req)
 	}
 
 	if err != nil {
@@ -402,10 +582,11 @@ func (s *Server) RemoveDB(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.fixtures.forget(req.URI)
 	JSON(w, http.StatusNoContent, nil)
 }
 
-func createPostgresDB(ctx context.Context, r *CreateDBRequest) (string, error) {
+func createPostgresDB(ctx context.Context, r *CreateDBRequest, pool *pg.Pool) (*database.CreateDBResponse, error) {
 	if r.InstancePort == 0 {
 		r.InstancePort = pg.DefaultPort
 	}
@@ -422,25 +603,22 @@ func createPostgresDB(ctx context.Context, r *CreateDBRequest) (string, error) {
 		r.InstanceName = pg.DefaultName
 	}
 
-	pgDB, err := pg.New(pg.WithHost(r.InstanceUser, r.InstancePass, r.InstanceName, r.InstancePort))
+	pgDB, err := pg.New(pg.WithInstance(r.instance), pg.WithHost(r.InstanceUser, r.InstancePass, r.InstanceName, r.InstancePort), pg.WithPool(pool))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	res, err := pgDB.CreateDB(ctx, &database.CreateDBRequest{
+	return pgDB.CreateDB(ctx, &database.CreateDBRequest{
 		Migrations:            r.Migrations,
 		Fixtures:              r.Fixtures,
 		WithDefaultMigrations: r.WithDefaultMigrations,
+		RestrictedRole:        r.RestrictedRole,
+		Grants:                r.Grants,
+		Isolation:             r.Isolation,
 	})
-
-	if err != nil {
-		return "", err
-	}
-
-	return res.URI, nil
 }
 
-func createRedisDB(ctx context.Context, r *CreateDBRequest) (string, error) {
+func createRedisDB(ctx context.Context, r *CreateDBRequest) (*database.CreateDBResponse, error) {
 	if r.InstancePort == 0 {
 		r.InstancePort = rs.DefaultPort
 	}
@@ -453,20 +631,15 @@ func createRedisDB(ctx context.Context, r *CreateDBRequest) (string, error) {
 		r.InstancePass = rs.DefaultPass
 	}
 
-	rsDB, err := rs.New(rs.WithHost(r.InstanceUser, r.InstancePass, 0, r.InstancePort))
-	if err != nil {
-		return "", err
-	}
-
-	res, err := rsDB.CreateDB(ctx, &database.CreateDBRequest{Fixtures: r.Fixtures})
+	rsDB, err := rs.New(rs.WithInstance(r.instance), rs.WithHost(r.InstanceUser, r.InstancePass, 0, r.InstancePort))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return res.URI, nil
+	return rsDB.CreateDB(ctx, &database.CreateDBRequest{Fixtures: r.Fixtures})
 }
 
-func createMongoDBDB(ctx context.Context, r *CreateDBRequest) (string, error) {
+func createMongoDBDB(ctx context.Context, r *CreateDBRequest) (*database.CreateDBResponse, error) {
 	if r.InstancePort == 0 {
 		r.InstancePort = mongodb.DefaultPort
 	}
@@ -483,44 +656,38 @@ func createMongoDBDB(ctx context.Context, r *CreateDBRequest) (string, error) {
 		r.InstanceName = mongodb.DefaultName
 	}
 
-	mongoDbDB, err := mongodb.New(mongodb.WithHost(r.InstanceUser, r.InstancePass, r.InstanceName, r.InstancePort))
+	mongoDbDB, err := mongodb.New(mongodb.WithInstance(r.instance), mongodb.WithHost(r.InstanceUser, r.InstancePass, r.InstanceName, r.InstancePort))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	res, err := mongoDbDB.CreateDB(ctx, &database.CreateDBRequest{
+	return mongoDbDB.CreateDB(ctx, &database.CreateDBRequest{
 		Migrations: r.Migrations,
 		Fixtures:   r.Fixtures,
 	})
-
-	if err != nil {
-		return "", err
-	}
-
-	return res.URI, nil
 }
 
 // instanceOptions returns the options needed to reach the instance the database
 // lives on. Removing a database has to target the same instance it was created
 // on, so the caller supplied connection details are honoured here as well.
-func removePostgresDB(ctx context.Context, r *RemoveDBRequest) error {
-	pgDB, err := pg.New(pg.WithURI(r.URI))
+func removePostgresDB(ctx context.Context, instance *database.Instance, r *RemoveDBRequest) error {
+	pgDB, err := pg.New(pg.WithInstance(instance), pg.WithURI(r.URI))
 	if err != nil {
 		return err
 	}
 	return pgDB.RemoveDB(ctx, r.URI)
 }
 
-func removeRedisDB(ctx context.Context, r *RemoveDBRequest) error {
-	rsDB, err := rs.New(rs.WithURI(r.URI))
+func removeRedisDB(ctx context.Context, instance *database.Instance, r *RemoveDBRequest) error {
+	rsDB, err := rs.New(rs.WithInstance(instance), rs.WithURI(r.URI))
 	if err != nil {
 		return err
 	}
 	return rsDB.RemoveDB(ctx, r.URI)
 }
 
-func removeMongoDBDB(ctx context.Context, r *RemoveDBRequest) error {
-	mongoDbDB, err := mongodb.New(mongodb.WithURI(r.URI))
+func removeMongoDBDB(ctx context.Context, instance *database.Instance, r *RemoveDBRequest) error {
+	mongoDbDB, err := mongodb.New(mongodb.WithInstance(instance), mongodb.WithURI(r.URI))
 	if err != nil {
 		return err
 	}
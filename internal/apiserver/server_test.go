@@ -6,12 +6,14 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
 )
 
 // A request without any file attached is not multipart encoded. The server used
 // to dereference the missing form and take the connection down with it.
 func TestCreateDBWithoutFilesDoesNotPanic(t *testing.T) {
-	s := NewServer(DefaultPort, "")
+	s := NewServer(DefaultPort, "", Roles{}, pg.PoolConfig{})
 
 	req := httptest.NewRequest(http.MethodPost, "/create",
 		strings.NewReader("type=postgres&instance_port=1"))
@@ -41,7 +43,7 @@ func TestValidateType(t *testing.T) {
 }
 
 func TestCreateDBRejectsInvalidPort(t *testing.T) {
-	s := NewServer(DefaultPort, "")
+	s := NewServer(DefaultPort, "", Roles{}, pg.PoolConfig{})
 
 	req := httptest.NewRequest(http.MethodPost, "/create",
 		strings.NewReader("type=postgres&instance_port=not-a-port"))
@@ -55,6 +57,57 @@ func TestCreateDBRejectsInvalidPort(t *testing.T) {
 	}
 }
 
+func TestCreateDBRejectsRestrictedRoleOfRedis(t *testing.T) {
+	s := NewServer(DefaultPort, "", Roles{}, pg.PoolConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/create",
+		strings.NewReader("type=redis&restricted_role=true"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res := httptest.NewRecorder()
+	s.CreateDB(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a restricted role of redis, got %d", res.Code)
+	}
+}
+
+func TestCreateDBRejectsInvalidIsolation(t *testing.T) {
+	s := NewServer(DefaultPort, "", Roles{}, pg.PoolConfig{})
+
+	for _, body := range []string{
+		"type=redis&isolation=schema",
+		"type=postgres&isolation=table",
+		"type=postgres&isolation=schema&restricted_role=true",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		res := httptest.NewRecorder()
+		s.CreateDB(res, req)
+
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, res.Code)
+		}
+	}
+}
+
+func TestRolesFromEnv(t *testing.T) {
+	t.Setenv(EnvRestrictedRoles, "true")
+	t.Setenv(EnvGrants, "grant select on all tables in schema public to :role;")
+
+	s := NewServer(DefaultPort, "", Roles{}, pg.PoolConfig{})
+	if !s.roles.Restricted || s.roles.Grants == "" {
+		t.Fatalf("roles of the environment not applied: %+v", s.roles)
+	}
+
+	// the ones the server is started with win
+	s = NewServer(DefaultPort, "", Roles{Restricted: true}, pg.PoolConfig{})
+	if s.roles.Grants != "" {
+		t.Fatalf("roles of the environment override the given ones: %+v", s.roles)
+	}
+}
+
 func TestUploadPath(t *testing.T) {
 	ok := map[string]string{
 		"001_init.up.sql":            "001_init.up.sql",
@@ -95,3 +148,29 @@ func TestIsTrue(t *testing.T) {
 		}
 	}
 }
+
+func TestPoolFromEnv(t *testing.T) {
+	cfg := pg.PoolConfig{Size: 2, Targets: map[string]int{"dbctl_tpl_ab": 5, "dbctl_template": 1}}
+	for k, v := range poolEnv(cfg) {
+		t.Setenv(k, v)
+	}
+
+	got := poolFromEnv()
+	if got.Size != 2 || len(got.Targets) != 2 || got.Targets["dbctl_tpl_ab"] != 5 || got.Targets["dbctl_template"] != 1 {
+		t.Fatalf("pool of the environment not applied: %+v", got)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s := NewServer(DefaultPort, "", Roles{}, pg.PoolConfig{})
+
+	res := httptest.NewRecorder()
+	s.Status(res, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.Code)
+	}
+	if want := `{"pool":{"size":0,"templates":[]}}`; strings.TrimSpace(res.Body.String()) != want {
+		t.Fatalf("unexpected status %s", res.Body.String())
+	}
+}
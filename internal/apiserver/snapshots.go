@@ -0,0 +1,194 @@
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/database/mongodb"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	rs "github.com/mirzakhany/dbctl/internal/database/redis"
+)
+
+// SnapshotRequest is the request body of the snapshot endpoints
+type SnapshotRequest struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+
+	// URI is the database to snapshot or to restore into. A snapshot is taken of
+	// the database of the instance, and restored into the database it was taken of,
+	// when it is left out.
+	URI string `json:"uri"`
+}
+
+// Snapshots lists the snapshots of an instance on GET, takes one on POST and
+// removes one on DELETE.
+func (s *Server) Snapshots(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		req := &SnapshotRequest{Type: r.URL.Query().Get("type")}
+		snapshotter, ok := s.snapshotterFor(w, r, req)
+		if !ok {
+			return
+		}
+
+		snapshots, err := snapshotter.Snapshots(r.Context())
+		if err != nil {
+			snapshotError(w, err)
+			return
+		}
+		if snapshots == nil {
+			snapshots = []database.Snapshot{}
+		}
+		JSON(w, http.StatusOK, snapshots)
+	case http.MethodPost:
+		req, snapshotter, ok := s.decodeSnapshotRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if err := database.ValidateSnapshotName(req.Name); err != nil {
+			JSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		snapshot, err := snapshotter.CreateSnapshot(r.Context(), req.Name, req.URI)
+		if err != nil {
+			snapshotError(w, err)
+			return
+		}
+		JSON(w, http.StatusCreated, snapshot)
+	case http.MethodDelete:
+		req, snapshotter, ok := s.decodeSnapshotRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if err := snapshotter.RemoveSnapshot(r.Context(), req.Name); err != nil {
+			snapshotError(w, err)
+			return
+		}
+		JSON(w, http.StatusNoContent, nil)
+	default:
+		JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// RestoreSnapshot replaces a database with a copy of a snapshot
+func (s *Server) RestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	req, snapshotter, ok := s.decodeSnapshotRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := snapshotter.RestoreSnapshot(r.Context(), req.Name, req.URI); err != nil {
+		snapshotError(w, err)
+		return
+	}
+	JSON(w, http.StatusNoContent, nil)
+}
+
+// BranchSnapshot creates a new database holding a copy of a snapshot, it is removed
+// through /remove like any other database.
+func (s *Server) BranchSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	req, snapshotter, ok := s.decodeSnapshotRequest(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := snapshotter.BranchSnapshot(r.Context(), req.Name)
+	if err != nil {
+		snapshotError(w, err)
+		return
+	}
+	JSON(w, http.StatusOK, CreateDBResponse{URI: res.URI, CA: res.CA})
+}
+
+func (s *Server) decodeSnapshotRequest(w http.ResponseWriter, r *http.Request) (*SnapshotRequest, database.Snapshotter, bool) {
+	req := &SnapshotRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	}
+
+	if req.Name == "" {
+		JSONError(w, http.StatusBadRequest, "name is required")
+		return nil, nil, false
+	}
+
+	snapshotter, ok := s.snapshotterFor(w, r, req)
+	return req, snapshotter, ok
+}
+
+// snapshotterFor returns the instance the request is about. It is the one the uri
+// of the request lives on when there is one, the running instance of the type
+// otherwise.
+func (s *Server) snapshotterFor(w http.ResponseWriter, r *http.Request, req *SnapshotRequest) (database.Snapshotter, bool) {
+	if req.Type == "" {
+		JSONError(w, http.StatusBadRequest, "type is required")
+		return nil, false
+	}
+
+	if err := validateType(req.Type); err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	snapshotter, err := s.newSnapshotter(r.Context(), req.Type, req.URI)
+	if err != nil {
+		JSONError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return snapshotter, true
+}
+
+func (s *Server) newSnapshotter(ctx context.Context, dbType, uri string) (database.Snapshotter, error) {
+	// the connection details of the uri win over the ones of the running instance,
+	// the same way they do when removing a database
+	instance := s.instanceFor(ctx, dbType)
+
+	switch dbType {
+	case database.TypePostgres:
+		pgDB, err := pg.New(pg.WithInstance(instance), pg.WithURI(uri))
+		if err != nil {
+			return nil, err
+		}
+		return pgDB, nil
+	case database.TypeRedis:
+		rsDB, err := rs.New(rs.WithInstance(instance), rs.WithURI(uri))
+		if err != nil {
+			return nil, err
+		}
+		return rsDB, nil
+	default:
+		mongoDbDB, err := mongodb.New(mongodb.WithInstance(instance), mongodb.WithURI(uri))
+		if err != nil {
+			return nil, err
+		}
+		return mongoDbDB, nil
+	}
+}
+
+// snapshotError answers with the status telling the client what went wrong.
+func snapshotError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrSnapshotNotFound):
+		JSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrSnapshotExists):
+		JSONError(w, http.StatusConflict, err.Error())
+	default:
+		JSONError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,45 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+)
+
+func TestSnapshotRequestsAreValidated(t *testing.T) {
+	s := NewServer(DefaultPort, "", Roles{}, pg.PoolConfig{})
+
+	cases := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPut, "/snapshots", `{}`, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/snapshots/restore", ``, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/snapshots", `{"type":"postgres"}`, http.StatusBadRequest},
+		{http.MethodPost, "/snapshots", `{"name":"before"}`, http.StatusBadRequest},
+		{http.MethodPost, "/snapshots", `{"type":"mysql","name":"before"}`, http.StatusBadRequest},
+		{http.MethodPost, "/snapshots", `{"type":"postgres","name":"Before Migration"}`, http.StatusBadRequest},
+		{http.MethodPost, "/snapshots/branch", `not json`, http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		res := httptest.NewRecorder()
+
+		switch c.path {
+		case "/snapshots":
+			s.Snapshots(res, req)
+		case "/snapshots/restore":
+			s.RestoreSnapshot(res, req)
+		case "/snapshots/branch":
+			s.BranchSnapshot(res, req)
+		}
+
+		if res.Code != c.want {
+			t.Fatalf("%s %s %s: expected %d, got %d: %s", c.method, c.path, c.body, c.want, res.Code, res.Body.String())
+		}
+	}
+}
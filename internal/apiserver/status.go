@@ -0,0 +1,25 @@
+package apiserver
+
+import (
+	"net/http"
+
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+)
+
+// StatusResponse is the response body of the status of the server
+type StatusResponse struct {
+	// Pool tells how many postgres databases are kept ready, per template, and how
+	// often one was at hand
+	Pool pg.PoolStatus `json:"pool"`
+}
+
+// Status answers with the state of the server, for people and scripts to tell
+// whether the pool keeps up with the tests.
+func (s *Server) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		JSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	JSON(w, http.StatusOK, StatusResponse{Pool: s.pool.Status()})
+}
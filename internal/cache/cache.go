@@ -0,0 +1,190 @@
+// Package cache manages what dbctl keeps on disk between runs, such as the dumps of
+// the template databases built from migrations.
+package cache
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// EnvDir overrides the directory the cache is kept in.
+const EnvDir = "DBCTL_CACHE_DIR"
+
+// Dir is the root of the cache, $DBCTL_CACHE_DIR or the dbctl directory of the
+// user cache directory, such as ~/.cache/dbctl.
+func Dir() (string, error) {
+	if dir := strings.TrimSpace(os.Getenv(EnvDir)); dir != "" {
+		return filepath.Abs(dir)
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("find cache directory failed, set $%s: %w", EnvDir, err)
+	}
+	return filepath.Join(dir, "dbctl"), nil
+}
+
+// TemplatesDir is where the dumps of template databases are kept.
+func TemplatesDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "templates"), nil
+}
+
+// TLSDir is where the certificates of the instances started with TLS are kept, in
+// a directory per instance.
+func TLSDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tls"), nil
+}
+
+// Export writes the content of dir to w as a gzipped tar archive, with names
+// relative to dir.
+func Export(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// an empty cache exports as an empty archive
+			if p == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipDir
+			}
+			return err
+		}
+
+		// files still being written are renamed into place once complete
+		if !d.Type().IsRegular() || strings.HasSuffix(d.Name(), ".tmp") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		// ownership means nothing on the machine the archive is imported on
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("export cache failed: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Import extracts an archive written by Export into dir, replacing the files it
+// holds and leaving the others in place. It returns the number of files imported.
+func Import(r io.Reader, dir string) (int, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, fmt.Errorf("import cache failed: %w", err)
+	}
+	defer func() {
+		_ = gz.Close()
+	}()
+
+	n := 0
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("import cache failed: %w", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name, err := entryPath(dir, hdr.Name)
+		if err != nil {
+			return n, err
+		}
+
+		if err := writeFile(name, tr); err != nil {
+			return n, fmt.Errorf("import %s failed: %w", hdr.Name, err)
+		}
+		n++
+	}
+}
+
+// entryPath is where the archive entry name goes in dir. Archives come from CI
+// caches and the like, an entry escaping dir is refused rather than written.
+func entryPath(dir, name string) (string, error) {
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("import cache failed: %q is outside of the cache", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// writeFile writes r to name through a temporary file, so that a dump is never
+// seen half written.
+func writeFile(name string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp := name + ".tmp"
+	// readable by all, the database containers reading the cache run as another user
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
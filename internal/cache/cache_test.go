@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"templates/abc.dump":     "first",
+		"templates/def.dump":     "second",
+		"templates/ghi.dump.tmp": "still being written",
+	} {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	n, err := Import(&buf, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 files imported, got %d", n)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dst, "templates", "def.dump"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "second" {
+		t.Fatalf("unexpected content %q", b)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "templates", "ghi.dump.tmp")); !os.IsNotExist(err) {
+		t.Fatal("expected files being written to be left out")
+	}
+}
+
+func TestExportOfAMissingCache(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Import(&buf, t.TempDir())
+	if err != nil || n != 0 {
+		t.Fatalf("expected an empty archive, got %d files, %v", n, err)
+	}
+}
+
+func TestImportRefusesEntriesOutsideOfTheCache(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	content := []byte("evil")
+	if err := tw.WriteHeader(&tar.Header{Name: "../outside.dump", Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "cache")
+	if _, err := Import(&buf, dir); err == nil {
+		t.Fatal("expected the entry to be refused")
+	}
+
+	if _, err := os.Stat(filepath.Join(parent, "outside.dump")); !os.IsNotExist(err) {
+		t.Fatal("expected nothing written outside of the cache")
+	}
+}
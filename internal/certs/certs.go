@@ -0,0 +1,267 @@
+// Package certs generates the throwaway certificates of the instances started with
+// TLS: an authority of their own, a certificate of the server signed by it and,
+// when asked for, one of a client.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/cache"
+	"github.com/mirzakhany/dbctl/internal/container"
+	"github.com/mirzakhany/dbctl/internal/database"
+)
+
+// The files Generate writes.
+const (
+	CAFile         = "ca.pem"
+	ServerCertFile = "server.pem"
+	ServerKeyFile  = "server-key.pem"
+	ClientCertFile = "client.pem"
+	ClientKeyFile  = "client-key.pem"
+
+	// the certificate and key in one file, the way mongodb takes them
+	ServerCombinedFile = "server-combined.pem"
+	ClientCombinedFile = "client-combined.pem"
+)
+
+// MountPath is where the certificates are mounted into containers. They are owned
+// by the user of the host there, the databases refuse keys they do not own.
+const MountPath = "/dbctl/tls-src"
+
+// Path is where InstallScript copies the certificates to.
+const Path = "/etc/dbctl/tls"
+
+// validity is how long the certificates are valid for. They are thrown away with
+// the instance, but an instance may run for a while.
+const validity = 90 * 24 * time.Hour
+
+// Hosts are the names the certificate of a server is valid for: the ones its
+// clients reach it by on the host and from other containers, and the address
+// ports are published on when it is a specific one.
+func Hosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1", "host.docker.internal"}
+	if ip := net.ParseIP(container.ListenAddress()); ip != nil && !ip.IsLoopback() && !ip.IsUnspecified() {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts
+}
+
+// Generate writes a new authority and a certificate of a server valid for hosts
+// to dir, and a certificate of the client clientName when one is given. The keys
+// are only readable by the user.
+func Generate(dir string, hosts []string, clientName string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create certificates directory failed: %w", err)
+	}
+
+	now := time.Now()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate key failed: %w", err)
+	}
+	caTemplate := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "dbctl throwaway authority"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := sign(caTemplate, caTemplate, caKey, caKey)
+	if err != nil {
+		return err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return fmt.Errorf("read authority failed: %w", err)
+	}
+	if err := writePEM(filepath.Join(dir, CAFile), 0o644, pemBlock("CERTIFICATE", caDER)); err != nil {
+		return err
+	}
+
+	server := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "dbctl"},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(validity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			server.IPAddresses = append(server.IPAddresses, ip)
+		} else {
+			server.DNSNames = append(server.DNSNames, h)
+		}
+	}
+	if err := issue(dir, server, ca, caKey, ServerCertFile, ServerKeyFile, ServerCombinedFile); err != nil {
+		return err
+	}
+
+	if clientName == "" {
+		return nil
+	}
+	client := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: clientName},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(validity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	return issue(dir, client, ca, caKey, ClientCertFile, ClientKeyFile, ClientCombinedFile)
+}
+
+// issue signs template with the authority and writes the certificate, its key and
+// both of them to the given files of dir.
+func issue(dir string, template, ca *x509.Certificate, caKey *ecdsa.PrivateKey, certFile, keyFile, combinedFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generate key failed: %w", err)
+	}
+
+	der, err := sign(template, ca, key, caKey)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("encode key failed: %w", err)
+	}
+
+	cert, keyPEM := pemBlock("CERTIFICATE", der), pemBlock("PRIVATE KEY", keyDER)
+	if err := writePEM(filepath.Join(dir, certFile), 0o644, cert); err != nil {
+		return err
+	}
+	if err := writePEM(filepath.Join(dir, keyFile), 0o600, keyPEM); err != nil {
+		return err
+	}
+	return writePEM(filepath.Join(dir, combinedFile), 0o600, cert, keyPEM)
+}
+
+func sign(template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number failed: %w", err)
+	}
+	template.SerialNumber = serial
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("sign certificate failed: %w", err)
+	}
+	return der, nil
+}
+
+func pemBlock(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
+
+func writePEM(path string, perm os.FileMode, blocks ...[]byte) error {
+	var content []byte
+	for _, b := range blocks {
+		content = append(content, b...)
+	}
+	if err := os.WriteFile(path, content, perm); err != nil {
+		return fmt.Errorf("write %s failed: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// New generates the certificates of the instance running in the container name,
+// with one of the client clientName when it is given. They are kept in the cache,
+// in a directory of the instance.
+func New(name, clientName string) (*database.TLS, error) {
+	root, err := cache.TLSDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(root, name)
+	if err := Generate(dir, Hosts(), clientName); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	ca, err := os.ReadFile(filepath.Join(dir, CAFile))
+	if err != nil {
+		return nil, fmt.Errorf("read certificate authority failed: %w", err)
+	}
+	return &database.TLS{Dir: dir, CA: string(ca), ClientCert: clientName != ""}, nil
+}
+
+// Remove removes the certificates of an instance once it is stopped. Only the
+// host they were generated on has them, elsewhere there is nothing to remove.
+func Remove(t *database.TLS) error {
+	if t == nil || t.Dir == "" {
+		return nil
+	}
+	return os.RemoveAll(t.Dir)
+}
+
+// Mount mounts the certificates of an instance at MountPath.
+func Mount(t *database.TLS) container.Mount {
+	return container.Mount{Source: t.Dir, Target: MountPath, ReadOnly: true}
+}
+
+// Command wraps cmd, the command of an image whose entrypoint is
+// docker-entrypoint.sh, so that the certificates are installed for user before
+// the entrypoint runs it.
+func Command(user string, cmd []string) []string {
+	return append([]string{"sh", "-c", InstallScript(user) + ` && exec docker-entrypoint.sh "$@"`, "sh"}, cmd...)
+}
+
+// InstallScript is a shell command copying the certificates mounted at MountPath
+// to Path, owned by user, the one the database runs as.
+func InstallScript(user string) string {
+	return fmt.Sprintf("mkdir -p %[1]s && cp %[2]s/* %[1]s/ && chown -R %[3]s %[1]s && chmod 600 %[1]s/*key.pem %[1]s/*combined.pem",
+		Path, MountPath, user)
+}
+
+// Pool returns a pool holding the authority caPEM, to verify servers with.
+func Pool(caPEM string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		return nil, errors.New("read certificate authority failed: no certificate found")
+	}
+	return pool, nil
+}
+
+// Prune removes the directories of root holding the certificates of instances no
+// longer running, the ones not named in running.
+func Prune(root string, running []string) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	keep := make(map[string]bool, len(running))
+	for _, name := range running {
+		keep[name] = true
+	}
+
+	var errs []error
+	for _, e := range entries {
+		if !e.IsDir() || keep[e.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, e.Name())); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,117 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dbctl_pg_1")
+	if err := Generate(dir, []string{"localhost", "127.0.0.1", "host.docker.internal"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := os.ReadFile(filepath.Join(dir, CAFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := Pool(string(ca))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := tls.LoadX509KeyPair(filepath.Join(dir, ServerCertFile), filepath.Join(dir, ServerKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{"localhost", "127.0.0.1", "host.docker.internal"} {
+		if _, err := server.Verify(x509.VerifyOptions{DNSName: host, Roots: pool}); err != nil {
+			t.Fatalf("server certificate is not valid for %s: %v", host, err)
+		}
+	}
+	if _, err := server.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: pool}); err == nil {
+		t.Fatal("server certificate is valid for a host it was not generated for")
+	}
+
+	// mongodb takes the certificate and the key in one file
+	if _, err := tls.LoadX509KeyPair(filepath.Join(dir, ServerCombinedFile), filepath.Join(dir, ServerCombinedFile)); err != nil {
+		t.Fatalf("combined server file does not hold the certificate and key: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, ServerKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("server key is readable by others, mode %s", info.Mode().Perm())
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ClientCertFile)); !os.IsNotExist(err) {
+		t.Fatalf("client certificate generated without being asked for: %v", err)
+	}
+}
+
+func TestGenerateClient(t *testing.T) {
+	dir := t.TempDir()
+	if err := Generate(dir, []string{"localhost"}, "postgres"); err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := os.ReadFile(filepath.Join(dir, CAFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := Pool(string(ca))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err := tls.LoadX509KeyPair(filepath.Join(dir, ClientCertFile), filepath.Join(dir, ClientKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// postgres matches the common name against the user connecting
+	if client.Subject.CommonName != "postgres" {
+		t.Fatalf("unexpected client common name %q", client.Subject.CommonName)
+	}
+	if _, err := client.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Fatalf("client certificate does not verify: %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"dbctl_pg_1", "dbctl_rs_2"} {
+		if err := os.Mkdir(filepath.Join(root, name), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Prune(root, []string{"dbctl_rs_2", "dbctl_api_3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "dbctl_pg_1")); !os.IsNotExist(err) {
+		t.Fatalf("certificates of a stopped instance were kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "dbctl_rs_2")); err != nil {
+		t.Fatalf("certificates of a running instance were removed: %v", err)
+	}
+
+	if err := Prune(filepath.Join(root, "missing"), nil); err != nil {
+		t.Fatalf("pruning a missing directory failed: %v", err)
+	}
+}
@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/mirzakhany/dbctl/internal/logger"
 )
@@ -35,6 +39,8 @@ func Run(ctx context.Context, req CreateRequest) (*Container, error) {
 		Env:          req.Env,
 		ExposedPorts: req.ExposedPorts,
 		Labels:       req.Labels,
+		Mounts:       req.Mounts,
+		Network:      req.Network,
 	})
 	if err != nil {
 		return nil, err
@@ -95,27 +101,37 @@ func CreateContainer(ctx context.Context, params CreateRequest) (string, error)
 		}
 	}
 
+	mounts := make([]mount.Mount, 0, len(params.Mounts))
+	for _, m := range params.Mounts {
+		mounts = append(mounts, mount.Mount{Type: mount.TypeBind, Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+
 	envs := make([]string, 0, len(params.Env))
 	for k, v := range params.Env {
 		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
 	}
 
+	var networking *network.NetworkingConfig
+	hostConfig := &container.HostConfig{
+		PortBindings: exposedPortMap,
+		Mounts:       mounts,
+		// containers reach services running on the host through
+		// host.docker.internal. Docker Desktop provides that name, on linux it
+		// has to be mapped to the gateway explicitly.
+		ExtraHosts: []string{"host.docker.internal:host-gateway"},
+	}
+	if params.Network != "" {
+		hostConfig.NetworkMode = container.NetworkMode(params.Network)
+		networking = &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{params.Network: {}}}
+	}
+
 	resp, err := cl.ContainerCreate(ctx, &container.Config{
 		Image:        params.Image,
 		Cmd:          params.Cmd,
 		Env:          envs,
 		Labels:       labels,
 		ExposedPorts: exposedPortSet,
-	}, &container.HostConfig{
-		PortBindings: exposedPortMap,
-		// containers reach services running on the host through
-		// host.docker.internal. Docker Desktop provides that name, on linux it
-		// has to be mapped to the gateway explicitly.
-		ExtraHosts: []string{"host.docker.internal:host-gateway"},
-	}, nil,
-		nil,
-		params.Name,
-	)
+	}, hostConfig, networking, nil, params.Name)
 	if err != nil {
 		return "", err
 	}
@@ -260,6 +276,56 @@ func RunExec(ctx context.Context, containerID string, cmd []string) (string, err
 	return StartExec(ctx, execID)
 }
 
+// Exec runs cmd in the container like RunExec, but fails when cmd does. The error
+// carries what cmd wrote to stderr, the output returned is what it wrote to stdout.
+func Exec(ctx context.Context, containerID string, cmd []string) (string, error) {
+	cl, closer, err := getDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer closer()
+
+	execID, err := CreateExec(ctx, containerID, cmd)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := cl.ContainerExecAttach(ctx, execID, types.ExecStartCheck{})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Close()
+
+	var stdout, stderr strings.Builder
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, resp.Reader); err != nil {
+		return "", err
+	}
+
+	inspect, err := cl.ContainerExecInspect(ctx, execID)
+	if err != nil {
+		return "", err
+	}
+
+	if inspect.ExitCode != 0 {
+		return stdout.String(), &ExecError{Cmd: cmd[0], ExitCode: inspect.ExitCode, Stderr: strings.TrimSpace(stderr.String())}
+	}
+	return stdout.String(), nil
+}
+
+// ExecError is returned by Exec when the command exits with a non zero code.
+type ExecError struct {
+	Cmd      string
+	ExitCode int
+	Stderr   string
+}
+
+func (e *ExecError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s exited with code %d", e.Cmd, e.ExitCode)
+	}
+	return fmt.Sprintf("%s exited with code %d: %s", e.Cmd, e.ExitCode, e.Stderr)
+}
+
 func isPortFree(port string) bool {
 	conn, err := net.DialTimeout("tcp", net.JoinHostPort("", port), 3*time.Second)
 	if err != nil {
@@ -282,3 +348,70 @@ func getDockerClient() (*client.Client, func(), error) {
 		_ = cli.Close()
 	}, nil
 }
+
+// CreateNetwork creates a bridge network for the containers of an instance to reach
+// each other on, by name.
+func CreateNetwork(ctx context.Context, name string, labels map[string]string) (string, error) {
+	cl, closer, err := getDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer closer()
+
+	all := map[string]string{LabelManagedBy: LabelDBctl}
+	for k, v := range labels {
+		all[k] = v
+	}
+
+	resp, err := cl.NetworkCreate(ctx, name, types.NetworkCreate{Driver: "bridge", Labels: all})
+	if err != nil {
+		return "", fmt.Errorf("create network %s failed: %w", name, err)
+	}
+	return resp.ID, nil
+}
+
+// RemoveNetwork removes a network by name or id, its containers have to be removed
+// first.
+func RemoveNetwork(ctx context.Context, name string) error {
+	cl, closer, err := getDockerClient()
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	return cl.NetworkRemove(ctx, name)
+}
+
+// PruneNetworks removes the networks created by dbctl no container is on anymore,
+// the ones left behind by instances stopped through their containers.
+func PruneNetworks(ctx context.Context) error {
+	cl, closer, err := getDockerClient()
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	_, err = cl.NetworksPrune(ctx, filters.NewArgs(filters.Arg("label", LabelManagedBy+"="+LabelDBctl)))
+	return err
+}
+
+// Logs writes the output of a container to stdout and stderr, and keeps writing
+// what it outputs until ctx is done when follow is set.
+func Logs(ctx context.Context, id string, follow bool, stdout, stderr io.Writer) error {
+	cl, closer, err := getDockerClient()
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	logs, err := cl.ContainerLogs(ctx, id, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: follow})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	if _, err := stdcopy.StdCopy(stdout, stderr, logs); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
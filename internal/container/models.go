@@ -19,6 +19,26 @@ const (
 	LabelUser = "dbctl_user"
 	LabelPass = "dbctl_pass"
 	LabelName = "dbctl_name"
+
+	// LabelRole tells the primary of an instance from its replicas, and
+	// LabelPrimaryPort names the port of the primary a replica follows.
+	LabelRole        = "dbctl_role"
+	LabelPrimaryPort = "dbctl_primary_port"
+	// LabelNetwork is the network the containers of an instance share.
+	LabelNetwork = "dbctl_network"
+
+	// The certificates of an instance started with TLS: the directory of the host
+	// holding them, the authority they are signed by, and whether there is one of
+	// a client.
+	LabelTLSDir    = "dbctl_tls_dir"
+	LabelTLSCA     = "dbctl_tls_ca"
+	LabelTLSClient = "dbctl_tls_client"
+)
+
+// The roles of the containers of an instance.
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
 )
 
 // EnvListen overrides the address published ports are bound to.
@@ -65,4 +85,19 @@ type CreateRequest struct {
 	Cmd          []string
 	Env          map[string]string
 	Labels       map[string]string
+	Mounts       []Mount
+	// Network is the docker network the container joins, next to the default
+	// bridge. Containers of a network reach each other by name.
+	Network string
+}
+
+// Mount binds a directory, or a file, of the host into a container. Unlike the volumes of the
+// container, it outlives the container.
+type Mount struct {
+	// Source is the absolute path of the directory on the host
+	Source string
+	// Target is where the directory appears inside the container
+	Target string
+	// ReadOnly keeps the container from changing what is mounted
+	ReadOnly bool
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -59,6 +60,49 @@ func ConnectionLabels(user, pass, name string, port uint32) map[string]string {
 	}
 }
 
+// TLS is where the certificates of an instance started with TLS are.
+type TLS struct {
+	// Dir is the directory of the host holding them, the files named as in
+	// package certs
+	Dir string
+	// CA is the certificate of the authority signing them, PEM encoded. The
+	// clients that can not read Dir, such as the api server, verify the
+	// instance with it.
+	CA string
+	// ClientCert is set when Dir holds the certificate of a client
+	ClientCert bool
+}
+
+// Authority returns the certificate of the authority, none without TLS.
+func (t *TLS) Authority() string {
+	if t == nil {
+		return ""
+	}
+	return t.CA
+}
+
+// TLSLabels records the certificates of an instance on the container running it,
+// none without TLS.
+func TLSLabels(t *TLS) map[string]string {
+	if t == nil {
+		return nil
+	}
+	return map[string]string{
+		container.LabelTLSDir:    t.Dir,
+		container.LabelTLSCA:     t.CA,
+		container.LabelTLSClient: strconv.FormatBool(t.ClientCert),
+	}
+}
+
+// tlsFromLabels reads back what TLSLabels recorded.
+func tlsFromLabels(labels map[string]string) *TLS {
+	if labels[container.LabelTLSCA] == "" {
+		return nil
+	}
+	client, _ := strconv.ParseBool(labels[container.LabelTLSClient])
+	return &TLS{Dir: labels[container.LabelTLSDir], CA: labels[container.LabelTLSCA], ClientCert: client}
+}
+
 // Instance is a running database instance and the details needed to connect to it.
 type Instance struct {
 	ID    string
@@ -69,6 +113,9 @@ type Instance struct {
 	User string
 	Pass string
 	Name string
+
+	// TLS is set for the instances started with TLS
+	TLS *TLS `json:",omitempty"`
 }
 
 // ErrNoInstance is returned when no running instance of a type can be found.
@@ -82,11 +129,20 @@ var ErrAmbiguousInstance = errors.New("more than one running instance")
 // have to know the port it was started on. When more than one is running the label
 // is what tells them apart.
 func FindInstance(ctx context.Context, dbType, label string) (*Instance, error) {
-	found, err := container.List(ctx, InstanceLabels(dbType, label))
+	listed, err := container.List(ctx, InstanceLabels(dbType, label))
 	if err != nil {
 		return nil, err
 	}
 
+	// the replicas of an instance are reached through it, they are not instances
+	// of their own
+	found := make([]*container.Container, 0, len(listed))
+	for _, c := range listed {
+		if c.Labels[container.LabelRole] != container.RoleReplica {
+			found = append(found, c)
+		}
+	}
+
 	if len(found) == 0 {
 		if label != "" {
 			return nil, fmt.Errorf("%w: no %s instance labelled %q, start one with 'dbctl start %s --label %s'",
@@ -112,6 +168,7 @@ func FindInstance(ctx context.Context, dbType, label string) (*Instance, error)
 		User:  c.Labels[container.LabelUser],
 		Pass:  c.Labels[container.LabelPass],
 		Name:  c.Labels[container.LabelName],
+		TLS:   tlsFromLabels(c.Labels),
 	}
 
 	// instances started by an older dbctl carry no connection labels, the caller
@@ -163,13 +220,117 @@ type CreateDBRequest struct {
 	Fixtures   string
 
 	WithDefaultMigrations bool
+
+	// RestrictedRole hands the database out with a role of its own rather than
+	// the credentials of the instance, for the types that have roles. Grants are
+	// the privileges of the role, SQL naming it :role, :"role" or :'role'; it owns
+	// the database when there are none.
+	RestrictedRole bool
+	Grants         string
+
+	// Isolation is what a database is handed out as, IsolationDatabase when empty
+	Isolation string
 }
 
+const (
+	// IsolationDatabase hands out a database of its own
+	IsolationDatabase = "database"
+	// IsolationSchema hands out a schema of a database shared with other tests,
+	// for the types that have schemas. It is cheaper to create than a database.
+	IsolationSchema = "schema"
+)
+
 type CreateDBResponse struct {
 	URI string
+	// ReplicaURIs reach the database on the replicas of the instance, for the
+	// types that have them
+	ReplicaURIs []string
+	// CA is the certificate of the authority to verify the instance with, PEM
+	// encoded, for the instances started with TLS
+	CA string
 }
 
 type Admin interface {
 	CreateDB(ctx context.Context, req *CreateDBRequest) (*CreateDBResponse, error)
 	RemoveDB(ctx context.Context, uri string) error
 }
+
+// Resetter is implemented by the database types that can return one of their
+// databases to the state it was created in, in place. It is much cheaper than
+// removing the database and creating it again.
+type Resetter interface {
+	// ResetDB removes the data of the database at uri, keeping what its migrations
+	// built, and applies the fixtures at the path given again
+	ResetDB(ctx context.Context, uri, fixtures string) error
+}
+
+// Snapshot is a named copy of a database, kept to return to the state it was taken
+// in later.
+type Snapshot struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Source is the database the snapshot was taken of, and the one restoring it
+	// goes to unless told otherwise
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ErrSnapshotNotFound is returned when no snapshot has the given name.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// ErrSnapshotExists is returned when a snapshot is created under a name in use.
+var ErrSnapshotExists = errors.New("snapshot already exists")
+
+// Snapshotter is implemented by the database types that can snapshot one of their
+// databases. A database is given by its name, or its index for redis, or by its
+// connection uri.
+type Snapshotter interface {
+	CreateSnapshot(ctx context.Context, name, db string) (*Snapshot, error)
+	// RestoreSnapshot replaces the content of db with the snapshot, db is the
+	// database the snapshot was taken of when empty
+	RestoreSnapshot(ctx context.Context, name, db string) error
+	// BranchSnapshot creates a new database holding the snapshot, removed like any
+	// other database created through Admin
+	BranchSnapshot(ctx context.Context, name string) (*CreateDBResponse, error)
+	Snapshots(ctx context.Context) ([]Snapshot, error)
+	RemoveSnapshot(ctx context.Context, name string) error
+}
+
+// maxSnapshotName keeps the name of a snapshot, with the prefix the database types
+// put in front of it, within the 63 bytes of a postgres identifier.
+const maxSnapshotName = 40
+
+// ValidateSnapshotName reports whether name can name a snapshot. Names end up in
+// database names and keys of every type, so they are kept to lower case letters,
+// digits, - and _.
+func ValidateSnapshotName(name string) error {
+	if name == "" {
+		return errors.New("snapshot name is required")
+	}
+
+	if len(name) > maxSnapshotName {
+		return fmt.Errorf("snapshot name %q is longer than %d characters", name, maxSnapshotName)
+	}
+
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return fmt.Errorf("snapshot name %q may only hold lower case letters, digits, - and _", name)
+		}
+	}
+	return nil
+}
+
+// scopedCondition matches a condition given to one table or collection, such as
+// `users: id < 100`. The :: of a cast is not a scope.
+var scopedCondition = regexp.MustCompile(`^\s*([A-Za-z_][\w$]*(?:\.[A-Za-z_][\w$]*)?)\s*:([^:].*)$`)
+
+// SplitCondition splits a condition of an export into the table or collection it is
+// scoped to and the condition itself. The scope is empty for a condition every one
+// of them is exported with.
+func SplitCondition(where string) (scope, condition string) {
+	m := scopedCondition.FindStringSubmatch(where)
+	if m == nil {
+		return "", strings.TrimSpace(where)
+	}
+	return m[1], strings.TrimSpace(m[2])
+}
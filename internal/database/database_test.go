@@ -0,0 +1,37 @@
+package database
+
+import "testing"
+
+func TestValidateSnapshotName(t *testing.T) {
+	for _, name := range []string{"before-migration", "step_2", "a"} {
+		if err := ValidateSnapshotName(name); err != nil {
+			t.Fatalf("%q: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "Upper", "with space", "semi;colon", "dots.are.out", "a-very-long-name-that-does-not-fit-in-postgres"} {
+		if err := ValidateSnapshotName(name); err == nil {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestSplitCondition(t *testing.T) {
+	cases := []struct {
+		in, scope, condition string
+	}{
+		{"users: id < 100", "users", "id < 100"},
+		{"billing.invoices:paid", "billing.invoices", "paid"},
+		{"created_at > now() - interval '1 day'", "", "created_at > now() - interval '1 day'"},
+		{"id::int > 3", "", "id::int > 3"},
+		{`{"active": true}`, "", `{"active": true}`},
+		{`users:{"active": true}`, "users", `{"active": true}`},
+	}
+
+	for _, tc := range cases {
+		scope, condition := SplitCondition(tc.in)
+		if scope != tc.scope || condition != tc.condition {
+			t.Fatalf("%q: expected %q and %q, got %q and %q", tc.in, tc.scope, tc.condition, scope, condition)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// AssertRequest picks the database AssertDB compares and the golden files it is
+// compared with.
+type AssertRequest struct {
+	// DB is the database to compare, by name, index or uri, the database of the
+	// instance when empty.
+	DB string
+	// Dir holds the golden files, in the formats fixtures are loaded in.
+	Dir string
+	// Ignore are the columns or fields left out of the comparison, `column` in every
+	// table and `table.column` in one. They are patterns of keys for redis.
+	Ignore []string
+	// Update rewrites the golden files with what the database holds, instead of
+	// comparing them.
+	Update bool
+}
+
+// Row is a row, document or key as it is compared: the value of each column as
+// text, nil for NULL.
+type Row map[string]any
+
+// The kinds of RowDiff.
+const (
+	// RowMissing is a row of a golden file the database does not hold
+	RowMissing = "missing"
+	// RowExtra is a row the database holds that no golden file has
+	RowExtra = "extra"
+	// RowChanged is a row the database holds with other values than its golden file
+	RowChanged = "changed"
+)
+
+// RowDiff is a row the database holds differently than its golden file.
+type RowDiff struct {
+	Kind     string `json:"kind"`
+	Expected Row    `json:"expected,omitempty"`
+	Actual   Row    `json:"actual,omitempty"`
+	// Columns are the columns a changed row differs in
+	Columns []string `json:"columns,omitempty"`
+}
+
+// TableDiff is a table, collection or set of keys whose content differs from its
+// golden file.
+type TableDiff struct {
+	Table string `json:"table"`
+	// File is the golden file of the table, relative to the directory of the golden
+	// files
+	File string `json:"file"`
+	// Key are the columns rows are matched by, rows without a key are matched by the
+	// values they have in common
+	Key  []string  `json:"key,omitempty"`
+	Rows []RowDiff `json:"rows"`
+}
+
+// Asserter is implemented by the database types whose content can be compared with
+// golden files.
+type Asserter interface {
+	// AssertDB returns the tables differing from their golden files, none when the
+	// database matches them, or rewrites the files when asked to
+	AssertDB(ctx context.Context, req AssertRequest) ([]TableDiff, error)
+}
+
+// Ignored reports whether column of table is in ignore, as a column of every table
+// or of this one. A table is named with or without its schema.
+func Ignored(ignore []string, table, column string) bool {
+	for _, i := range ignore {
+		scope, name := "", i
+		if n := strings.LastIndex(i, "."); n > 0 {
+			scope, name = i[:n], i[n+1:]
+		}
+		if name != column {
+			continue
+		}
+		if scope == "" || scope == table || strings.HasSuffix(table, "."+scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoredKey reports whether key matches a pattern of ignore, the glob-style
+// patterns of redis.
+func IgnoredKey(ignore []string, key string) bool {
+	for _, pattern := range ignore {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareRows compares the rows of a golden file with the ones of the database, only
+// on the columns each expected row has. Rows are matched by the columns of key when
+// given, by equal values otherwise: a row matching none exactly is taken for a
+// changed version of the row it shares the most values with.
+func CompareRows(expected, actual []Row, key []string) []RowDiff {
+	var out []RowDiff
+	used := make([]bool, len(actual))
+
+	if len(key) > 0 {
+		byKey := make(map[string]int, len(actual))
+		for i, row := range actual {
+			byKey[keyOf(row, key)] = i
+		}
+
+		for _, want := range expected {
+			i, ok := byKey[keyOf(want, key)]
+			if !ok || used[i] {
+				out = append(out, RowDiff{Kind: RowMissing, Expected: want})
+				continue
+			}
+			used[i] = true
+			if columns := changedColumns(want, actual[i]); len(columns) > 0 {
+				out = append(out, RowDiff{Kind: RowChanged, Expected: want, Actual: actual[i], Columns: columns})
+			}
+		}
+		return append(out, extraRows(actual, used)...)
+	}
+
+	var unmatched []Row
+	for _, want := range expected {
+		found := false
+		for i, got := range actual {
+			if !used[i] && len(changedColumns(want, got)) == 0 {
+				used[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, want)
+		}
+	}
+
+	for _, want := range unmatched {
+		best, shared := -1, 0
+		for i, got := range actual {
+			if used[i] {
+				continue
+			}
+			if n := len(want) - len(changedColumns(want, got)); n > shared {
+				best, shared = i, n
+			}
+		}
+		if best == -1 {
+			out = append(out, RowDiff{Kind: RowMissing, Expected: want})
+			continue
+		}
+		used[best] = true
+		out = append(out, RowDiff{Kind: RowChanged, Expected: want, Actual: actual[best], Columns: changedColumns(want, actual[best])})
+	}
+	return append(out, extraRows(actual, used)...)
+}
+
+func keyOf(row Row, key []string) string {
+	values := make([]any, 0, len(key))
+	for _, k := range key {
+		values = append(values, row[k])
+	}
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+// changedColumns returns the columns of want got has other values in, sorted.
+func changedColumns(want, got Row) []string {
+	var out []string
+	for column, v := range want {
+		if got[column] != v {
+			out = append(out, column)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func extraRows(actual []Row, used []bool) []RowDiff {
+	var out []RowDiff
+	for i, row := range actual {
+		if !used[i] {
+			out = append(out, RowDiff{Kind: RowExtra, Actual: row})
+		}
+	}
+	return out
+}
+
+// FormatDiff writes tables the way a failing test shows them: a line per table
+// counting its differences, then a line per row, - for a missing row, + for an
+// extra one and ~ for a changed one with the values it has instead. The files are
+// shown within dir.
+func FormatDiff(w io.Writer, dir string, tables []TableDiff) {
+	for _, t := range tables {
+		counts := map[string]int{}
+		for _, r := range t.Rows {
+			counts[r.Kind]++
+		}
+
+		var parts []string
+		for _, kind := range []string{RowMissing, RowExtra, RowChanged} {
+			if counts[kind] > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+			}
+		}
+		file := t.File
+		if dir != "" {
+			file = filepath.Join(dir, filepath.FromSlash(t.File))
+		}
+		_, _ = fmt.Fprintf(w, "%s (%s): %s\n", t.Table, file, strings.Join(parts, ", "))
+
+		for _, r := range t.Rows {
+			switch r.Kind {
+			case RowMissing:
+				_, _ = fmt.Fprintf(w, "  - %s\n", formatRow(r.Expected, t.Key))
+			case RowExtra:
+				_, _ = fmt.Fprintf(w, "  + %s\n", formatRow(r.Actual, t.Key))
+			default:
+				changes := make([]string, 0, len(r.Columns))
+				for _, c := range r.Columns {
+					changes = append(changes, fmt.Sprintf("%s %s => %s", c, formatValue(r.Expected[c]), formatValue(r.Actual[c])))
+				}
+				// a row is told by its key, or by the values it kept without one
+				label := Row{}
+				for c, v := range r.Expected {
+					if len(t.Key) == 0 || contains(t.Key, c) {
+						label[c] = v
+					}
+				}
+				for _, c := range r.Columns {
+					delete(label, c)
+				}
+				_, _ = fmt.Fprintf(w, "  ~ %s: %s\n", formatRow(label, t.Key), strings.Join(changes, ", "))
+			}
+		}
+	}
+}
+
+// formatRow writes the columns of row as column=value, the ones of key first.
+func formatRow(row Row, key []string) string {
+	columns := make([]string, 0, len(row))
+	for c := range row {
+		if !contains(key, c) {
+			columns = append(columns, c)
+		}
+	}
+	sort.Strings(columns)
+
+	parts := make([]string, 0, len(row))
+	for _, c := range append(append([]string{}, key...), columns...) {
+		if v, ok := row[c]; ok {
+			parts = append(parts, c+"="+formatValue(v))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatValue writes a value as it is, but quoted when it would not read back as
+// one: empty, spaced out or taken for NULL.
+func formatValue(v any) string {
+	if v == nil {
+		return "NULL"
+	}
+
+	s := fmt.Sprint(v)
+	if s == "" || s == "NULL" || strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}) != -1 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
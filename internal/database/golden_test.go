@@ -0,0 +1,106 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	ignore := []string{"created_at", "users.id", "billing.invoices.number"}
+
+	for _, c := range []struct {
+		table, column string
+		want          bool
+	}{
+		{"users", "created_at", true},
+		{"orders", "created_at", true},
+		{"users", "id", true},
+		{"public.users", "id", true},
+		{"orders", "id", false},
+		{"billing.invoices", "number", true},
+		{"invoices", "number", false},
+	} {
+		if got := Ignored(ignore, c.table, c.column); got != c.want {
+			t.Fatalf("Ignored(%s, %s) = %v", c.table, c.column, got)
+		}
+	}
+}
+
+func TestCompareRowsByKey(t *testing.T) {
+	expected := []Row{
+		{"id": "1", "name": "Alice"},
+		{"id": "2", "name": "Bob"},
+		{"id": "3", "name": "Carol"},
+	}
+	actual := []Row{
+		{"id": "1", "name": "Alice", "email": nil},
+		{"id": "2", "name": "Robert", "email": nil},
+		{"id": "4", "name": "Dave", "email": nil},
+	}
+
+	diff := CompareRows(expected, actual, []string{"id"})
+	if len(diff) != 3 {
+		t.Fatalf("unexpected diff %v", diff)
+	}
+	if diff[0].Kind != RowChanged || diff[0].Columns[0] != "name" || diff[0].Actual["name"] != "Robert" {
+		t.Fatalf("unexpected change %v", diff[0])
+	}
+	if diff[1].Kind != RowMissing || diff[1].Expected["id"] != "3" {
+		t.Fatalf("unexpected missing row %v", diff[1])
+	}
+	if diff[2].Kind != RowExtra || diff[2].Actual["id"] != "4" {
+		t.Fatalf("unexpected extra row %v", diff[2])
+	}
+}
+
+func TestCompareRowsWithoutKey(t *testing.T) {
+	expected := []Row{
+		{"name": "Alice", "city": "Paris"},
+		{"name": "Bob", "city": "Berlin"},
+		{"name": "Alice", "city": "Paris"},
+	}
+	actual := []Row{
+		{"name": "Bob", "city": "Vienna"},
+		{"name": "Alice", "city": "Paris"},
+	}
+
+	diff := CompareRows(expected, actual, nil)
+	if len(diff) != 2 {
+		t.Fatalf("unexpected diff %v", diff)
+	}
+	if diff[0].Kind != RowChanged || diff[0].Expected["name"] != "Bob" || diff[0].Columns[0] != "city" {
+		t.Fatalf("unexpected change %v", diff[0])
+	}
+	if diff[1].Kind != RowMissing || diff[1].Expected["name"] != "Alice" {
+		t.Fatalf("the duplicate row is not missing: %v", diff[1])
+	}
+
+	if diff := CompareRows(expected[:2], []Row{{"name": "Bob", "city": "Berlin"}, {"name": "Alice", "city": "Paris"}}, nil); len(diff) != 0 {
+		t.Fatalf("rows in another order differ: %v", diff)
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	tables := []TableDiff{{
+		Table: "users",
+		File:  "users.csv",
+		Key:   []string{"id"},
+		Rows: []RowDiff{
+			{Kind: RowMissing, Expected: Row{"id": "3", "name": "Carol Smith"}},
+			{Kind: RowExtra, Actual: Row{"id": "4", "name": "Dave", "email": nil}},
+			{Kind: RowChanged, Expected: Row{"id": "2", "name": "Bob"}, Actual: Row{"id": "2", "name": ""}, Columns: []string{"name"}},
+		},
+	}}
+
+	var b strings.Builder
+	FormatDiff(&b, "testdata/expected", tables)
+
+	want := `users (testdata/expected/users.csv): 1 missing, 1 extra, 1 changed
+  - id=3 name="Carol Smith"
+  + id=4 email=NULL name=Dave
+  ~ id=2: name Bob => ""
+`
+	if b.String() != want {
+		t.Fatalf("unexpected diff:\n%s", b.String())
+	}
+}
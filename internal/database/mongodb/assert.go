@@ -0,0 +1,205 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ database.Asserter = (*MongoDB)(nil)
+
+// AssertDB compares the collections of the golden files in req.Dir with the
+// documents of the database, or rewrites the files with them when req.Update is
+// set. Golden files are json fixtures, users.json holding the documents of users,
+// compared on their top level fields. A document leaving out a field is not
+// compared on it. Values are compared as relaxed extended json, an int and a long
+// of the same value are equal.
+func (m *MongoDB) AssertDB(ctx context.Context, req database.AssertRequest) ([]database.TableDiff, error) {
+	name, err := m.databaseName(req.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := listFiles(req.Dir, func(name string) bool {
+		return fixtures.HasExt(name, ".json")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read golden files failed: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no golden files in %s", req.Dir)
+	}
+
+	client, err := m.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB failed: %w", err)
+	}
+	defer client.Disconnect(ctx)
+	db := client.Database(name)
+
+	var out []database.TableDiff
+	for _, file := range files {
+		display := goldenName(req.Dir, file)
+		if req.Update && fixtures.IsTemplate(file) {
+			return nil, fmt.Errorf("golden file %s is a template, it can not be rewritten", display)
+		}
+
+		diff, err := assertCollection(ctx, db, req, file)
+		if err != nil {
+			return nil, fmt.Errorf("compare %s failed: %w", display, err)
+		}
+		if diff != nil {
+			diff.File = display
+			out = append(out, *diff)
+		}
+	}
+	return out, nil
+}
+
+func assertCollection(ctx context.Context, db *mongo.Database, req database.AssertRequest, file string) (*database.TableDiff, error) {
+	collection := strings.TrimSuffix(filepath.Base(fixtures.Name(file)), filepath.Ext(fixtures.Name(file)))
+	content, err := fixtures.ReadFile(file, fixtures.DefaultSeed)
+	if err != nil {
+		return nil, err
+	}
+	documents, err := parseDocuments(content)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := db.Collection(collection).Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var current []bson.D
+	for cur.Next(ctx) {
+		var doc bson.D
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		current = append(current, withoutIgnored(doc, req.Ignore, collection))
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	if req.Update {
+		return nil, writeGolden(file, current)
+	}
+
+	// the fields compared are the ones of the golden documents
+	fields := map[string]bool{}
+	expected := make([]database.Row, 0, len(documents))
+	for _, d := range documents {
+		row, err := documentRow(withoutIgnored(d.(bson.D), req.Ignore, collection), nil)
+		if err != nil {
+			return nil, err
+		}
+		for f := range row {
+			fields[f] = true
+		}
+		expected = append(expected, row)
+	}
+
+	actual := make([]database.Row, 0, len(current))
+	for _, d := range current {
+		row, err := documentRow(d, fields)
+		if err != nil {
+			return nil, err
+		}
+		actual = append(actual, row)
+	}
+
+	var key []string
+	if fields["_id"] {
+		key = []string{"_id"}
+	}
+
+	rows := database.CompareRows(expected, actual, key)
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &database.TableDiff{Table: collection, Key: key, Rows: rows}, nil
+}
+
+// withoutIgnored returns doc without the fields of collection in ignore.
+func withoutIgnored(doc bson.D, ignore []string, collection string) bson.D {
+	out := make(bson.D, 0, len(doc))
+	for _, e := range doc {
+		if !database.Ignored(ignore, collection, e.Key) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// documentRow returns the fields of doc as relaxed extended json, the ones of fields
+// only when given, a field doc leaves out as nil.
+func documentRow(doc bson.D, fields map[string]bool) (database.Row, error) {
+	row := database.Row{}
+	for f := range fields {
+		row[f] = nil
+	}
+
+	for _, e := range doc {
+		if fields != nil && !fields[e.Key] {
+			continue
+		}
+
+		// UnmarshalExtJSON only writes documents, the value is wrapped in one
+		b, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: e.Value}}, false, false)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", e.Key, err)
+		}
+		row[e.Key] = string(bytes.TrimSuffix(bytes.TrimPrefix(b, []byte(`{"v":`)), []byte("}")))
+	}
+	return row, nil
+}
+
+// writeGolden rewrites the golden file at file with documents, the way Export writes
+// them.
+func writeGolden(file string, documents []bson.D) error {
+	var b bytes.Buffer
+	b.WriteString("[")
+	for i, d := range documents {
+		doc, err := bson.MarshalExtJSON(d, false, false)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n  ")
+		b.Write(doc)
+	}
+	b.WriteString("\n]\n")
+
+	if err := os.WriteFile(file, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write %s failed: %w", file, err)
+	}
+	return nil
+}
+
+// goldenName is the path of a golden file within dir.
+func goldenName(dir, file string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return file
+	}
+	rel, err := filepath.Rel(abs, file)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return filepath.Base(file)
+	}
+	return filepath.ToSlash(rel)
+}
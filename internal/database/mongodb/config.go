@@ -1,6 +1,7 @@
 package mongodb
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -11,6 +12,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
 	"github.com/mirzakhany/dbctl/internal/utils"
 )
 
@@ -26,8 +29,21 @@ type config struct {
 	withUI bool
 	logger io.Writer
 
+	// dump is restored before the migrations
+	dump *dump
+
 	migrationsFiles []string
 	fixtureFiles    []string
+
+	// seed seeds the random source of the fixtures written as templates
+	seed int64
+
+	// tls starts the instance with TLS, with the certificate of a client too when
+	// tlsClientCert is set
+	tls           bool
+	tlsClientCert bool
+	// certs are the certificates of an instance started with TLS
+	certs *database.TLS
 }
 
 var (
@@ -67,6 +83,45 @@ func WithHost(user, pass, name string, port uint32) Option {
 	}
 }
 
+// WithInstance applies the connection details of a running instance to config.
+// Instances started by an older dbctl carry none, the defaults stay in place for
+// those.
+func WithInstance(i *database.Instance) Option {
+	return func(c *config) error {
+		if i == nil {
+			return nil
+		}
+		if i.Port != 0 {
+			c.port = i.Port
+		}
+		if i.User != "" {
+			c.user = i.User
+		}
+		if i.Pass != "" {
+			c.pass = i.Pass
+		}
+		if i.Name != "" {
+			c.name = i.Name
+		}
+		c.certs = i.TLS
+		return nil
+	}
+}
+
+// WithTLS starts the instance with TLS, with certificates generated for it and a
+// certificate of a client too when clientCert is set. The databases it hands out
+// connect with tls=true.
+func WithTLS(enabled, clientCert bool) Option {
+	return func(c *config) error {
+		if clientCert && !enabled {
+			return errors.New("a client certificate takes tls")
+		}
+		c.tls = enabled
+		c.tlsClientCert = clientCert
+		return nil
+	}
+}
+
 // WithURI applies the instance connection details found in a database uri to config.
 // The database name is deliberately left untouched: administrative commands have to run
 // against the maintenance database, not against the one being created or dropped.
@@ -150,10 +205,33 @@ func WithMigrations(path string) Option {
 	}
 }
 
+// WithDump restores the output of mongodump at path, a directory or an archive,
+// when the instance starts.
+func WithDump(path string) Option {
+	return func(c *config) error {
+		if path == "" {
+			return nil
+		}
+
+		// the dump is bind mounted, docker takes absolute paths only
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("invalid dump %q: %w", path, err)
+		}
+
+		d, err := readDump(abs)
+		if err != nil {
+			return err
+		}
+		c.dump = d
+		return nil
+	}
+}
+
 // WithFixtures applies selected fixtures to config
 func WithFixtures(path string) Option {
 	return func(c *config) error {
-		files, err := getFiles(path)
+		files, err := getFixtureFiles(path)
 		if err != nil {
 			return fmt.Errorf("read fixtures failed: %w", err)
 		}
@@ -162,7 +240,30 @@ func WithFixtures(path string) Option {
 	}
 }
 
+// WithSeed seeds the random source of the fixtures written as templates, the same
+// seed renders them into the same data.
+func WithSeed(seed int64) Option {
+	return func(c *config) error {
+		c.seed = seed
+		return nil
+	}
+}
+
 func getFiles(path string) ([]string, error) {
+	return listFiles(path, func(name string) bool {
+		return utils.OneOf(strings.ToLower(filepath.Ext(name)), ".js", ".json")
+	})
+}
+
+// getFixtureFiles returns the scripts in path along with the templates rendering
+// into scripts.
+func getFixtureFiles(path string) ([]string, error) {
+	return listFiles(path, func(name string) bool {
+		return fixtures.HasExt(name, ".js", ".json")
+	})
+}
+
+func listFiles(path string, keep func(name string) bool) ([]string, error) {
 	if len(path) == 0 {
 		return nil, nil
 	}
@@ -195,7 +296,7 @@ func getFiles(path string) ([]string, error) {
 
 		// only the scripts mongodb knows how to apply, a directory can hold a
 		// readme or a checked in .gitkeep next to the migrations.
-		if d.IsDir() || !utils.OneOf(strings.ToLower(filepath.Ext(d.Name())), ".js", ".json") {
+		if d.IsDir() || !keep(d.Name()) {
 			return nil
 		}
 
@@ -0,0 +1,143 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Schema is what a database tells about its collections.
+type Schema struct {
+	Database    string       `json:"database"`
+	Collections []Collection `json:"collections"`
+}
+
+// Collection is a collection, a view or a time series collection. The validator,
+// the keys of indexes and the pipeline of views are kept as extended json.
+type Collection struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	Documents int64   `json:"documents"`
+	Indexes   []Index `json:"indexes,omitempty"`
+	Validator string  `json:"validator,omitempty"`
+	ViewOn    string  `json:"view_on,omitempty"`
+	Pipeline  string  `json:"pipeline,omitempty"`
+}
+
+// Index is an index of a collection.
+type Index struct {
+	Name   string `json:"name"`
+	Keys   string `json:"keys"`
+	Unique bool   `json:"unique,omitempty"`
+	Sparse bool   `json:"sparse,omitempty"`
+	// TTL is the expireAfterSeconds of the index, 0 when documents do not expire
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// Schema reads the collections of db, by name or uri, the database of the instance
+// when empty.
+func (m *MongoDB) Schema(ctx context.Context, db string) (*Schema, error) {
+	name, err := m.databaseName(db)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := m.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB failed: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	return readSchema(ctx, client.Database(name))
+}
+
+// readSchema reads the collections of database, see Schema.
+func readSchema(ctx context.Context, database *mongo.Database) (*Schema, error) {
+	specs, err := database.ListCollectionSpecifications(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("list collections failed: %w", err)
+	}
+
+	s := &Schema{Database: database.Name(), Collections: make([]Collection, 0, len(specs))}
+	for _, spec := range specs {
+		if strings.HasPrefix(spec.Name, "system.") {
+			continue
+		}
+
+		c := Collection{Name: spec.Name, Type: spec.Type}
+		if v, err := spec.Options.LookupErr("validator"); err == nil {
+			c.Validator = extJSON(v)
+		}
+
+		if spec.Type == "view" {
+			if v, err := spec.Options.LookupErr("viewOn"); err == nil {
+				c.ViewOn = v.StringValue()
+			}
+			if v, err := spec.Options.LookupErr("pipeline"); err == nil {
+				c.Pipeline = extJSON(v)
+			}
+			s.Collections = append(s.Collections, c)
+			continue
+		}
+
+		coll := database.Collection(spec.Name)
+		if c.Documents, err = coll.EstimatedDocumentCount(ctx); err != nil {
+			return nil, fmt.Errorf("count documents of %s failed: %w", spec.Name, err)
+		}
+
+		cur, err := coll.Indexes().List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list indexes of %s failed: %w", spec.Name, err)
+		}
+
+		var indexes []bson.Raw
+		if err := cur.All(ctx, &indexes); err != nil {
+			return nil, fmt.Errorf("list indexes of %s failed: %w", spec.Name, err)
+		}
+		for _, raw := range indexes {
+			c.Indexes = append(c.Indexes, readIndex(raw))
+		}
+		s.Collections = append(s.Collections, c)
+	}
+
+	sort.Slice(s.Collections, func(i, j int) bool {
+		return s.Collections[i].Name < s.Collections[j].Name
+	})
+	return s, nil
+}
+
+func readIndex(raw bson.Raw) Index {
+	i := Index{}
+	if v, err := raw.LookupErr("name"); err == nil {
+		i.Name, _ = v.StringValueOK()
+	}
+	if v, err := raw.LookupErr("key"); err == nil {
+		i.Keys = extJSON(v)
+	}
+	if v, err := raw.LookupErr("unique"); err == nil {
+		i.Unique, _ = v.BooleanOK()
+	}
+	if v, err := raw.LookupErr("sparse"); err == nil {
+		i.Sparse, _ = v.BooleanOK()
+	}
+	if v, err := raw.LookupErr("expireAfterSeconds"); err == nil {
+		i.TTL, _ = v.AsInt64OK()
+	}
+	return i
+}
+
+// extJSON returns v as relaxed extended json, the way mongosh prints it.
+func extJSON(v bson.RawValue) string {
+	b, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, false, false)
+	if err != nil {
+		return v.String()
+	}
+	// the value was wrapped in a document, MarshalExtJSON only takes documents
+	s := strings.TrimSpace(string(b))
+	s = strings.TrimPrefix(s, `{"v":`)
+	return strings.TrimSuffix(s, "}")
+}
@@ -0,0 +1,101 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/container"
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// DumpMount is where the dump an instance is started from is mounted in the
+// mongodb container, read only. It is restored with the mongorestore of the image.
+const DumpMount = "/var/lib/dbctl/dump"
+
+// dump is the output of mongodump to restore into the instance when it starts,
+// either a directory or an archive, gzipped or not.
+type dump struct {
+	path    string
+	archive bool
+	gzip    bool
+}
+
+// target is where the dump appears inside the container.
+func (d dump) target() string {
+	if !d.archive {
+		return DumpMount
+	}
+	return DumpMount + "/" + filepath.Base(d.path)
+}
+
+// restoreCommand is the mongorestore command restoring the dump, its databases keep
+// the names they have in the dump.
+func (d dump) restoreCommand(user, pass string) []string {
+	cmd := []string{"mongorestore", "--username", user, "--password", pass, "--authenticationDatabase", "admin"}
+	if d.archive {
+		cmd = append(cmd, "--archive="+d.target())
+	} else {
+		cmd = append(cmd, "--dir", d.target())
+	}
+
+	if d.gzip {
+		cmd = append(cmd, "--gzip")
+	}
+	return cmd
+}
+
+func readDump(path string) (*dump, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("read dump failed: %w", err)
+	}
+
+	if stat.IsDir() {
+		// mongodump --gzip compresses every file of the directory
+		gzipped := false
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasSuffix(p, ".bson.gz") {
+				gzipped = true
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read dump failed: %w", err)
+		}
+		return &dump{path: path, gzip: gzipped}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read dump failed: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return nil, fmt.Errorf("read dump failed: %w", err)
+	}
+	return &dump{path: path, archive: true, gzip: bytes.Equal(head, []byte{0x1f, 0x8b})}, nil
+}
+
+// restoreDump restores the dump the instance was started with.
+func (m *MongoDB) restoreDump(ctx context.Context) error {
+	logger.Info(fmt.Sprintf("Restoring dump %s ...", m.cfg.dump.path))
+
+	if _, err := container.Exec(ctx, m.containerID, m.cfg.dump.restoreCommand(m.cfg.user, m.cfg.pass)); err != nil {
+		return fmt.Errorf("restore dump %s failed: %w", m.cfg.dump.path, err)
+	}
+	return nil
+}
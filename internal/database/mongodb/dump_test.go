@@ -0,0 +1,46 @@
+package mongodb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadDump(t *testing.T) {
+	dir := t.TempDir()
+
+	archive := filepath.Join(dir, "prod.archive.gz")
+	if err := os.WriteFile(archive, []byte{0x1f, 0x8b, 8, 0}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := readDump(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := strings.Join(d.restoreCommand("root", "secret"), " ")
+	if !strings.Contains(cmd, "--archive="+DumpMount+"/prod.archive.gz") || !strings.Contains(cmd, "--gzip") {
+		t.Fatalf("unexpected command %s", cmd)
+	}
+
+	out := filepath.Join(dir, "dump", "app")
+	if err := os.MkdirAll(out, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(out, "users.bson"), []byte{0}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = readDump(filepath.Join(dir, "dump"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mongorestore --gzip skips the bson files that are not compressed
+	cmd = strings.Join(d.restoreCommand("root", "secret"), " ")
+	if !strings.Contains(cmd, "--dir "+DumpMount) || strings.Contains(cmd, "--gzip") {
+		t.Fatalf("unexpected command %s", cmd)
+	}
+}
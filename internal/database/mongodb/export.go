@@ -0,0 +1,211 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ExportRequest picks what Export writes.
+type ExportRequest struct {
+	// DB is the database to export, by name or uri, the database of the instance
+	// when empty.
+	DB string
+	// Collections are the collections to export, every one but views when empty.
+	Collections []string
+	// Where are filters on the documents to export as extended json,
+	// `collection: {...}` for the documents of one collection and a plain filter
+	// for the ones of every collection.
+	Where []string
+	// Dir is the directory the fixtures are written to.
+	Dir string
+}
+
+// ExportedCollection is a collection Export wrote the documents of.
+type ExportedCollection struct {
+	Collection string
+	// File is empty for a collection without documents to export.
+	File      string
+	Documents int64
+}
+
+// Export writes the documents of the collections of a database as json fixtures,
+// users.json holding the documents of users, the way json fixtures are imported.
+// Documents are written as relaxed extended json, ids and dates are kept but a
+// small long is read back as an int.
+func (m *MongoDB) Export(ctx context.Context, req ExportRequest) ([]ExportedCollection, error) {
+	name, err := m.databaseName(req.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := m.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB failed: %w", err)
+	}
+	defer client.Disconnect(ctx)
+	db := client.Database(name)
+
+	collections, err := exportCollections(ctx, db, req.Collections)
+	if err != nil {
+		return nil, err
+	}
+	if len(collections) == 0 {
+		return nil, fmt.Errorf("no collections to export in %s", name)
+	}
+
+	filters, err := exportFilters(collections, req.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(req.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create export directory failed: %w", err)
+	}
+
+	out := make([]ExportedCollection, 0, len(collections))
+	for _, c := range collections {
+		file := filepath.Join(req.Dir, c+".json")
+		n, err := exportDocuments(ctx, db.Collection(c), filters[c], file)
+		if err != nil {
+			return nil, fmt.Errorf("export %s failed: %w", c, err)
+		}
+
+		e := ExportedCollection{Collection: c, Documents: n}
+		if n > 0 {
+			e.File = file
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// exportCollections returns names, checked to exist, or the collections of db but
+// views, which hold no documents of their own.
+func exportCollections(ctx context.Context, db *mongo.Database, names []string) ([]string, error) {
+	specs, err := db.ListCollectionSpecifications(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("list collections failed: %w", err)
+	}
+
+	existing := map[string]bool{}
+	var all []string
+	for _, spec := range specs {
+		if spec.Type == "view" || strings.HasPrefix(spec.Name, "system.") {
+			continue
+		}
+		existing[spec.Name] = true
+		all = append(all, spec.Name)
+	}
+
+	if len(names) == 0 {
+		sort.Strings(all)
+		return all, nil
+	}
+
+	out := make([]string, 0, len(names))
+	seen := map[string]bool{}
+	for _, n := range names {
+		if !existing[n] {
+			return nil, fmt.Errorf("collection %s does not exist", n)
+		}
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// exportFilters returns the filter on the documents of each collection, the filters
+// of where scoped to it and the ones of every collection joined with $and.
+func exportFilters(collections []string, where []string) (map[string]bson.D, error) {
+	exported := map[string]bool{}
+	for _, c := range collections {
+		exported[c] = true
+	}
+
+	parts := map[string]bson.A{}
+	for _, w := range where {
+		scope, condition := database.SplitCondition(w)
+
+		var filter bson.D
+		if err := bson.UnmarshalExtJSON([]byte(condition), false, &filter); err != nil {
+			return nil, fmt.Errorf("filter %q is not an extended json document: %w", w, err)
+		}
+
+		if scope == "" {
+			for _, c := range collections {
+				parts[c] = append(parts[c], filter)
+			}
+			continue
+		}
+		if !exported[scope] {
+			return nil, fmt.Errorf("filter %q is on %s, which is not exported", w, scope)
+		}
+		parts[scope] = append(parts[scope], filter)
+	}
+
+	out := make(map[string]bson.D, len(parts))
+	for c, filters := range parts {
+		if len(filters) == 1 {
+			out[c] = filters[0].(bson.D)
+			continue
+		}
+		out[c] = bson.D{{Key: "$and", Value: filters}}
+	}
+	return out, nil
+}
+
+// exportDocuments writes the documents of c matching filter to file, a json array
+// of a document per line ordered by _id. Nothing is written for a collection
+// without documents to export.
+func exportDocuments(ctx context.Context, c *mongo.Collection, filter bson.D, file string) (int64, error) {
+	if filter == nil {
+		filter = bson.D{}
+	}
+
+	cur, err := c.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	var b bytes.Buffer
+	var n int64
+	for cur.Next(ctx) {
+		doc, err := bson.MarshalExtJSON(cur.Current, false, false)
+		if err != nil {
+			return 0, err
+		}
+
+		if n == 0 {
+			b.WriteString("[\n  ")
+		} else {
+			b.WriteString(",\n  ")
+		}
+		b.Write(doc)
+		n++
+	}
+	if err := cur.Err(); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	b.WriteString("\n]\n")
+
+	if err := os.WriteFile(file, b.Bytes(), 0o644); err != nil {
+		return 0, fmt.Errorf("write %s failed: %w", file, err)
+	}
+	return n, nil
+}
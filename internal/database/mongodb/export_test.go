@@ -0,0 +1,60 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseDocuments(t *testing.T) {
+	documents, err := parseDocuments([]byte(`[
+  {"_id": {"$oid": "5f8f8c44b54764421b7156c9"}, "name": "Ada", "born": {"$date": "1815-12-10T00:00:00Z"}},
+  {"name": "Alan", "tags": ["a", "b"]}
+]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(documents) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(documents))
+	}
+
+	// the types of extended json are kept, a plain json document is one as well
+	first := documents[0].(bson.D).Map()
+	if _, ok := first["_id"].(primitive.ObjectID); !ok {
+		t.Fatalf("expected an ObjectID, got %T", first["_id"])
+	}
+	if _, ok := first["born"].(primitive.DateTime); !ok {
+		t.Fatalf("expected a DateTime, got %T", first["born"])
+	}
+	if name := documents[1].(bson.D).Map()["name"]; name != "Alan" {
+		t.Fatalf("expected Alan, got %v", name)
+	}
+
+	if _, err := parseDocuments([]byte(`{"name": "not an array"}`)); err == nil {
+		t.Fatal("expected a document that is not in an array to be rejected")
+	}
+}
+
+func TestExportFilters(t *testing.T) {
+	filters, err := exportFilters([]string{"users", "orders"}, []string{`{"deleted": false}`, `users: {"age": {"$gt": 18}}`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := bson.MarshalExtJSON(filters["users"], false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"$and":[{"deleted":false},{"age":{"$gt":18}}]}`; string(got) != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	if got, _ := bson.MarshalExtJSON(filters["orders"], false, false); string(got) != `{"deleted":false}` {
+		t.Fatalf("expected the filter of every collection for orders, got %s", got)
+	}
+
+	if _, err := exportFilters([]string{"users"}, []string{`orders: {}`}); err == nil {
+		t.Fatal("expected a filter on a collection that is not exported to be rejected")
+	}
+}
@@ -1,11 +1,12 @@
 package mongodb
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
 	"net/url"
@@ -15,10 +16,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mirzakhany/dbctl/internal/certs"
 	"github.com/mirzakhany/dbctl/internal/container"
 	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
 	"github.com/mirzakhany/dbctl/internal/logger"
 	"github.com/mirzakhany/dbctl/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -55,6 +59,7 @@ func New(options ...Option) (*MongoDB, error) {
 		name:    DefaultName,
 		port:    DefaultPort,
 		version: "7.0", // Default to latest version
+		seed:    fixtures.DefaultSeed,
 	}}
 
 	for _, o := range options {
@@ -96,17 +101,12 @@ func (m *MongoDB) CreateDB(ctx context.Context, req *database.CreateDBRequest) (
 	// Apply fixtures if they exist
 	if len(req.Fixtures) > 0 {
 		logger.Info("Applying fixtures to MongoDB...")
-		if err := applyFixturesFromDir(ctx, db, req.Fixtures); err != nil {
+		if err := applyFixturesFromDir(ctx, db, req.Fixtures, m.cfg.seed); err != nil {
 			return nil, fmt.Errorf("applying fixtures failed: %w", err)
 		}
 	}
 
-	// Make sure we return localhost instead of host.docker.internal
-	if os.Getenv("DBCTL_INSIDE_DOCKER") == "true" {
-		newURI = strings.ReplaceAll(newURI, "host.docker.internal", "localhost")
-	}
-
-	return &database.CreateDBResponse{URI: newURI}, nil
+	return &database.CreateDBResponse{URI: m.clientURI(newURI), CA: m.cfg.certs.Authority()}, nil
 }
 
 // RemoveDB removes a database from MongoDB by given URI
@@ -146,6 +146,13 @@ func (m *MongoDB) Start(ctx context.Context, detach bool) error {
 
 	logger.Info("MongoDB is up and running")
 
+	// the dump is restored first, migrations newer than it are applied on top
+	if m.cfg.dump != nil {
+		if err := m.restoreDump(ctx); err != nil {
+			return err
+		}
+	}
+
 	// Run migrations if they exist
 	if err := m.runMigrations(ctx); err != nil {
 		return err
@@ -157,7 +164,8 @@ func (m *MongoDB) Start(ctx context.Context, detach bool) error {
 	}
 
 	// Print connection URL
-	logger.Info(fmt.Sprintf("Database URI is: %q", m.URI()))
+	logger.Info(fmt.Sprintf("Database URI is: %q", m.clientURI(m.URI())))
+	m.logCertificates()
 
 	var mongoExpressCloseFunc database.CloseFunc
 	if m.cfg.withUI {
@@ -190,7 +198,10 @@ func (m *MongoDB) Start(ctx context.Context, detach bool) error {
 
 // Stop stops a MongoDB database
 func (m *MongoDB) Stop(ctx context.Context) error {
-	return container.TerminateByID(ctx, m.containerID)
+	if err := container.TerminateByID(ctx, m.containerID); err != nil {
+		return err
+	}
+	return certs.Remove(m.cfg.certs)
 }
 
 // WaitForStart waits for MongoDB to start
@@ -236,6 +247,53 @@ func Instances(ctx context.Context, label string) ([]database.Info, error) {
 	return out, nil
 }
 
+// Running returns a controller for the running mongodb instance, the one carrying
+// the given label when there are several.
+func Running(ctx context.Context, label string) (*MongoDB, error) {
+	instance, err := database.FindInstance(ctx, database.TypeMongoDB, label)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := New(WithInstance(instance))
+	if err != nil {
+		return nil, err
+	}
+
+	db.containerID = instance.ID
+	return db, nil
+}
+
+// RunningOrThrowaway returns the running mongodb instance, or starts a throwaway one
+// of version on a free port when none is running, for the commands that only need
+// an instance to apply migrations on. The returned func stops the throwaway
+// instance, whose logs go to logs.
+func RunningOrThrowaway(ctx context.Context, label, version string, logs io.Writer) (*MongoDB, func(), error) {
+	m, err := Running(ctx, label)
+	if err == nil {
+		return m, func() {}, nil
+	}
+	if !errors.Is(err, database.ErrNoInstance) || label != "" {
+		return nil, nil, err
+	}
+
+	m, err = New(
+		WithHost(DefaultUser, DefaultPass, DefaultName, uint32(utils.GetAvailablePort())),
+		WithVersion(version),
+		WithLogger(logs),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := m.Start(ctx, true); err != nil {
+		return nil, nil, err
+	}
+	return m, func() {
+		_ = m.Stop(ctx)
+	}, nil
+}
+
 func (m *MongoDB) startUsingDocker(ctx context.Context, timeout time.Duration) (database.CloseFunc, error) {
 	var rnd, err = rand.Int(rand.Reader, big.NewInt(20))
 	if err != nil {
@@ -268,15 +326,35 @@ func (m *MongoDB) startUsingDocker(ctx context.Context, timeout time.Duration) (
 		req.Labels[container.LabelCustom] = m.cfg.label
 	}
 
+	if m.cfg.dump != nil {
+		req.Mounts = append(req.Mounts, container.Mount{Source: m.cfg.dump.path, Target: m.cfg.dump.target(), ReadOnly: true})
+	}
+
+	if m.cfg.tls {
+		clientName := ""
+		if m.cfg.tlsClientCert {
+			clientName = m.cfg.user
+		}
+		if m.cfg.certs, err = certs.New(req.Name, clientName); err != nil {
+			return nil, err
+		}
+		req.Cmd = certs.Command("mongodb", append([]string{"mongod"}, tlsArgs()...))
+		req.Mounts = append(req.Mounts, certs.Mount(m.cfg.certs))
+		for k, v := range database.TLSLabels(m.cfg.certs) {
+			req.Labels[k] = v
+		}
+	}
+
 	mongo, err := container.Run(ctx, req)
 	if err != nil {
+		_ = certs.Remove(m.cfg.certs)
 		return nil, err
 	}
 
 	m.containerID = mongo.ID
 
 	closeFunc := func(ctx context.Context) error {
-		return mongo.Terminate(ctx)
+		return m.Stop(ctx)
 	}
 
 	return closeFunc, m.WaitForStart(ctx, timeout)
@@ -400,7 +478,7 @@ func (m *MongoDB) applyFixtures(ctx context.Context) error {
 
 	// Apply fixtures
 	for _, file := range m.cfg.fixtureFiles {
-		if err := applyJSScript(ctx, db, file); err != nil {
+		if err := applyFixture(ctx, db, file, m.cfg.seed); err != nil {
 			return fmt.Errorf("failed to apply fixture %s: %w", file, err)
 		}
 	}
@@ -432,12 +510,12 @@ func applyMigrationsFromDir(ctx context.Context, db *mongo.Database, dir string)
 }
 
 // Apply fixtures from a directory
-func applyFixturesFromDir(ctx context.Context, db *mongo.Database, dir string) error {
+func applyFixturesFromDir(ctx context.Context, db *mongo.Database, dir string, seed int64) error {
 	if dir == "" {
 		return nil
 	}
 
-	files, err := getFiles(dir)
+	files, err := getFixtureFiles(dir)
 	if err != nil {
 		return fmt.Errorf("read fixtures failed: %w", err)
 	}
@@ -446,7 +524,7 @@ func applyFixturesFromDir(ctx context.Context, db *mongo.Database, dir string) e
 
 	for _, file := range files {
 		logger.Info(fmt.Sprintf("Applying fixture: %s", filepath.Base(file)))
-		if err := applyJSScript(ctx, db, file); err != nil {
+		if err := applyFixture(ctx, db, file, seed); err != nil {
 			return fmt.Errorf("failed to apply fixture %s: %w", file, err)
 		}
 	}
@@ -454,6 +532,16 @@ func applyFixturesFromDir(ctx context.Context, db *mongo.Database, dir string) e
 	return nil
 }
 
+// applyFixture applies a fixture, rendering it with seed first when it is a template.
+// A template is applied as the script it renders into, users.json.tmpl as users.json.
+func applyFixture(ctx context.Context, db *mongo.Database, path string, seed int64) error {
+	content, err := fixtures.ReadFile(path, seed)
+	if err != nil {
+		return fmt.Errorf("failed to read script file: %w", err)
+	}
+	return applyScript(ctx, db, fixtures.Name(path), content)
+}
+
 // Apply a JavaScript script to the MongoDB database
 // This is used for both migrations and fixtures
 func applyJSScript(ctx context.Context, db *mongo.Database, scriptPath string) error {
@@ -462,7 +550,12 @@ func applyJSScript(ctx context.Context, db *mongo.Database, scriptPath string) e
 	if err != nil {
 		return fmt.Errorf("failed to read script file: %w", err)
 	}
+	return applyScript(ctx, db, scriptPath, content)
+}
 
+// applyScript applies the content of the script at scriptPath, picking how by its
+// extension.
+func applyScript(ctx context.Context, db *mongo.Database, scriptPath string, content []byte) error {
 	// For MongoDB, we need to run the JavaScript through the mongo shell
 	// We'll use the same container to run the mongo shell command
 
@@ -510,9 +603,10 @@ func applyJSScript(ctx context.Context, db *mongo.Database, scriptPath string) e
 		collName := filepath.Base(scriptPath)
 		collName = strings.TrimSuffix(collName, ext)
 
-		// Parse JSON file content
-		var documents []interface{}
-		if err := json.Unmarshal(content, &documents); err != nil {
+		// Parse JSON file content as extended json, so that ids and dates, such as
+		// the ones dbctl export writes, are inserted with their types
+		documents, err := parseDocuments(content)
+		if err != nil {
 			return fmt.Errorf("failed to parse JSON file: %w", err)
 		}
 
@@ -532,3 +626,21 @@ func applyJSScript(ctx context.Context, db *mongo.Database, scriptPath string) e
 
 	return nil
 }
+
+// parseDocuments parses a json array of documents as extended json. The array is
+// wrapped in a document on the way, since UnmarshalExtJSON only takes documents.
+func parseDocuments(content []byte) ([]interface{}, error) {
+	var wrapped struct {
+		Documents []bson.D `bson:"v"`
+	}
+	src := append(append([]byte(`{"v":`), bytes.TrimSpace(content)...), '}')
+	if err := bson.UnmarshalExtJSON(src, false, &wrapped); err != nil {
+		return nil, err
+	}
+
+	documents := make([]interface{}, 0, len(wrapped.Documents))
+	for _, d := range wrapped.Documents {
+		documents = append(documents, d)
+	}
+	return documents, nil
+}
@@ -0,0 +1,61 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var _ database.Resetter = (*MongoDB)(nil)
+
+// trackingCollections are the collections migration tools keep the migrations they
+// applied in, a reset keeps their documents.
+var trackingCollections = []string{
+	"schema_migrations", // golang-migrate
+	"changelog",         // migrate-mongo
+}
+
+// ResetDB deletes the documents of every collection of the database at uri and
+// applies the fixtures again. The collections stay, with the indexes and the
+// validators the migrations gave them.
+func (m *MongoDB) ResetDB(ctx context.Context, uri, fixtures string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+
+	dbName := strings.TrimPrefix(u.Path, "/")
+	if dbName == "" {
+		return fmt.Errorf("uri %q does not contain a database name", uri)
+	}
+
+	client, err := m.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect to MongoDB failed: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	db := client.Database(dbName)
+
+	// views hold no documents of their own, the system collections are the server's
+	names, err := db.ListCollectionNames(ctx, bson.M{"type": "collection", "name": bson.M{"$not": bson.M{"$regex": `^system\.`}}})
+	if err != nil {
+		return fmt.Errorf("list collections failed: %w", err)
+	}
+
+	for _, name := range names {
+		if utils.OneOf(name, trackingCollections...) {
+			continue
+		}
+		if _, err := db.Collection(name).DeleteMany(ctx, bson.M{}); err != nil {
+			return fmt.Errorf("reset collection %s failed: %w", name, err)
+		}
+	}
+
+	return applyFixturesFromDir(ctx, db, fixtures, m.cfg.seed)
+}
@@ -0,0 +1,294 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ database.Snapshotter = (*MongoDB)(nil)
+
+const (
+	// SnapshotPrefix starts the name of the database holding a snapshot, the name
+	// of the snapshot makes up the rest of it.
+	SnapshotPrefix = "dbctl_snap_"
+
+	// bookkeepingDB and snapshotsCollection keep what dbctl knows about the
+	// snapshots, a document per snapshot.
+	bookkeepingDB       = "dbctl"
+	snapshotsCollection = "snapshots"
+)
+
+type snapshotDoc struct {
+	Name      string    `bson:"_id"`
+	Source    string    `bson:"source"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func (d snapshotDoc) snapshot() database.Snapshot {
+	return database.Snapshot{Name: d.Name, Type: database.TypeMongoDB, Source: d.Source, CreatedAt: d.CreatedAt}
+}
+
+// CreateSnapshot copies the database db to a snapshot called name.
+func (m *MongoDB) CreateSnapshot(ctx context.Context, name, db string) (*database.Snapshot, error) {
+	if err := database.ValidateSnapshotName(name); err != nil {
+		return nil, err
+	}
+
+	source, err := m.databaseName(db)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := m.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB failed: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	// claiming the name first keeps two snapshots from being copied into one
+	doc := snapshotDoc{Name: name, Source: source, CreatedAt: time.Now().UTC()}
+	if _, err := client.Database(bookkeepingDB).Collection(snapshotsCollection).InsertOne(ctx, doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("%w: %q, remove it first", database.ErrSnapshotExists, name)
+		}
+		return nil, err
+	}
+
+	if err := copyDatabase(ctx, client, source, SnapshotPrefix+name); err != nil {
+		_ = client.Database(SnapshotPrefix + name).Drop(context.Background())
+		_, _ = client.Database(bookkeepingDB).Collection(snapshotsCollection).DeleteOne(context.Background(), bson.D{{Key: "_id", Value: name}})
+		return nil, fmt.Errorf("snapshot of %q failed: %w", source, err)
+	}
+
+	s := doc.snapshot()
+	return &s, nil
+}
+
+// RestoreSnapshot replaces the database db with a copy of the snapshot called name.
+func (m *MongoDB) RestoreSnapshot(ctx context.Context, name, db string) error {
+	client, err := m.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect to MongoDB failed: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	doc, err := findSnapshot(ctx, client, name)
+	if err != nil {
+		return err
+	}
+
+	target := doc.Source
+	if db != "" {
+		if target, err = m.databaseName(db); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Database(target).Drop(ctx); err != nil {
+		return fmt.Errorf("drop database failed: %w", err)
+	}
+
+	if err := copyDatabase(ctx, client, SnapshotPrefix+name, target); err != nil {
+		return fmt.Errorf("restore snapshot %q failed: %w", name, err)
+	}
+	return nil
+}
+
+// BranchSnapshot copies the snapshot called name to a new database.
+func (m *MongoDB) BranchSnapshot(ctx context.Context, name string) (*database.CreateDBResponse, error) {
+	client, err := m.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB failed: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	if _, err := findSnapshot(ctx, client, name); err != nil {
+		return nil, err
+	}
+
+	dbName := fmt.Sprintf("dbctl_%d", time.Now().UnixNano())
+	if err := copyDatabase(ctx, client, SnapshotPrefix+name, dbName); err != nil {
+		_ = client.Database(dbName).Drop(context.Background())
+		return nil, fmt.Errorf("branch snapshot %q failed: %w", name, err)
+	}
+
+	newDB, _ := New(WithHost(m.cfg.user, m.cfg.pass, dbName, m.cfg.port))
+	return &database.CreateDBResponse{URI: m.clientURI(newDB.URI()), CA: m.cfg.certs.Authority()}, nil
+}
+
+// Snapshots returns the snapshots of this instance, sorted by name.
+func (m *MongoDB) Snapshots(ctx context.Context) ([]database.Snapshot, error) {
+	client, err := m.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB failed: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	cur, err := client.Database(bookkeepingDB).Collection(snapshotsCollection).
+		Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots failed: %w", err)
+	}
+
+	var docs []snapshotDoc
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("list snapshots failed: %w", err)
+	}
+
+	out := make([]database.Snapshot, 0, len(docs))
+	for _, d := range docs {
+		out = append(out, d.snapshot())
+	}
+	return out, nil
+}
+
+// RemoveSnapshot drops the snapshot called name.
+func (m *MongoDB) RemoveSnapshot(ctx context.Context, name string) error {
+	client, err := m.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect to MongoDB failed: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	if _, err := findSnapshot(ctx, client, name); err != nil {
+		return err
+	}
+
+	if err := client.Database(SnapshotPrefix + name).Drop(ctx); err != nil {
+		return fmt.Errorf("drop database failed: %w", err)
+	}
+
+	_, err = client.Database(bookkeepingDB).Collection(snapshotsCollection).DeleteOne(ctx, bson.D{{Key: "_id", Value: name}})
+	return err
+}
+
+func findSnapshot(ctx context.Context, client *mongo.Client, name string) (*snapshotDoc, error) {
+	var doc snapshotDoc
+	err := client.Database(bookkeepingDB).Collection(snapshotsCollection).
+		FindOne(ctx, bson.D{{Key: "_id", Value: name}}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: no mongodb snapshot called %q", database.ErrSnapshotNotFound, name)
+		}
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// copyDatabase copies the collections of src, their indexes and its views to dst.
+// The documents never leave the server, $out writes them to dst directly.
+func copyDatabase(ctx context.Context, client *mongo.Client, src, dst string) error {
+	from, to := client.Database(src), client.Database(dst)
+
+	specs, err := from.ListCollectionSpecifications(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+
+	var views []*mongo.CollectionSpecification
+	for _, spec := range specs {
+		if strings.HasPrefix(spec.Name, "system.") {
+			continue
+		}
+
+		// views are created once the collections they read from exist
+		if spec.Type == "view" {
+			views = append(views, spec)
+			continue
+		}
+
+		if err := to.CreateCollection(ctx, spec.Name); err != nil {
+			return fmt.Errorf("create collection %s failed: %w", spec.Name, err)
+		}
+
+		out := bson.D{{Key: "$out", Value: bson.D{{Key: "db", Value: dst}, {Key: "coll", Value: spec.Name}}}}
+		cur, err := from.Collection(spec.Name).Aggregate(ctx, mongo.Pipeline{out})
+		if err != nil {
+			return fmt.Errorf("copy collection %s failed: %w", spec.Name, err)
+		}
+		_ = cur.Close(ctx)
+
+		if err := copyIndexes(ctx, from.Collection(spec.Name), to); err != nil {
+			return err
+		}
+	}
+
+	for _, spec := range views {
+		var opts struct {
+			ViewOn   string `bson:"viewOn"`
+			Pipeline bson.A `bson:"pipeline"`
+		}
+		if err := bson.Unmarshal(spec.Options, &opts); err != nil {
+			return fmt.Errorf("read view %s failed: %w", spec.Name, err)
+		}
+
+		if err := to.CreateView(ctx, spec.Name, opts.ViewOn, opts.Pipeline); err != nil {
+			return fmt.Errorf("create view %s failed: %w", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+// copyIndexes creates the indexes of coll, but the one every collection has on _id,
+// on the collection of the same name in dst.
+func copyIndexes(ctx context.Context, coll *mongo.Collection, dst *mongo.Database) error {
+	cur, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return fmt.Errorf("list indexes of %s failed: %w", coll.Name(), err)
+	}
+
+	var specs []bson.M
+	if err := cur.All(ctx, &specs); err != nil {
+		return fmt.Errorf("list indexes of %s failed: %w", coll.Name(), err)
+	}
+
+	indexes := make(bson.A, 0, len(specs))
+	for _, spec := range specs {
+		if spec["name"] == "_id_" {
+			continue
+		}
+		delete(spec, "ns")
+		indexes = append(indexes, spec)
+	}
+
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	cmd := bson.D{{Key: "createIndexes", Value: coll.Name()}, {Key: "indexes", Value: indexes}}
+	if err := dst.RunCommand(ctx, cmd).Err(); err != nil {
+		return fmt.Errorf("create indexes of %s failed: %w", coll.Name(), err)
+	}
+	return nil
+}
+
+// databaseName is the name of the database db stands for, either a name or a
+// connection uri.
+func (m *MongoDB) databaseName(db string) (string, error) {
+	if strings.Contains(db, "://") {
+		u, err := url.Parse(db)
+		if err != nil {
+			return "", fmt.Errorf("parse database uri failed: %w", err)
+		}
+		db = strings.TrimPrefix(u.Path, "/")
+	}
+
+	if db == "" {
+		db = m.cfg.name
+	}
+
+	// admin is where the users of the instance live, not data
+	if db == "" || db == "admin" {
+		return "", errors.New("name the mongodb database, such as with --db")
+	}
+	return db, nil
+}
@@ -0,0 +1,282 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Baseline is the result of squashing migrations.
+type Baseline struct {
+	// Script creates the collections, views, indexes and validators the
+	// migrations do, for mongosh.
+	Script []byte
+	// Files are the migrations squashed, relative to their directory.
+	Files []string
+}
+
+// Squash applies the migrations at path to a new database and writes a script
+// creating its collections, views, indexes and validators. The script is then run
+// on another database and both are compared: the baseline is only returned when it
+// creates what the migrations do. Documents the migrations insert are left out.
+func (m *MongoDB) Squash(ctx context.Context, path string) (*Baseline, error) {
+	files, err := getFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations failed: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no migrations found in %s", path)
+	}
+
+	client, err := m.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB failed: %w", err)
+	}
+	defer client.Disconnect(ctx)
+
+	stamp := time.Now().UnixNano()
+	replay := client.Database(fmt.Sprintf("dbctl_squash_%d", stamp))
+	check := client.Database(fmt.Sprintf("dbctl_squash_check_%d", stamp))
+	defer func() {
+		for _, db := range []*mongo.Database{replay, check} {
+			if err := db.Drop(context.Background()); err != nil {
+				logger.Warn(fmt.Sprintf("drop database %s failed: %s", db.Name(), err))
+			}
+		}
+	}()
+
+	if err := applyMigrationsFromDir(ctx, replay, path); err != nil {
+		return nil, fmt.Errorf("applying migrations failed: %w", err)
+	}
+
+	script, err := baselineScript(ctx, replay)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Baseline{Files: make([]string, 0, len(files))}
+	for _, f := range files {
+		b.Files = append(b.Files, displayName(path, f))
+	}
+	b.Script = []byte(fmt.Sprintf("// Baseline of %d migrations, %s to %s, written by dbctl squash.\n// It creates the collections, indexes and validators applying them does.\n\n%s",
+		len(b.Files), b.Files[0], b.Files[len(b.Files)-1], script))
+
+	if err := applyScript(ctx, check, "baseline.js", b.Script); err != nil {
+		return nil, fmt.Errorf("the baseline does not apply: %w", err)
+	}
+
+	if err := sameSchemas(ctx, replay, check); err != nil {
+		return nil, fmt.Errorf("the baseline does not create what the migrations do: %w", err)
+	}
+	return b, nil
+}
+
+// displayName is the name of a migration relative to the migrations directory.
+func displayName(root, file string) string {
+	if rel, err := filepath.Rel(root, file); err == nil && !strings.HasPrefix(rel, "..") && rel != "." {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.Base(file)
+}
+
+// baselineScript writes the mongosh statements creating the collections, views and
+// indexes of db. Options and keys go through EJSON.parse, so that the types of
+// extended json, such as dates and longs in a validator, are kept.
+func baselineScript(ctx context.Context, db *mongo.Database) (string, error) {
+	specs, err := db.ListCollectionSpecifications(ctx, bson.D{})
+	if err != nil {
+		return "", fmt.Errorf("list collections failed: %w", err)
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Name < specs[j].Name
+	})
+
+	var b strings.Builder
+	var views []*mongo.CollectionSpecification
+	for _, spec := range specs {
+		if strings.HasPrefix(spec.Name, "system.") {
+			continue
+		}
+		if spec.Type == "view" {
+			views = append(views, spec)
+			continue
+		}
+
+		opts, err := canonicalJSON(bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: spec.Options})
+		if err != nil {
+			return "", err
+		}
+		_, _ = fmt.Fprintf(&b, "db.createCollection(%s, EJSON.parse(%s));\n", jsString(spec.Name), jsString(opts))
+
+		cur, err := db.Collection(spec.Name).Indexes().List(ctx)
+		if err != nil {
+			return "", fmt.Errorf("list indexes of %s failed: %w", spec.Name, err)
+		}
+		var indexes []bson.Raw
+		if err := cur.All(ctx, &indexes); err != nil {
+			return "", fmt.Errorf("list indexes of %s failed: %w", spec.Name, err)
+		}
+
+		for _, raw := range indexes {
+			keys, options, err := indexSpec(raw)
+			if err != nil {
+				return "", err
+			}
+			// the index on _id comes with the collection
+			if options == "" {
+				continue
+			}
+			_, _ = fmt.Fprintf(&b, "db.getCollection(%s).createIndex(EJSON.parse(%s), EJSON.parse(%s));\n",
+				jsString(spec.Name), jsString(keys), jsString(options))
+		}
+		b.WriteString("\n")
+	}
+
+	// a view may be a view on another view, created before it
+	created := map[string]bool{}
+	for _, spec := range specs {
+		if spec.Type != "view" {
+			created[spec.Name] = true
+		}
+	}
+	for len(views) > 0 {
+		var next []*mongo.CollectionSpecification
+		for _, spec := range views {
+			on, _ := spec.Options.Lookup("viewOn").StringValueOK()
+			if !created[on] && containsView(views, on) {
+				next = append(next, spec)
+				continue
+			}
+
+			pipeline := "[]"
+			if v, err := spec.Options.LookupErr("pipeline"); err == nil {
+				if pipeline, err = canonicalJSON(v); err != nil {
+					return "", err
+				}
+			}
+			_, _ = fmt.Fprintf(&b, "db.createView(%s, %s, EJSON.parse(%s));\n", jsString(spec.Name), jsString(on), jsString(pipeline))
+			created[spec.Name] = true
+		}
+		if len(next) == len(views) {
+			return "", fmt.Errorf("views %s refer to each other", viewNames(next))
+		}
+		views = next
+	}
+	return b.String(), nil
+}
+
+// indexSpec returns the keys and the options of an index as canonical extended json.
+// The options are empty for the index on _id.
+func indexSpec(raw bson.Raw) (string, string, error) {
+	name, _ := raw.Lookup("name").StringValueOK()
+	keys, err := canonicalJSON(raw.Lookup("key"))
+	if err != nil {
+		return "", "", err
+	}
+	if name == "_id_" {
+		return keys, "", nil
+	}
+
+	elems, err := raw.Elements()
+	if err != nil {
+		return "", "", err
+	}
+	var opts bson.D
+	for _, e := range elems {
+		switch e.Key() {
+		// the version and namespace belong to the server, not to the index
+		case "v", "key", "ns":
+			continue
+		}
+		opts = append(opts, bson.E{Key: e.Key(), Value: e.Value()})
+	}
+
+	b, err := bson.MarshalExtJSON(opts, true, false)
+	if err != nil {
+		return "", "", err
+	}
+	return keys, string(b), nil
+}
+
+// canonicalJSON returns v as canonical extended json, wrapped in a document on the
+// way since MarshalExtJSON only takes documents.
+func canonicalJSON(v bson.RawValue) (string, error) {
+	b, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, true, false)
+	if err != nil {
+		return "", err
+	}
+	s := strings.TrimPrefix(string(b), `{"v":`)
+	return strings.TrimSuffix(s, "}"), nil
+}
+
+// jsString quotes s as a javascript string, json strings are.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func containsView(views []*mongo.CollectionSpecification, name string) bool {
+	for _, v := range views {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func viewNames(views []*mongo.CollectionSpecification) string {
+	names := make([]string, 0, len(views))
+	for _, v := range views {
+		names = append(names, v.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// sameSchemas returns an error naming the collections a and b differ in.
+func sameSchemas(ctx context.Context, a, b *mongo.Database) error {
+	sa, err := readSchema(ctx, a)
+	if err != nil {
+		return err
+	}
+	sb, err := readSchema(ctx, b)
+	if err != nil {
+		return err
+	}
+
+	collections := func(s *Schema) map[string]Collection {
+		out := map[string]Collection{}
+		for _, c := range s.Collections {
+			// documents are not part of the baseline
+			c.Documents = 0
+			out[c.Name] = c
+		}
+		return out
+	}
+	ca, cb := collections(sa), collections(sb)
+
+	var differ []string
+	for name, c := range ca {
+		if other, ok := cb[name]; !ok || !reflect.DeepEqual(c, other) {
+			differ = append(differ, name)
+		}
+	}
+	for name := range cb {
+		if _, ok := ca[name]; !ok {
+			differ = append(differ, name)
+		}
+	}
+	if len(differ) > 0 {
+		sort.Strings(differ)
+		return fmt.Errorf("collections %s differ", strings.Join(differ, ", "))
+	}
+	return nil
+}
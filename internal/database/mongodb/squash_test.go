@@ -0,0 +1,45 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexSpec(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "v", Value: int32(2)},
+		{Key: "key", Value: bson.D{{Key: "email", Value: int32(1)}, {Key: "created_at", Value: int32(-1)}}},
+		{Key: "name", Value: "email_1_created_at_-1"},
+		{Key: "unique", Value: true},
+		{Key: "expireAfterSeconds", Value: int64(3600)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, opts, err := indexSpec(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the order of keys is the order of the index, and the types of values are kept
+	if want := `{"email":{"$numberInt":"1"},"created_at":{"$numberInt":"-1"}}`; keys != want {
+		t.Fatalf("expected keys %s, got %s", want, keys)
+	}
+	if want := `{"name":"email_1_created_at_-1","unique":true,"expireAfterSeconds":{"$numberLong":"3600"}}`; opts != want {
+		t.Fatalf("expected options %s, got %s", want, opts)
+	}
+
+	raw, err = bson.Marshal(bson.D{
+		{Key: "v", Value: int32(2)},
+		{Key: "key", Value: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Key: "name", Value: "_id_"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, opts, err := indexSpec(raw); err != nil || opts != "" {
+		t.Fatalf("expected no options for the index on _id, got %q, %v", opts, err)
+	}
+}
@@ -0,0 +1,65 @@
+package mongodb
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/certs"
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// tlsArgs are the arguments of mongod on an instance started with TLS. It prefers
+// TLS without requiring it, the clients it hands databases out to connect with it
+// while dbctl itself keeps connecting without. Certificates of clients are taken
+// when they present one.
+func tlsArgs() []string {
+	return []string{
+		"--tlsMode", "preferTLS",
+		"--tlsCertificateKeyFile", path.Join(certs.Path, certs.ServerCombinedFile),
+		"--tlsCAFile", path.Join(certs.Path, certs.CAFile),
+		"--tlsAllowConnectionsWithoutCertificates",
+	}
+}
+
+// clientURI is uri as it is handed out: reachable by the caller and, on an instance
+// started with TLS, verifying the server with the authority of the instance and
+// presenting the certificate of the client when there is one.
+func (m *MongoDB) clientURI(uri string) string {
+	// the api server reaches the instance through host.docker.internal, its
+	// clients run outside docker
+	if os.Getenv("DBCTL_INSIDE_DOCKER") == "true" {
+		uri = strings.ReplaceAll(uri, "host.docker.internal", "localhost")
+	}
+	if m.cfg.certs == nil {
+		return uri
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	q := u.Query()
+	q.Set("tls", "true")
+	q.Set("tlsCAFile", filepath.Join(m.cfg.certs.Dir, certs.CAFile))
+	if m.cfg.certs.ClientCert {
+		q.Set("tlsCertificateKeyFile", filepath.Join(m.cfg.certs.Dir, certs.ClientCombinedFile))
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// logCertificates tells where the certificates of an instance started with TLS
+// are, for the clients not given a uri by dbctl.
+func (m *MongoDB) logCertificates() {
+	if m.cfg.certs == nil {
+		return
+	}
+	logger.Info("Connections are verified with the certificate authority at " + filepath.Join(m.cfg.certs.Dir, certs.CAFile))
+	if m.cfg.certs.ClientCert {
+		logger.Info("The certificate of the client and its key are at " + filepath.Join(m.cfg.certs.Dir, certs.ClientCombinedFile))
+	}
+}
@@ -0,0 +1,337 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
+	"gopkg.in/yaml.v3"
+)
+
+var _ database.Asserter = (*Postgres)(nil)
+
+// goldenOrdinal numbers the rows of a golden file as they are copied, to tell which
+// columns each of them left out.
+const goldenOrdinal = "dbctl_golden_row"
+
+// AssertDB compares the tables of the golden files in req.Dir with the rows of the
+// database, or rewrites the files with them when req.Update is set. Golden files are
+// table fixtures: a csv, json or yaml file per table, compared on the columns it
+// lists. A row leaving out a column is not compared on it.
+//
+// The values of a golden file are loaded into a temporary copy of its table and read
+// back as text like the rows of the table, so that 1.50 and 1.5 or two spellings of
+// the same timestamp are the same value.
+func (p *Postgres) AssertDB(ctx context.Context, req database.AssertRequest) ([]database.TableDiff, error) {
+	name, err := p.databaseName(req.DB)
+	if err != nil {
+		return nil, err
+	}
+	target, err := p.database(name)
+	if err != nil {
+		return nil, err
+	}
+
+	targetURI := target.URI()
+	if u, err := url.Parse(req.DB); err == nil && strings.Contains(req.DB, "://") {
+		if schema := schemaOf(u); schema != "" {
+			targetURI = withSchema(targetURI, schema)
+		}
+	}
+
+	files, err := getFixtureFiles(req.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read golden files failed: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no golden files in %s", req.Dir)
+	}
+	for _, file := range files {
+		if !isTableFixture(file) {
+			return nil, fmt.Errorf("golden file %s is not a csv, json or yaml table fixture", displayName(req.Dir, file))
+		}
+		if req.Update && fixtures.IsTemplate(file) {
+			return nil, fmt.Errorf("golden file %s is a template, it can not be rewritten", displayName(req.Dir, file))
+		}
+	}
+
+	conn, err := dbConnect(ctx, targetURI)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// the temporary tables go with the transaction, it is never committed
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var out []database.TableDiff
+	for i, file := range files {
+		diff, err := assertTable(ctx, tx, req, file, fmt.Sprintf("dbctl_golden_%d", i))
+		if err != nil {
+			return nil, fmt.Errorf("compare %s failed: %w", displayName(req.Dir, file), err)
+		}
+		if diff != nil {
+			out = append(out, *diff)
+		}
+	}
+	return out, nil
+}
+
+// assertTable compares the table of the golden file at file, or rewrites the file,
+// loading the golden rows into the temporary table tmp.
+func assertTable(ctx context.Context, tx *sql.Tx, req database.AssertRequest, file, tmp string) (*database.TableDiff, error) {
+	fixture, err := readTableFixture(file, fixtures.DefaultSeed)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := resolveTable(ctx, tx, fixture)
+	if err != nil {
+		return nil, err
+	}
+
+	tableName := table.name
+	if table.schema != "public" {
+		tableName = table.schema + "." + table.name
+	}
+
+	var columns []tableColumn
+	for _, col := range fixture.columns {
+		c := table.columns[col]
+		if !database.Ignored(req.Ignore, tableName, c.name) {
+			columns = append(columns, c)
+		}
+	}
+
+	_, primaryKey, err := exportColumns(ctx, tx, table.oid)
+	if err != nil {
+		return nil, err
+	}
+	key := primaryKey
+	for _, k := range primaryKey {
+		if !hasColumn(columns, k) {
+			key = nil
+			break
+		}
+	}
+
+	// rows without a key are ordered by every column, the same rows are written in
+	// the same order
+	order := key
+	if len(order) == 0 {
+		for _, c := range columns {
+			order = append(order, c.name)
+		}
+	}
+
+	actual, err := goldenRows(ctx, tx, table.qualifiedName(), columns, order)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Update {
+		return nil, writeGolden(file, fixture, tableName, columns, actual)
+	}
+
+	expected, err := loadGolden(ctx, tx, table, columns, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := database.CompareRows(expected, actual, key)
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &database.TableDiff{Table: tableName, File: displayName(req.Dir, file), Key: key, Rows: rows}, nil
+}
+
+// loadGolden copies the rows of the golden file of table into the temporary table
+// tmp, of the columns of the table the file lists, and reads them back. Each row
+// keeps only the columns its line or object sets.
+func loadGolden(ctx context.Context, tx *sql.Tx, table *loadedTable, columns []tableColumn, tmp string) ([]database.Row, error) {
+	names := make([]string, 0, len(table.fixture.columns))
+	for _, col := range table.fixture.columns {
+		names = append(names, quoteIdentifier(table.columns[col].name))
+	}
+
+	// created without the constraints of the table, a golden row may leave out a
+	// column that is not null
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("create temp table %s as select %s from %s with no data",
+		quoteIdentifier(tmp), strings.Join(names, ", "), table.qualifiedName())); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("alter table %s add column %s bigserial",
+		quoteIdentifier(tmp), goldenOrdinal)); err != nil {
+		return nil, err
+	}
+
+	golden := &loadedTable{fixture: table.fixture, schema: "pg_temp", name: tmp, columns: table.columns}
+	if err := copyRows(ctx, tx, golden); err != nil {
+		return nil, err
+	}
+
+	rows, err := goldenRows(ctx, tx, "pg_temp."+quoteIdentifier(tmp), columns, []string{goldenOrdinal})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, row := range rows {
+		set := table.fixture.rows[i]
+		for _, col := range table.fixture.columns {
+			if _, ok := set[col]; !ok {
+				delete(row, table.columns[col].name)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// goldenRows reads the columns of the rows of table as text, ordered by order.
+// json columns are read as jsonb, which spells the same document the same way.
+func goldenRows(ctx context.Context, tx *sql.Tx, table string, columns []tableColumn, order []string) ([]database.Row, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+
+	selects := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if c.isJSON() {
+			selects = append(selects, quoteIdentifier(c.name)+"::jsonb::text")
+			continue
+		}
+		selects = append(selects, quoteIdentifier(c.name)+"::text")
+	}
+	quoted := make([]string, 0, len(order))
+	for _, o := range order {
+		quoted = append(quoted, quoteIdentifier(o))
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("select %s from %s order by %s",
+		strings.Join(selects, ", "), table, strings.Join(quoted, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var out []database.Row
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make(database.Row, len(columns))
+		for i, c := range columns {
+			if values[i].Valid {
+				row[c.name] = values[i].String
+			} else {
+				row[c.name] = nil
+			}
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// writeGolden rewrites the golden file of fixture with rows, in its format. The file
+// names its table when its name does not.
+func writeGolden(file string, fixture *tableFixture, table string, columns []tableColumn, rows []database.Row) error {
+	base := filepath.Base(fixtures.Name(file))
+	named := fixture.table != strings.TrimSuffix(base, filepath.Ext(base))
+
+	var content []byte
+	var err error
+	switch fixtures.Ext(file) {
+	case ".csv":
+		content, err = goldenCSV(fixture.table, named, columns, rows)
+	case ".json":
+		content, err = json.MarshalIndent(goldenDocument(fixture.table, named, rows), "", "  ")
+		content = append(content, '\n')
+	default:
+		content, err = yaml.Marshal(goldenDocument(fixture.table, named, rows))
+	}
+	if err != nil {
+		return fmt.Errorf("write rows of %s failed: %w", table, err)
+	}
+
+	if err := os.WriteFile(file, content, 0o644); err != nil {
+		return fmt.Errorf("write %s failed: %w", file, err)
+	}
+	return nil
+}
+
+// goldenDocument is the content of a json or yaml golden file, a plain list of rows
+// unless it names its table.
+func goldenDocument(table string, named bool, rows []database.Row) any {
+	list := make([]database.Row, 0, len(rows))
+	list = append(list, rows...)
+	if !named {
+		return list
+	}
+	return struct {
+		Table string         `json:"table" yaml:"table"`
+		Rows  []database.Row `json:"rows" yaml:"rows"`
+	}{Table: table, Rows: list}
+}
+
+// goldenCSV writes rows as a csv table fixture. A NULL is an empty cell, the way it
+// is loaded.
+func goldenCSV(table string, named bool, columns []tableColumn, rows []database.Row) ([]byte, error) {
+	var b bytes.Buffer
+	if named {
+		b.WriteString("# table: " + table + "\n")
+	}
+
+	w := csv.NewWriter(&b)
+	header := make([]string, 0, len(columns))
+	for _, c := range columns {
+		header = append(header, c.name)
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, c := range columns {
+			record[i], _ = row[c.name].(string)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+func hasColumn(columns []tableColumn, name string) bool {
+	for _, c := range columns {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
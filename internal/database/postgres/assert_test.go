@@ -0,0 +1,47 @@
+package pg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+)
+
+func TestWriteGolden(t *testing.T) {
+	columns := []tableColumn{{name: "id", typ: "int4"}, {name: "note", typ: "text"}}
+	rows := []database.Row{{"id": "1", "note": "first, with a comma"}, {"id": "2", "note": nil}}
+
+	dir := t.TempDir()
+	for _, name := range []string{"users.csv", "invoices.json", "users.yaml"} {
+		file := filepath.Join(dir, name)
+		// the invoices file names a table of another schema, and keeps naming it
+		fixture := &tableFixture{file: file, table: "users"}
+		if name == "invoices.json" {
+			fixture.table = "billing.invoices"
+		}
+
+		if err := writeGolden(file, fixture, fixture.table, columns, rows); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := readTableFixture(file, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.table != fixture.table {
+			t.Fatalf("%s names table %q", name, got.table)
+		}
+		if len(got.rows) != 2 || got.rows[0]["note"] != "first, with a comma" || got.rows[1]["note"] != nil {
+			t.Fatalf("%s holds rows %v", name, got.rows)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "id,note\n1,\"first, with a comma\"\n2,\n"; string(content) != want {
+		t.Fatalf("unexpected csv %q", content)
+	}
+}
@@ -3,6 +3,7 @@ package pg
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -12,6 +13,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
 )
 
 type config struct {
@@ -26,8 +31,38 @@ type config struct {
 	withUI bool
 	logger io.Writer
 
+	// templateCache is the directory of the host templates are cached in, none
+	// are when it is empty
+	templateCache string
+
+	// dump is restored into the database of the instance before its migrations
+	dump *dump
+
 	migrationsFiles []string
 	fixtureFiles    []string
+
+	// seed seeds the random source of the fixtures written as templates
+	seed int64
+
+	// replicas is the number of streaming standbys started next to the primary,
+	// replaying what it writes replicaDelay late
+	replicas     int
+	replicaDelay time.Duration
+
+	// logQueries logs every statement the instance runs, to read back per database
+	logQueries bool
+	// queryStats tracks the statistics of the statements of the test databases
+	queryStats bool
+
+	// tls starts the instance with TLS, with the certificate of a client too when
+	// tlsClientCert is set
+	tls           bool
+	tlsClientCert bool
+	// certs are the certificates of an instance started with TLS
+	certs *database.TLS
+
+	// pool keeps databases ready for CreateDB to hand out
+	pool *Pool
 }
 
 var (
@@ -61,6 +96,48 @@ func WithLabel(label string) Option {
 	}
 }
 
+// WithTemplateCache caches the templates built on the instance in dir, to restore
+// them when an instance started later misses them. An empty dir disables the cache.
+func WithTemplateCache(dir string) Option {
+	return func(c *config) error {
+		if dir == "" {
+			c.templateCache = ""
+			return nil
+		}
+
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("invalid template cache %q: %w", dir, err)
+		}
+		c.templateCache = abs
+		return nil
+	}
+}
+
+// WithDump restores the dump at path into the database of the instance when it
+// starts, the format of the dump is told from its content.
+func WithDump(path string) Option {
+	return func(c *config) error {
+		if path == "" {
+			return nil
+		}
+
+		// the dump is bind mounted, docker takes absolute paths only
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("invalid dump %q: %w", path, err)
+		}
+
+		format, err := detectDumpFormat(abs)
+		if err != nil {
+			return err
+		}
+
+		c.dump = &dump{path: abs, format: format}
+		return nil
+	}
+}
+
 // WithHost applied selected postgres host to config
 func WithHost(user, pass, name string, port uint32) Option {
 	return func(c *config) error {
@@ -75,6 +152,8 @@ func WithHost(user, pass, name string, port uint32) Option {
 // WithURI applies the instance connection details found in a database uri to config.
 // The database name is deliberately left untouched: administrative statements have to
 // run against the maintenance database, not against the one being created or dropped.
+// So are the credentials of the role a database was handed out with, they are not
+// the ones of the instance.
 func WithURI(uri string) Option {
 	return func(c *config) error {
 		if uri == "" {
@@ -86,7 +165,7 @@ func WithURI(uri string) Option {
 			return fmt.Errorf("parse database uri failed: %w", err)
 		}
 
-		if u.User != nil {
+		if u.User != nil && u.User.Username() != roleName(strings.TrimPrefix(u.Path, "/")) {
 			if name := u.User.Username(); name != "" {
 				c.user = name
 			}
@@ -107,6 +186,31 @@ func WithURI(uri string) Option {
 	}
 }
 
+// WithInstance applies the connection details of a running instance to config.
+// Instances started by an older dbctl carry none, the defaults stay in place for
+// those.
+func WithInstance(i *database.Instance) Option {
+	return func(c *config) error {
+		if i == nil {
+			return nil
+		}
+		if i.Port != 0 {
+			c.port = i.Port
+		}
+		if i.User != "" {
+			c.user = i.User
+		}
+		if i.Pass != "" {
+			c.pass = i.Pass
+		}
+		if i.Name != "" {
+			c.name = i.Name
+		}
+		c.certs = i.TLS
+		return nil
+	}
+}
+
 // WithVersion applied selected postgres version to config
 func WithVersion(version string) Option {
 	vv := strings.TrimSpace(version)
@@ -171,7 +275,7 @@ func MigrationFiles(files []string) []string {
 // WithFixtures applied selected fixtures to config
 func WithFixtures(path string) Option {
 	return func(c *config) error {
-		files, err := getFiles(path)
+		files, err := getFixtureFiles(path)
 		if err != nil {
 			return fmt.Errorf("read fixtures failed: %w", err)
 		}
@@ -180,7 +284,90 @@ func WithFixtures(path string) Option {
 	}
 }
 
+// WithSeed seeds the random source of the fixtures written as templates, the same
+// seed renders them into the same data.
+func WithSeed(seed int64) Option {
+	return func(c *config) error {
+		c.seed = seed
+		return nil
+	}
+}
+
+// WithReplicas starts n streaming standbys of the instance, on a network of their
+// own with the primary. They replay what the primary writes delay late, to test
+// how code reading from them copes with the lag.
+func WithReplicas(n int, delay time.Duration) Option {
+	return func(c *config) error {
+		if n < 0 {
+			return fmt.Errorf("invalid number of replicas %d", n)
+		}
+		if delay < 0 {
+			return fmt.Errorf("invalid replica delay %s", delay)
+		}
+		if delay > 0 && n == 0 {
+			return errors.New("a replica delay takes replicas")
+		}
+		c.replicas = n
+		c.replicaDelay = delay
+		return nil
+	}
+}
+
+// WithQueryLog logs every statement the instance runs, along with the database it
+// ran in, so that the queries of a database can be read back with QueryLog.
+func WithQueryLog(enabled bool) Option {
+	return func(c *config) error {
+		c.logQueries = enabled
+		return nil
+	}
+}
+
+// WithQueryStats preloads pg_stat_statements, to report the slowest and most
+// frequent statements of every test database with QueryReport.
+func WithQueryStats(enabled bool) Option {
+	return func(c *config) error {
+		c.queryStats = enabled
+		return nil
+	}
+}
+
+// WithTLS starts the instance with TLS, with certificates generated for it and a
+// certificate of a client too when clientCert is set. The databases it hands out
+// verify the server with sslmode=verify-full.
+func WithTLS(enabled, clientCert bool) Option {
+	return func(c *config) error {
+		if clientCert && !enabled {
+			return errors.New("a client certificate takes tls")
+		}
+		c.tls = enabled
+		c.tlsClientCert = clientCert
+		return nil
+	}
+}
+
+// WithPool has CreateDB hand out the databases pool keeps ready, and refill it.
+func WithPool(pool *Pool) Option {
+	return func(c *config) error {
+		c.pool = pool
+		return nil
+	}
+}
+
 func getFiles(path string) ([]string, error) {
+	return listFiles(path, func(name string) bool {
+		return strings.EqualFold(filepath.Ext(name), ".sql")
+	})
+}
+
+// getFixtureFiles returns the sql files in path along with the csv, json and yaml
+// ones holding the rows of a table, and the templates rendering into any of them.
+func getFixtureFiles(path string) ([]string, error) {
+	return listFiles(path, func(name string) bool {
+		return fixtures.HasExt(name, append([]string{".sql"}, tableFixtureExts...)...)
+	})
+}
+
+func listFiles(path string, keep func(name string) bool) ([]string, error) {
 	if len(path) == 0 {
 		return nil, nil
 	}
@@ -211,9 +398,9 @@ func getFiles(path string) ([]string, error) {
 			return err
 		}
 
-		// only sql files are applied, a directory can hold a readme or a
+		// only the files kept are applied, a directory can hold a readme or a
 		// checked in .gitkeep next to the migrations.
-		if d.IsDir() || !strings.EqualFold(filepath.Ext(d.Name()), ".sql") {
+		if d.IsDir() || !keep(d.Name()) {
 			return nil
 		}
 
@@ -234,16 +421,33 @@ func getFiles(path string) ([]string, error) {
 // the api server writes every request's uploads into a fresh temporary directory,
 // so paths differ on every call while the migrations themselves do not.
 func templateName(root string, files []string) (string, error) {
-	absRoot, err := filepath.Abs(root)
+	names, err := templateNames(root, files)
 	if err != nil {
 		return "", err
 	}
+	return names[len(names)-1], nil
+}
+
+// templateNames returns the name of the template of every prefix of files: the
+// first name is that of a template holding files[0] alone, the last one that of a
+// template holding all of them. The hash is built incrementally, so the template of
+// a prefix is named the same whatever follows it.
+func templateNames(root string, files []string) ([]string, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no migration files to name a template after")
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
 
+	names := make([]string, 0, len(files))
 	h := sha256.New()
 	for _, f := range files {
 		b, err := os.ReadFile(f)
 		if err != nil {
-			return "", fmt.Errorf("read migration file (%s) failed: %w", f, err)
+			return nil, fmt.Errorf("read migration file (%s) failed: %w", f, err)
 		}
 
 		// include the name relative to the migrations directory, so that renaming
@@ -256,10 +460,11 @@ func templateName(root string, files []string) (string, error) {
 
 		h.Write([]byte(filepath.ToSlash(name)))
 		h.Write(b)
-	}
 
-	// postgres truncates identifiers at 63 bytes, keep well below that.
-	return "dbctl_tpl_" + hex.EncodeToString(h.Sum(nil))[:32], nil
+		// postgres truncates identifiers at 63 bytes, keep well below that.
+		names = append(names, TemplatePrefix+hex.EncodeToString(h.Sum(nil))[:32])
+	}
+	return names, nil
 }
 
 func getPostGisImage(version string) string {
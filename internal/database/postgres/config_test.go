@@ -69,6 +69,55 @@ func TestTemplateNameFollowsContentNotPaths(t *testing.T) {
 	}
 }
 
+func TestTemplateNamesOfPrefixes(t *testing.T) {
+	main := writeFiles(t, map[string]string{
+		"001_init.up.sql":  "create table foo(id int);",
+		"002_users.up.sql": "create table users(id int);",
+	})
+
+	// a branch adds a migration on top of the ones main has
+	branch := writeFiles(t, map[string]string{
+		"001_init.up.sql":   "create table foo(id int);",
+		"002_users.up.sql":  "create table users(id int);",
+		"003_orders.up.sql": "create table orders(id int);",
+	})
+
+	names := func(dir string) []string {
+		files, err := getFiles(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := templateNames(dir, files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != len(files) {
+			t.Fatalf("expected a name for each of the %d prefixes, got %d", len(files), len(out))
+		}
+
+		full, err := templateName(dir, files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out[len(out)-1] != full {
+			t.Fatalf("the last prefix is all of the files, expected %s, got %s", full, out[len(out)-1])
+		}
+		return out
+	}
+
+	mainNames, branchNames := names(main), names(branch)
+	for i := range mainNames {
+		if mainNames[i] != branchNames[i] {
+			t.Fatalf("prefix %d of the same migrations named differently: %s != %s", i, mainNames[i], branchNames[i])
+		}
+	}
+
+	if branchNames[2] == mainNames[1] {
+		t.Fatal("a longer prefix has to be named differently")
+	}
+}
+
 func TestGetFilesWalksSubdirectories(t *testing.T) {
 	dir := t.TempDir()
 	for name, content := range map[string]string{
@@ -0,0 +1,145 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/container"
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// DumpMount is where the dump an instance is started from is mounted in the
+// postgres container, read only. It is restored by the tools of the container, so
+// that the dump is read by the version of pg_restore matching the server.
+const DumpMount = "/var/lib/dbctl/dump"
+
+// The formats of a dump, the ones of pg_dump and a gzipped plain dump.
+const (
+	dumpCustom    = "custom"
+	dumpDirectory = "directory"
+	dumpTar       = "tar"
+	dumpPlain     = "plain"
+	dumpPlainGzip = "plain-gzip"
+)
+
+// dump is a dump of a database to restore into the instance when it starts.
+type dump struct {
+	path   string
+	format string
+}
+
+// target is where the dump appears inside the container.
+func (d dump) target() string {
+	if d.format == dumpDirectory {
+		return DumpMount
+	}
+	return DumpMount + "/" + filepath.Base(d.path)
+}
+
+// restoreCommand is the shell command restoring the dump into the database name.
+// Dumps of production databases commonly refer to roles that do not exist here,
+// ownership and grants are left out.
+func (d dump) restoreCommand(user, name string) string {
+	target, user, name := shellQuote(d.target()), shellQuote(user), shellQuote(name)
+	switch d.format {
+	case dumpPlain:
+		return fmt.Sprintf("psql -q -U %s -d %s -f %s", user, name, target)
+	case dumpPlainGzip:
+		return fmt.Sprintf("gunzip -c %s | psql -q -U %s -d %s", target, user, name)
+	case dumpTar:
+		// tar archives can not be restored in parallel
+		return fmt.Sprintf("pg_restore --no-owner --no-privileges -U %s -d %s %s", user, name, target)
+	default:
+		return fmt.Sprintf("pg_restore --no-owner --no-privileges --jobs 4 -U %s -d %s %s", user, name, target)
+	}
+}
+
+// detectDumpFormat tells the format of the dump at path from its content, whatever
+// the name of the file is.
+func detectDumpFormat(path string) (string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("read dump failed: %w", err)
+	}
+
+	if stat.IsDir() {
+		// pg_dump -Fd writes the table of contents next to a file per table
+		if _, err := os.Stat(filepath.Join(path, "toc.dat")); err != nil {
+			return "", fmt.Errorf("directory %s is not a pg_dump directory dump, it has no toc.dat", path)
+		}
+		return dumpDirectory, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("read dump failed: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read dump failed: %w", err)
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PGDMP")):
+		return dumpCustom, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return dumpPlainGzip, nil
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return dumpTar, nil
+	}
+	return dumpPlain, nil
+}
+
+// restoreDump restores the dump the instance was started with into its database.
+// Restoring carries on past the statements that fail, such as the ones creating an
+// extension the image lacks; they are reported once it is done.
+func (p *Postgres) restoreDump(ctx context.Context) error {
+	logger.Info(fmt.Sprintf("Restoring %s dump %s ...", p.cfg.dump.format, p.cfg.dump.path))
+
+	// the errors are read from the output, psql carries on past failed statements
+	// and pg_restore only exits with 1 once done
+	cmd := "(" + p.cfg.dump.restoreCommand(p.cfg.user, p.cfg.name) + ") 2>&1"
+	out, err := container.Exec(ctx, p.containerID, []string{"sh", "-c", cmd})
+
+	var execErr *container.ExecError
+	if err != nil && !errors.As(err, &execErr) {
+		return fmt.Errorf("restore dump %s failed: %w", p.cfg.dump.path, err)
+	}
+
+	var failed []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, "ERROR:") {
+			failed = append(failed, strings.TrimSpace(line))
+		}
+	}
+
+	if err != nil && len(failed) == 0 {
+		return fmt.Errorf("restore dump %s failed: %w: %s", p.cfg.dump.path, err, strings.TrimSpace(out))
+	}
+
+	if len(failed) > 0 {
+		const shown = 5
+		msg := fmt.Sprintf("%d statements of the dump failed, the database may be incomplete:", len(failed))
+		for i, line := range failed {
+			if i == shown {
+				msg += fmt.Sprintf("\n  ... and %d more", len(failed)-shown)
+				break
+			}
+			msg += "\n  " + line
+		}
+		logger.Warn(msg)
+	}
+	return nil
+}
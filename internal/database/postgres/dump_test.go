@@ -0,0 +1,93 @@
+package pg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectDumpFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("create table foo (id int);\n"))
+	_ = zw.Close()
+
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	_ = tw.WriteHeader(&tar.Header{Name: "toc.dat", Mode: 0o600, Size: 5})
+	_, _ = tw.Write([]byte("PGDMP"))
+	_ = tw.Close()
+
+	files := map[string][]byte{
+		"prod.dump":   append([]byte("PGDMP"), 1, 14, 0),
+		"prod.sql":    []byte("--\n-- PostgreSQL database dump\n--\ncreate table foo (id int);\n"),
+		"prod.sql.gz": gz.Bytes(),
+		"prod.tar":    tarball.Bytes(),
+		// the content tells the format, not the name
+		"backup":    append([]byte("PGDMP"), 1, 14, 0),
+		"empty.sql": nil,
+	}
+	want := map[string]string{
+		"prod.dump":   dumpCustom,
+		"prod.sql":    dumpPlain,
+		"prod.sql.gz": dumpPlainGzip,
+		"prod.tar":    dumpTar,
+		"backup":      dumpCustom,
+		"empty.sql":   dumpPlain,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := detectDumpFormat(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != want[name] {
+			t.Fatalf("%s: expected %s, got %s", name, want[name], got)
+		}
+	}
+
+	directory := filepath.Join(dir, "prod")
+	if err := os.Mkdir(directory, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := detectDumpFormat(directory); err == nil {
+		t.Fatal("expected a directory without toc.dat to be rejected")
+	}
+
+	if err := os.WriteFile(filepath.Join(directory, "toc.dat"), []byte("PGDMP"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := detectDumpFormat(directory); err != nil || got != dumpDirectory {
+		t.Fatalf("expected a directory dump, got %s, %v", got, err)
+	}
+}
+
+func TestDumpRestoreCommand(t *testing.T) {
+	d := dump{path: "/home/me/bug 123/prod.sql.gz", format: dumpPlainGzip}
+	if d.target() != DumpMount+"/prod.sql.gz" {
+		t.Fatalf("unexpected target %s", d.target())
+	}
+
+	cmd := d.restoreCommand("postgres", "app")
+	if !strings.HasPrefix(cmd, "gunzip -c '"+DumpMount+"/prod.sql.gz' | psql") {
+		t.Fatalf("unexpected command %s", cmd)
+	}
+
+	// production dumps refer to roles that do not exist in the container
+	d = dump{path: "/home/me/prod", format: dumpDirectory}
+	cmd = d.restoreCommand("postgres", "app")
+	if !strings.Contains(cmd, "--no-owner") || !strings.HasSuffix(cmd, "'"+DumpMount+"'") {
+		t.Fatalf("unexpected command %s", cmd)
+	}
+}
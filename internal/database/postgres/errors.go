@@ -0,0 +1,203 @@
+package pg
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// statementError is a failure of one statement of a file applied statement by
+// statement.
+type statementError struct {
+	// number is the position of the statement in its file, counting from 1
+	number int
+	stmt   statement
+	err    error
+}
+
+func (e *statementError) Error() string {
+	return fmt.Sprintf("statement %d at line %d: %v", e.number, e.stmt.line, e.err)
+}
+
+func (e *statementError) Unwrap() error {
+	return e.err
+}
+
+// sourceError is a failure to apply a sql file, pinned to the place in the file that
+// caused it. A 2000 line migration failing with nothing but "syntax error at or near
+// ," leaves the reader searching, the location and an excerpt do not.
+type sourceError struct {
+	file string
+	// line and column are where the failure happened, counting from 1. They are 0
+	// when postgres did not say where.
+	line   int
+	column int
+	// statement is the number of the failing statement, for files applied statement
+	// by statement
+	statement int
+
+	excerpt string
+	err     error
+}
+
+func (e *sourceError) Error() string {
+	loc := e.file
+	if e.line > 0 {
+		loc += ":" + strconv.Itoa(e.line)
+		if e.column > 0 {
+			loc += ":" + strconv.Itoa(e.column)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "applying %s failed", loc)
+	if e.statement > 0 {
+		fmt.Fprintf(&b, ", statement %d", e.statement)
+	}
+	fmt.Fprintf(&b, ": %v", e.err)
+
+	var pqErr *pq.Error
+	if errors.As(e.err, &pqErr) {
+		for _, f := range []struct{ name, value string }{
+			{"detail", pqErr.Detail},
+			{"hint", pqErr.Hint},
+			{"where", pqErr.Where},
+		} {
+			if f.value != "" {
+				fmt.Fprintf(&b, "\n  %s: %s", f.name, f.value)
+			}
+		}
+	}
+
+	if e.excerpt != "" {
+		b.WriteString("\n")
+		b.WriteString(e.excerpt)
+	}
+	return b.String()
+}
+
+func (e *sourceError) Unwrap() error {
+	return e.err
+}
+
+// newSourceError pins an error returned while applying src, the content of file,
+// to its place in the file. Postgres reports the position of a failure as the
+// character it happened at in the query it was sent, for files applied statement by
+// statement that query is the statement rather than the file.
+func newSourceError(file, src string, err error) error {
+	out := &sourceError{file: file, err: err}
+
+	// where the query postgres saw starts in the file
+	base := 0
+	var stmtErr *statementError
+	if errors.As(err, &stmtErr) {
+		out.statement = stmtErr.number
+		out.err = stmtErr.err
+		out.line = stmtErr.stmt.line
+		base = stmtErr.stmt.offset
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Position == "" {
+		return out
+	}
+
+	pos, perr := strconv.Atoi(pqErr.Position)
+	if perr != nil || pos < 1 {
+		return out
+	}
+
+	offset, ok := charOffset(src, base, pos-1)
+	if !ok {
+		return out
+	}
+
+	out.line, out.column = lineColumn(src, offset)
+	out.excerpt = excerpt(src, out.line, out.column)
+	return out
+}
+
+// charOffset moves n characters forward from the byte offset base in src and
+// returns the byte offset it ends up at.
+func charOffset(src string, base, n int) (int, bool) {
+	offset := base
+	for ; n > 0; n-- {
+		if offset >= len(src) {
+			return 0, false
+		}
+		_, size := utf8.DecodeRuneInString(src[offset:])
+		offset += size
+	}
+	return offset, offset <= len(src)
+}
+
+// lineColumn turns a byte offset into a line and a column, both counting from 1.
+// Columns count characters, not bytes.
+func lineColumn(src string, offset int) (int, int) {
+	before := src[:offset]
+	line := strings.Count(before, "\n") + 1
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return line, utf8.RuneCountInString(before[lineStart:]) + 1
+}
+
+// excerpt renders the failing line and the one before it, with a caret under the
+// column the failure happened at.
+func excerpt(src string, line, column int) string {
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	first := line - 1
+	if first < 1 {
+		first = 1
+	}
+
+	width := len(strconv.Itoa(line))
+
+	var b strings.Builder
+	for n := first; n <= line; n++ {
+		fmt.Fprintf(&b, "  %*d | %s\n", width, n, strings.TrimRight(lines[n-1], "\r"))
+	}
+
+	// tabs are kept under tabs, so the caret lines up however wide they render
+	var pad strings.Builder
+	for i, r := range []rune(lines[line-1]) {
+		if i >= column-1 {
+			break
+		}
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+
+	fmt.Fprintf(&b, "  %s | %s^", strings.Repeat(" ", width), pad.String())
+	return b.String()
+}
+
+// displayName is how a file is referred to in errors: relative to the directory it
+// was read from when there is one. The api server unpacks every request into a
+// fresh temporary directory, whose name means nothing to its client.
+func displayName(root, file string) string {
+	if root == "" {
+		return file
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return file
+	}
+
+	rel, err := filepath.Rel(absRoot, file)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return file
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,77 @@
+package pg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestSourceErrorPointsAtTheFailingLine(t *testing.T) {
+	src := "create table a (\n\tid int,,\n\tname text\n);\n"
+
+	// postgres counts the position in characters of the query it was sent, the
+	// second comma is the 26th character of the file.
+	err := newSourceError("001_init.up.sql", src, &pq.Error{
+		Message:  `syntax error at or near ","`,
+		Position: "26",
+		Hint:     "remove the extra comma",
+	})
+
+	got := err.Error()
+	for _, want := range []string{
+		`applying 001_init.up.sql:2:9 failed: pq: syntax error at or near ","`,
+		"hint: remove the extra comma",
+		"  1 | create table a (",
+		"  2 | \tid int,,",
+		"    | \t       ^",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestSourceErrorCountsCharactersNotBytes(t *testing.T) {
+	src := "insert into a values ('héllo');\nselect nope from a;\n"
+
+	// "select nope" starts at character 33, the é is two bytes but one character
+	err := newSourceError("fixtures.sql", src, &pq.Error{Message: "column \"nope\" does not exist", Position: "40"})
+
+	if !strings.Contains(err.Error(), "fixtures.sql:2:8") {
+		t.Fatalf("expected line 2, column 8, got:\n%s", err)
+	}
+}
+
+func TestSourceErrorOfAStatement(t *testing.T) {
+	src := "-- dbctl:no-transaction\nselect 1;\n\ncreate index concurrently i on t (nope);\n"
+
+	stmts := splitStatements(src)
+	err := newSourceError("002_index.up.sql", src, &statementError{
+		number: 2,
+		stmt:   stmts[1],
+		err:    &pq.Error{Message: `column "nope" does not exist`, Position: "35"},
+	})
+
+	got := err.Error()
+	if !strings.Contains(got, "applying 002_index.up.sql:4:35 failed, statement 2:") {
+		t.Fatalf("unexpected error:\n%s", got)
+	}
+
+	// without a position the statement still tells where to look
+	err = newSourceError("002_index.up.sql", src, &statementError{number: 2, stmt: stmts[1], err: &pq.Error{Message: "boom"}})
+	if !strings.HasPrefix(err.Error(), "applying 002_index.up.sql:4 failed, statement 2: pq: boom") {
+		t.Fatalf("unexpected error:\n%s", err)
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	dir := t.TempDir()
+	if got := displayName(dir, dir+"/tenant/001_init.up.sql"); got != "tenant/001_init.up.sql" {
+		t.Fatalf("expected the name relative to the directory, got %q", got)
+	}
+
+	if got := displayName("", "/m/001_init.up.sql"); got != "/m/001_init.up.sql" {
+		t.Fatalf("expected the name as is, got %q", got)
+	}
+}
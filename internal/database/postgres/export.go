@@ -0,0 +1,499 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+)
+
+// The formats tables are exported in.
+const (
+	ExportSQL = "sql"
+	ExportCSV = "csv"
+)
+
+// exportBatch is the number of rows an INSERT statement of an export holds.
+const exportBatch = 100
+
+// ExportRequest picks what Export writes.
+type ExportRequest struct {
+	// DB is the database to export, by name or uri, the database of the instance
+	// when empty.
+	DB string
+	// Tables are the tables to export, by name or schema and name. Every table is
+	// exported when empty, but the ones migration tools track migrations in.
+	Tables []string
+	// Where are conditions on the rows to export, `table: condition` for the rows
+	// of one table and a plain condition for the ones of every table.
+	Where []string
+	// Format is ExportSQL or ExportCSV.
+	Format string
+	// Dir is the directory the fixtures are written to.
+	Dir string
+}
+
+// ExportedTable is a table Export wrote the rows of.
+type ExportedTable struct {
+	Table string
+	// File is empty for a table without rows to export.
+	File string
+	Rows int64
+}
+
+// exportTable is a table of an export, as to_regclass prints it.
+type exportTable struct {
+	oid  int64
+	name string
+}
+
+// Export writes the rows of the tables of a database as fixtures, a file per table
+// numbered in the order their foreign keys load them in. SQL fixtures insert the
+// rows and move the sequences of the table past them, csv ones are table fixtures:
+// an empty cell is loaded as NULL, so empty strings come back as NULL.
+//
+// The rows of every table are read in one transaction, they are consistent with each
+// other.
+func (p *Postgres) Export(ctx context.Context, req ExportRequest) ([]ExportedTable, error) {
+	if req.Format == "" {
+		req.Format = ExportSQL
+	}
+	if req.Format != ExportSQL && req.Format != ExportCSV {
+		return nil, fmt.Errorf("unknown export format %q, can be %s or %s", req.Format, ExportSQL, ExportCSV)
+	}
+
+	name, err := p.databaseName(req.DB)
+	if err != nil {
+		return nil, err
+	}
+	target, err := p.database(name)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dbConnect(ctx, target.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	tables, err := exportTables(ctx, tx, req.Tables)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no tables to export in %s", name)
+	}
+
+	conditions, err := exportConditions(tables, req.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	oids := make([]int64, 0, len(tables))
+	for _, t := range tables {
+		oids = append(oids, t.oid)
+	}
+	deps, err := foreignKeys(ctx, tx, oids)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(req.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create export directory failed: %w", err)
+	}
+
+	out := make([]ExportedTable, 0, len(tables))
+	for n, i := range orderByDependencies(oids, deps) {
+		t := tables[i]
+		file := filepath.Join(req.Dir, fmt.Sprintf("%03d_%s.%s", n+1, exportFileName(t.name), req.Format))
+
+		rows, err := exportRows(ctx, tx, t, conditions[t.name], file, req.Format, nil)
+		if err != nil {
+			return nil, fmt.Errorf("export %s failed: %w", t.name, err)
+		}
+
+		e := ExportedTable{Table: t.name, Rows: rows}
+		if rows > 0 {
+			e.File = file
+		}
+		out = append(out, e)
+	}
+	return out, tx.Commit()
+}
+
+// exportTables resolves names to the tables to export, every table of the database
+// but the tracking ones of migration tools when empty. Partitions are exported
+// through the table they are partitions of.
+func exportTables(ctx context.Context, tx *sql.Tx, names []string) ([]exportTable, error) {
+	if len(names) > 0 {
+		out := make([]exportTable, 0, len(names))
+		seen := map[int64]bool{}
+		for _, name := range names {
+			var t exportTable
+			err := tx.QueryRowContext(ctx, "select c.oid::bigint, c.oid::regclass::text from pg_class c where c.oid = to_regclass($1)", name).
+				Scan(&t.oid, &t.name)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("table %s does not exist", name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("look up table %s failed: %w", name, err)
+			}
+			if !seen[t.oid] {
+				seen[t.oid] = true
+				out = append(out, t)
+			}
+		}
+		return out, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		select c.oid::bigint, c.oid::regclass::text
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		where c.relkind in ('r', 'p') and not c.relispartition
+		  and n.nspname not in ('pg_catalog', 'information_schema') and n.nspname not like 'pg\_toast%'
+		  and not exists (
+		    select 1 from pg_depend d
+		    where d.classid = 'pg_class'::regclass and d.objid = c.oid and d.deptype = 'e')
+		order by n.nspname, c.relname`)
+	if err != nil {
+		return nil, fmt.Errorf("list tables failed: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	tracking := map[string]bool{}
+	for _, t := range TrackingTables {
+		tracking[t] = true
+	}
+
+	var out []exportTable
+	for rows.Next() {
+		var t exportTable
+		if err := rows.Scan(&t.oid, &t.name); err != nil {
+			return nil, err
+		}
+		// the rows of a tracking table are there once the migrations are, loading
+		// them again as fixtures would collide with them
+		if tracking[t.name[strings.LastIndex(t.name, ".")+1:]] {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// exportConditions returns the condition on the rows of each table, the conditions
+// of where scoped to it and the ones of every table joined with AND.
+func exportConditions(tables []exportTable, where []string) (map[string]string, error) {
+	byName := map[string]string{}
+	for _, t := range tables {
+		byName[t.name] = t.name
+		// to_regclass leaves out the schema of a table on the search path, users
+		// can be scoped as public.users too
+		if !strings.Contains(t.name, ".") {
+			byName["public."+t.name] = t.name
+		}
+	}
+
+	parts := map[string][]string{}
+	for _, w := range where {
+		scope, condition := database.SplitCondition(w)
+		if condition == "" {
+			return nil, fmt.Errorf("condition %q is empty", w)
+		}
+		if scope == "" {
+			for _, t := range tables {
+				parts[t.name] = append(parts[t.name], condition)
+			}
+			continue
+		}
+
+		name, ok := byName[scope]
+		if !ok {
+			return nil, fmt.Errorf("condition %q is on %s, which is not exported", w, scope)
+		}
+		parts[name] = append(parts[name], condition)
+	}
+
+	out := make(map[string]string, len(parts))
+	for name, conditions := range parts {
+		out[name] = "(" + strings.Join(conditions, ") and (") + ")"
+	}
+	return out, nil
+}
+
+// exportFileName is the name of the file of a table, without the quotes of a name
+// to_regclass had to quote and without the public schema.
+func exportFileName(table string) string {
+	name := strings.TrimPrefix(table, "public.")
+	name = strings.ReplaceAll(name, `"`, "")
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// exportColumn is a column of an exported table.
+type exportColumn struct {
+	name string
+	// identity is set for a GENERATED ALWAYS AS IDENTITY column, which an insert
+	// only sets with OVERRIDING SYSTEM VALUE
+	identity bool
+}
+
+// exportRows writes the rows of t matching condition to file, ordered by primary
+// key so that exporting the same rows writes the same file, with the values of
+// the columns of mask scrubbed when given. Nothing is written for a table without
+// rows to export.
+func exportRows(ctx context.Context, tx *sql.Tx, t exportTable, condition, file, format string, mask *tableMask) (int64, error) {
+	columns, order, err := exportColumns(ctx, tx, t.oid)
+	if err != nil {
+		return 0, err
+	}
+	if len(columns) == 0 {
+		return 0, nil
+	}
+	if err := mask.check(t.name, columns); err != nil {
+		return 0, err
+	}
+
+	// every value is read as text, the way an insert of a string literal or a
+	// table fixture takes it back
+	selects := make([]string, 0, len(columns))
+	for _, c := range columns {
+		selects = append(selects, mask.selectExpr(c.name)+"::text")
+	}
+	query := fmt.Sprintf("select %s from %s", strings.Join(selects, ", "), t.name)
+	if condition != "" {
+		query += " where " + condition
+	}
+	if len(order) > 0 {
+		quoted := make([]string, 0, len(order))
+		for _, o := range order {
+			quoted = append(quoted, quoteIdentifier(o))
+		}
+		query += " order by " + strings.Join(quoted, ", ")
+	}
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var values [][]sql.NullString
+	for rows.Next() {
+		row := make([]sql.NullString, len(columns))
+		dest := make([]any, len(row))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return 0, err
+		}
+		if err := mask.apply(columns, row); err != nil {
+			return 0, err
+		}
+		values = append(values, row)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	var content []byte
+	if format == ExportCSV {
+		content, err = exportCSV(t.name, columns, values)
+	} else {
+		var sequences []string
+		if sequences, err = ownedSequences(ctx, tx, t); err == nil {
+			content = []byte(exportSQL(t.name, columns, values, sequences))
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.WriteFile(file, content, 0o644); err != nil {
+		return 0, fmt.Errorf("write %s failed: %w", file, err)
+	}
+	return int64(len(values)), nil
+}
+
+// exportColumns returns the columns of a table an insert can set, generated columns
+// are computed again, and the columns of its primary key.
+func exportColumns(ctx context.Context, tx *sql.Tx, oid int64) ([]exportColumn, []string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		select a.attname, a.attidentity = 'a'
+		from pg_attribute a
+		where a.attrelid = $1 and a.attnum > 0 and not a.attisdropped and a.attgenerated = ''
+		order by a.attnum`, oid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var columns []exportColumn
+	for rows.Next() {
+		var c exportColumn
+		if err := rows.Scan(&c.name, &c.identity); err != nil {
+			_ = rows.Close()
+			return nil, nil, err
+		}
+		columns = append(columns, c)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		select a.attname
+		from pg_index i join pg_attribute a on a.attrelid = i.indrelid and a.attnum = any(i.indkey)
+		where i.indrelid = $1 and i.indisprimary
+		order by array_position(i.indkey::int2[], a.attnum)`, oid)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var order []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, nil, err
+		}
+		order = append(order, name)
+	}
+	return columns, order, rows.Err()
+}
+
+// ownedSequences returns the statements moving the sequences owned by the columns
+// of t past the largest value exported, the way loading a table fixture does.
+func ownedSequences(ctx context.Context, tx *sql.Tx, t exportTable) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		select a.attname, pg_get_serial_sequence($1, a.attname)
+		from pg_attribute a
+		where a.attrelid = $2 and a.attnum > 0 and not a.attisdropped
+		  and pg_get_serial_sequence($1, a.attname) is not null
+		order by a.attnum`, t.name, t.oid)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var out []string
+	for rows.Next() {
+		var column, sequence string
+		if err := rows.Scan(&column, &sequence); err != nil {
+			return nil, err
+		}
+		out = append(out, fmt.Sprintf("SELECT setval(%s, coalesce(max(%s), 0) + 1, false) FROM %s;",
+			quoteLiteral(sequence), quoteIdentifier(column), t.name))
+	}
+	return out, rows.Err()
+}
+
+// exportSQL writes rows as INSERT statements of exportBatch rows. Values are string
+// literals, the type of their column is inferred from the insert.
+func exportSQL(table string, columns []exportColumn, rows [][]sql.NullString, sequences []string) string {
+	names := make([]string, 0, len(columns))
+	overriding := false
+	for _, c := range columns {
+		names = append(names, quoteIdentifier(c.name))
+		overriding = overriding || c.identity
+	}
+
+	head := fmt.Sprintf("INSERT INTO %s (%s)", table, strings.Join(names, ", "))
+	if overriding {
+		head += " OVERRIDING SYSTEM VALUE"
+	}
+	head += " VALUES\n"
+
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "-- %d rows of %s, written by dbctl export.\n\n", len(rows), table)
+	for start := 0; start < len(rows); start += exportBatch {
+		end := start + exportBatch
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		b.WriteString(head)
+		for i, row := range rows[start:end] {
+			values := make([]string, 0, len(row))
+			for _, v := range row {
+				if !v.Valid {
+					values = append(values, "NULL")
+					continue
+				}
+				values = append(values, quoteLiteral(v.String))
+			}
+
+			b.WriteString("\t(" + strings.Join(values, ", ") + ")")
+			if start+i == end-1 {
+				b.WriteString(";\n\n")
+			} else {
+				b.WriteString(",\n")
+			}
+		}
+	}
+
+	for _, s := range sequences {
+		b.WriteString(s + "\n")
+	}
+	return b.String()
+}
+
+// exportCSV writes rows as a csv table fixture, naming its table on the first line.
+func exportCSV(table string, columns []exportColumn, rows [][]sql.NullString) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("# table: " + table + "\n")
+
+	w := csv.NewWriter(&b)
+	header := make([]string, 0, len(columns))
+	for _, c := range columns {
+		header = append(header, c.name)
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, v := range row {
+			record[i] = v.String
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return []byte(b.String()), w.Error()
+}
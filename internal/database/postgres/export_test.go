@@ -0,0 +1,55 @@
+package pg
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestExportSQL(t *testing.T) {
+	columns := []exportColumn{{name: "id", identity: true}, {name: "name"}, {name: "note"}}
+	rows := [][]sql.NullString{
+		{{String: "1", Valid: true}, {String: "O'Brien", Valid: true}, {}},
+		{{String: "2", Valid: true}, {String: "Ada", Valid: true}, {String: "", Valid: true}},
+	}
+
+	got := exportSQL("users", columns, rows, []string{`SELECT setval('users_id_seq', coalesce(max("id"), 0) + 1, false) FROM users;`})
+	want := `-- 2 rows of users, written by dbctl export.
+
+INSERT INTO users ("id", "name", "note") OVERRIDING SYSTEM VALUE VALUES
+	('1', 'O''Brien', NULL),
+	('2', 'Ada', '');
+
+SELECT setval('users_id_seq', coalesce(max("id"), 0) + 1, false) FROM users;
+`
+	if got != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	// every statement applies on its own, the splitter of fixtures sees them all
+	many := make([][]sql.NullString, exportBatch+1)
+	for i := range many {
+		many[i] = []sql.NullString{{String: "1", Valid: true}, {}, {}}
+	}
+	if n := len(splitStatements(exportSQL("users", columns, many, nil))); n != 2 {
+		t.Fatalf("expected 2 statements for %d rows, got %d", len(many), n)
+	}
+}
+
+func TestExportConditions(t *testing.T) {
+	tables := []exportTable{{oid: 1, name: "users"}, {oid: 2, name: "billing.invoices"}}
+
+	got, err := exportConditions(tables, []string{"created_at > now() - interval '1 day'", "public.users: id < 100"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "(created_at > now() - interval '1 day') and (id < 100)"; got["users"] != want {
+		t.Fatalf("expected %q for users, got %q", want, got["users"])
+	}
+	if want := "(created_at > now() - interval '1 day')"; got["billing.invoices"] != want {
+		t.Fatalf("expected %q for invoices, got %q", want, got["billing.invoices"])
+	}
+
+	if _, err := exportConditions(tables, []string{"orders: id < 100"}); err == nil {
+		t.Fatal("expected a condition on a table that is not exported to be rejected")
+	}
+}
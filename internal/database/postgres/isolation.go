@@ -0,0 +1,225 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// SchemasDatabase holds the schemas handed out with schema isolation, along with
+// the template schemas they are cloned from. Tests share it, and the connections
+// to it, rather than getting a database each.
+const SchemasDatabase = "dbctl_schemas"
+
+// searchPathOption is how a uri confines its sessions to a schema, the options of
+// the server libpq and the drivers following it send on connecting.
+const searchPathOption = "-csearch_path="
+
+// withSchema returns uri confining its sessions to schema. The extensions of the
+// shared database are created in public, it stays on the path for them.
+func withSchema(uri, schema string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	q := u.Query()
+	q.Set("options", searchPathOption+schema+",public")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// schemaOf returns the schema u confines its sessions to, empty for the uri of a
+// whole database.
+func schemaOf(u *url.URL) string {
+	path, ok := strings.CutPrefix(u.Query().Get("options"), searchPathOption)
+	if !ok {
+		return ""
+	}
+	schema, _, _ := strings.Cut(path, ",")
+	return schema
+}
+
+// createSchemaDB hands out a schema of SchemasDatabase holding the migrations and
+// fixtures of req, the schema isolation counterpart of CreateDB.
+func (p *Postgres) createSchemaDB(ctx context.Context, conn *sql.DB, req *database.CreateDBRequest) (*database.CreateDBResponse, error) {
+	switch {
+	case req.WithDefaultMigrations:
+		return nil, errors.New("default migrations are kept in a database of their own, they can not be handed out as a schema")
+	case req.RestrictedRole:
+		return nil, errors.New("restricted roles own a database of their own, they can not be handed out with a schema")
+	}
+
+	if err := ensureDatabase(ctx, conn, SchemasDatabase); err != nil {
+		return nil, err
+	}
+
+	shared, err := p.database(SchemasDatabase)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := dbConnect(ctx, shared.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	// schemas are named like the databases, a uri tells which one it is by its options
+	schema := fmt.Sprintf("dbctl_%d", time.Now().UnixNano())
+	newURI := withSchema(shared.URI(), schema)
+
+	if err := p.createSchemaFromMigrations(ctx, db, shared.URI(), schema, req.Migrations); err != nil {
+		return nil, err
+	}
+
+	if len(req.Fixtures) != 0 {
+		if err := applyFixturesFromDir(ctx, nil, req.Fixtures, newURI, p.cfg.seed); err != nil {
+			return nil, err
+		}
+	}
+
+	p.findReplicas(ctx)
+	if err := p.waitForReplay(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	res := &database.CreateDBResponse{URI: p.clientURI(newURI), CA: p.cfg.certs.Authority()}
+	for _, r := range p.replicas {
+		res.ReplicaURIs = append(res.ReplicaURIs, p.clientURI(withSchema(p.replicaURI(r, SchemasDatabase), schema)))
+	}
+	return res, nil
+}
+
+// createSchemaFromMigrations creates schema in db, holding the migrations at
+// migrationsPath. The migrations are applied once, to a template schema named like
+// the template databases, and cloned from there.
+func (p *Postgres) createSchemaFromMigrations(ctx context.Context, db *sql.DB, sharedURI, schema, migrationsPath string) error {
+	files, err := getFiles(migrationsPath)
+	if err != nil {
+		return fmt.Errorf("read migraions failed: %w", err)
+	}
+
+	migrationFiles := MigrationFiles(files)
+	if len(migrationFiles) == 0 {
+		return createSchema(ctx, db, schema)
+	}
+
+	names, err := templateNames(migrationsPath, migrationFiles)
+	if err != nil {
+		return err
+	}
+	template := names[len(names)-1]
+
+	if err := p.buildTemplateSchema(ctx, db, sharedURI, template, migrationsPath, migrationFiles); err != nil {
+		return err
+	}
+
+	err = cloneSchema(ctx, db, fmt.Sprintf("%d/%s", p.cfg.port, template), template, schema)
+	if err == nil {
+		return nil
+	}
+
+	// cloning is only a shortcut, replaying the migrations gets there as well
+	logger.Debug("cloning template schema", template, "failed, applying the migrations instead:", err)
+	if err := createSchema(ctx, db, schema); err != nil {
+		return err
+	}
+	return applyMigrations(ctx, nil, migrationsPath, migrationFiles, 0, "", withSchema(sharedURI, schema))
+}
+
+// buildTemplateSchema applies the migrations to template, unless an earlier request
+// already did.
+func (p *Postgres) buildTemplateSchema(ctx context.Context, db *sql.DB, sharedURI, template, migrationsPath string, files []string) error {
+	if ok, err := schemaExists(ctx, db, template); err != nil || ok {
+		return err
+	}
+
+	// the lock of the schema is apart from the one of the template database of the
+	// same migrations, building one does not hold up the other
+	unlock, err := p.lockTemplate(ctx, db, "schema:"+template)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if ok, err := schemaExists(ctx, db, template); err != nil || ok {
+		return err
+	}
+
+	if err := createSchema(ctx, db, template); err != nil {
+		return err
+	}
+	if err := applyMigrations(ctx, nil, migrationsPath, files, 0, "", withSchema(sharedURI, template)); err != nil {
+		// a half applied template would be cloned by every request after this one
+		_ = dropSchema(ctx, db, template)
+		return err
+	}
+	return nil
+}
+
+// removeSchemaDB drops the schema handed out by createSchemaDB, with everything in it.
+func (p *Postgres) removeSchemaDB(ctx context.Context, schema string) error {
+	// the template schemas are shared by every test cloning them
+	if strings.HasPrefix(schema, TemplatePrefix) || schema == "public" {
+		return fmt.Errorf("schema %q was not handed out by dbctl", schema)
+	}
+
+	db, err := p.connectTo(ctx, SchemasDatabase)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	return dropSchema(ctx, db, schema)
+}
+
+// ensureDatabase creates name unless it exists.
+func ensureDatabase(ctx context.Context, conn *sql.DB, name string) error {
+	var exists bool
+	if err := conn.QueryRowContext(ctx, "select exists(select from pg_database where datname = $1)", name).Scan(&exists); err != nil {
+		return fmt.Errorf("look up database %q failed: %w", name, err)
+	}
+	if exists {
+		return nil
+	}
+
+	// a concurrent request may create it in between
+	if err := createDatabase(ctx, conn, name); err != nil && !strings.Contains(err.Error(), "already exists") {
+		return err
+	}
+	return nil
+}
+
+func schemaExists(ctx context.Context, db *sql.DB, name string) (bool, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, "select exists(select from pg_namespace where nspname = $1)", name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("look up schema %q failed: %w", name, err)
+	}
+	return exists, nil
+}
+
+func createSchema(ctx context.Context, db *sql.DB, name string) error {
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("create schema %s", quoteIdentifier(name))); err != nil {
+		return fmt.Errorf("create schema failed: %w", err)
+	}
+	return nil
+}
+
+func dropSchema(ctx context.Context, db *sql.DB, name string) error {
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("drop schema if exists %s cascade", quoteIdentifier(name))); err != nil {
+		return fmt.Errorf("drop schema failed: %w", err)
+	}
+	return nil
+}
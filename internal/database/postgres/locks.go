@@ -0,0 +1,107 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// templateLocks serialises the building of each template within this process. The
+// api server handles every request in its own goroutine, without it all the
+// requests sent at once by a fresh `go test ./...` build the same template side by
+// side.
+var templateLocks = newKeyedLocks()
+
+// keyedLocks hands out one lock per key. Unlike a map of sync.Mutex, waiting for a
+// lock gives up when the context of the waiting request is done.
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sem chan struct{}
+	// refs counts the holder and the waiters, the lock is forgotten with the last one
+	refs int
+}
+
+func newKeyedLocks() *keyedLocks {
+	return &keyedLocks{locks: make(map[string]*keyedLock)}
+}
+
+// lock takes the lock of key, it returns the function releasing it.
+func (k *keyedLocks) lock(ctx context.Context, key string) (func(), error) {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{sem: make(chan struct{}, 1)}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	select {
+	case l.sem <- struct{}{}:
+		return func() {
+			<-l.sem
+			k.release(key, l)
+		}, nil
+	case <-ctx.Done():
+		k.release(key, l)
+		return nil, ctx.Err()
+	}
+}
+
+func (k *keyedLocks) release(key string, l *keyedLock) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(k.locks, key)
+	}
+}
+
+// lockTemplate makes the caller the only one building template, both among the
+// requests of this process and across api servers sharing the instance, which
+// coordinate through a postgres advisory lock. The lock is held by a session of
+// conn, closing conn releases it as well.
+func (p *Postgres) lockTemplate(ctx context.Context, conn *sql.DB, template string) (func(), error) {
+	unlock, err := templateLocks.lock(ctx, fmt.Sprintf("%d/%s", p.cfg.port, template))
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := conn.Conn(ctx)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	key := advisoryKey(template)
+	if _, err := session.ExecContext(ctx, "select pg_advisory_lock($1)", key); err != nil {
+		_ = session.Close()
+		unlock()
+		return nil, fmt.Errorf("waiting for template %q failed: %w", template, err)
+	}
+
+	return func() {
+		// the context may be done by now, the lock has to be released anyway
+		if _, err := session.ExecContext(context.Background(), "select pg_advisory_unlock($1)", key); err != nil {
+			logger.Debug("releasing the lock of template", template, "failed:", err)
+		}
+		_ = session.Close()
+		unlock()
+	}, nil
+}
+
+// advisoryKey maps a template to the number postgres advisory locks are keyed by.
+func advisoryKey(template string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("dbctl:template:" + template))
+	return int64(h.Sum64())
+}
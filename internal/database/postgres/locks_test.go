@@ -0,0 +1,82 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedLocksSerialisePerKey(t *testing.T) {
+	locks := newKeyedLocks()
+	ctx := context.Background()
+
+	var (
+		mu      sync.Mutex
+		running int
+		wg      sync.WaitGroup
+	)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			unlock, err := locks.lock(ctx, "tpl")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+
+			mu.Lock()
+			running++
+			if running > 1 {
+				t.Error("two holders of the same lock")
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// a different key is never held up
+	unlock, err := locks.lock(ctx, "tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	other, err := locks.lock(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other()
+}
+
+func TestKeyedLocksGiveUpWithTheContext(t *testing.T) {
+	locks := newKeyedLocks()
+
+	unlock, err := locks.lock(context.Background(), "tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := locks.lock(ctx, "tpl"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to end with the context, got %v", err)
+	}
+
+	unlock()
+	if len(locks.locks) != 0 {
+		t.Fatalf("expected released locks to be forgotten, %d left", len(locks.locks))
+	}
+}
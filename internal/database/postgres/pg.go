@@ -6,14 +6,17 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/mirzakhany/dbctl/internal/certs"
 	"github.com/mirzakhany/dbctl/internal/logger"
 	"github.com/mirzakhany/dbctl/internal/utils"
 
@@ -21,6 +24,7 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/mirzakhany/dbctl/internal/container"
 	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
 )
 
 var (
@@ -49,6 +53,19 @@ const (
 type Postgres struct {
 	containerID string
 	cfg         config
+
+	// network is the network the primary shares with its replicas
+	network  string
+	replicas []replica
+	// replicasKnown is set once the replicas of an instance started elsewhere
+	// have been looked up
+	replicasKnown bool
+
+	// caching tracks the templates being dumped to the template cache in the
+	// background, Stop waits for them, or cancels them, before the container goes
+	caching       sync.WaitGroup
+	cachingCtx    context.Context
+	cancelCaching context.CancelFunc
 }
 
 // New creates a new postgres database instance controller
@@ -60,7 +77,9 @@ func New(options ...Option) (*Postgres, error) {
 		name:    DefaultName,
 		port:    DefaultPort,
 		version: DefaultVersion,
+		seed:    fixtures.DefaultSeed,
 	}}
+	pg.cachingCtx, pg.cancelCaching = context.WithCancel(context.Background())
 
 	for _, o := range options {
 		if err := o(&pg.cfg); err != nil {
@@ -71,7 +90,8 @@ func New(options ...Option) (*Postgres, error) {
 	return pg, nil
 }
 
-// CreateDB creates a new database with given migrations and fixtures
+// CreateDB creates a new database with given migrations and fixtures, or a schema
+// of a shared one holding them with schema isolation
 func (p *Postgres) CreateDB(ctx context.Context, req *database.CreateDBRequest) (*database.CreateDBResponse, error) {
 	// connect to default database
 	conn, err := dbConnect(ctx, p.URI())
@@ -82,8 +102,37 @@ func (p *Postgres) CreateDB(ctx context.Context, req *database.CreateDBRequest)
 		_ = conn.Close()
 	}()
 
+	if req.Isolation == database.IsolationSchema {
+		return p.createSchemaDB(ctx, conn, req)
+	}
+
+	// the template of the request, for the pool to hand out a database cloned from
+	// it already and to keep more ready
+	var template string
+	if p.cfg.pool != nil {
+		if template, err = poolTemplate(req); err != nil {
+			return nil, err
+		}
+	}
+
 	// create a random name for new database
 	dbName := fmt.Sprintf("dbctl_%d", time.Now().UnixNano())
+	pooled := ""
+	if template != "" {
+		pooled = p.fromPool(ctx, conn, template)
+	}
+
+	// taken out of the pool, the database is dropped unless it is handed out
+	handedOut := false
+	if pooled != "" {
+		dbName = pooled
+		defer func() {
+			if !handedOut {
+				_ = dropDatabase(context.Background(), conn, dbName)
+			}
+		}()
+	}
+
 	newDB, err := New(WithHost(p.cfg.user, p.cfg.pass, dbName, p.cfg.port))
 	if err != nil {
 		return nil, err
@@ -91,6 +140,9 @@ func (p *Postgres) CreateDB(ctx context.Context, req *database.CreateDBRequest)
 	newURI := newDB.URI()
 
 	switch {
+	case pooled != "":
+		logger.Debug("Handing out database", dbName, "kept ready by the pool ...")
+
 	case req.WithDefaultMigrations:
 		if err := p.createDatabaseWithTemplate(ctx, conn, dbName, DefaultTemplate); err != nil {
 			if errors.Is(err, errDatabaseNotExists) {
@@ -111,15 +163,44 @@ func (p *Postgres) CreateDB(ctx context.Context, req *database.CreateDBRequest)
 		}
 	}
 
+	// the template exists by now, the pool clones it for the requests to come
+	if template != "" {
+		p.cfg.pool.refill(p, template)
+	}
+
+	p.trackTestDatabase(ctx, conn, dbName)
+
 	// fixtures always go to the database that was just created, never to the
 	// maintenance connection this method holds.
 	if len(req.Fixtures) != 0 {
-		if err := applyFixturesFromDir(ctx, nil, req.Fixtures, newURI); err != nil {
+		if err := applyFixturesFromDir(ctx, nil, req.Fixtures, newURI, p.cfg.seed); err != nil {
+			return nil, err
+		}
+	}
+
+	// the role is created last, so that it is given what the migrations and the
+	// fixtures created
+	user, pass := p.cfg.user, p.cfg.pass
+	if req.RestrictedRole {
+		if user, pass, err = p.createRole(ctx, conn, dbName, req.Grants); err != nil {
+			_ = dropDatabase(ctx, conn, dbName)
+			_ = dropRole(ctx, conn, dbName)
 			return nil, err
 		}
 	}
 
-	return &database.CreateDBResponse{URI: hostURI(newURI)}, nil
+	// the database is handed out on the replicas too, once they replayed creating it
+	p.findReplicas(ctx)
+	if err := p.waitForReplay(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	res := &database.CreateDBResponse{URI: p.clientURI(withUser(newURI, user, pass)), CA: p.cfg.certs.Authority()}
+	for _, r := range p.replicas {
+		res.ReplicaURIs = append(res.ReplicaURIs, p.clientURI(withUser(p.replicaURI(r, dbName), user, pass)))
+	}
+	handedOut = true
+	return res, nil
 }
 
 // createDatabaseFromMigrations creates dbName from a template holding the given
@@ -139,14 +220,15 @@ func (p *Postgres) createDatabaseFromMigrations(ctx context.Context, conn *sql.D
 		return createDatabase(ctx, conn, dbName)
 	}
 
-	template, err := templateName(migrationsPath, migrationFiles)
+	names, err := templateNames(migrationsPath, migrationFiles)
 	if err != nil {
 		return err
 	}
+	template := names[len(names)-1]
 	logger.Debug("template name is:", template)
 
 	// try to create the database from the template built by an earlier request
-	err = p.createDatabaseWithTemplate(ctx, conn, dbName, template)
+	err = p.cloneTemplate(ctx, conn, dbName, template)
 	if err == nil {
 		return nil
 	}
@@ -154,25 +236,117 @@ func (p *Postgres) createDatabaseFromMigrations(ctx context.Context, conn *sql.D
 		return err
 	}
 
-	logger.Debug("template database not found, creating a new database ...")
-	if err := createDatabase(ctx, conn, dbName); err != nil {
+	// build the template once, the requests missing it at the same time wait for
+	// it and clone it rather than running the same migrations side by side.
+	unlock, err := p.lockTemplate(ctx, conn, template)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = p.cloneTemplate(ctx, conn, dbName, template)
+	if err == nil {
+		logger.Debug("template", template, "was built by a concurrent request")
+		return nil
+	}
+	if !errors.Is(err, errDatabaseNotExists) {
+		return err
+	}
+
+	// an earlier instance may have built it, before it was stopped
+	if templateCacheEnabled(ctx, conn) {
+		restored, err := p.restoreTemplate(ctx, conn, template)
+		if err != nil {
+			logger.Warn(err.Error())
+		}
+		if restored {
+			logger.Info("Restored the template of the migrations from the cache")
+			return p.cloneTemplate(ctx, conn, dbName, template)
+		}
+	}
+
+	// a branch usually adds a few migrations to the ones a template was already
+	// built for, start from the template of the longest such prefix and only apply
+	// what follows it.
+	base, done, err := p.createDatabaseFromPrefix(ctx, conn, dbName, names[:len(names)-1])
+	if err != nil {
 		return err
 	}
 
-	// connect to new database and run migrations
-	if err := RunMigrations(ctx, nil, migrationFiles, dbURI); err != nil {
+	// connect to new database and run migrations, errors name the files relative
+	// to the migrations directory.
+	if err := applyMigrations(ctx, nil, migrationsPath, migrationFiles, done, base, dbURI); err != nil {
 		return err
 	}
 
-	// snapshot it as the template for the next request. a concurrent request may
-	// have created it in the meantime, which is harmless.
+	// snapshot it as the template for the next request
 	if err := p.createDatabaseWithTemplate(ctx, conn, template, dbName); err != nil {
 		logger.Debug("creating template database failed, migrations will run again next time:", err)
+		return nil
+	}
+
+	applied := make([]string, 0, len(migrationFiles))
+	for _, f := range migrationFiles {
+		applied = append(applied, displayName(migrationsPath, f))
+	}
+
+	meta := templateMeta{CreatedAt: time.Now().UTC(), Base: base, Files: applied}
+	if err := writeTemplateMeta(ctx, conn, template, meta); err != nil {
+		logger.Debug("storing the details of template", template, "failed:", err)
+	}
+
+	// dumped once the lock is released, the request does not wait for it either
+	if templateCacheEnabled(ctx, conn) {
+		p.caching.Add(1)
+		go p.cacheTemplateInBackground(template, meta)
 	}
 
 	return nil
 }
 
+// createDatabaseFromPrefix creates dbName from the template of the longest of the
+// given prefixes one exists for, prefixes being the template names templateNames
+// returns. It returns that template and how many migrations it already holds, when
+// there is none dbName is created empty and nothing is applied yet.
+func (p *Postgres) createDatabaseFromPrefix(ctx context.Context, conn *sql.DB, dbName string, prefixes []string) (string, int, error) {
+	i, err := longestTemplate(ctx, conn, prefixes)
+	if err != nil {
+		// only a shortcut, building from scratch still works
+		logger.Debug("looking up templates of earlier migrations failed:", err)
+		i = -1
+	}
+	// an earlier instance may have built a longer one, before it was stopped
+	i = p.restoreCachedPrefix(ctx, conn, prefixes, i)
+
+	if i >= 0 {
+		base := prefixes[i]
+		err := p.cloneTemplate(ctx, conn, dbName, base)
+		if err == nil {
+			return base, i + 1, nil
+		}
+		// it may have been pruned since it was looked up
+		if !errors.Is(err, errDatabaseNotExists) {
+			return "", 0, err
+		}
+	}
+
+	logger.Debug("template database not found, creating a new database ...")
+	return "", 0, createDatabase(ctx, conn, dbName)
+}
+
+// cloneTemplate creates name from one of the templates built from migrations and
+// counts the use of the template.
+func (p *Postgres) cloneTemplate(ctx context.Context, conn *sql.DB, name, template string) error {
+	if err := p.createDatabaseWithTemplate(ctx, conn, name, template); err != nil {
+		return err
+	}
+
+	if err := p.recordTemplateHit(ctx, conn, template); err != nil {
+		logger.Debug("recording the use of template", template, "failed:", err)
+	}
+	return nil
+}
+
 // hostURI rewrites a uri so that it is usable by the caller. The api server reaches
 // the databases through host.docker.internal, its clients run outside docker.
 func hostURI(uri string) string {
@@ -206,6 +380,18 @@ func (p *Postgres) createDatabaseWithTemplate(ctx context.Context, conn *sql.DB,
 	return nil
 }
 
+func (p *Postgres) createDefaultTemplate(ctx context.Context) error {
+	conn, err := p.connectOutside(ctx, p.cfg.name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	return p.createDatabaseWithTemplate(ctx, conn, DefaultTemplate, p.cfg.name)
+}
+
 // RemoveDB removes a database from postgres by given uri
 func (p *Postgres) RemoveDB(ctx context.Context, uri string) error {
 	// parse the uri to get database name
@@ -220,6 +406,11 @@ func (p *Postgres) RemoveDB(ctx context.Context, uri string) error {
 		return fmt.Errorf("uri %q does not contain a database name", uri)
 	}
 
+	// a schema handed out by schema isolation goes alone, the database is shared
+	if schema := schemaOf(u); schema != "" && dbName == SchemasDatabase {
+		return p.removeSchemaDB(ctx, schema)
+	}
+
 	conn, err := dbConnect(ctx, p.URI())
 	if err != nil {
 		return err
@@ -228,16 +419,29 @@ func (p *Postgres) RemoveDB(ctx context.Context, uri string) error {
 		_ = conn.Close()
 	}()
 
+	if err := dropDatabase(ctx, conn, dbName); err != nil {
+		return err
+	}
+
+	// a database handed out with a role of its own takes the role with it
+	if u.User != nil && u.User.Username() == roleName(dbName) {
+		return dropRole(ctx, conn, dbName)
+	}
+	return nil
+}
+
+// dropDatabase drops name, ending the sessions connected to it first.
+func dropDatabase(ctx context.Context, conn *sql.DB, name string) error {
 	// terminate the sessions still connected to it, postgres refuses to drop a
 	// database while anyone is attached to it and callers commonly still hold a
 	// pooled connection at cleanup time.
 	if _, err := conn.ExecContext(ctx,
 		"select pg_terminate_backend(pid) from pg_stat_activity where datname = $1 and pid <> pg_backend_pid()",
-		dbName); err != nil {
-		return fmt.Errorf("terminating connections to database %q failed: %w", dbName, err)
+		name); err != nil {
+		return fmt.Errorf("terminating connections to database %q failed: %w", name, err)
 	}
 
-	if _, err := conn.ExecContext(ctx, fmt.Sprintf("drop database if exists %s", quoteIdentifier(dbName))); err != nil {
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("drop database if exists %s", quoteIdentifier(name))); err != nil {
 		return fmt.Errorf("drop database failed: %w", err)
 	}
 
@@ -250,6 +454,12 @@ func quoteIdentifier(name string) string {
 	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
 }
 
+// quoteLiteral quotes a value as a postgres string literal, for the statements that
+// take no parameters.
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
 // Start starts a postgres database
 func (p *Postgres) Start(ctx context.Context, detach bool) error {
 	logger.Info(fmt.Sprintf("Starting postgres version %s ...", p.cfg.version))
@@ -260,23 +470,49 @@ func (p *Postgres) Start(ctx context.Context, detach bool) error {
 	}
 
 	logger.Info("Postgres is up and running")
+	if p.cfg.queryStats {
+		if err := p.createStatsDatabase(ctx); err != nil {
+			_ = closeFunc(ctx)
+			return err
+		}
+	}
+	// the dump is restored first, migrations newer than it are applied on top
+	if p.cfg.dump != nil {
+		if err := p.restoreDump(ctx); err != nil {
+			return err
+		}
+	}
+
 	// run migrations if exist
 	if err := RunMigrations(ctx, nil, p.cfg.migrationsFiles, p.URI()); err != nil {
 		return err
 	}
 
-	// create template database if migrations exist
-	if len(p.cfg.migrationsFiles) > 0 {
-		_ = p.createDatabaseWithTemplate(ctx, nil, DefaultTemplate, p.cfg.name)
+	// create template database if migrations or a dump exist
+	if len(p.cfg.migrationsFiles) > 0 || p.cfg.dump != nil {
+		// postgres refuses to clone a database with sessions on it, the own included
+		if err := p.createDefaultTemplate(ctx); err != nil {
+			logger.Warn(fmt.Sprintf("Creating %s failed, databases can not be created with the default migrations: %v", DefaultTemplate, err))
+		}
 
 		// run apply fixtures if exist
-		if err := ApplyFixtures(ctx, nil, p.cfg.fixtureFiles, p.URI()); err != nil {
+		if err := ApplyFixtures(ctx, nil, p.cfg.fixtureFiles, p.URI(), p.cfg.seed); err != nil {
 			return err
 		}
 	}
 
 	// print connection url
-	logger.Info(fmt.Sprintf("Database uri is: %q", p.URI()))
+	logger.Info(fmt.Sprintf("Database uri is: %q", p.clientURI(p.URI())))
+	for i, uri := range p.ReplicaURIs() {
+		logger.Info(fmt.Sprintf("Replica %d uri is: %q", i+1, p.clientURI(uri)))
+	}
+	p.logCertificates()
+	if p.cfg.logQueries {
+		logger.Info("Queries are logged, read them with 'dbctl logs pg --queries'")
+	}
+	if p.cfg.queryStats {
+		logger.Info("Queries are tracked, report on them with 'dbctl report queries'")
+	}
 
 	var pgwebCloseFunc database.CloseFunc
 	if p.cfg.withUI {
@@ -310,9 +546,15 @@ func (p *Postgres) Start(ctx context.Context, detach bool) error {
 	return closeFunc(shutdownCtx)
 }
 
-// Stop stops a postgres database
+// Stop stops a postgres database, along with its replicas
 func (p *Postgres) Stop(ctx context.Context) error {
-	return container.TerminateByID(ctx, p.containerID)
+	p.waitForCaching(ctx)
+	p.findReplicas(ctx)
+	err := errors.Join(p.stopReplicas(ctx), container.TerminateByID(ctx, p.containerID))
+	if err != nil {
+		return err
+	}
+	return errors.Join(p.removeNetwork(ctx), certs.Remove(p.cfg.certs))
 }
 
 // WaitForStart waits for postgres to start
@@ -390,6 +632,54 @@ func Instances(ctx context.Context, label string) ([]database.Info, error) {
 	return out, nil
 }
 
+// Running returns a controller for the running postgres instance, the one carrying
+// the given label when there are several.
+func Running(ctx context.Context, label string) (*Postgres, error) {
+	instance, err := database.FindInstance(ctx, database.TypePostgres, label)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := New(WithInstance(instance))
+	if err != nil {
+		return nil, err
+	}
+
+	p.containerID = instance.ID
+	p.findReplicas(ctx)
+	return p, nil
+}
+
+// RunningOrThrowaway returns the running postgres instance, or starts a throwaway
+// one of version on a free port when none is running, for the commands that only
+// need an instance to apply migrations on. The returned func stops the throwaway
+// instance, whose logs go to logs.
+func RunningOrThrowaway(ctx context.Context, label, version string, logs io.Writer) (*Postgres, func(), error) {
+	p, err := Running(ctx, label)
+	if err == nil {
+		return p, func() {}, nil
+	}
+	if !errors.Is(err, database.ErrNoInstance) || label != "" {
+		return nil, nil, err
+	}
+
+	p, err = New(
+		WithHost(DefaultUser, DefaultPass, DefaultName, uint32(utils.GetAvailablePort())),
+		WithVersion(version),
+		WithLogger(logs),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := p.Start(ctx, true); err != nil {
+		return nil, nil, err
+	}
+	return p, func() {
+		_ = p.Stop(ctx)
+	}, nil
+}
+
 func (p *Postgres) startUsingDocker(ctx context.Context, timeout time.Duration) (database.CloseFunc, error) {
 	var rnd, err = rand.Int(rand.Reader, big.NewInt(20))
 	if err != nil {
@@ -403,6 +693,16 @@ func (p *Postgres) startUsingDocker(ctx context.Context, timeout time.Duration)
 	}
 
 	port := strconv.Itoa(int(p.cfg.port))
+	args := []string{"postgres", "-c", "fsync=off", "-c", "synchronous_commit=off", "-c", "full_page_writes=off"}
+	if p.cfg.logQueries {
+		args = append(args, queryLogArgs()...)
+	}
+	if p.cfg.queryStats {
+		args = append(args, queryStatsArgs()...)
+	}
+	if p.cfg.tls {
+		args = append(args, tlsArgs()...)
+	}
 	req := container.CreateRequest{
 		Image: getPostGisImage(p.cfg.version),
 		Env: map[string]string{
@@ -410,10 +710,13 @@ func (p *Postgres) startUsingDocker(ctx context.Context, timeout time.Duration)
 			"POSTGRES_USER":     p.cfg.user,
 			"POSTGRES_DB":       p.cfg.name,
 		},
-		Cmd:          []string{"postgres", "-c", "fsync=off", "-c", "synchronous_commit=off", "-c", "full_page_writes=off"},
+		Cmd:          args,
 		ExposedPorts: []string{container.PortSpec(port, "5432/tcp")},
 		Name:         fmt.Sprintf("dbctl_pg_%d_%d", time.Now().Unix(), rnd.Uint64()),
-		Labels:       map[string]string{container.LabelType: database.LabelPostgres},
+		Labels: map[string]string{
+			container.LabelType: database.LabelPostgres,
+			container.LabelRole: container.RolePrimary,
+		},
 	}
 
 	for k, v := range database.ConnectionLabels(p.cfg.user, p.cfg.pass, p.cfg.name, p.cfg.port) {
@@ -424,18 +727,73 @@ func (p *Postgres) startUsingDocker(ctx context.Context, timeout time.Duration)
 		req.Labels[container.LabelCustom] = p.cfg.label
 	}
 
+	if p.cfg.templateCache != "" {
+		dir := templateCacheDir(p.cfg.templateCache, req.Image)
+		mount, err := prepareTemplateCache(dir)
+		if err != nil {
+			return nil, err
+		}
+		if mount {
+			req.Mounts = append(req.Mounts, container.Mount{Source: dir, Target: TemplateCacheMount})
+		}
+	}
+
+	if p.cfg.dump != nil {
+		req.Mounts = append(req.Mounts, container.Mount{Source: p.cfg.dump.path, Target: p.cfg.dump.target(), ReadOnly: true})
+	}
+
+	if p.cfg.tls {
+		clientName := ""
+		if p.cfg.tlsClientCert {
+			clientName = p.cfg.user
+		}
+		if p.cfg.certs, err = certs.New(req.Name, clientName); err != nil {
+			return nil, err
+		}
+		req.Cmd = certs.Command("postgres", args)
+		req.Mounts = append(req.Mounts, certs.Mount(p.cfg.certs))
+		for k, v := range database.TLSLabels(p.cfg.certs) {
+			req.Labels[k] = v
+		}
+	}
+
+	// the replicas reach the primary by its name on a network of their own
+	if p.cfg.replicas > 0 {
+		network := req.Name + "_net"
+		if _, err := container.CreateNetwork(ctx, network, map[string]string{container.LabelNetwork: network}); err != nil {
+			_ = certs.Remove(p.cfg.certs)
+			return nil, err
+		}
+		p.network = network
+		req.Network = network
+		req.Labels[container.LabelNetwork] = network
+	}
+
 	pg, err := container.Run(ctx, req)
 	if err != nil {
+		_ = p.removeNetwork(ctx)
+		_ = certs.Remove(p.cfg.certs)
 		return nil, err
 	}
 
 	p.containerID = pg.ID
+	p.replicasKnown = true
 
 	closeFunc := func(ctx context.Context) error {
-		return pg.Terminate(ctx)
+		return p.Stop(ctx)
+	}
+
+	if err := p.WaitForStart(ctx, timeout); err != nil {
+		return closeFunc, err
 	}
 
-	return closeFunc, p.WaitForStart(ctx, timeout)
+	if p.cfg.replicas > 0 {
+		if err := p.startReplicas(ctx, req.Name, args); err != nil {
+			_ = closeFunc(context.Background())
+			return nil, err
+		}
+	}
+	return closeFunc, nil
 }
 
 // URI returns the postgres connection uri
@@ -459,32 +817,46 @@ func RunMigrations(ctx context.Context, conn *sql.DB, migrationsFiles []string,
 		return nil
 	}
 
-	logger.Info("Applying migrations ...")
-	return applySQL(ctx, conn, migrationsFiles, uri)
+	return applyMigrations(ctx, conn, "", migrationsFiles, 0, "", uri)
+}
+
+// applyMigrations applies files after the first done of them, which base, a template,
+// already holds. Every migration is applied through here, so that they are logged
+// and their errors located the same way.
+func applyMigrations(ctx context.Context, conn *sql.DB, root string, files []string, done int, base, uri string) error {
+	remaining := files[done:]
+	if base == "" {
+		logger.Info("Applying migrations ...")
+	} else {
+		logger.Info(fmt.Sprintf("Applying %d of %d migrations on top of template %s ...",
+			len(remaining), len(files), strings.TrimPrefix(base, TemplatePrefix)))
+	}
+	return applySQL(ctx, conn, root, remaining, uri)
 }
 
-// ApplyFixtures applies fixtures on a postgres database
-func ApplyFixtures(ctx context.Context, conn *sql.DB, fixtureFiles []string, uri string) error {
+// ApplyFixtures applies fixtures on a postgres database, the ones written as templates
+// are rendered with seed.
+func ApplyFixtures(ctx context.Context, conn *sql.DB, fixtureFiles []string, uri string, seed int64) error {
 	if len(fixtureFiles) == 0 {
 		return nil
 	}
 
 	logger.Info("Applying fixtures ...")
-	return applySQL(ctx, conn, fixtureFiles, uri)
+	return applyFixtures(ctx, conn, "", fixtureFiles, uri, seed)
 }
 
-func applyFixturesFromDir(ctx context.Context, conn *sql.DB, dir string, uri string) error {
+func applyFixturesFromDir(ctx context.Context, conn *sql.DB, dir string, uri string, seed int64) error {
 	if dir == "" {
 		return nil
 	}
 
-	files, err := getFiles(dir)
+	files, err := getFixtureFiles(dir)
 	if err != nil {
 		return fmt.Errorf("read fixtures failed: %w", err)
 	}
 
 	logger.Info("Applying fixtures ...")
-	return applySQL(ctx, conn, files, uri)
+	return applyFixtures(ctx, conn, dir, files, uri, seed)
 }
 
 func createDatabase(ctx context.Context, conn *sql.DB, name string) error {
@@ -494,7 +866,9 @@ func createDatabase(ctx context.Context, conn *sql.DB, name string) error {
 	return nil
 }
 
-func applySQL(ctx context.Context, conn *sql.DB, stmts []string, uri string) error {
+// applySQL applies the given files in order. Files are named relative to root in
+// errors, when root is set.
+func applySQL(ctx context.Context, conn *sql.DB, root string, stmts []string, uri string) error {
 	if conn == nil {
 		var err error
 		conn, err = dbConnect(ctx, uri)
@@ -512,10 +886,47 @@ func applySQL(ctx context.Context, conn *sql.DB, stmts []string, uri string) err
 			return fmt.Errorf("read file (%s) failed: %w", f, err)
 		}
 
-		// one transaction per file, so a failing file does not leave a half
-		// applied schema behind that would then be cached as a template.
-		if err := applyInTx(ctx, conn, string(b)); err != nil {
-			return fmt.Errorf("applying file (%s) failed: %w", f, err)
+		if err := applySource(ctx, conn, displayName(root, f), string(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySource applies the SQL of the file called name.
+func applySource(ctx context.Context, conn *sql.DB, name, src string) error {
+	// statements such as CREATE INDEX CONCURRENTLY refuse to run in a
+	// transaction, files marked for it are applied one statement at a time.
+	if noTransaction(src) {
+		if err := applyEach(ctx, conn, src); err != nil {
+			return newSourceError(name, src, err)
+		}
+		return nil
+	}
+
+	// one transaction per file, so a failing file does not leave a half
+	// applied schema behind that would then be cached as a template.
+	if err := applyInTx(ctx, conn, src); err != nil {
+		return newSourceError(name, src, err)
+	}
+	return nil
+}
+
+// applyEach runs the statements of a file one by one, outside of a transaction. They
+// share one session, so that a SET early in the file still holds for the statements
+// after it.
+func applyEach(ctx context.Context, conn *sql.DB, src string) error {
+	session, err := conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = session.Close()
+	}()
+
+	for i, stmt := range splitStatements(src) {
+		if _, err := session.ExecContext(ctx, stmt.sql); err != nil {
+			return &statementError{number: i + 1, stmt: stmt, err: err}
 		}
 	}
 	return nil
@@ -0,0 +1,390 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// poolIdle is how long the databases of a template are kept ready after it was last
+// asked for. A branch switched away from leaves its template behind, its databases
+// go with it rather than piling up in the instance.
+const poolIdle = 30 * time.Minute
+
+// PoolConfig is how many databases a Pool keeps ready.
+type PoolConfig struct {
+	// Size is the number of databases kept ready for each template recently asked for
+	Size int
+	// Targets overrides Size for the templates it names
+	Targets map[string]int
+}
+
+// Enabled reports whether c keeps any database ready.
+func (c PoolConfig) Enabled() bool {
+	return c.Size > 0 || len(c.Targets) > 0
+}
+
+// ParsePoolTargets parses the targets of a pool written as template=count, separated
+// by commas. A template is named by its hash as `dbctl templates` lists it, or as
+// dbctl_template for the one of the default migrations.
+func ParsePoolTargets(s string) (map[string]int, error) {
+	targets := map[string]int{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, count, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("pool target %q is not template=count", part)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("pool target %q is not template=count", part)
+		}
+
+		name = strings.TrimSpace(name)
+		if name != DefaultTemplate && !strings.HasPrefix(name, TemplatePrefix) {
+			name = TemplatePrefix + name
+		}
+		targets[name] = n
+	}
+	return targets, nil
+}
+
+// Pool keeps databases cloned from the templates recently asked for ready, so that
+// CreateDB hands one out at once instead of cloning while the test waits. It is
+// refilled in the background. A Pool is shared by the requests of the api server.
+type Pool struct {
+	cfg PoolConfig
+
+	// ctx is done once the pool is closed, ending the refills
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	entries map[string]*poolEntry
+}
+
+// poolEntry holds the databases ready for a template of an instance.
+type poolEntry struct {
+	// instance is the instance of the template, the one its databases are created on
+	instance *Postgres
+	template string
+	ready    []string
+	filling  bool
+
+	hits     int
+	misses   int
+	lastUsed time.Time
+}
+
+// PoolStatus tells how a Pool is doing, for the status endpoint of the api server.
+type PoolStatus struct {
+	Size      int                  `json:"size"`
+	Templates []PoolTemplateStatus `json:"templates"`
+}
+
+// PoolTemplateStatus tells how a Pool is doing for one template.
+type PoolTemplateStatus struct {
+	Port     uint32    `json:"port"`
+	Template string    `json:"template"`
+	Target   int       `json:"target"`
+	Ready    int       `json:"ready"`
+	Hits     int       `json:"hits"`
+	Misses   int       `json:"misses"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// NewPool creates a pool keeping cfg.Size databases ready for each template.
+func NewPool(cfg PoolConfig) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{cfg: cfg, ctx: ctx, cancel: cancel, entries: map[string]*poolEntry{}}
+}
+
+// target is the number of databases kept ready for template.
+func (pl *Pool) target(template string) int {
+	if n, ok := pl.cfg.Targets[template]; ok {
+		return n
+	}
+	return pl.cfg.Size
+}
+
+func poolKey(p *Postgres, template string) string {
+	return fmt.Sprintf("%d/%s", p.cfg.port, template)
+}
+
+// take hands out a database of template ready on the instance of p, empty when
+// there is none.
+func (pl *Pool) take(p *Postgres, template string) string {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	key := poolKey(p, template)
+	e, ok := pl.entries[key]
+	if !ok {
+		e = &poolEntry{instance: p, template: template}
+		pl.entries[key] = e
+	}
+	e.lastUsed = time.Now()
+
+	if len(e.ready) == 0 {
+		e.misses++
+		return ""
+	}
+
+	e.hits++
+	name := e.ready[0]
+	e.ready = e.ready[1:]
+	return name
+}
+
+// refill clones template until the target of its databases are ready, in the
+// background. It is called once the template exists.
+func (pl *Pool) refill(p *Postgres, template string) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	key := poolKey(p, template)
+	e, ok := pl.entries[key]
+	if !ok || e.filling || pl.closed || len(e.ready) >= pl.target(template) {
+		return
+	}
+
+	e.filling = true
+	pl.wg.Add(1)
+	go pl.fill(key, e)
+}
+
+func (pl *Pool) fill(key string, e *poolEntry) {
+	defer pl.wg.Done()
+
+	done := func() {
+		pl.mu.Lock()
+		e.filling = false
+		pl.mu.Unlock()
+	}
+
+	for {
+		pl.mu.Lock()
+		wanted := !pl.closed && pl.entries[key] == e && len(e.ready) < pl.target(e.template)
+		pl.mu.Unlock()
+		if !wanted {
+			done()
+			return
+		}
+
+		name, err := e.instance.clonePooled(pl.ctx, e.template)
+		if err != nil {
+			logger.Debug("filling the pool of template", e.template, "failed:", err)
+			done()
+			return
+		}
+
+		pl.mu.Lock()
+		// the entry may have been dropped or the pool closed while cloning
+		kept := !pl.closed && pl.entries[key] == e
+		if kept {
+			e.ready = append(e.ready, name)
+		}
+		pl.mu.Unlock()
+
+		if !kept {
+			e.instance.dropPooled(context.Background(), []string{name})
+			done()
+			return
+		}
+	}
+}
+
+// Status returns how the pool is doing, the templates ordered by how recently they
+// were asked for. A nil pool keeps nothing ready.
+func (pl *Pool) Status() PoolStatus {
+	if pl == nil {
+		return PoolStatus{Templates: []PoolTemplateStatus{}}
+	}
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	status := PoolStatus{Size: pl.cfg.Size, Templates: make([]PoolTemplateStatus, 0, len(pl.entries))}
+	for _, e := range pl.entries {
+		status.Templates = append(status.Templates, PoolTemplateStatus{
+			Port:     e.instance.cfg.port,
+			Template: e.template,
+			Target:   pl.target(e.template),
+			Ready:    len(e.ready),
+			Hits:     e.hits,
+			Misses:   e.misses,
+			LastUsed: e.lastUsed,
+		})
+	}
+
+	sort.Slice(status.Templates, func(i, j int) bool {
+		return status.Templates[i].LastUsed.After(status.Templates[j].LastUsed)
+	})
+	return status
+}
+
+// Run drops the databases of the templates not asked for in a while, until ctx is
+// done. The pool is closed then, dropping every database it kept ready.
+func (pl *Pool) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			pl.Close()
+			return
+		case <-ticker.C:
+			pl.dropIdle(time.Now().Add(-poolIdle))
+		}
+	}
+}
+
+// dropIdle drops the entries of the templates last asked for before since.
+func (pl *Pool) dropIdle(since time.Time) {
+	pl.mu.Lock()
+	var idle []*poolEntry
+	for key, e := range pl.entries {
+		if e.lastUsed.Before(since) {
+			idle = append(idle, e)
+			delete(pl.entries, key)
+		}
+	}
+	pl.mu.Unlock()
+
+	for _, e := range idle {
+		e.instance.dropPooled(pl.ctx, e.ready)
+	}
+}
+
+// Close stops refilling the pool and drops the databases it kept ready.
+func (pl *Pool) Close() {
+	pl.mu.Lock()
+	if pl.closed {
+		pl.mu.Unlock()
+		return
+	}
+	pl.closed = true
+	pl.mu.Unlock()
+
+	pl.cancel()
+	pl.wg.Wait()
+
+	pl.mu.Lock()
+	entries := pl.entries
+	pl.entries = map[string]*poolEntry{}
+	pl.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, e := range entries {
+		e.instance.dropPooled(ctx, e.ready)
+	}
+}
+
+// poolTemplate is the template a database of req is cloned from, empty for the ones
+// not cloned from a template.
+func poolTemplate(req *database.CreateDBRequest) (string, error) {
+	if req.Isolation == database.IsolationSchema {
+		return "", nil
+	}
+	if req.WithDefaultMigrations {
+		return DefaultTemplate, nil
+	}
+
+	files, err := getFiles(req.Migrations)
+	if err != nil {
+		return "", fmt.Errorf("read migraions failed: %w", err)
+	}
+	migrationFiles := MigrationFiles(files)
+	if len(migrationFiles) == 0 {
+		return "", nil
+	}
+
+	names, err := templateNames(req.Migrations, migrationFiles)
+	if err != nil {
+		return "", err
+	}
+	return names[len(names)-1], nil
+}
+
+// fromPool hands out a database of template the pool of p keeps ready, empty when
+// there is none. conn is connected to the database of the instance.
+func (p *Postgres) fromPool(ctx context.Context, conn *sql.DB, template string) string {
+	for {
+		name := p.cfg.pool.take(p, template)
+		if name == "" {
+			return ""
+		}
+
+		// the instance may have been restarted since, taking its databases along
+		var exists bool
+		err := conn.QueryRowContext(ctx, "select exists(select from pg_database where datname = $1)", name).Scan(&exists)
+		if err != nil {
+			return ""
+		}
+		if !exists {
+			continue
+		}
+
+		if strings.HasPrefix(template, TemplatePrefix) {
+			if err := p.recordTemplateHit(ctx, conn, template); err != nil {
+				logger.Debug("recording the use of template", template, "failed:", err)
+			}
+		}
+		return name
+	}
+}
+
+// clonePooled creates a database of template for the pool to keep ready.
+func (p *Postgres) clonePooled(ctx context.Context, template string) (string, error) {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	name := fmt.Sprintf("dbctl_%d", time.Now().UnixNano())
+	if err := p.createDatabaseWithTemplate(ctx, conn, name, template); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// dropPooled drops databases the pool kept ready and will not hand out.
+func (p *Postgres) dropPooled(ctx context.Context, names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		logger.Debug("dropping the databases of the pool failed:", err)
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for _, name := range names {
+		if err := dropDatabase(ctx, conn, name); err != nil {
+			logger.Debug("dropping the databases of the pool failed:", err)
+		}
+	}
+}
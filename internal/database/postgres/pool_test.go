@@ -0,0 +1,75 @@
+package pg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePoolTargets(t *testing.T) {
+	targets, err := ParsePoolTargets("ab12=5, dbctl_tpl_cd34=0,dbctl_template=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"dbctl_tpl_ab12": 5, "dbctl_tpl_cd34": 0, DefaultTemplate: 2}
+	if len(targets) != len(want) {
+		t.Fatalf("unexpected targets %v", targets)
+	}
+	for name, n := range want {
+		if targets[name] != n {
+			t.Fatalf("unexpected target of %s in %v", name, targets)
+		}
+	}
+
+	for _, invalid := range []string{"ab12", "ab12=many", "ab12=-1"} {
+		if _, err := ParsePoolTargets(invalid); err == nil {
+			t.Fatalf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestPoolTake(t *testing.T) {
+	pl := NewPool(PoolConfig{Size: 3, Targets: map[string]int{"dbctl_tpl_b": 1}})
+	defer pl.Close()
+
+	p, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := pl.take(p, "dbctl_tpl_a"); name != "" {
+		t.Fatalf("an empty pool handed out %q", name)
+	}
+
+	pl.entries[poolKey(p, "dbctl_tpl_a")].ready = []string{"dbctl_1", "dbctl_2"}
+	if name := pl.take(p, "dbctl_tpl_a"); name != "dbctl_1" {
+		t.Fatalf("unexpected database %q", name)
+	}
+	pl.take(p, "dbctl_tpl_b")
+
+	status := pl.Status()
+	if len(status.Templates) != 2 || status.Size != 3 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// the template asked for last comes first
+	b, a := status.Templates[0], status.Templates[1]
+	if b.Template != "dbctl_tpl_b" || b.Target != 1 || b.Misses != 1 {
+		t.Fatalf("unexpected status of the template with a target %+v", b)
+	}
+	if a.Target != 3 || a.Ready != 1 || a.Hits != 1 || a.Misses != 1 {
+		t.Fatalf("unexpected status %+v", a)
+	}
+
+	// no instance to drop the databases on
+	pl.entries[poolKey(p, "dbctl_tpl_a")].ready = nil
+	pl.dropIdle(time.Now().Add(time.Hour))
+	if len(pl.Status().Templates) != 0 {
+		t.Fatal("templates not asked for in a while were kept")
+	}
+
+	var none *Pool
+	if none.Status().Templates == nil {
+		t.Fatal("the status of no pool lists no templates as null")
+	}
+}
@@ -0,0 +1,223 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// queryLogPrefix starts every line postgres logs. %q ends it for the processes
+// without a session, the ones that do not run statements.
+const queryLogPrefix = "%m [%p] %q%u@%d "
+
+// queryLogChunk is the most of the log read at a time.
+const queryLogChunk = 4 << 20
+
+// ErrQueryLogOff is returned reading the queries of an instance that does not log
+// them.
+var ErrQueryLogOff = errors.New("queries are not logged, start postgres with --log-queries")
+
+// queryLogLine matches the first line of an entry of the log. The lines up to the
+// next entry are the rest of a statement written over several lines.
+var queryLogLine = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \S+ \S+ \[\d+\] (?:(\S*)@(\S*) )?([A-Z0-9]+):  `)
+
+// queryLogArgs are the settings of an instance logging its queries. They go to
+// files of the data directory rather than to the output of the container, so that
+// they can be read through a connection, by the api server too.
+func queryLogArgs() []string {
+	return []string{
+		"-c", "logging_collector=on",
+		"-c", "log_statement=all",
+		"-c", "log_line_prefix=" + queryLogPrefix,
+	}
+}
+
+// QueryLogEntry is an entry of the query log: a statement, its parameters or what
+// postgres had to say about it.
+type QueryLogEntry struct {
+	Database string `json:"database"`
+	Severity string `json:"severity"`
+	// Text is the entry as postgres wrote it, every line of the statement included.
+	Text string `json:"text"`
+}
+
+// queryLogParser splits the log into entries as it is read. An entry is complete
+// once the next one starts, or once nothing more is written.
+type queryLogParser struct {
+	rest    string
+	pending *QueryLogEntry
+}
+
+// feed adds what was read from the log and returns the entries it completes.
+func (q *queryLogParser) feed(data string) []QueryLogEntry {
+	data = q.rest + data
+	end := strings.LastIndexByte(data, '\n')
+	if end < 0 {
+		q.rest = data
+		return nil
+	}
+	q.rest = data[end+1:]
+
+	var out []QueryLogEntry
+	for _, line := range strings.Split(data[:end], "\n") {
+		m := queryLogLine.FindStringSubmatch(line)
+		if m == nil {
+			// the rest of an entry logged before the log was read is dropped
+			if q.pending != nil {
+				q.pending.Text += "\n" + line
+			}
+			continue
+		}
+
+		if q.pending != nil {
+			out = append(out, *q.pending)
+		}
+		q.pending = &QueryLogEntry{Database: m[2], Severity: m[3], Text: line}
+	}
+	return out
+}
+
+// flush returns the entry still held, once the log was read to its end.
+func (q *queryLogParser) flush() []QueryLogEntry {
+	if q.pending == nil {
+		return nil
+	}
+	e := *q.pending
+	q.pending = nil
+	return []QueryLogEntry{e}
+}
+
+// QueryLog calls fn with the entries the query log holds for db, by name or uri,
+// for every database when empty. It returns once the log is read to its end, or
+// keeps reading what gets logged until ctx is done when follow is set.
+func (p *Postgres) QueryLog(ctx context.Context, db string, follow bool, fn func(QueryLogEntry) error) error {
+	var name string
+	if db != "" {
+		var err error
+		if name, err = p.databaseName(db); err != nil {
+			return err
+		}
+	}
+
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var logged bool
+	if err := conn.QueryRowContext(ctx,
+		"select current_setting('logging_collector') = 'on' and current_setting('log_statement') = 'all'").Scan(&logged); err != nil {
+		return fmt.Errorf("read log settings failed: %w", err)
+	}
+	if !logged {
+		return ErrQueryLogOff
+	}
+
+	emit := func(entries []QueryLogEntry) error {
+		for _, e := range entries {
+			if name != "" && e.Database != name {
+				continue
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	var parser queryLogParser
+	offsets := map[string]int64{}
+	for {
+		data, err := readQueryLog(ctx, conn, offsets)
+		if err != nil {
+			if follow && ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if err := emit(parser.feed(data)); err != nil {
+			return err
+		}
+		if data != "" {
+			continue
+		}
+
+		if err := emit(parser.flush()); err != nil {
+			return err
+		}
+		if !follow {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// readQueryLog reads what was logged past offsets, kept by file of the log, and
+// moves them past what it read. It returns nothing once every file is read.
+func readQueryLog(ctx context.Context, conn *sql.DB, offsets map[string]int64) (string, error) {
+	rows, err := conn.QueryContext(ctx, "select name, size from pg_ls_logdir() where name like '%.log' order by modification, name")
+	if err != nil {
+		return "", fmt.Errorf("list log files failed: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	type logFile struct {
+		name string
+		size int64
+	}
+	var files []logFile
+	for rows.Next() {
+		var f logFile
+		if err := rows.Scan(&f.name, &f.size); err != nil {
+			return "", fmt.Errorf("list log files failed: %w", err)
+		}
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("list log files failed: %w", err)
+	}
+
+	for _, f := range files {
+		offset := offsets[f.name]
+		if f.size <= offset {
+			continue
+		}
+
+		n := f.size - offset
+		if n > queryLogChunk {
+			n = queryLogChunk
+		}
+
+		// read as bytes, a chunk may end in the middle of a character
+		var data []byte
+		if err := conn.QueryRowContext(ctx,
+			"select pg_read_binary_file(current_setting('log_directory') || '/' || $1, $2, $3)",
+			f.name, offset, n).Scan(&data); err != nil {
+			return "", fmt.Errorf("read log file %s failed: %w", f.name, err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		offsets[f.name] = offset + int64(len(data))
+		return string(data), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,42 @@
+package pg
+
+import "testing"
+
+func TestQueryLogParser(t *testing.T) {
+	var q queryLogParser
+
+	// the rest of an entry logged before the log was read is dropped, an entry is
+	// only complete once the next one starts
+	entries := q.feed("\tfrom users\n" +
+		"2023-10-11 10:00:00.000 UTC [42] postgres@dbctl_1 LOG:  statement: select *\n" +
+		"\tfrom orders\n" +
+		"2023-10-11 10:00:00.001 UTC [7] LOG:  checkpoint starting: time\n" +
+		"2023-10-11 10:00:00.002 UTC [43] postgres@dbctl_2 LOG:  execute <unnamed>: select $1\n" +
+		"2023-10-11 10:00:00.002 UTC [43] post")
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	if entries[0].Database != "dbctl_1" || entries[0].Severity != "LOG" {
+		t.Fatalf("unexpected entry %+v", entries[0])
+	}
+	if entries[0].Text != "2023-10-11 10:00:00.000 UTC [42] postgres@dbctl_1 LOG:  statement: select *\n\tfrom orders" {
+		t.Fatalf("unexpected text %q", entries[0].Text)
+	}
+	if entries[1].Database != "" {
+		t.Fatalf("a process without a session has no database, got %+v", entries[1])
+	}
+
+	// a line is only parsed once it is written to its end
+	entries = q.feed("gres@dbctl_2 DETAIL:  parameters: $1 = '1'\n")
+	if len(entries) != 1 || entries[0].Database != "dbctl_2" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+
+	entries = q.flush()
+	if len(entries) != 1 || entries[0].Severity != "DETAIL" || entries[0].Database != "dbctl_2" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if len(q.flush()) != 0 {
+		t.Fatal("flush returned an entry twice")
+	}
+}
@@ -0,0 +1,258 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// StatsDatabase holds pg_stat_statements and the test databases it reports on. The
+// statistics of a test database outlive it, it is usually dropped by the time they
+// are read, so its name is recorded when it is created.
+const StatsDatabase = "dbctl_stats"
+
+// ErrQueryStatsOff is returned reporting the queries of an instance that does not
+// keep statistics of them.
+var ErrQueryStatsOff = errors.New("queries are not tracked, start postgres with --query-stats")
+
+// queryStatsArgs are the settings of an instance tracking the statistics of its
+// statements.
+func queryStatsArgs() []string {
+	return []string{
+		"-c", "shared_preload_libraries=pg_stat_statements",
+		"-c", "pg_stat_statements.track=all",
+	}
+}
+
+// createStatsDatabase creates the database the statistics are read from, next to
+// the databases of the instance rather than in them, so that the extension does not
+// end up in templates and the databases cloned from them.
+func (p *Postgres) createStatsDatabase(ctx context.Context) error {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, "select exists(select from pg_database where datname = $1)", StatsDatabase).Scan(&exists); err != nil {
+		return fmt.Errorf("create stats database failed: %w", err)
+	}
+	if !exists {
+		if err := createDatabase(ctx, conn, StatsDatabase); err != nil {
+			return err
+		}
+	}
+
+	stats, err := p.connectTo(ctx, StatsDatabase)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stats.Close()
+	}()
+
+	for _, stmt := range []string{
+		"create extension if not exists pg_stat_statements",
+		"create table if not exists test_databases (oid oid primary key, name text not null, created_at timestamptz not null default now())",
+	} {
+		if _, err := stats.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create stats database failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// trackTestDatabase records name as a test database the statistics are reported
+// for, on the instances tracking them.
+func (p *Postgres) trackTestDatabase(ctx context.Context, conn *sql.DB, name string) {
+	var tracked bool
+	if err := conn.QueryRowContext(ctx, "select exists(select from pg_database where datname = $1)", StatsDatabase).Scan(&tracked); err != nil || !tracked {
+		return
+	}
+
+	var oid int64
+	if err := conn.QueryRowContext(ctx, "select oid::bigint from pg_database where datname = $1", name).Scan(&oid); err != nil {
+		logger.Debug("looking up database", name, "for its query statistics failed:", err)
+		return
+	}
+
+	stats, err := p.connectTo(ctx, StatsDatabase)
+	if err != nil {
+		logger.Debug("recording database", name, "for its query statistics failed:", err)
+		return
+	}
+	defer func() {
+		_ = stats.Close()
+	}()
+
+	if _, err := stats.ExecContext(ctx,
+		"insert into test_databases (oid, name) values ($1, $2) on conflict (oid) do update set name = excluded.name, created_at = now()",
+		oid, name); err != nil {
+		logger.Debug("recording database", name, "for its query statistics failed:", err)
+	}
+}
+
+// QueryStat is what pg_stat_statements knows about a normalised statement, the
+// statements differing only by their constants taken as one.
+type QueryStat struct {
+	Query   string  `json:"query"`
+	Calls   int64   `json:"calls"`
+	Rows    int64   `json:"rows"`
+	TotalMS float64 `json:"total_ms"`
+	MeanMS  float64 `json:"mean_ms"`
+}
+
+// DatabaseQueries are the statements a test database ran that took the longest in
+// total and that ran most often, the ones pointing at missing indexes and N+1
+// queries.
+type DatabaseQueries struct {
+	Database  string      `json:"database"`
+	CreatedAt time.Time   `json:"created_at"`
+	Slowest   []QueryStat `json:"slowest"`
+	Frequent  []QueryStat `json:"frequent"`
+}
+
+// QueryReport returns the top statements of every test database created on the
+// instance, in the order they were created. db keeps the ones of one database, by
+// name or uri, when it is given.
+func (p *Postgres) QueryReport(ctx context.Context, db string, top int) ([]DatabaseQueries, error) {
+	var name string
+	if db != "" {
+		var err error
+		if name, err = p.databaseName(db); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := p.statsConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// the timing columns were renamed in postgres 13
+	var version int
+	if err := conn.QueryRowContext(ctx, "select current_setting('server_version_num')::int").Scan(&version); err != nil {
+		return nil, fmt.Errorf("read server version failed: %w", err)
+	}
+	total, mean := "total_exec_time", "mean_exec_time"
+	if version < 130000 {
+		total, mean = "total_time", "mean_time"
+	}
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(`select d.name, d.created_at, s.query, s.calls, s.rows, s.%s, s.%s
+from pg_stat_statements s join test_databases d on d.oid = s.dbid
+where $1 = '' or d.name = $1
+order by d.created_at, d.name`, total, mean), name)
+	if err != nil {
+		return nil, fmt.Errorf("read query statistics failed: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var out []DatabaseQueries
+	var stats []QueryStat
+	for rows.Next() {
+		var dbName string
+		var createdAt time.Time
+		var s QueryStat
+		if err := rows.Scan(&dbName, &createdAt, &s.Query, &s.Calls, &s.Rows, &s.TotalMS, &s.MeanMS); err != nil {
+			return nil, fmt.Errorf("read query statistics failed: %w", err)
+		}
+
+		if len(out) == 0 || out[len(out)-1].Database != dbName {
+			if len(out) > 0 {
+				out[len(out)-1].Slowest, out[len(out)-1].Frequent = topQueries(stats, top)
+			}
+			out = append(out, DatabaseQueries{Database: dbName, CreatedAt: createdAt})
+			stats = nil
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read query statistics failed: %w", err)
+	}
+	if len(out) > 0 {
+		out[len(out)-1].Slowest, out[len(out)-1].Frequent = topQueries(stats, top)
+	}
+	return out, nil
+}
+
+// ResetQueryStats forgets the statistics gathered so far, and the test databases
+// they were gathered for that no longer exist, to report on the next test run alone.
+func (p *Postgres) ResetQueryStats(ctx context.Context) error {
+	conn, err := p.statsConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := conn.ExecContext(ctx, "select pg_stat_statements_reset()"); err != nil {
+		return fmt.Errorf("reset query statistics failed: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx,
+		"delete from test_databases d where not exists(select from pg_database where oid = d.oid)"); err != nil {
+		return fmt.Errorf("reset query statistics failed: %w", err)
+	}
+	return nil
+}
+
+// statsConn connects to the stats database, once it is known to exist.
+func (p *Postgres) statsConn(ctx context.Context) (*sql.DB, error) {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	err = conn.QueryRowContext(ctx, "select exists(select from pg_database where datname = $1)", StatsDatabase).Scan(&exists)
+	_ = conn.Close()
+	if err != nil {
+		return nil, fmt.Errorf("look up stats database failed: %w", err)
+	}
+	if !exists {
+		return nil, ErrQueryStatsOff
+	}
+
+	return p.connectTo(ctx, StatsDatabase)
+}
+
+// connectTo connects to the database name of the instance.
+func (p *Postgres) connectTo(ctx context.Context, name string) (*sql.DB, error) {
+	db, err := p.database(name)
+	if err != nil {
+		return nil, err
+	}
+	return dbConnect(ctx, db.URI())
+}
+
+// topQueries returns the top statements of stats by total time and by calls.
+func topQueries(stats []QueryStat, top int) (slowest, frequent []QueryStat) {
+	slowest = append([]QueryStat(nil), stats...)
+	sort.SliceStable(slowest, func(i, j int) bool {
+		return slowest[i].TotalMS > slowest[j].TotalMS
+	})
+
+	frequent = append([]QueryStat(nil), stats...)
+	sort.SliceStable(frequent, func(i, j int) bool {
+		return frequent[i].Calls > frequent[j].Calls
+	})
+
+	if top > 0 && len(stats) > top {
+		slowest, frequent = slowest[:top], frequent[:top]
+	}
+	return slowest, frequent
+}
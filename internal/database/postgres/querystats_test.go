@@ -0,0 +1,29 @@
+package pg
+
+import "testing"
+
+func TestTopQueries(t *testing.T) {
+	stats := []QueryStat{
+		{Query: "select * from users where id = $1", Calls: 200, TotalMS: 20},
+		{Query: "select * from orders where total > $1", Calls: 2, TotalMS: 900},
+		{Query: "insert into users (name) values ($1)", Calls: 10, TotalMS: 5},
+	}
+
+	slowest, frequent := topQueries(stats, 2)
+	if len(slowest) != 2 || slowest[0].Query != stats[1].Query || slowest[1].Query != stats[0].Query {
+		t.Fatalf("unexpected slowest %+v", slowest)
+	}
+	if len(frequent) != 2 || frequent[0].Query != stats[0].Query || frequent[1].Query != stats[2].Query {
+		t.Fatalf("unexpected frequent %+v", frequent)
+	}
+
+	// the statements are sorted by copies of them
+	if stats[0].Calls != 200 || stats[1].Calls != 2 {
+		t.Fatalf("topQueries reordered its input: %+v", stats)
+	}
+
+	slowest, _ = topQueries(stats, 5)
+	if len(slowest) != 3 {
+		t.Fatalf("expected every statement, got %+v", slowest)
+	}
+}
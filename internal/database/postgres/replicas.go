@@ -0,0 +1,326 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/certs"
+	"github.com/mirzakhany/dbctl/internal/container"
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/logger"
+	"github.com/mirzakhany/dbctl/internal/utils"
+)
+
+// replicaStartTimeout bounds the time a replica takes to copy the primary and start
+// replaying, a base backup of an empty cluster takes seconds.
+const replicaStartTimeout = 60 * time.Second
+
+// replica is a streaming standby of the instance.
+type replica struct {
+	containerID string
+	port        uint32
+}
+
+// replicaScript is the command of a replica container. It copies the primary with
+// pg_basebackup, told where it is by the PG* variables of the container, and starts
+// postgres as a standby of it; -R writes the settings of a standby for the version
+// of the image. The copy is retried until the primary accepts it, and runs as the
+// postgres user whichever of gosu or su-exec the image has. setup runs first, as
+// root.
+func replicaScript(setup string, delay time.Duration, args []string) string {
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	if setup != "" {
+		b.WriteString(setup + "\n")
+	}
+	b.WriteString(`run=gosu
+command -v gosu >/dev/null 2>&1 || run=su-exec
+mkdir -p "$PGDATA"
+chown postgres "$PGDATA"
+chmod 700 "$PGDATA"
+until $run postgres pg_basebackup -D "$PGDATA" -R -X stream; do
+  rm -rf "$PGDATA"/*
+  sleep 1
+done
+`)
+
+	// recovery settings live in recovery.conf up to postgres 11, in the main
+	// configuration after
+	if delay > 0 {
+		_, _ = fmt.Fprintf(&b, `conf="$PGDATA/postgresql.auto.conf"
+[ -f "$PGDATA/recovery.conf" ] && conf="$PGDATA/recovery.conf"
+echo "recovery_min_apply_delay = '%dms'" >> "$conf"
+`, delay.Milliseconds())
+	}
+
+	b.WriteString(`exec $run postgres`)
+	for _, a := range args {
+		b.WriteString(" " + shellQuote(a))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// allowReplication lets the replicas of the network connect for replication, the
+// image only lets clients connect to databases.
+func (p *Postgres) allowReplication(ctx context.Context) error {
+	if _, err := container.Exec(ctx, p.containerID, []string{"sh", "-c",
+		`echo "host replication all all md5" >> "$PGDATA/pg_hba.conf"`}); err != nil {
+		return fmt.Errorf("allow replication failed: %w", err)
+	}
+
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := conn.ExecContext(ctx, "select pg_reload_conf()"); err != nil {
+		return fmt.Errorf("allow replication failed: %w", err)
+	}
+	return nil
+}
+
+// startReplicas starts the replicas of the instance once the primary, named
+// primary on the network of the instance, is up. They are waited for until they
+// replay what the primary writes.
+func (p *Postgres) startReplicas(ctx context.Context, primary string, args []string) error {
+	if err := p.allowReplication(ctx); err != nil {
+		return err
+	}
+
+	// the replicas serve with the certificates of the primary
+	var setup string
+	if p.cfg.certs != nil {
+		setup = certs.InstallScript("postgres")
+	}
+
+	logger.Info(fmt.Sprintf("Starting %d postgres replicas ...", p.cfg.replicas))
+	for i := 0; i < p.cfg.replicas; i++ {
+		port := uint32(utils.GetAvailablePort())
+		req := container.CreateRequest{
+			Image: getPostGisImage(p.cfg.version),
+			Env: map[string]string{
+				"PGHOST":     primary,
+				"PGPORT":     "5432",
+				"PGUSER":     p.cfg.user,
+				"PGPASSWORD": p.cfg.pass,
+			},
+			Cmd:          []string{"sh", "-c", replicaScript(setup, p.cfg.replicaDelay, args)},
+			ExposedPorts: []string{container.PortSpec(strconv.Itoa(int(port)), "5432/tcp")},
+			Name:         fmt.Sprintf("%s_replica_%d", primary, i+1),
+			Network:      p.network,
+			Labels: map[string]string{
+				container.LabelType:        database.LabelPostgres,
+				container.LabelRole:        container.RoleReplica,
+				container.LabelPrimaryPort: strconv.Itoa(int(p.cfg.port)),
+				container.LabelNetwork:     p.network,
+			},
+		}
+		for k, v := range database.ConnectionLabels(p.cfg.user, p.cfg.pass, p.cfg.name, port) {
+			req.Labels[k] = v
+		}
+		if p.cfg.label != "" {
+			req.Labels[container.LabelCustom] = p.cfg.label
+		}
+		if p.cfg.certs != nil {
+			req.Mounts = append(req.Mounts, certs.Mount(p.cfg.certs))
+		}
+
+		c, err := container.Run(ctx, req)
+		if c != nil {
+			p.replicas = append(p.replicas, replica{containerID: c.ID, port: port})
+		}
+		if err != nil {
+			return fmt.Errorf("start replica failed: %w", err)
+		}
+	}
+	p.replicasKnown = true
+
+	for _, r := range p.replicas {
+		if err := p.waitForReplica(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForReplica waits until r accepts connections as a standby.
+func (p *Postgres) waitForReplica(ctx context.Context, r replica) error {
+	ctx, cancel := context.WithTimeout(ctx, replicaStartTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	uri := p.replicaURI(r, p.cfg.name)
+	for {
+		conn, err := dbConnect(ctx, uri)
+		if err == nil {
+			var recovering bool
+			err = conn.QueryRowContext(ctx, "select pg_is_in_recovery()").Scan(&recovering)
+			_ = conn.Close()
+			if err == nil && recovering {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("replica on port %d did not start: %w", r.port, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// stopReplicas removes the replicas and the network of the instance.
+func (p *Postgres) stopReplicas(ctx context.Context) error {
+	var errs []error
+	for _, r := range p.replicas {
+		if err := container.TerminateByID(ctx, r.containerID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.replicas = nil
+	return errors.Join(errs...)
+}
+
+// removeNetwork removes the network of the instance, once its containers are gone.
+func (p *Postgres) removeNetwork(ctx context.Context) error {
+	if p.network == "" {
+		return nil
+	}
+	if err := container.RemoveNetwork(ctx, p.network); err != nil {
+		return fmt.Errorf("remove network %s failed: %w", p.network, err)
+	}
+	p.network = ""
+	return nil
+}
+
+// findReplicas looks up the replicas of an instance started elsewhere, the ones
+// following its port. An instance whose containers can not be listed, such as from
+// an api server without access to docker, is taken to have none.
+func (p *Postgres) findReplicas(ctx context.Context) {
+	if p.replicasKnown {
+		return
+	}
+	p.replicasKnown = true
+
+	found, err := container.List(ctx, map[string]string{
+		container.LabelType:        database.LabelPostgres,
+		container.LabelRole:        container.RoleReplica,
+		container.LabelPrimaryPort: strconv.Itoa(int(p.cfg.port)),
+	})
+	if err != nil {
+		logger.Debug(fmt.Sprintf("Looking up replicas failed, taking the instance to have none: %v", err))
+		return
+	}
+
+	for _, c := range found {
+		port, err := strconv.ParseUint(c.Labels[container.LabelPort], 10, 32)
+		if err != nil {
+			continue
+		}
+		p.replicas = append(p.replicas, replica{containerID: c.ID, port: uint32(port)})
+		if p.network == "" {
+			p.network = c.Labels[container.LabelNetwork]
+		}
+	}
+}
+
+// replicaURI is the uri of the database name on replica r.
+func (p *Postgres) replicaURI(r replica, name string) string {
+	addr := "localhost"
+	if os.Getenv("DBCTL_INSIDE_DOCKER") == "true" {
+		addr = "host.docker.internal"
+	}
+
+	host := net.JoinHostPort(addr, strconv.Itoa(int(r.port)))
+	return (&url.URL{Scheme: "postgres", User: url.UserPassword(p.cfg.user, p.cfg.pass), Host: host, Path: name, RawQuery: "sslmode=disable"}).String()
+}
+
+// ReplicaURIs returns the uris of the database of the instance on its replicas, in
+// the order they were started in. They are read only.
+func (p *Postgres) ReplicaURIs() []string {
+	out := make([]string, 0, len(p.replicas))
+	for _, r := range p.replicas {
+		out = append(out, p.replicaURI(r, p.cfg.name))
+	}
+	return out
+}
+
+// waitForReplay waits until every replica replayed what the primary wrote so far,
+// such as a database just created, so that it can be connected to on them. With a
+// replica delay that takes the delay at least.
+func (p *Postgres) waitForReplay(ctx context.Context, conn *sql.DB) error {
+	if len(p.replicas) == 0 {
+		return nil
+	}
+
+	var lsn string
+	if err := conn.QueryRowContext(ctx, "select pg_current_wal_lsn()::text").Scan(&lsn); err != nil {
+		return fmt.Errorf("read the position of the primary failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, replicaStartTimeout+p.replicaDelay(ctx))
+	defer cancel()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for _, r := range p.replicas {
+		rc, err := dbConnect(ctx, p.replicaURI(r, p.cfg.name))
+		if err != nil {
+			return err
+		}
+
+		for {
+			var replayed bool
+			err := rc.QueryRowContext(ctx, "select coalesce(pg_last_wal_replay_lsn() >= $1::pg_lsn, false)", lsn).Scan(&replayed)
+			if err == nil && replayed {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				_ = rc.Close()
+				return fmt.Errorf("replica on port %d did not catch up with the primary: %w", r.port, ctx.Err())
+			case <-ticker.C:
+			}
+		}
+		_ = rc.Close()
+	}
+	return nil
+}
+
+// replicaDelay is the replay delay of the replicas, read from the first one when
+// the instance was started elsewhere.
+func (p *Postgres) replicaDelay(ctx context.Context) time.Duration {
+	if p.cfg.replicaDelay > 0 || len(p.replicas) == 0 {
+		return p.cfg.replicaDelay
+	}
+
+	conn, err := dbConnect(ctx, p.replicaURI(p.replicas[0], p.cfg.name))
+	if err != nil {
+		return 0
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var ms int64
+	if err := conn.QueryRowContext(ctx, "select setting::bigint from pg_settings where name = 'recovery_min_apply_delay'").Scan(&ms); err != nil {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
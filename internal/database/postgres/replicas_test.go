@@ -0,0 +1,55 @@
+package pg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithReplicas(t *testing.T) {
+	cases := []struct {
+		n     int
+		delay time.Duration
+		ok    bool
+	}{
+		{n: 0, ok: true},
+		{n: 2, ok: true},
+		{n: 1, delay: time.Second, ok: true},
+		{n: -1},
+		{n: 1, delay: -time.Second},
+		{n: 0, delay: time.Second},
+	}
+
+	for _, c := range cases {
+		_, err := New(WithReplicas(c.n, c.delay))
+		if (err == nil) != c.ok {
+			t.Fatalf("WithReplicas(%d, %s): unexpected error %v", c.n, c.delay, err)
+		}
+	}
+}
+
+func TestReplicaScript(t *testing.T) {
+	args := []string{"postgres", "-c", "fsync=off"}
+
+	script := replicaScript("", 0, args)
+	if !strings.Contains(script, `pg_basebackup -D "$PGDATA" -R -X stream`) {
+		t.Fatalf("script does not copy the primary:\n%s", script)
+	}
+	if !strings.HasSuffix(script, "exec $run postgres 'postgres' '-c' 'fsync=off'\n") {
+		t.Fatalf("script does not start postgres with the arguments of the primary:\n%s", script)
+	}
+	if strings.Contains(script, "recovery_min_apply_delay") {
+		t.Fatalf("script without a delay sets one:\n%s", script)
+	}
+
+	script = replicaScript("", 1500*time.Millisecond, args)
+	if !strings.Contains(script, `echo "recovery_min_apply_delay = '1500ms'"`) {
+		t.Fatalf("script does not set the delay:\n%s", script)
+	}
+
+	script = replicaScript("install certs", 0, args)
+	setup, copyPrimary := strings.Index(script, "install certs"), strings.Index(script, "pg_basebackup")
+	if setup < 0 || setup > copyPrimary {
+		t.Fatalf("script does not run the setup before copying the primary:\n%s", script)
+	}
+}
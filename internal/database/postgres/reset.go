@@ -0,0 +1,98 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mirzakhany/dbctl/internal/database"
+)
+
+var _ database.Resetter = (*Postgres)(nil)
+
+// ResetDB empties the tables of the database at uri, but the tracking tables of
+// migration tools and the ones of extensions, restarts its sequences and applies
+// fixtures again. For a schema handed out with schema isolation it only resets the
+// schema.
+func (p *Postgres) ResetDB(ctx context.Context, uri, fixtures string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+
+	dbName := strings.TrimPrefix(u.Path, "/")
+	if dbName == "" {
+		return fmt.Errorf("uri %q does not contain a database name", uri)
+	}
+
+	target, err := p.database(dbName)
+	if err != nil {
+		return err
+	}
+	targetURI := target.URI()
+	schema := schemaOf(u)
+	if schema != "" {
+		targetURI = withSchema(targetURI, schema)
+	}
+
+	db, err := dbConnect(ctx, targetURI)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	// emptied at once, a reset failing half way leaves the rows as they were
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	tables, err := queryStrings(ctx, tx, `select quote_ident(n.nspname) || '.' || quote_ident(c.relname)
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		where c.relkind in ('r', 'p') and not c.relispartition
+			and n.nspname not like 'pg\_%' and n.nspname <> 'information_schema'
+			and ($1 = '' or n.nspname = $1)
+			and c.relname <> all($2)
+			and not exists (select from pg_depend d where d.classid = 'pg_class'::regclass and d.objid = c.oid and d.deptype = 'e')
+		order by c.oid`, schema, pq.Array(TrackingTables))
+	if err != nil {
+		return fmt.Errorf("list tables failed: %w", err)
+	}
+
+	// the sequences of identity and serial columns restart with their table
+	sequences, err := queryStrings(ctx, tx, `select quote_ident(n.nspname) || '.' || quote_ident(c.relname)
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		where c.relkind = 'S'
+			and n.nspname not like 'pg\_%' and n.nspname <> 'information_schema'
+			and ($1 = '' or n.nspname = $1)
+			and not exists (select from pg_depend d where d.classid = 'pg_class'::regclass and d.objid = c.oid and d.deptype in ('a', 'i', 'e'))
+		order by c.oid`, schema)
+	if err != nil {
+		return fmt.Errorf("list sequences failed: %w", err)
+	}
+
+	var stmts []string
+	if len(tables) > 0 {
+		stmts = append(stmts, fmt.Sprintf("truncate table %s restart identity cascade", strings.Join(tables, ", ")))
+	}
+	for _, seq := range sequences {
+		stmts = append(stmts, fmt.Sprintf("alter sequence %s restart", seq))
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("reset database failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("reset database failed: %w", err)
+	}
+
+	return applyFixturesFromDir(ctx, nil, fixtures, targetURI, p.cfg.seed)
+}
@@ -0,0 +1,201 @@
+package pg
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+// roleName is the name of the role a database is handed out with. It is derived
+// from the database, so that removing the database knows which role goes with it.
+func roleName(dbName string) string {
+	return dbName + "_role"
+}
+
+// grantsRole matches the role in a grants file, written the way psql takes
+// variables: :role as is, :"role" as an identifier and :'role' as a literal. The
+// :: of a cast is not a variable.
+var grantsRole = regexp.MustCompile(`(^|[^:]):("role"|'role'|role)([^A-Za-z0-9_]|$)`)
+
+// expandGrants replaces the role in grants with the name of role.
+func expandGrants(grants, role string) string {
+	return grantsRole.ReplaceAllStringFunc(grants, func(m string) string {
+		sub := grantsRole.FindStringSubmatch(m)
+		value := role
+		switch sub[2] {
+		case `"role"`:
+			value = quoteIdentifier(role)
+		case `'role'`:
+			value = quoteLiteral(role)
+		}
+		return sub[1] + value + sub[3]
+	})
+}
+
+// createRole creates the role dbName is handed out with, with a random password,
+// and returns its name and password. Without grants the role owns the database
+// and its schemas and may do anything with what they hold, otherwise it has the
+// privileges the grants give it and no more.
+func (p *Postgres) createRole(ctx context.Context, conn *sql.DB, dbName, grants string) (string, string, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("generate password failed: %w", err)
+	}
+	role, pass := roleName(dbName), hex.EncodeToString(secret)
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("create role %s login password %s",
+		quoteIdentifier(role), quoteLiteral(pass))); err != nil {
+		return "", "", fmt.Errorf("create role failed: %w", err)
+	}
+
+	db, err := p.connectTo(ctx, dbName)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	if grants != "" {
+		if err := applySource(ctx, db, "grants", expandGrants(grants, role)); err != nil {
+			return "", "", err
+		}
+		return role, pass, nil
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("alter database %s owner to %s",
+		quoteIdentifier(dbName), quoteIdentifier(role))); err != nil {
+		return "", "", fmt.Errorf("grant database to role failed: %w", err)
+	}
+	if err := grantSchemas(ctx, db, role); err != nil {
+		return "", "", err
+	}
+	if err := reassignObjects(ctx, db, role); err != nil {
+		return "", "", err
+	}
+	return role, pass, nil
+}
+
+// grantSchemas hands the schemas of the database to role, along with every
+// privilege on what they hold, such as the tables of extensions it does not own.
+func grantSchemas(ctx context.Context, db *sql.DB, role string) error {
+	rows, err := db.QueryContext(ctx,
+		`select nspname from pg_namespace where nspname not like 'pg\_%' and nspname <> 'information_schema'`)
+	if err != nil {
+		return fmt.Errorf("list schemas failed: %w", err)
+	}
+
+	var schemas []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("list schemas failed: %w", err)
+		}
+		schemas = append(schemas, name)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list schemas failed: %w", err)
+	}
+
+	r := quoteIdentifier(role)
+	for _, name := range schemas {
+		s := quoteIdentifier(name)
+		for _, stmt := range []string{
+			fmt.Sprintf("alter schema %s owner to %s", s, r),
+			fmt.Sprintf("grant all on all tables in schema %s to %s", s, r),
+			fmt.Sprintf("grant all on all sequences in schema %s to %s", s, r),
+			fmt.Sprintf("grant all on all functions in schema %s to %s", s, r),
+		} {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("grant schema %s to role failed: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ownedObjects lists the statements handing the objects the migrations created to
+// a role, as the user of the instance that ran them: relations, routines and types.
+// The members of extensions stay with them, sequences of serial and identity
+// columns and the functions of types follow the object they belong to. REASSIGN
+// OWNED would do it at once, but not for the superuser the instance was created
+// with, and along with every database it owns.
+var ownedObjects = []string{
+	`select format('alter %s %s owner to ', case c.relkind when 'v' then 'view' when 'm' then 'materialized view'
+			when 'f' then 'foreign table' when 'S' then 'sequence' else 'table' end, c.oid::regclass)
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		where c.relkind in ('r', 'p', 'v', 'm', 'f', 'S') and c.relowner = (select oid from pg_roles where rolname = current_user)
+			and n.nspname not like 'pg\_%' and n.nspname <> 'information_schema'
+			and not exists (select from pg_depend d where d.classid = 'pg_class'::regclass and d.objid = c.oid
+				and (d.deptype = 'e' or c.relkind = 'S' and d.deptype in ('a', 'i')))`,
+	`select format('alter %s %s owner to ', case when current_setting('server_version_num')::int >= 110000
+			then 'routine' else 'function' end, p.oid::regprocedure)
+		from pg_proc p join pg_namespace n on n.oid = p.pronamespace
+		where p.proowner = (select oid from pg_roles where rolname = current_user)
+			and n.nspname not like 'pg\_%' and n.nspname <> 'information_schema'
+			and not exists (select from pg_depend d where d.classid = 'pg_proc'::regclass and d.objid = p.oid
+				and d.deptype in ('e', 'i'))`,
+	`select format('alter %s %s owner to ', case t.typtype when 'd' then 'domain' else 'type' end, t.oid::regtype)
+		from pg_type t join pg_namespace n on n.oid = t.typnamespace
+		where t.typowner = (select oid from pg_roles where rolname = current_user)
+			and n.nspname not like 'pg\_%' and n.nspname <> 'information_schema'
+			and (t.typtype in ('e', 'd', 'r') or t.typtype = 'c' and (select relkind from pg_class where oid = t.typrelid) = 'c')
+			and not exists (select from pg_depend d where d.classid = 'pg_type'::regclass and d.objid = t.oid
+				and d.deptype = 'e')`,
+}
+
+// reassignObjects hands the objects the migrations created to role, so that it may
+// alter and drop them as the owner of the database would. Granting every privilege
+// is not enough for that, only the owner of a table may alter or drop it.
+func reassignObjects(ctx context.Context, db *sql.DB, role string) error {
+	var stmts []string
+	for _, query := range ownedObjects {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("list objects of the database failed: %w", err)
+		}
+		for rows.Next() {
+			var stmt string
+			if err := rows.Scan(&stmt); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("list objects of the database failed: %w", err)
+			}
+			stmts = append(stmts, stmt+quoteIdentifier(role))
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("list objects of the database failed: %w", err)
+		}
+	}
+
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("hand objects to role failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// dropRole drops the role dbName was handed out with, once the database is gone.
+func dropRole(ctx context.Context, conn *sql.DB, dbName string) error {
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("drop role if exists %s", quoteIdentifier(roleName(dbName)))); err != nil {
+		return fmt.Errorf("drop role failed: %w", err)
+	}
+	return nil
+}
+
+// withUser returns uri connecting as user instead.
+func withUser(uri, user, pass string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	u.User = url.UserPassword(user, pass)
+	return u.String()
+}
@@ -0,0 +1,360 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+
+	"github.com/lib/pq"
+)
+
+// Schema is what the catalog of a database tells about its tables, functions and
+// extensions.
+type Schema struct {
+	Database   string      `json:"database"`
+	Tables     []Table     `json:"tables"`
+	Functions  []Function  `json:"functions,omitempty"`
+	Extensions []Extension `json:"extensions,omitempty"`
+}
+
+// Table is a table, a view or a materialized view.
+type Table struct {
+	Schema      string       `json:"schema"`
+	Name        string       `json:"name"`
+	Kind        string       `json:"kind"`
+	Comment     string       `json:"comment,omitempty"`
+	Columns     []Column     `json:"columns"`
+	PrimaryKey  []string     `json:"primary_key,omitempty"`
+	Indexes     []Index      `json:"indexes,omitempty"`
+	ForeignKeys []ForeignKey `json:"foreign_keys,omitempty"`
+	Constraints []Constraint `json:"constraints,omitempty"`
+}
+
+// QualifiedName is the name of the table with its schema, as SQL takes it.
+func (t Table) QualifiedName() string {
+	return quoteIdentifier(t.Schema) + "." + quoteIdentifier(t.Name)
+}
+
+// FullName is the name of the table with its schema, for people to read.
+func (t Table) FullName() string {
+	return t.Schema + "." + t.Name
+}
+
+// Column is a column of a table.
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	Default  string `json:"default,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Index is an index of a table, Definition is its CREATE INDEX statement.
+type Index struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+	Unique     bool   `json:"unique,omitempty"`
+	Primary    bool   `json:"primary,omitempty"`
+}
+
+// ForeignKey is a foreign key of a table, RefTable is the schema and name of the
+// table it refers to.
+type ForeignKey struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	RefSchema  string   `json:"ref_schema"`
+	RefTable   string   `json:"ref_table"`
+	RefColumns []string `json:"ref_columns"`
+	Definition string   `json:"definition"`
+}
+
+// Constraint is a primary key, unique, check or exclusion constraint of a table.
+type Constraint struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Definition string `json:"definition"`
+}
+
+// Function is a function or a procedure, Definition is its CREATE statement.
+type Function struct {
+	Schema     string `json:"schema"`
+	Name       string `json:"name"`
+	Arguments  string `json:"arguments"`
+	Result     string `json:"result,omitempty"`
+	Definition string `json:"definition"`
+}
+
+// Signature is the name of the function with its schema and the types of its
+// arguments, overloads of a name have signatures of their own.
+func (f Function) Signature() string {
+	return f.Schema + "." + f.Name + "(" + f.Arguments + ")"
+}
+
+// Extension is an extension installed in a database.
+type Extension struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Schema  string `json:"schema"`
+}
+
+// constraintTypes names the contype of pg_constraint.
+var constraintTypes = map[string]string{
+	"p": "primary key",
+	"u": "unique",
+	"c": "check",
+	"x": "exclude",
+	"t": "trigger",
+}
+
+// Schema reads the tables of db, by name or uri, the database of the instance when
+// empty. Tables are read from every schema but the ones of postgres, or from the
+// schemas given, and only the ones matching pattern, such as users or order_*.
+func (p *Postgres) Schema(ctx context.Context, db string, schemas []string, pattern string) (*Schema, error) {
+	name, err := p.databaseName(db)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := New(WithHost(p.cfg.user, p.cfg.pass, name, p.cfg.port))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dbConnect(ctx, target.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	s, err := ReadSchema(ctx, conn, schemas, pattern)
+	if err != nil {
+		return nil, err
+	}
+	s.Database = name
+	return s, nil
+}
+
+// ReadSchema reads the tables of the database conn is connected to, see Schema. The
+// functions of the schemas and the extensions are read as well, whatever the pattern.
+func ReadSchema(ctx context.Context, conn *sql.DB, schemas []string, pattern string) (*Schema, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+	}
+
+	// partitions are described by the table they are a partition of
+	rows, err := conn.QueryContext(ctx, `
+		select c.oid, n.nspname, c.relname, c.relkind, coalesce(obj_description(c.oid, 'pg_class'), '')
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		where c.relkind in ('r', 'p', 'v', 'm') and not c.relispartition
+		  and n.nspname not in ('pg_catalog', 'information_schema')
+		  and n.nspname not like 'pg\_toast%' and n.nspname not like 'pg\_temp%'
+		  and (cardinality($1::text[]) = 0 or n.nspname = any($1::text[]))
+		order by n.nspname, c.relname`, pq.Array(schemas))
+	if err != nil {
+		return nil, fmt.Errorf("read tables failed: %w", err)
+	}
+
+	type relation struct {
+		oid   int64
+		table Table
+	}
+	var relations []relation
+	for rows.Next() {
+		var r relation
+		var kind string
+		if err := rows.Scan(&r.oid, &r.table.Schema, &r.table.Name, &kind, &r.table.Comment); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		if ok, _ := path.Match(pattern, r.table.Name); !ok {
+			continue
+		}
+
+		r.table.Kind = map[string]string{"r": "table", "p": "table", "v": "view", "m": "materialized view"}[kind]
+		relations = append(relations, r)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s := &Schema{Tables: make([]Table, 0, len(relations))}
+	for _, r := range relations {
+		t := r.table
+		if err := readTable(ctx, conn, r.oid, &t); err != nil {
+			return nil, fmt.Errorf("read table %s failed: %w", t.FullName(), err)
+		}
+		s.Tables = append(s.Tables, t)
+	}
+
+	if s.Functions, err = readFunctions(ctx, conn, schemas); err != nil {
+		return nil, fmt.Errorf("read functions failed: %w", err)
+	}
+	if s.Extensions, err = readExtensions(ctx, conn); err != nil {
+		return nil, fmt.Errorf("read extensions failed: %w", err)
+	}
+	return s, nil
+}
+
+// readFunctions reads the functions and procedures of schemas, leaving out the
+// ones of extensions, which come and go with the extension.
+func readFunctions(ctx context.Context, conn *sql.DB, schemas []string) ([]Function, error) {
+	rows, err := conn.QueryContext(ctx, `
+		select n.nspname, p.proname, pg_get_function_identity_arguments(p.oid),
+			coalesce(pg_get_function_result(p.oid), ''), pg_get_functiondef(p.oid)
+		from pg_proc p join pg_namespace n on n.oid = p.pronamespace
+		where p.prokind in ('f', 'p')
+		  and n.nspname not in ('pg_catalog', 'information_schema')
+		  and n.nspname not like 'pg\_toast%' and n.nspname not like 'pg\_temp%'
+		  and (cardinality($1::text[]) = 0 or n.nspname = any($1::text[]))
+		  and not exists (
+			select 1 from pg_depend d
+			where d.classid = 'pg_proc'::regclass and d.objid = p.oid and d.deptype = 'e')
+		order by n.nspname, p.proname, 3`, pq.Array(schemas))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var out []Function
+	for rows.Next() {
+		var f Function
+		if err := rows.Scan(&f.Schema, &f.Name, &f.Arguments, &f.Result, &f.Definition); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+func readExtensions(ctx context.Context, conn *sql.DB) ([]Extension, error) {
+	rows, err := conn.QueryContext(ctx, `
+		select e.extname, e.extversion, n.nspname
+		from pg_extension e join pg_namespace n on n.oid = e.extnamespace
+		order by e.extname`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var out []Extension
+	for rows.Next() {
+		var e Extension
+		if err := rows.Scan(&e.Name, &e.Version, &e.Schema); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func readTable(ctx context.Context, conn *sql.DB, oid int64, t *Table) error {
+	rows, err := conn.QueryContext(ctx, `
+		select a.attname, format_type(a.atttypid, a.atttypmod), not a.attnotnull,
+			case a.attidentity
+				when 'a' then 'generated always as identity'
+				when 'd' then 'generated by default as identity'
+				else coalesce(pg_get_expr(d.adbin, d.adrelid), '')
+			end,
+			coalesce(col_description(a.attrelid, a.attnum), '')
+		from pg_attribute a
+		left join pg_attrdef d on d.adrelid = a.attrelid and d.adnum = a.attnum
+		where a.attrelid = $1 and a.attnum > 0 and not a.attisdropped
+		order by a.attnum`, oid)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var c Column
+		if err := rows.Scan(&c.Name, &c.Type, &c.Nullable, &c.Default, &c.Comment); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		t.Columns = append(t.Columns, c)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = conn.QueryContext(ctx, `
+		select ic.relname, pg_get_indexdef(i.indexrelid), i.indisunique, i.indisprimary
+		from pg_index i join pg_class ic on ic.oid = i.indexrelid
+		where i.indrelid = $1
+		order by ic.relname`, oid)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var i Index
+		if err := rows.Scan(&i.Name, &i.Definition, &i.Unique, &i.Primary); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		t.Indexes = append(t.Indexes, i)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = conn.QueryContext(ctx, `
+		select c.conname, c.contype, pg_get_constraintdef(c.oid),
+			array(
+				select a.attname::text
+				from unnest(c.conkey) with ordinality k(attnum, n)
+				join pg_attribute a on a.attrelid = c.conrelid and a.attnum = k.attnum
+				order by k.n),
+			coalesce(rn.nspname, ''), coalesce(rc.relname, ''),
+			array(
+				select a.attname::text
+				from unnest(c.confkey) with ordinality k(attnum, n)
+				join pg_attribute a on a.attrelid = c.confrelid and a.attnum = k.attnum
+				order by k.n)
+		from pg_constraint c
+		left join pg_class rc on rc.oid = c.confrelid
+		left join pg_namespace rn on rn.oid = rc.relnamespace
+		where c.conrelid = $1
+		order by c.conname`, oid)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var name, kind, def, refSchema, refTable string
+		var columns, refColumns []string
+		if err := rows.Scan(&name, &kind, &def, pq.Array(&columns), &refSchema, &refTable, pq.Array(&refColumns)); err != nil {
+			return err
+		}
+
+		switch kind {
+		case "f":
+			t.ForeignKeys = append(t.ForeignKeys, ForeignKey{
+				Name:       name,
+				Columns:    columns,
+				RefSchema:  refSchema,
+				RefTable:   refTable,
+				RefColumns: refColumns,
+				Definition: def,
+			})
+			continue
+		case "p":
+			t.PrimaryKey = columns
+		}
+		t.Constraints = append(t.Constraints, Constraint{Name: name, Type: constraintTypes[kind], Definition: def})
+	}
+	return rows.Err()
+}
@@ -0,0 +1,480 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// errSchemaNotClonable is returned cloning a schema that holds something
+// cloneSchema does not know how to copy.
+var errSchemaNotClonable = errors.New("schema can not be cloned")
+
+// clonePlans keeps the statements cloning each template schema, by the key given to
+// cloneSchema. A template schema is never changed once its migrations are applied,
+// its catalog is read once.
+var clonePlans sync.Map
+
+// unclonable are the objects cloneSchema does not copy, a schema holding any of them
+// is not cloned rather than cloned without them.
+var unclonable = []struct {
+	what  string
+	query string
+}{
+	{"extensions", `select exists(select from pg_extension where extnamespace = $1)`},
+	{"partitioned, materialized or foreign tables, or composite types",
+		`select exists(select from pg_class where relnamespace = $1 and relkind in ('p', 'm', 'f', 'c'))`},
+	{"inherited tables",
+		`select exists(select from pg_inherits i join pg_class c on c.oid = i.inhrelid where c.relnamespace = $1)`},
+	{"row level security",
+		`select exists(select from pg_class where relnamespace = $1 and relrowsecurity)`},
+	{"rules",
+		`select exists(select from pg_rewrite r join pg_class c on c.oid = r.ev_class where c.relnamespace = $1 and r.rulename <> '_RETURN')`},
+	{"range or base types",
+		`select exists(select from pg_type where typnamespace = $1 and (typtype in ('r', 'm') or (typtype = 'b' and typcategory <> 'A')))`},
+	{"aggregates",
+		`select exists(select from pg_proc where pronamespace = $1 and prokind in ('a', 'w'))`},
+}
+
+// cloneSchema creates to as a copy of from, the rows of its tables and the values
+// of its sequences included. Postgres has no statement copying a schema, the ones
+// creating the copy are generated from the catalog of from, read with from as the
+// search path so that they name what it holds without a schema. They create the
+// same in to run with to as the search path.
+func cloneSchema(ctx context.Context, db *sql.DB, key, from, to string) error {
+	var stmts []string
+	if plan, ok := clonePlans.Load(key); ok {
+		stmts = plan.([]string)
+	} else {
+		var err error
+		if stmts, err = planClone(ctx, db, from); err != nil {
+			return err
+		}
+		clonePlans.Store(key, stmts)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	prelude := []string{
+		fmt.Sprintf("create schema %s", quoteIdentifier(to)),
+		fmt.Sprintf("set local search_path = %s, public", quoteIdentifier(to)),
+		// functions may use the tables created after them
+		"set local check_function_bodies = off",
+	}
+	for _, stmt := range append(prelude, stmts...) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("clone schema %s failed: %w", from, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// planClone returns the statements creating a copy of schema in the schema first on
+// the search path.
+func planClone(ctx context.Context, db *sql.DB, schema string) ([]string, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("set local search_path = %s", quoteIdentifier(schema))); err != nil {
+		return nil, err
+	}
+
+	var nsp int64
+	if err := tx.QueryRowContext(ctx, "select oid::bigint from pg_namespace where nspname = $1", schema).Scan(&nsp); err != nil {
+		return nil, fmt.Errorf("look up schema %q failed: %w", schema, err)
+	}
+
+	for _, u := range unclonable {
+		var found bool
+		if err := tx.QueryRowContext(ctx, u.query, nsp).Scan(&found); err != nil {
+			return nil, fmt.Errorf("read schema %q failed: %w", schema, err)
+		}
+		if found {
+			return nil, fmt.Errorf("%w: it holds %s", errSchemaNotClonable, u.what)
+		}
+	}
+
+	p := &clonePlan{tx: tx, nsp: nsp, schema: schema}
+	for _, step := range []func(context.Context) error{
+		p.types,
+		p.functions,
+		p.sequences,
+		p.tables,
+		p.sequenceValues,
+		p.constraints,
+		p.indexes,
+		p.views,
+		p.triggers,
+	} {
+		if err := step(ctx); err != nil {
+			return nil, fmt.Errorf("read schema %q failed: %w", schema, err)
+		}
+	}
+	return p.stmts, nil
+}
+
+// clonePlan gathers the statements cloning a schema, in the order they run in.
+type clonePlan struct {
+	tx     *sql.Tx
+	nsp    int64
+	schema string
+	stmts  []string
+}
+
+func (p *clonePlan) add(format string, args ...any) {
+	p.stmts = append(p.stmts, fmt.Sprintf(format, args...))
+}
+
+// each runs query and calls scan for every row.
+func (p *clonePlan) each(ctx context.Context, query string, arg int64, scan func(*sql.Rows) error) error {
+	rows, err := p.tx.QueryContext(ctx, query, arg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// types are the enums and the domains, the other types of a schema are not cloned.
+func (p *clonePlan) types(ctx context.Context) error {
+	err := p.each(ctx, `select quote_ident(t.typname),
+			array_to_string(array(select quote_literal(e.enumlabel) from pg_enum e where e.enumtypid = t.oid order by e.enumsortorder), ', ')
+		from pg_type t where t.typnamespace = $1 and t.typtype = 'e' order by t.oid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var name, labels string
+			if err := rows.Scan(&name, &labels); err != nil {
+				return err
+			}
+			p.add("create type %s as enum (%s)", name, labels)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	return p.each(ctx, `select quote_ident(t.typname), format_type(t.typbasetype, t.typtypmod), t.typnotnull, coalesce(t.typdefault, ''),
+			coalesce((select string_agg('constraint ' || quote_ident(c.conname) || ' ' || pg_get_constraintdef(c.oid, true), ' ' order by c.oid)
+				from pg_constraint c where c.contypid = t.oid and c.contype <> 'n'), '')
+		from pg_type t where t.typnamespace = $1 and t.typtype = 'd' order by t.oid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var name, base, def, checks string
+			var notNull bool
+			if err := rows.Scan(&name, &base, &notNull, &def, &checks); err != nil {
+				return err
+			}
+
+			stmt := fmt.Sprintf("create domain %s as %s", name, base)
+			if def != "" {
+				stmt += " default " + def
+			}
+			if notNull {
+				stmt += " not null"
+			}
+			if checks != "" {
+				stmt += " " + checks
+			}
+			p.stmts = append(p.stmts, stmt)
+			return nil
+		})
+}
+
+func (p *clonePlan) functions(ctx context.Context) error {
+	return p.each(ctx, `select pg_get_functiondef(oid) from pg_proc where pronamespace = $1 and prokind in ('f', 'p') order by oid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var def string
+			if err := rows.Scan(&def); err != nil {
+				return err
+			}
+			p.stmts = append(p.stmts, unqualifyFunction(def, p.schema))
+			return nil
+		})
+}
+
+// unqualifyFunction drops schema from the name of the function def creates, the
+// definitions postgres gives always name the schema of a function.
+func unqualifyFunction(def, schema string) string {
+	for _, kind := range []string{"FUNCTION ", "PROCEDURE "} {
+		for _, name := range []string{schema, quoteIdentifier(schema)} {
+			if prefix := kind + name + "."; strings.Contains(def, prefix) {
+				return strings.Replace(def, prefix, kind, 1)
+			}
+		}
+	}
+	return def
+}
+
+// sequences are the ones not made for identity columns, those come with their table.
+func (p *clonePlan) sequences(ctx context.Context) error {
+	return p.each(ctx, `select quote_ident(c.relname), format_type(s.seqtypid, null),
+			s.seqincrement, s.seqmin, s.seqmax, s.seqstart, s.seqcache, s.seqcycle
+		from pg_sequence s join pg_class c on c.oid = s.seqrelid
+		where c.relnamespace = $1 and not exists (
+			select from pg_depend d where d.classid = 'pg_class'::regclass and d.objid = c.oid and d.deptype = 'i')
+		order by c.oid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var name, typ string
+			var increment, min, max, start, cache int64
+			var cycle bool
+			if err := rows.Scan(&name, &typ, &increment, &min, &max, &start, &cache, &cycle); err != nil {
+				return err
+			}
+
+			stmt := fmt.Sprintf("create sequence %s as %s increment by %d minvalue %d maxvalue %d start with %d cache %d",
+				name, typ, increment, min, max, start, cache)
+			if cycle {
+				stmt += " cycle"
+			}
+			p.stmts = append(p.stmts, stmt)
+			return nil
+		})
+}
+
+type cloneTable struct {
+	oid      int64
+	name     string
+	unlogged bool
+}
+
+// tables creates the tables without their constraints, other than not null, and
+// copies their rows before the constraints and indexes are added.
+func (p *clonePlan) tables(ctx context.Context) error {
+	var tables []cloneTable
+	err := p.each(ctx, `select oid::bigint, quote_ident(relname), relpersistence = 'u'
+		from pg_class where relnamespace = $1 and relkind = 'r' order by oid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var t cloneTable
+			if err := rows.Scan(&t.oid, &t.name, &t.unlogged); err != nil {
+				return err
+			}
+			tables = append(tables, t)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	var copies []string
+	for _, t := range tables {
+		cp, err := p.table(ctx, t)
+		if err != nil {
+			return err
+		}
+		copies = append(copies, cp)
+	}
+
+	// serial columns own their sequence, it goes with the column
+	err = p.each(ctx, `select quote_ident(s.relname), quote_ident(t.relname), quote_ident(a.attname)
+		from pg_depend d
+			join pg_class s on s.oid = d.objid
+			join pg_class t on t.oid = d.refobjid
+			join pg_attribute a on a.attrelid = t.oid and a.attnum = d.refobjsubid
+		where s.relnamespace = $1 and s.relkind = 'S' and d.deptype = 'a'
+			and d.classid = 'pg_class'::regclass and d.refclassid = 'pg_class'::regclass
+		order by s.oid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var seq, table, column string
+			if err := rows.Scan(&seq, &table, &column); err != nil {
+				return err
+			}
+			p.add("alter sequence %s owned by %s.%s", seq, table, column)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	p.stmts = append(p.stmts, copies...)
+	return nil
+}
+
+// table creates t and returns the statement copying its rows.
+func (p *clonePlan) table(ctx context.Context, t cloneTable) (string, error) {
+	var columns, copied []string
+	overriding := ""
+	err := p.each(ctx, `select quote_ident(a.attname), format_type(a.atttypid, a.atttypmod), a.attnotnull,
+			a.attidentity::text, a.attgenerated::text, coalesce(pg_get_expr(d.adbin, d.adrelid, true), ''),
+			coalesce((select quote_ident(n.nspname) || '.' || quote_ident(c.collname)
+				from pg_collation c join pg_namespace n on n.oid = c.collnamespace
+				where c.oid = a.attcollation and a.attcollation <> t.typcollation), '')
+		from pg_attribute a
+			join pg_type t on t.oid = a.atttypid
+			left join pg_attrdef d on d.adrelid = a.attrelid and d.adnum = a.attnum
+		where a.attrelid = $1 and a.attnum > 0 and not a.attisdropped
+		order by a.attnum`, t.oid,
+		func(rows *sql.Rows) error {
+			var name, typ, identity, generated, def, collation string
+			var notNull bool
+			if err := rows.Scan(&name, &typ, &notNull, &identity, &generated, &def, &collation); err != nil {
+				return err
+			}
+
+			column := name + " " + typ
+			if collation != "" {
+				column += " collate " + collation
+			}
+			switch {
+			case generated == "s":
+				column += " generated always as (" + def + ") stored"
+			case identity == "a":
+				column += " generated always as identity"
+				overriding = " overriding system value"
+			case identity == "d":
+				column += " generated by default as identity"
+			case def != "":
+				column += " default " + def
+			}
+			if notNull {
+				column += " not null"
+			}
+			columns = append(columns, column)
+
+			// generated columns are computed again rather than copied
+			if generated == "" {
+				copied = append(copied, name)
+			}
+			return nil
+		})
+	if err != nil {
+		return "", err
+	}
+
+	create := "create table"
+	if t.unlogged {
+		create = "create unlogged table"
+	}
+	p.add("%s %s (%s)", create, t.name, strings.Join(columns, ", "))
+
+	list := strings.Join(copied, ", ")
+	return fmt.Sprintf("insert into %s (%s)%s select %s from %s.%s",
+		t.name, list, overriding, list, quoteIdentifier(p.schema), t.name), nil
+}
+
+// sequenceValues carries the sequences on from where the ones of the schema are, so
+// that the rows inserted next do not collide with the ones copied.
+func (p *clonePlan) sequenceValues(ctx context.Context) error {
+	type sequence struct {
+		name, table, column string
+	}
+
+	var sequences []sequence
+	err := p.each(ctx, `select quote_ident(s.relname), coalesce(quote_ident(t.relname), ''), coalesce(a.attname, '')
+		from pg_class s
+			left join pg_depend d on d.classid = 'pg_class'::regclass and d.objid = s.oid
+				and d.refclassid = 'pg_class'::regclass and d.deptype = 'i'
+			left join pg_class t on t.oid = d.refobjid
+			left join pg_attribute a on a.attrelid = t.oid and a.attnum = d.refobjsubid
+		where s.relnamespace = $1 and s.relkind = 'S'
+		order by s.oid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var s sequence
+			if err := rows.Scan(&s.name, &s.table, &s.column); err != nil {
+				return err
+			}
+			sequences = append(sequences, s)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sequences {
+		var value int64
+		var called bool
+		if err := p.tx.QueryRowContext(ctx, fmt.Sprintf("select last_value, is_called from %s.%s",
+			quoteIdentifier(p.schema), s.name)).Scan(&value, &called); err != nil {
+			return err
+		}
+
+		// the sequence of an identity column is named by postgres
+		seq := quoteLiteral(s.name)
+		if s.table != "" {
+			seq = fmt.Sprintf("pg_get_serial_sequence(%s, %s)", quoteLiteral(s.table), quoteLiteral(s.column))
+		}
+		p.add("select setval(%s, %d, %t)", seq, value, called)
+	}
+	return nil
+}
+
+// constraints adds the foreign keys last, once the keys they reference exist.
+func (p *clonePlan) constraints(ctx context.Context) error {
+	return p.each(ctx, `select quote_ident(t.relname), quote_ident(c.conname), pg_get_constraintdef(c.oid, true)
+		from pg_constraint c join pg_class t on t.oid = c.conrelid
+		where t.relnamespace = $1 and t.relkind = 'r' and c.contype in ('p', 'u', 'c', 'x', 'f')
+		order by c.contype = 'f', c.oid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var table, name, def string
+			if err := rows.Scan(&table, &name, &def); err != nil {
+				return err
+			}
+			p.add("alter table %s add constraint %s %s", table, name, def)
+			return nil
+		})
+}
+
+// indexes are the ones not made for a constraint.
+func (p *clonePlan) indexes(ctx context.Context) error {
+	return p.each(ctx, `select pg_get_indexdef(i.indexrelid, 0, true)
+		from pg_index i join pg_class t on t.oid = i.indrelid
+		where t.relnamespace = $1 and t.relkind = 'r' and not exists (
+			select from pg_constraint c
+			where c.conindid = i.indexrelid and c.conrelid = i.indrelid and c.contype in ('p', 'u', 'x'))
+		order by i.indexrelid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var def string
+			if err := rows.Scan(&def); err != nil {
+				return err
+			}
+			p.stmts = append(p.stmts, def)
+			return nil
+		})
+}
+
+// views are created in the order they were, a view only uses the ones before it.
+func (p *clonePlan) views(ctx context.Context) error {
+	return p.each(ctx, `select quote_ident(relname), pg_get_viewdef(oid, true)
+		from pg_class where relnamespace = $1 and relkind = 'v' order by oid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var name, def string
+			if err := rows.Scan(&name, &def); err != nil {
+				return err
+			}
+			p.add("create view %s as %s", name, strings.TrimSuffix(strings.TrimSpace(def), ";"))
+			return nil
+		})
+}
+
+// triggers are added once the rows are copied, copying does not fire them.
+func (p *clonePlan) triggers(ctx context.Context) error {
+	return p.each(ctx, `select pg_get_triggerdef(t.oid, true)
+		from pg_trigger t join pg_class c on c.oid = t.tgrelid
+		where c.relnamespace = $1 and not t.tgisinternal
+		order by t.oid`, p.nsp,
+		func(rows *sql.Rows) error {
+			var def string
+			if err := rows.Scan(&def); err != nil {
+				return err
+			}
+			p.stmts = append(p.stmts, def)
+			return nil
+		})
+}
@@ -0,0 +1,301 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// The actions of a schema change.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// Change is one difference between two schemas. Table names the table a column,
+// index or constraint belongs to, Attribute what changed of something both schemas
+// have, such as the type of a column. From and To are the definitions, or the
+// values of the attribute, on each side.
+type Change struct {
+	Action    string `json:"action"`
+	Kind      string `json:"kind"`
+	Table     string `json:"table,omitempty"`
+	Name      string `json:"name"`
+	Attribute string `json:"attribute,omitempty"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+}
+
+// DiffSchemas returns what changes from one schema to the other: tables, columns,
+// their types, defaults and nullability, indexes, constraints, foreign keys,
+// functions and extensions. Things are matched by name, a rename is a removal and
+// an addition.
+func DiffSchemas(from, to *Schema) []Change {
+	var changes []Change
+
+	fromTables := map[string]Table{}
+	for _, t := range from.Tables {
+		fromTables[t.FullName()] = t
+	}
+	toTables := map[string]Table{}
+	for _, t := range to.Tables {
+		toTables[t.FullName()] = t
+	}
+
+	for _, name := range unionKeys(fromTables, toTables) {
+		a, inFrom := fromTables[name]
+		b, inTo := toTables[name]
+		switch {
+		case !inFrom:
+			changes = append(changes, Change{Action: ChangeAdded, Kind: b.Kind, Name: name})
+		case !inTo:
+			changes = append(changes, Change{Action: ChangeRemoved, Kind: a.Kind, Name: name})
+		default:
+			changes = append(changes, diffTables(a, b)...)
+		}
+	}
+
+	fromFuncs := map[string]Function{}
+	for _, f := range from.Functions {
+		fromFuncs[f.Signature()] = f
+	}
+	toFuncs := map[string]Function{}
+	for _, f := range to.Functions {
+		toFuncs[f.Signature()] = f
+	}
+	for _, sig := range unionKeys(fromFuncs, toFuncs) {
+		a, inFrom := fromFuncs[sig]
+		b, inTo := toFuncs[sig]
+		switch {
+		case !inFrom:
+			changes = append(changes, Change{Action: ChangeAdded, Kind: "function", Name: sig, To: b.Definition})
+		case !inTo:
+			changes = append(changes, Change{Action: ChangeRemoved, Kind: "function", Name: sig, From: a.Definition})
+		case a.Definition != b.Definition:
+			changes = append(changes, Change{Action: ChangeChanged, Kind: "function", Name: sig, Attribute: "definition",
+				From: a.Definition, To: b.Definition})
+		}
+	}
+
+	fromExts := map[string]Extension{}
+	for _, e := range from.Extensions {
+		fromExts[e.Name] = e
+	}
+	toExts := map[string]Extension{}
+	for _, e := range to.Extensions {
+		toExts[e.Name] = e
+	}
+	for _, name := range unionKeys(fromExts, toExts) {
+		a, inFrom := fromExts[name]
+		b, inTo := toExts[name]
+		switch {
+		case !inFrom:
+			changes = append(changes, Change{Action: ChangeAdded, Kind: "extension", Name: name, To: b.Version})
+		case !inTo:
+			changes = append(changes, Change{Action: ChangeRemoved, Kind: "extension", Name: name, From: a.Version})
+		case a.Version != b.Version:
+			changes = append(changes, Change{Action: ChangeChanged, Kind: "extension", Name: name, Attribute: "version",
+				From: a.Version, To: b.Version})
+		case a.Schema != b.Schema:
+			changes = append(changes, Change{Action: ChangeChanged, Kind: "extension", Name: name, Attribute: "schema",
+				From: a.Schema, To: b.Schema})
+		}
+	}
+	return changes
+}
+
+func diffTables(a, b Table) []Change {
+	table := a.FullName()
+	var changes []Change
+
+	for _, c := range [][3]string{{"kind", a.Kind, b.Kind}, {"comment", a.Comment, b.Comment}} {
+		if c[1] != c[2] {
+			changes = append(changes, Change{Action: ChangeChanged, Kind: b.Kind, Name: table, Attribute: c[0], From: c[1], To: c[2]})
+		}
+	}
+
+	attr := func(kind, name, attribute, from, to string) {
+		if from != to {
+			changes = append(changes, Change{Action: ChangeChanged, Kind: kind, Table: table, Name: name,
+				Attribute: attribute, From: from, To: to})
+		}
+	}
+
+	fromCols := map[string]Column{}
+	for _, c := range a.Columns {
+		fromCols[c.Name] = c
+	}
+	toCols := map[string]Column{}
+	for _, c := range b.Columns {
+		toCols[c.Name] = c
+	}
+
+	// columns keep the order of the table they are in rather than of their names
+	var names []string
+	for _, c := range a.Columns {
+		names = append(names, c.Name)
+	}
+	for _, c := range b.Columns {
+		if _, ok := fromCols[c.Name]; !ok {
+			names = append(names, c.Name)
+		}
+	}
+
+	for _, name := range names {
+		x, inFrom := fromCols[name]
+		y, inTo := toCols[name]
+		switch {
+		case !inFrom:
+			changes = append(changes, Change{Action: ChangeAdded, Kind: "column", Table: table, Name: name, To: columnDefinition(y)})
+		case !inTo:
+			changes = append(changes, Change{Action: ChangeRemoved, Kind: "column", Table: table, Name: name, From: columnDefinition(x)})
+		default:
+			attr("column", name, "type", x.Type, y.Type)
+			attr("column", name, "nullable", fmt.Sprint(x.Nullable), fmt.Sprint(y.Nullable))
+			attr("column", name, "default", x.Default, y.Default)
+			attr("column", name, "comment", x.Comment, y.Comment)
+		}
+	}
+
+	diffNamed := func(kind string, from, to map[string]string) {
+		for _, name := range unionKeys(from, to) {
+			x, inFrom := from[name]
+			y, inTo := to[name]
+			switch {
+			case !inFrom:
+				changes = append(changes, Change{Action: ChangeAdded, Kind: kind, Table: table, Name: name, To: y})
+			case !inTo:
+				changes = append(changes, Change{Action: ChangeRemoved, Kind: kind, Table: table, Name: name, From: x})
+			default:
+				attr(kind, name, "definition", x, y)
+			}
+		}
+	}
+
+	indexes := func(t Table) map[string]string {
+		out := map[string]string{}
+		for _, i := range t.Indexes {
+			out[i.Name] = i.Definition
+		}
+		return out
+	}
+	constraints := func(t Table) map[string]string {
+		out := map[string]string{}
+		for _, c := range t.Constraints {
+			out[c.Name] = c.Definition
+		}
+		return out
+	}
+	foreignKeys := func(t Table) map[string]string {
+		out := map[string]string{}
+		for _, fk := range t.ForeignKeys {
+			out[fk.Name] = fk.Definition
+		}
+		return out
+	}
+
+	diffNamed("index", indexes(a), indexes(b))
+	diffNamed("constraint", constraints(a), constraints(b))
+	diffNamed("foreign key", foreignKeys(a), foreignKeys(b))
+	return changes
+}
+
+// columnDefinition is a column the way CREATE TABLE takes it, without its name.
+func columnDefinition(c Column) string {
+	def := c.Type
+	if !c.Nullable {
+		def += " not null"
+	}
+	if c.Default != "" {
+		def += " default " + c.Default
+	}
+	return def
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MigrationsSchema reads the schema the migrations at path build. They are applied
+// the way the api server applies them, through the template of the migrations, so
+// that the next run, or a test asking for the same migrations, clones it rather
+// than applying them again. The database they are applied to is dropped once read.
+func (p *Postgres) MigrationsSchema(ctx context.Context, path string) (*Schema, error) {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	name := fmt.Sprintf("dbctl_diff_%d", time.Now().UnixNano())
+	target, err := New(WithHost(p.cfg.user, p.cfg.pass, name, p.cfg.port))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.createDatabaseFromMigrations(ctx, conn, name, target.URI(), path); err != nil {
+		// a migration may fail half way, leaving the database behind
+		if dropErr := dropDatabase(ctx, conn, name); dropErr != nil {
+			logger.Debug("dropping", name, "failed:", dropErr)
+		}
+		return nil, err
+	}
+	defer func() {
+		if err := dropDatabase(ctx, conn, name); err != nil {
+			logger.Warn(err.Error())
+		}
+	}()
+
+	db, err := dbConnect(ctx, target.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	s, err := ReadSchema(ctx, db, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	s.Database = strings.TrimSuffix(path, "/")
+	return s, nil
+}
+
+// URISchema reads the schema of the database at uri, such as a database a test
+// left behind.
+func URISchema(ctx context.Context, uri string) (*Schema, error) {
+	db, err := dbConnect(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	s, err := ReadSchema(ctx, db, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.QueryRowContext(ctx, "select current_database()").Scan(&s.Database); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
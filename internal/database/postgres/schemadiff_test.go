@@ -0,0 +1,67 @@
+package pg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	from := &Schema{
+		Tables: []Table{
+			{
+				Schema: "public", Name: "users", Kind: "table",
+				Columns: []Column{
+					{Name: "id", Type: "bigint"},
+					{Name: "email", Type: "character varying(100)", Nullable: true},
+					{Name: "legacy", Type: "text", Nullable: true},
+				},
+				Indexes: []Index{{Name: "users_pkey", Definition: "CREATE UNIQUE INDEX users_pkey ON public.users USING btree (id)"}},
+			},
+			{Schema: "public", Name: "audit", Kind: "table"},
+		},
+		Functions:  []Function{{Schema: "public", Name: "touch", Definition: "v1"}},
+		Extensions: []Extension{{Name: "pgcrypto", Version: "1.3", Schema: "public"}},
+	}
+	to := &Schema{
+		Tables: []Table{
+			{
+				Schema: "public", Name: "users", Kind: "table",
+				Columns: []Column{
+					{Name: "id", Type: "bigint"},
+					{Name: "email", Type: "character varying(255)", Default: "''::character varying"},
+					{Name: "name", Type: "text"},
+				},
+				Indexes: []Index{
+					{Name: "users_email_key", Definition: "CREATE UNIQUE INDEX users_email_key ON public.users USING btree (email)"},
+					{Name: "users_pkey", Definition: "CREATE UNIQUE INDEX users_pkey ON public.users USING btree (id)"},
+				},
+			},
+			{Schema: "public", Name: "orders", Kind: "table"},
+		},
+		Functions:  []Function{{Schema: "public", Name: "touch", Definition: "v2"}},
+		Extensions: []Extension{{Name: "pgcrypto", Version: "1.3", Schema: "public"}, {Name: "citext", Version: "1.6", Schema: "public"}},
+	}
+
+	want := []Change{
+		{Action: ChangeRemoved, Kind: "table", Name: "public.audit"},
+		{Action: ChangeAdded, Kind: "table", Name: "public.orders"},
+		{Action: ChangeChanged, Kind: "column", Table: "public.users", Name: "email", Attribute: "type",
+			From: "character varying(100)", To: "character varying(255)"},
+		{Action: ChangeChanged, Kind: "column", Table: "public.users", Name: "email", Attribute: "nullable", From: "true", To: "false"},
+		{Action: ChangeChanged, Kind: "column", Table: "public.users", Name: "email", Attribute: "default", To: "''::character varying"},
+		{Action: ChangeRemoved, Kind: "column", Table: "public.users", Name: "legacy", From: "text"},
+		{Action: ChangeAdded, Kind: "column", Table: "public.users", Name: "name", To: "text not null"},
+		{Action: ChangeAdded, Kind: "index", Table: "public.users", Name: "users_email_key",
+			To: "CREATE UNIQUE INDEX users_email_key ON public.users USING btree (email)"},
+		{Action: ChangeChanged, Kind: "function", Name: "public.touch()", Attribute: "definition", From: "v1", To: "v2"},
+		{Action: ChangeAdded, Kind: "extension", Name: "citext", To: "1.6"},
+	}
+
+	if got := DiffSchemas(from, to); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected changes:\n%+v\ngot:\n%+v", want, got)
+	}
+
+	if got := DiffSchemas(to, to); len(got) != 0 {
+		t.Fatalf("expected no changes between a schema and itself, got %+v", got)
+	}
+}
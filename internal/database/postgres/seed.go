@@ -0,0 +1,1126 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
+	"github.com/mirzakhany/dbctl/internal/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// maxSeedTries is how many times a row is generated again when it breaks a unique
+// key, before giving up on the table.
+const maxSeedTries = 100
+
+// SeedRequest asks for generated rows in the tables of a database.
+type SeedRequest struct {
+	// DB is the database to seed, by name or uri, the database of the instance
+	// when empty
+	DB string
+	// Rows is the number of rows to generate, by table
+	Rows map[string]int
+	// Overrides shape the values of some columns
+	Overrides SeedOverrides
+	// Seed seeds the random source, the same seed generates the same rows
+	Seed int64
+}
+
+// SeedOverrides are the overrides of the columns of tables, by table and column.
+type SeedOverrides map[string]map[string]ColumnOverride
+
+// ColumnOverride shapes the values generated for a column, the ones it leaves unset
+// are told by the schema.
+type ColumnOverride struct {
+	// Values are picked from at random
+	Values []any `yaml:"values"`
+	// Regex is a regular expression the values match
+	Regex string `yaml:"regex"`
+	// Min and Max bound the values of a number column
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+	// Null is the share of rows, 0 to 1, the column is left NULL in
+	Null float64 `yaml:"null"`
+}
+
+// ReadSeedOverrides reads the overrides of a yaml or json file such as:
+//
+//	users:
+//	  email:
+//	    regex: '[a-z]{6}@acme\.test'
+//	  role:
+//	    values: [admin, member]
+func ReadSeedOverrides(path string) (SeedOverrides, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read overrides failed: %w", err)
+	}
+
+	var out SeedOverrides
+	if err := yaml.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("read overrides %s failed: %w", path, err)
+	}
+	return out, nil
+}
+
+// SeededTable is a table rows were generated for.
+type SeededTable struct {
+	Table string
+	Rows  int
+}
+
+// Seed generates rows in the tables of the request, after the tables they refer to,
+// in one transaction. The values follow the schema: the type, NOT NULL, CHECK and
+// UNIQUE constraints, enums and foreign keys of every column. Columns with a default
+// are left to it unless they are overridden.
+func (p *Postgres) Seed(ctx context.Context, req *SeedRequest) ([]SeededTable, error) {
+	if len(req.Rows) == 0 {
+		return nil, errors.New("no rows to generate, name a table and its number of rows, such as users=1000")
+	}
+
+	name, err := p.databaseName(req.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := New(WithHost(p.cfg.user, p.cfg.pass, name, p.cfg.port))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dbConnect(ctx, target.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// sorted, so that the same request generates the same rows
+	names := make([]string, 0, len(req.Rows))
+	for table := range req.Rows {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+
+	tables := make([]*seedTable, 0, len(names))
+	oids := make([]int64, 0, len(names))
+	for _, table := range names {
+		if req.Rows[table] < 0 {
+			return nil, fmt.Errorf("invalid number of rows for %s: %d", table, req.Rows[table])
+		}
+
+		t, err := inspectTable(ctx, tx, table)
+		if err != nil {
+			return nil, err
+		}
+		t.rows = req.Rows[table]
+		t.overrides = req.Overrides[table]
+
+		tables = append(tables, t)
+		oids = append(oids, t.oid)
+	}
+
+	deps, err := foreignKeys(ctx, tx, oids)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []SeededTable
+	for _, i := range orderByDependencies(oids, deps) {
+		t := tables[i]
+		logger.Info(fmt.Sprintf("Generating %d rows in %s ...", t.rows, t.qualifiedName()))
+
+		if err := t.seed(ctx, tx, req.Seed); err != nil {
+			return nil, fmt.Errorf("seed %s failed: %w", t.qualifiedName(), err)
+		}
+		if err := resetSequences(ctx, tx, t.oid, t.qualifiedName()); err != nil {
+			return nil, fmt.Errorf("resetting the sequences of %s failed: %w", t.qualifiedName(), err)
+		}
+		out = append(out, SeededTable{Table: t.qualifiedName(), Rows: t.rows})
+	}
+
+	return out, tx.Commit()
+}
+
+// seedTable is a table rows are generated for, as its schema tells.
+type seedTable struct {
+	oid    int64
+	schema string
+	name   string
+
+	columns []*seedColumn
+	// uniques are the column sets of the unique keys, the primary key included
+	uniques [][]string
+	fks     []*seedForeignKey
+
+	rows      int
+	overrides map[string]ColumnOverride
+}
+
+func (t *seedTable) qualifiedName() string {
+	return quoteIdentifier(t.schema) + "." + quoteIdentifier(t.name)
+}
+
+func (t *seedTable) column(name string) *seedColumn {
+	for _, c := range t.columns {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// seedColumn is a column of a table rows are generated for.
+type seedColumn struct {
+	tableColumn
+
+	notNull    bool
+	hasDefault bool
+	// kind is the typtype of the type, e for enums
+	kind   string
+	elem   string
+	typmod int
+	labels []string
+
+	rules columnRules
+
+	// unique is set when the column is a unique key on its own
+	unique bool
+	// next numbers the values of a unique column
+	next int64
+	// fk is the foreign key the column takes its value from
+	fk *seedForeignKey
+	// override shapes the values of the column, unset when the schema tells them
+	override *ColumnOverride
+}
+
+// seedForeignKey is a foreign key of a table rows are generated for, its values are
+// picked from the rows of the table it refers to.
+type seedForeignKey struct {
+	name    string
+	columns []string
+	parent  string
+	refs    []string
+
+	tuples [][]any
+	// distinct is set when the columns are a unique key, every row takes a tuple of
+	// its own: the tuples are shuffled and taken in turn
+	distinct bool
+	taken    int
+}
+
+// inspectTable reads what the schema tells about the columns of table.
+func inspectTable(ctx context.Context, tx *sql.Tx, table string) (*seedTable, error) {
+	t := &seedTable{}
+
+	// the name is parsed like in SQL, quote it to keep its case
+	err := tx.QueryRowContext(ctx, `
+		select c.oid, n.nspname, c.relname
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		where c.oid = to_regclass($1)`, table).Scan(&t.oid, &t.schema, &t.name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("table %s does not exist", table)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.readColumns(ctx, tx); err != nil {
+		return nil, fmt.Errorf("reading the columns of %s failed: %w", table, err)
+	}
+	if err := t.readConstraints(ctx, tx); err != nil {
+		return nil, fmt.Errorf("reading the constraints of %s failed: %w", table, err)
+	}
+	return t, nil
+}
+
+func (t *seedTable) readColumns(ctx context.Context, tx *sql.Tx) error {
+	// domains are generated as their base type, identity and generated columns
+	// count as having a default
+	rows, err := tx.QueryContext(ctx, `
+		select a.attname, a.attnotnull, a.atthasdef or a.attidentity <> '',
+			t.oid, t.typname, t.typtype, t.typcategory, coalesce(e.typname, ''), a.atttypmod
+		from pg_attribute a
+		join pg_type d on d.oid = a.atttypid
+		join pg_type t on t.oid = coalesce(nullif(d.typbasetype, 0), d.oid)
+		left join pg_type e on e.oid = t.typelem and t.typcategory = 'A'
+		where a.attrelid = $1 and a.attnum > 0 and not a.attisdropped
+		order by a.attnum`, t.oid)
+	if err != nil {
+		return err
+	}
+
+	enums := make(map[*seedColumn]int64)
+	for rows.Next() {
+		var c seedColumn
+		var typeOID int64
+		if err := rows.Scan(&c.name, &c.notNull, &c.hasDefault, &typeOID, &c.typ, &c.kind, &c.category, &c.elem, &c.typmod); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		t.columns = append(t.columns, &c)
+		if c.kind == "e" {
+			enums[&c] = typeOID
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for c, typeOID := range enums {
+		labels, err := queryStrings(ctx, tx, "select enumlabel::text from pg_enum where enumtypid = $1 order by enumsortorder", typeOID)
+		if err != nil {
+			return err
+		}
+		c.labels = labels
+	}
+	return nil
+}
+
+func (t *seedTable) readConstraints(ctx context.Context, tx *sql.Tx) error {
+	// unique indexes rather than constraints, a unique index is as binding. Partial
+	// and expression indexes are left out, they say nothing about a column alone.
+	rows, err := tx.QueryContext(ctx, `
+		select array(
+			select a.attname::text
+			from unnest(i.indkey::int2[]) with ordinality k(attnum, n)
+			join pg_attribute a on a.attrelid = i.indrelid and a.attnum = k.attnum
+			order by k.n)
+		from pg_index i
+		where i.indrelid = $1 and i.indisunique and i.indpred is null and not 0 = any(i.indkey::int2[])
+		order by i.indexrelid`, t.oid)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var columns []string
+		if err := rows.Scan(pq.Array(&columns)); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		t.uniques = append(t.uniques, columns)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		select conname, pg_get_constraintdef(oid)
+		from pg_constraint
+		where conrelid = $1 and contype = 'c'
+		order by conname`, t.oid)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name, def string
+		if err := rows.Scan(&name, &def); err != nil {
+			_ = rows.Close()
+			return err
+		}
+
+		rules, ok := parseCheck(def)
+		if !ok {
+			logger.Warn(fmt.Sprintf("check %s of %s is not understood, rows breaking it fail the seed, shape its columns with an override: %s",
+				name, t.qualifiedName(), def))
+		}
+		for column, r := range rules {
+			if c := t.column(column); c != nil {
+				c.rules.merge(r)
+			}
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		select c.conname, c.confrelid::regclass::text,
+			array(
+				select a.attname::text
+				from unnest(c.conkey) with ordinality k(attnum, n)
+				join pg_attribute a on a.attrelid = c.conrelid and a.attnum = k.attnum
+				order by k.n),
+			array(
+				select a.attname::text
+				from unnest(c.confkey) with ordinality k(attnum, n)
+				join pg_attribute a on a.attrelid = c.confrelid and a.attnum = k.attnum
+				order by k.n)
+		from pg_constraint c
+		where c.conrelid = $1 and c.contype = 'f'
+		order by c.conname`, t.oid)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		fk := &seedForeignKey{}
+		if err := rows.Scan(&fk.name, &fk.parent, pq.Array(&fk.columns), pq.Array(&fk.refs)); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		t.fks = append(t.fks, fk)
+	}
+	_ = rows.Close()
+	return rows.Err()
+}
+
+func queryStrings(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// seed generates the rows of t and copies them into it.
+func (t *seedTable) seed(ctx context.Context, tx *sql.Tx, seed int64) error {
+	// every table draws from a source of its own, seeding another table does not
+	// change its rows
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(t.schema + "." + t.name))
+	g := fixtures.NewGenerator(seed ^ int64(h.Sum64()))
+
+	columns, err := t.prepare(ctx, tx, g)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("every column has a default, override one of them to generate rows")
+	}
+
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		names = append(names, c.name)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema(t.schema, t.name, names...))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	// the keys of the rows already there and of the generated ones, a row breaking
+	// one is generated again
+	seen, err := t.existingKeys(ctx, tx, names)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < t.rows; i++ {
+		var row map[string]any
+		for try := 0; ; try++ {
+			if row, err = t.generate(g, columns); err != nil {
+				return err
+			}
+
+			key := t.breaks(row, seen)
+			if key == nil {
+				break
+			}
+			if try == maxSeedTries {
+				return fmt.Errorf("no row unique on (%s) found after %d tries, ask for fewer rows or override the columns with more values",
+					strings.Join(key, ", "), maxSeedTries)
+			}
+		}
+
+		values := make([]any, 0, len(columns))
+		for _, c := range columns {
+			values = append(values, row[c.name])
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return err
+		}
+	}
+
+	// the rows are only sent, and checked, once COPY is told they are all there
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+// prepare works out how every column is generated and returns the columns to copy,
+// the ones left out take their default.
+func (t *seedTable) prepare(ctx context.Context, tx *sql.Tx, g *fixtures.Generator) ([]*seedColumn, error) {
+	for name := range t.overrides {
+		if t.column(name) == nil {
+			return nil, fmt.Errorf("override of column %s, which %s does not have", name, t.qualifiedName())
+		}
+	}
+
+	var columns []*seedColumn
+	for _, c := range t.columns {
+		if o, ok := t.overrides[c.name]; ok {
+			o := o
+			c.override = &o
+		}
+		if c.hasDefault && c.override == nil {
+			continue
+		}
+		columns = append(columns, c)
+	}
+
+	for _, key := range t.uniques {
+		if len(key) == 1 {
+			if c := t.column(key[0]); c != nil {
+				c.unique = true
+			}
+		}
+	}
+
+	for _, fk := range t.fks {
+		overridden := false
+		for _, name := range fk.columns {
+			if c := t.column(name); c.override != nil || c.hasDefault {
+				overridden = true
+			}
+		}
+		// the override wins, such as a fixed tenant all rows belong to
+		if overridden {
+			continue
+		}
+
+		if err := fk.load(ctx, tx, g, t.uniques); err != nil {
+			return nil, err
+		}
+		for _, name := range fk.columns {
+			t.column(name).fk = fk
+		}
+	}
+
+	// unique numbers and texts carry on from the rows already there
+	var count int64
+	if err := tx.QueryRowContext(ctx, "select count(*) from "+t.qualifiedName()).Scan(&count); err != nil {
+		return nil, err
+	}
+	for _, c := range columns {
+		if !c.unique || c.fk != nil {
+			continue
+		}
+
+		c.next = count + 1
+		if isInteger(c.typ) {
+			var max int64
+			if err := tx.QueryRowContext(ctx, fmt.Sprintf("select coalesce(max(%s), 0) from %s",
+				quoteIdentifier(c.name), t.qualifiedName())).Scan(&max); err != nil {
+				return nil, err
+			}
+			c.next = max + 1
+			if c.rules.min != nil && c.next < int64(math.Ceil(*c.rules.min)) {
+				c.next = int64(math.Ceil(*c.rules.min))
+			}
+		}
+	}
+	return columns, nil
+}
+
+// load reads the tuples rows can refer to.
+func (fk *seedForeignKey) load(ctx context.Context, tx *sql.Tx, g *fixtures.Generator, uniques [][]string) error {
+	refs := make([]string, 0, len(fk.refs))
+	conds := make([]string, 0, len(fk.refs))
+	for _, r := range fk.refs {
+		refs = append(refs, quoteIdentifier(r)+"::text")
+		conds = append(conds, quoteIdentifier(r)+" is not null")
+	}
+
+	// the parent is named by regclass, quoted as needed already
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("select %s from %s where %s order by 1",
+		strings.Join(refs, ", "), fk.parent, strings.Join(conds, " and ")))
+	if err != nil {
+		return fmt.Errorf("reading the rows of %s failed: %w", fk.parent, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		values := make([]string, len(refs))
+		dest := make([]any, len(refs))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		tuple := make([]any, len(values))
+		for i, v := range values {
+			tuple[i] = v
+		}
+		fk.tuples = append(fk.tuples, tuple)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range uniques {
+		if containsAll(fk.columns, key) {
+			fk.distinct = true
+			g.Rand().Shuffle(len(fk.tuples), func(i, j int) {
+				fk.tuples[i], fk.tuples[j] = fk.tuples[j], fk.tuples[i]
+			})
+			break
+		}
+	}
+	return nil
+}
+
+// pick returns the tuple a row refers to, nil when there is none to refer to.
+func (fk *seedForeignKey) pick(g *fixtures.Generator) []any {
+	if fk.distinct {
+		if fk.taken == len(fk.tuples) {
+			return nil
+		}
+		fk.taken++
+		return fk.tuples[fk.taken-1]
+	}
+	if len(fk.tuples) == 0 {
+		return nil
+	}
+	return fk.tuples[g.Rand().Intn(len(fk.tuples))]
+}
+
+// generate returns the values of a row, by column.
+func (t *seedTable) generate(g *fixtures.Generator, columns []*seedColumn) (map[string]any, error) {
+	row := make(map[string]any, len(columns))
+
+	for _, fk := range t.fks {
+		if len(fk.columns) == 0 || t.column(fk.columns[0]).fk != fk {
+			continue
+		}
+
+		nullable := true
+		for _, name := range fk.columns {
+			if t.column(name).notNull {
+				nullable = false
+			}
+		}
+
+		// a row in ten does not refer to anything when it does not have to
+		var tuple []any
+		if !nullable || fk.distinct || g.Rand().Intn(10) > 0 {
+			tuple = fk.pick(g)
+		}
+		if tuple == nil && !nullable {
+			if fk.distinct && len(fk.tuples) > 0 {
+				return nil, fmt.Errorf("%s takes a row of %s of its own and there are only %d, ask for fewer rows",
+					strings.Join(fk.columns, ", "), fk.parent, len(fk.tuples))
+			}
+			return nil, fmt.Errorf("%s refers to %s, which has no rows, seed it as well", strings.Join(fk.columns, ", "), fk.parent)
+		}
+
+		for i, name := range fk.columns {
+			if tuple == nil {
+				row[name] = nil
+				continue
+			}
+			row[name] = tuple[i]
+		}
+	}
+
+	for _, c := range columns {
+		if c.fk != nil {
+			continue
+		}
+
+		v, err := c.value(g)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.name, err)
+		}
+		row[c.name] = v
+	}
+	return row, nil
+}
+
+// existingKeys returns the unique keys of the rows of t, by unique key, for the ones
+// made of generated columns only. A key of a column left to its default never
+// collides with a generated one.
+func (t *seedTable) existingKeys(ctx context.Context, tx *sql.Tx, generated []string) ([]map[string]bool, error) {
+	seen := make([]map[string]bool, len(t.uniques))
+	for i, key := range t.uniques {
+		seen[i] = make(map[string]bool)
+		if !containsAll(generated, key) {
+			continue
+		}
+
+		selects := make([]string, 0, len(key))
+		conds := make([]string, 0, len(key))
+		for _, name := range key {
+			selects = append(selects, quoteIdentifier(name)+"::text")
+			conds = append(conds, quoteIdentifier(name)+" is not null")
+		}
+
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("select %s from %s where %s",
+			strings.Join(selects, ", "), t.qualifiedName(), strings.Join(conds, " and ")))
+		if err != nil {
+			return nil, fmt.Errorf("reading the keys of %s failed: %w", t.qualifiedName(), err)
+		}
+
+		for rows.Next() {
+			values := make([]string, len(key))
+			dest := make([]any, len(key))
+			for j := range values {
+				dest[j] = &values[j]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+
+			tuple := make([]any, len(values))
+			for j, v := range values {
+				tuple[j] = v
+			}
+			seen[i][uniqueKey(tuple)] = true
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return seen, nil
+}
+
+// uniqueKey is the key of the values of the columns of a unique key, the same for a
+// generated value and for the text postgres reads it back as, such as 7 and "7".
+func uniqueKey(values []any) string {
+	var b strings.Builder
+	for _, v := range values {
+		fmt.Fprintf(&b, "%v\x00", v)
+	}
+	return b.String()
+}
+
+// breaks returns the first unique key row breaks, and records its keys otherwise.
+func (t *seedTable) breaks(row map[string]any, seen []map[string]bool) []string {
+	keys := make([]string, len(t.uniques))
+	for i, key := range t.uniques {
+		values := make([]any, 0, len(key))
+		for _, name := range key {
+			v, ok := row[name]
+			// a key of a column left to its default, or holding NULL, is unique
+			if !ok || v == nil {
+				break
+			}
+			values = append(values, v)
+		}
+		if len(values) < len(key) {
+			continue
+		}
+
+		keys[i] = uniqueKey(values)
+		if seen[i][keys[i]] {
+			return key
+		}
+	}
+
+	for i, k := range keys {
+		if k != "" {
+			seen[i][k] = true
+		}
+	}
+	return nil
+}
+
+// value generates a value of the column: the override comes first, then the values
+// its checks allow and its type.
+func (c *seedColumn) value(g *fixtures.Generator) (any, error) {
+	nulls := 0.0
+	if !c.notNull && !c.unique {
+		nulls = 0.1
+	}
+	if c.override != nil {
+		nulls = c.override.Null
+	}
+	if nulls > 0 && !c.notNull && g.Rand().Float64() < nulls {
+		return nil, nil
+	}
+
+	if o := c.override; o != nil {
+		switch {
+		case len(o.Values) > 0:
+			return copyValue(o.Values[g.Rand().Intn(len(o.Values))], c.tableColumn)
+		case o.Regex != "":
+			s, err := g.Regex(o.Regex)
+			if err != nil {
+				return nil, err
+			}
+			return c.fit(s), nil
+		}
+	}
+
+	if len(c.rules.values) > 0 {
+		return c.rules.values[g.Rand().Intn(len(c.rules.values))], nil
+	}
+	if c.rules.regex != "" {
+		s, err := g.Regex(c.rules.regex)
+		if err == nil {
+			return c.fit(s), nil
+		}
+	}
+	if len(c.labels) > 0 {
+		return c.labels[g.Rand().Intn(len(c.labels))], nil
+	}
+
+	if c.category == "A" {
+		return c.array(g)
+	}
+
+	v, ok := c.typeValue(g, c.typ)
+	if !ok {
+		if !c.notNull {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("values of type %s can not be generated, give the column an override", c.typ)
+	}
+	return v, nil
+}
+
+func (c *seedColumn) array(g *fixtures.Generator) (any, error) {
+	n := g.Rand().Intn(4)
+	elems := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		v, ok := c.typeValue(g, c.elem)
+		if !ok {
+			break
+		}
+		elems = append(elems, v)
+	}
+	return pq.GenericArray{A: elems}.Value()
+}
+
+// typeValue generates a value of type typ, false when the type is not known.
+func (c *seedColumn) typeValue(g *fixtures.Generator, typ string) (any, bool) {
+	rnd := g.Rand()
+	switch typ {
+	case "int2", "int4", "int8":
+		if c.unique {
+			c.next++
+			return c.next - 1, true
+		}
+		limit := map[string]float64{"int2": math.MaxInt16, "int4": math.MaxInt32, "int8": math.MaxInt64}[typ]
+		min, max := c.bounds(1, 10000, 1, -limit, limit)
+		lo, hi := int64(math.Ceil(min)), int64(math.Floor(max))
+		if hi < lo {
+			return lo, true
+		}
+		return lo + rnd.Int63n(hi-lo+1), true
+	case "numeric", "float4", "float8", "money":
+		scale := 2
+		limit := 1e15
+		if typ == "numeric" && c.typmod >= 4 {
+			precision := ((c.typmod - 4) >> 16) & 0xffff
+			scale = (c.typmod - 4) & 0xffff
+			limit = math.Pow10(precision-scale) - math.Pow10(-scale)
+		}
+		step := math.Pow10(-scale)
+		min, max := c.bounds(0, 1000, step, -limit, limit)
+		v := min + rnd.Float64()*(max-min)
+		return strconv.FormatFloat(math.Round(v/step)*step, 'f', scale, 64), true
+	case "bool":
+		return g.Bool(), true
+	case "text", "varchar", "bpchar", "citext", "name":
+		return c.fit(c.text(g)), true
+	case "uuid":
+		return g.UUID(), true
+	case "date":
+		return g.Date(), true
+	case "timestamp", "timestamptz":
+		return g.Timestamp(), true
+	case "time", "timetz":
+		return g.Time().Format("15:04:05"), true
+	case "interval":
+		return fmt.Sprintf("%d days %d hours", rnd.Intn(30), rnd.Intn(24)), true
+	case "json", "jsonb":
+		return fmt.Sprintf(`{"%s": "%s"}`, g.Word(), g.Word()), true
+	case "bytea":
+		b := make([]byte, 8)
+		_, _ = rnd.Read(b)
+		return b, true
+	case "inet", "cidr":
+		return fmt.Sprintf("10.%d.%d.%d", rnd.Intn(256), rnd.Intn(256), 1+rnd.Intn(254)), true
+	}
+	return nil, false
+}
+
+// bounds returns the range to draw a number from, the default one moved inside what
+// the checks and the override allow. step is the smallest difference between values.
+func (c *seedColumn) bounds(min, max, step, lowest, highest float64) (float64, float64) {
+	lo, hi := lowest, highest
+	if c.rules.min != nil {
+		lo = math.Max(lo, *c.rules.min)
+	}
+	if c.rules.max != nil {
+		hi = math.Min(hi, *c.rules.max)
+	}
+	if o := c.override; o != nil && o.Min != nil {
+		lo = math.Max(lo, *o.Min)
+	}
+	if o := c.override; o != nil && o.Max != nil {
+		hi = math.Min(hi, *o.Max)
+	}
+	if c.rules.minExclusive {
+		lo += step
+	}
+	if c.rules.maxExclusive {
+		hi -= step
+	}
+
+	// keep the default range where it fits, the numbers of a check such as
+	// price > 0 look like prices
+	switch {
+	case hi < min:
+		return math.Max(lo, hi-max+min), hi
+	case lo > max:
+		return lo, math.Min(hi, lo+max-min)
+	}
+	return math.Max(min, lo), math.Min(max, hi)
+}
+
+// text generates a text, told by the name of the column: an email for email, a
+// name for first_name.
+func (c *seedColumn) text(g *fixtures.Generator) string {
+	name := strings.ToLower(c.name)
+
+	var unique []any
+	if c.unique {
+		unique = append(unique, c.next)
+		c.next++
+	}
+
+	switch {
+	case strings.Contains(name, "email"):
+		return g.Email(unique...)
+	case strings.Contains(name, "username") || name == "login" || name == "handle":
+		return g.Username(unique...)
+	case strings.Contains(name, "first_name") || name == "firstname":
+		return g.FirstName() + fixtures.UniqueSuffix(unique...)
+	case strings.Contains(name, "last_name") || name == "lastname" || name == "surname":
+		return g.LastName() + fixtures.UniqueSuffix(unique...)
+	case name == "name" || strings.Contains(name, "full_name") || strings.HasSuffix(name, "_name"):
+		return g.Name() + fixtures.UniqueSuffix(unique...)
+	case strings.Contains(name, "company") || strings.Contains(name, "organization"):
+		return g.Company() + fixtures.UniqueSuffix(unique...)
+	case strings.Contains(name, "city"):
+		return g.City() + fixtures.UniqueSuffix(unique...)
+	case strings.Contains(name, "phone"):
+		s, _ := g.Regex(`\+1 555 [0-9]{3} [0-9]{4}`)
+		return s + fixtures.UniqueSuffix(unique...)
+	case strings.Contains(name, "url") || strings.Contains(name, "website"):
+		return "https://example.com/" + g.Word() + fixtures.UniqueSuffix(unique...)
+	case strings.Contains(name, "description") || strings.Contains(name, "comment") || name == "body" ||
+		name == "bio" || name == "content" || name == "notes" || name == "title" || name == "summary":
+		return g.Sentence() + fixtures.UniqueSuffix(unique...)
+	}
+	return g.Word() + fixtures.UniqueSuffix(unique...)
+}
+
+// fit cuts s to the length the column and its checks allow.
+func (c *seedColumn) fit(s string) string {
+	limit := 0
+	if (c.typ == "varchar" || c.typ == "bpchar") && c.typmod > 4 {
+		limit = c.typmod - 4
+	}
+	if c.rules.maxLen > 0 && (limit == 0 || c.rules.maxLen < limit) {
+		limit = c.rules.maxLen
+	}
+
+	// unique values end with their number, cut from the front to keep it
+	if r := []rune(s); limit > 0 && len(r) > limit {
+		if c.unique {
+			return string(r[len(r)-limit:])
+		}
+		return string(r[:limit])
+	}
+
+	for len([]rune(s)) < c.rules.minLen {
+		s += "x"
+	}
+	return s
+}
+
+func isInteger(typ string) bool {
+	return typ == "int2" || typ == "int4" || typ == "int8"
+}
+
+func containsAll(set, subset []string) bool {
+	for _, s := range subset {
+		found := false
+		for _, v := range set {
+			if v == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// columnRules are what the checks of a table allow in a column.
+type columnRules struct {
+	min, max                   *float64
+	minExclusive, maxExclusive bool
+	// minLen and maxLen bound the length of texts, maxLen is unbounded when 0
+	minLen, maxLen int
+	values         []string
+	regex          string
+}
+
+// merge narrows r to what o allows as well.
+func (r *columnRules) merge(o columnRules) {
+	if o.min != nil && (r.min == nil || *o.min >= *r.min) {
+		r.min, r.minExclusive = o.min, o.minExclusive
+	}
+	if o.max != nil && (r.max == nil || *o.max <= *r.max) {
+		r.max, r.maxExclusive = o.max, o.maxExclusive
+	}
+	if o.minLen > r.minLen {
+		r.minLen = o.minLen
+	}
+	if o.maxLen > 0 && (r.maxLen == 0 || o.maxLen < r.maxLen) {
+		r.maxLen = o.maxLen
+	}
+	if len(o.values) > 0 {
+		r.values = o.values
+	}
+	if o.regex != "" {
+		r.regex = o.regex
+	}
+}
+
+var (
+	checkCast    = regexp.MustCompile(`::[a-z][a-z0-9_]*(?: [a-z][a-z0-9_]*)*(\[\])?`)
+	checkCompare = regexp.MustCompile(`^"?(\w+)"? (>=|>|<=|<) (-?[0-9.]+)$`)
+	checkFlipped = regexp.MustCompile(`^(-?[0-9.]+) (>=|>|<=|<) "?(\w+)"?$`)
+	checkAny     = regexp.MustCompile(`^"?(\w+)"? = ANY ARRAY\[(.*)\]$`)
+	checkLength  = regexp.MustCompile(`^(?:char_length|length) "?(\w+)"? (>=|>|<=|<) ([0-9]+)$`)
+	checkMatch   = regexp.MustCompile(`^"?(\w+)"? ~ '(.*)'$`)
+	checkNotNull = regexp.MustCompile(`^"?(\w+)"? IS NOT NULL$`)
+	checkLiteral = regexp.MustCompile(`'((?:[^']|'')*)'`)
+)
+
+// parseCheck reads the rules of a check constraint, as pg_get_constraintdef prints
+// it, by column. Checks made of comparisons to numbers, lists of values, lengths and
+// regular expressions joined by AND are understood, ok is false when a part of the
+// check is not.
+func parseCheck(def string) (map[string]columnRules, bool) {
+	def = strings.TrimSpace(strings.TrimPrefix(def, "CHECK"))
+	def = strings.TrimSuffix(def, " NOT VALID")
+	if strings.Contains(def, " OR ") {
+		return nil, false
+	}
+
+	// casts and parentheses say nothing the rules need, ARRAY[] keeps its brackets
+	def = checkCast.ReplaceAllString(def, "")
+	def = strings.NewReplacer("(", " ", ")", " ").Replace(def)
+	def = strings.Join(strings.Fields(def), " ")
+
+	out := make(map[string]columnRules)
+	ok := true
+	for _, term := range strings.Split(def, " AND ") {
+		term = strings.TrimSpace(term)
+
+		if m := checkCompare.FindStringSubmatch(term); m != nil {
+			addBound(out, m[1], m[2], m[3])
+			continue
+		}
+		if m := checkFlipped.FindStringSubmatch(term); m != nil {
+			// 0 < price is price > 0
+			flipped := map[string]string{">": "<", ">=": "<=", "<": ">", "<=": ">="}[m[2]]
+			addBound(out, m[3], flipped, m[1])
+			continue
+		}
+		if m := checkAny.FindStringSubmatch(term); m != nil {
+			r := out[m[1]]
+			for _, lit := range checkLiteral.FindAllStringSubmatch(m[2], -1) {
+				r.values = append(r.values, strings.ReplaceAll(lit[1], "''", "'"))
+			}
+			out[m[1]] = r
+			continue
+		}
+		if m := checkLength.FindStringSubmatch(term); m != nil {
+			n, _ := strconv.Atoi(m[3])
+			r := out[m[1]]
+			switch m[2] {
+			case ">":
+				r.minLen = n + 1
+			case ">=":
+				r.minLen = n
+			case "<":
+				r.maxLen = n - 1
+			case "<=":
+				r.maxLen = n
+			}
+			out[m[1]] = r
+			continue
+		}
+		if m := checkMatch.FindStringSubmatch(term); m != nil {
+			r := out[m[1]]
+			r.regex = strings.ReplaceAll(m[2], "''", "'")
+			out[m[1]] = r
+			continue
+		}
+		if checkNotNull.MatchString(term) {
+			continue
+		}
+		ok = false
+	}
+	return out, ok
+}
+
+func addBound(rules map[string]columnRules, column, op, number string) {
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return
+	}
+
+	r := rules[column]
+	switch op {
+	case ">", ">=":
+		r.min, r.minExclusive = &v, op == ">"
+	case "<", "<=":
+		r.max, r.maxExclusive = &v, op == "<"
+	}
+	rules[column] = r
+}
@@ -0,0 +1,156 @@
+package pg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mirzakhany/dbctl/internal/fixtures"
+)
+
+func TestParseCheck(t *testing.T) {
+	float := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		def   string
+		rules map[string]columnRules
+		ok    bool
+	}{
+		{
+			def:   "CHECK ((price > (0)::numeric))",
+			rules: map[string]columnRules{"price": {min: float(0), minExclusive: true}},
+			ok:    true,
+		},
+		{
+			def:   "CHECK (((age >= 18) AND (age <= 130)))",
+			rules: map[string]columnRules{"age": {min: float(18), max: float(130)}},
+			ok:    true,
+		},
+		{
+			def:   "CHECK ((0 < quantity))",
+			rules: map[string]columnRules{"quantity": {min: float(0), minExclusive: true}},
+			ok:    true,
+		},
+		{
+			def:   "CHECK (((status)::text = ANY ((ARRAY['new'::character varying, 'paid'::character varying, 'it''s'::character varying])::text[])))",
+			rules: map[string]columnRules{"status": {values: []string{"new", "paid", "it's"}}},
+			ok:    true,
+		},
+		{
+			def:   "CHECK ((char_length(name) <= 50) AND (name IS NOT NULL))",
+			rules: map[string]columnRules{"name": {maxLen: 50}},
+			ok:    true,
+		},
+		{
+			def:   "CHECK ((code ~ '^[A-Z]{3}$'::text))",
+			rules: map[string]columnRules{"code": {regex: "^[A-Z]{3}$"}},
+			ok:    true,
+		},
+		{
+			def: "CHECK (((starts_at < ends_at) OR (ends_at IS NULL)))",
+			ok:  false,
+		},
+		{
+			def:   "CHECK ((starts_at < ends_at) AND (total >= 0))",
+			rules: map[string]columnRules{"total": {min: float(0)}},
+			ok:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		rules, ok := parseCheck(tt.def)
+		if ok != tt.ok {
+			t.Fatalf("%s: expected ok %v, got %v", tt.def, tt.ok, ok)
+		}
+		if tt.rules != nil && !reflect.DeepEqual(rules, tt.rules) {
+			t.Fatalf("%s: expected rules %+v, got %+v", tt.def, tt.rules, rules)
+		}
+	}
+}
+
+func TestSeedColumnValue(t *testing.T) {
+	g := fixtures.NewGenerator(fixtures.DefaultSeed)
+	min, max := 10.0, 20.0
+
+	qty := &seedColumn{tableColumn: tableColumn{name: "qty", typ: "int4"}, notNull: true}
+	qty.rules.merge(columnRules{min: &min, max: &max, maxExclusive: true})
+
+	price := &seedColumn{tableColumn: tableColumn{name: "price", typ: "numeric"}, notNull: true, typmod: (5<<16 | 2) + 4}
+	email := &seedColumn{tableColumn: tableColumn{name: "email", typ: "varchar"}, notNull: true, unique: true, typmod: 20 + 4, next: 1}
+	role := &seedColumn{tableColumn: tableColumn{name: "role", typ: "text"}, notNull: true,
+		override: &ColumnOverride{Values: []any{"admin", "member"}}}
+
+	for i := 0; i < 200; i++ {
+		v, err := qty.value(g)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n := v.(int64); n < 10 || n > 19 {
+			t.Fatalf("expected qty in [10, 20), got %d", n)
+		}
+
+		v, err = price.value(g)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if s := v.(string); len(s) > 6 || !strings.Contains(s, ".") {
+			t.Fatalf("expected a numeric(5, 2), got %s", s)
+		}
+
+		v, err = role.value(g)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v != "admin" && v != "member" {
+			t.Fatalf("expected a role of the override, got %v", v)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		v, err := email.value(g)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s := v.(string)
+		if len(s) > 20 || seen[s] {
+			t.Fatalf("expected unique emails of at most 20 characters, got %s", s)
+		}
+		seen[s] = true
+	}
+}
+
+func TestSeedTableBreaks(t *testing.T) {
+	table := &seedTable{uniques: [][]string{{"id"}, {"org_id", "slug"}}}
+	seen := []map[string]bool{{}, {}}
+
+	if key := table.breaks(map[string]any{"id": 1, "org_id": "1", "slug": "a"}, seen); key != nil {
+		t.Fatalf("expected the first row to be unique, it breaks %v", key)
+	}
+	if key := table.breaks(map[string]any{"id": 2, "org_id": "1", "slug": "a"}, seen); !reflect.DeepEqual(key, []string{"org_id", "slug"}) {
+		t.Fatalf("expected the second row to break (org_id, slug), got %v", key)
+	}
+	// a key holding NULL does not collide
+	if key := table.breaks(map[string]any{"id": 3, "org_id": nil, "slug": "a"}, seen); key != nil {
+		t.Fatalf("expected a key holding NULL to be unique, it breaks %v", key)
+	}
+}
+
+func TestUniqueKey(t *testing.T) {
+	// the keys of the rows already there are read back as text
+	table := &seedTable{uniques: [][]string{{"id"}, {"org_id", "slug"}}}
+	seen := []map[string]bool{
+		{uniqueKey([]any{"7"}): true},
+		{uniqueKey([]any{"1", "a"}): true},
+	}
+
+	if key := table.breaks(map[string]any{"id": int64(7), "org_id": "2", "slug": "a"}, seen); !reflect.DeepEqual(key, []string{"id"}) {
+		t.Fatalf("expected a row to break the id of an existing one, got %v", key)
+	}
+	if key := table.breaks(map[string]any{"id": int64(8), "org_id": "1", "slug": "a"}, seen); !reflect.DeepEqual(key, []string{"org_id", "slug"}) {
+		t.Fatalf("expected a row to break (org_id, slug) of an existing one, got %v", key)
+	}
+	if key := table.breaks(map[string]any{"id": int64(8), "org_id": "1", "slug": "b"}, seen); key != nil {
+		t.Fatalf("expected a new row to be unique, it breaks %v", key)
+	}
+}
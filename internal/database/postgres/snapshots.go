@@ -0,0 +1,355 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+var _ database.Snapshotter = (*Postgres)(nil)
+
+// SnapshotPrefix starts the name of the database holding a snapshot, the name of
+// the snapshot makes up the rest of it.
+const SnapshotPrefix = "dbctl_snap_"
+
+// snapshotMeta is kept as the comment of the snapshot database, like templateMeta.
+type snapshotMeta struct {
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// errSchemaSnapshot is returned for a snapshot of a schema handed out with schema
+// isolation, the database it lives in holds the schemas of every test sharing it.
+var errSchemaSnapshot = errors.New("snapshots copy a whole database, not a schema of " + SchemasDatabase)
+
+// CreateSnapshot copies db to a snapshot called name.
+func (p *Postgres) CreateSnapshot(ctx context.Context, name, db string) (*database.Snapshot, error) {
+	if err := database.ValidateSnapshotName(name); err != nil {
+		return nil, err
+	}
+
+	source, err := p.snapshotDatabase(db)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.connectOutside(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	snapshot := SnapshotPrefix + name
+	if err := copyDatabase(ctx, conn, p.cfg.user, source, snapshot); err != nil {
+		if isDuplicateDatabase(err) {
+			return nil, fmt.Errorf("%w: %q, remove it first", database.ErrSnapshotExists, name)
+		}
+		return nil, fmt.Errorf("snapshot of %q failed: %w", source, err)
+	}
+
+	meta := snapshotMeta{Source: source, CreatedAt: time.Now().UTC()}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("comment on database %s is %s",
+		quoteIdentifier(snapshot), quoteLiteral(string(b)))); err != nil {
+		logger.Debug("storing the details of snapshot", name, "failed:", err)
+	}
+
+	return &database.Snapshot{Name: name, Type: database.TypePostgres, Source: source, CreatedAt: meta.CreatedAt}, nil
+}
+
+// copyDatabase creates dst holding what src does. Cloning is what postgres does
+// fastest, but it refuses to clone a database anyone is connected to, such as the
+// one a test snapshots midway. Those are copied through pg_dump instead.
+func copyDatabase(ctx context.Context, conn *sql.DB, user, src, dst string) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("create database %s with template %s",
+		quoteIdentifier(dst), quoteIdentifier(src)))
+	if err == nil || !isObjectInUse(err) {
+		return err
+	}
+
+	logger.Debug("database", src, "is in use, copying it with pg_dump")
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("create database %s template template0", quoteIdentifier(dst))); err != nil {
+		return err
+	}
+
+	cmd := fmt.Sprintf("f=$(mktemp) && pg_dump -Fc -U %[1]s -d %[2]s -f \"$f\" && pg_restore --exit-on-error -U %[1]s -d %[3]s \"$f\"; s=$?; rm -f \"$f\"; exit $s",
+		shellQuote(user), shellQuote(src), shellQuote(dst))
+	if err := runProgram(ctx, conn, cmd, ""); err != nil {
+		_, _ = conn.ExecContext(context.Background(), fmt.Sprintf("drop database if exists %s", quoteIdentifier(dst)))
+		return err
+	}
+	return nil
+}
+
+// RestoreSnapshot replaces db with a copy of the snapshot called name, the sessions
+// connected to db are ended.
+func (p *Postgres) RestoreSnapshot(ctx context.Context, name, db string) error {
+	// told apart before anything is looked up, restoring drops the target
+	var target string
+	if db != "" {
+		var err error
+		if target, err = p.snapshotDatabase(db); err != nil {
+			return err
+		}
+	}
+
+	snapshot, err := p.snapshot(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if target == "" {
+		target = snapshot.Source
+	}
+	if target == "" {
+		return fmt.Errorf("snapshot %q does not tell which database it was taken of, name the one to restore into", name)
+	}
+	if target == SchemasDatabase {
+		return errSchemaSnapshot
+	}
+
+	conn, err := p.connectOutside(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	return restoreDatabase(ctx, conn, name, target)
+}
+
+// restoreDatabase replaces target with a copy of the snapshot called name. The
+// snapshot is cloned under another name first and target only dropped once the
+// clone succeeded, a restore failing half way leaves target as it was.
+func restoreDatabase(ctx context.Context, conn *sql.DB, name, target string) error {
+	staging := "dbctl_restore_snap_" + name
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("drop database if exists %s", quoteIdentifier(staging))); err != nil {
+		return fmt.Errorf("restore snapshot %q failed: %w", name, err)
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("create database %s with template %s",
+		quoteIdentifier(staging), quoteIdentifier(SnapshotPrefix+name))); err != nil {
+		return fmt.Errorf("restore snapshot %q failed: %w", name, err)
+	}
+
+	if err := dropDatabase(ctx, conn, target); err != nil {
+		_, _ = conn.ExecContext(context.Background(), fmt.Sprintf("drop database if exists %s", quoteIdentifier(staging)))
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("alter database %s rename to %s",
+		quoteIdentifier(staging), quoteIdentifier(target))); err != nil {
+		return fmt.Errorf("restore snapshot %q failed, it is restored as %s: %w", name, staging, err)
+	}
+	return nil
+}
+
+// connectOutside connects to the instance through a database other than db. A
+// database can neither be dropped from a session connected to it nor cloned while
+// one is, so the database of the instance is worked on from another one. template1
+// always exists, sessions on it only hold up creating databases for a moment.
+func (p *Postgres) connectOutside(ctx context.Context, db string) (*sql.DB, error) {
+	admin := p.cfg.name
+	if db == admin {
+		admin = "postgres"
+		if db == admin {
+			admin = "template1"
+		}
+	}
+
+	adminDB, err := New(WithHost(p.cfg.user, p.cfg.pass, admin, p.cfg.port))
+	if err != nil {
+		return nil, err
+	}
+	return dbConnect(ctx, adminDB.URI())
+}
+
+// BranchSnapshot creates a new database holding the snapshot called name.
+func (p *Postgres) BranchSnapshot(ctx context.Context, name string) (*database.CreateDBResponse, error) {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := findSnapshot(ctx, conn, name); err != nil {
+		return nil, err
+	}
+
+	dbName := fmt.Sprintf("dbctl_%d", time.Now().UnixNano())
+	if err := p.createDatabaseWithTemplate(ctx, conn, dbName, SnapshotPrefix+name); err != nil {
+		return nil, fmt.Errorf("branch snapshot %q failed: %w", name, err)
+	}
+	p.trackTestDatabase(ctx, conn, dbName)
+
+	newDB, err := New(WithHost(p.cfg.user, p.cfg.pass, dbName, p.cfg.port))
+	if err != nil {
+		return nil, err
+	}
+	return &database.CreateDBResponse{URI: p.clientURI(newDB.URI()), CA: p.cfg.certs.Authority()}, nil
+}
+
+// Snapshots returns the snapshots of this instance, sorted by name.
+func (p *Postgres) Snapshots(ctx context.Context) ([]database.Snapshot, error) {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	return listSnapshots(ctx, conn)
+}
+
+// RemoveSnapshot drops the snapshot called name.
+func (p *Postgres) RemoveSnapshot(ctx context.Context, name string) error {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := findSnapshot(ctx, conn, name); err != nil {
+		return err
+	}
+	return dropDatabase(ctx, conn, SnapshotPrefix+name)
+}
+
+func listSnapshots(ctx context.Context, conn *sql.DB) ([]database.Snapshot, error) {
+	rows, err := conn.QueryContext(ctx, `
+		select datname, coalesce(shobj_description(oid, 'pg_database'), '')
+		from pg_database
+		where left(datname, length($1)) = $1`, SnapshotPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots failed: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var out []database.Snapshot
+	for rows.Next() {
+		var datname, comment string
+		if err := rows.Scan(&datname, &comment); err != nil {
+			return nil, err
+		}
+
+		var meta snapshotMeta
+		_ = json.Unmarshal([]byte(comment), &meta)
+
+		out = append(out, database.Snapshot{
+			Name:      strings.TrimPrefix(datname, SnapshotPrefix),
+			Type:      database.TypePostgres,
+			Source:    meta.Source,
+			CreatedAt: meta.CreatedAt,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (p *Postgres) snapshot(ctx context.Context, name string) (*database.Snapshot, error) {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	return findSnapshot(ctx, conn, name)
+}
+
+func findSnapshot(ctx context.Context, conn *sql.DB, name string) (*database.Snapshot, error) {
+	snapshots, err := listSnapshots(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range snapshots {
+		if s.Name == name {
+			return &s, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no postgres snapshot called %q", database.ErrSnapshotNotFound, name)
+}
+
+// databaseName is the name of the database db stands for, either a name or a
+// connection uri. The database of the instance is used when db is empty.
+func (p *Postgres) databaseName(db string) (string, error) {
+	if db == "" {
+		return p.cfg.name, nil
+	}
+
+	if !strings.Contains(db, "://") {
+		return db, nil
+	}
+
+	u, err := url.Parse(db)
+	if err != nil {
+		return "", fmt.Errorf("parse database uri failed: %w", err)
+	}
+
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" {
+		return "", fmt.Errorf("uri %q does not contain a database name", db)
+	}
+	return name, nil
+}
+
+// snapshotDatabase is the database db stands for, the way databaseName tells it, to
+// take a snapshot of or restore one into. A uri of a schema handed out with schema
+// isolation is refused rather than taken for the database it lives in.
+func (p *Postgres) snapshotDatabase(db string) (string, error) {
+	if strings.Contains(db, "://") {
+		if u, err := url.Parse(db); err == nil && schemaOf(u) != "" {
+			return "", fmt.Errorf("%w, the uri is of schema %s", errSchemaSnapshot, schemaOf(u))
+		}
+	}
+
+	name, err := p.databaseName(db)
+	if err != nil {
+		return "", err
+	}
+	if name == SchemasDatabase {
+		return "", errSchemaSnapshot
+	}
+	return name, nil
+}
+
+// isObjectInUse reports whether err is postgres refusing to act on a database that
+// has sessions connected to it.
+func isObjectInUse(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "55006"
+}
+
+func isDuplicateDatabase(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P04"
+}
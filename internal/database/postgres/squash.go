@@ -0,0 +1,248 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/container"
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// TrackingTables are the tables migration tools keep the migrations they applied in.
+// A baseline carries their rows, so that the tool takes the squashed migrations as
+// applied.
+var TrackingTables = []string{
+	"schema_migrations",     // golang-migrate, dbmate, rails
+	"goose_db_version",      // goose
+	"flyway_schema_history", // flyway
+	"gorp_migrations",       // sql-migrate
+	"knex_migrations",       // knex
+}
+
+// Baseline is the result of squashing migrations.
+type Baseline struct {
+	// SQL builds the schema the migrations do, and holds the rows of their
+	// tracking tables.
+	SQL []byte
+	// Files are the migrations squashed, relative to their directory.
+	Files []string
+	// Tracking are the tracking tables whose rows the baseline holds.
+	Tracking []string
+}
+
+// psqlMetaCommand matches the lines of a plain dump meant for psql rather than the
+// server, such as the \restrict of newer pg_dump versions. Baselines are applied as
+// migrations, through a connection that would choke on them.
+var psqlMetaCommand = regexp.MustCompile(`(?m)^\\.*\n?`)
+
+// Squash applies the migrations at path to a new database, through their template,
+// and dumps its schema along with the rows of the tracking tables found in it, of
+// TrackingTables and of tracking. The dump is then applied to another database and
+// both are compared: the baseline is only returned when it builds the same schema,
+// and the same tracking rows, as the migrations do.
+func (p *Postgres) Squash(ctx context.Context, path string, tracking []string) (*Baseline, error) {
+	files, err := getFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations failed: %w", err)
+	}
+	files = MigrationFiles(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no migrations found in %s", path)
+	}
+
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	stamp := time.Now().UnixNano()
+	replay, err := p.database(fmt.Sprintf("dbctl_squash_%d", stamp))
+	if err != nil {
+		return nil, err
+	}
+	check, err := p.database(fmt.Sprintf("dbctl_squash_check_%d", stamp))
+	if err != nil {
+		return nil, err
+	}
+
+	// a migration or the baseline may fail half way, leaving the database behind
+	defer func() {
+		for _, name := range []string{replay.cfg.name, check.cfg.name} {
+			if err := dropDatabase(context.Background(), conn, name); err != nil {
+				logger.Warn(err.Error())
+			}
+		}
+	}()
+
+	if err := p.createDatabaseFromMigrations(ctx, conn, replay.cfg.name, replay.URI(), path); err != nil {
+		return nil, err
+	}
+
+	replayConn, err := dbConnect(ctx, replay.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = replayConn.Close()
+	}()
+
+	found, err := existingTables(ctx, replayConn, append(append([]string{}, TrackingTables...), tracking...))
+	if err != nil {
+		return nil, err
+	}
+
+	dump, err := p.schemaDump(ctx, replay.cfg.name, found)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Baseline{Files: make([]string, 0, len(files)), Tracking: found}
+	for _, f := range files {
+		b.Files = append(b.Files, displayName(path, f))
+	}
+	b.SQL = []byte(fmt.Sprintf("-- Baseline of %d migrations, %s to %s, written by dbctl squash.\n-- It builds the schema applying them does.\n\n%s",
+		len(b.Files), b.Files[0], b.Files[len(b.Files)-1], dump))
+
+	if err := createDatabase(ctx, conn, check.cfg.name); err != nil {
+		return nil, err
+	}
+	if err := applySQLSource(ctx, check.URI(), "baseline", string(b.SQL)); err != nil {
+		return nil, fmt.Errorf("the baseline does not apply: %w", err)
+	}
+
+	checkConn, err := dbConnect(ctx, check.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = checkConn.Close()
+	}()
+
+	if err := sameDatabases(ctx, replayConn, checkConn, found); err != nil {
+		return nil, fmt.Errorf("the baseline does not build what the migrations do: %w", err)
+	}
+	return b, nil
+}
+
+// database returns a controller for the database name of the instance.
+func (p *Postgres) database(name string) (*Postgres, error) {
+	return New(WithHost(p.cfg.user, p.cfg.pass, name, p.cfg.port))
+}
+
+// schemaDump dumps the schema of db, and the rows of tables, as plain SQL. Owners
+// and privileges are left out, they belong to the roles of an instance rather than
+// to the schema.
+func (p *Postgres) schemaDump(ctx context.Context, db string, tables []string) (string, error) {
+	if p.containerID == "" {
+		return "", errors.New("dumping a schema takes the container of the instance, it is not known")
+	}
+
+	args := []string{"pg_dump", "-U", p.cfg.user, "-d", db, "--no-owner", "--no-privileges"}
+	schema, err := container.Exec(ctx, p.containerID, append(append([]string{}, args...), "--schema-only"))
+	if err != nil {
+		return "", fmt.Errorf("dump schema failed: %w", err)
+	}
+	out := psqlMetaCommand.ReplaceAllString(schema, "")
+
+	if len(tables) > 0 {
+		// inserts rather than COPY ... FROM stdin, which only psql feeds
+		dataArgs := append(append([]string{}, args...), "--data-only", "--inserts")
+		for _, t := range tables {
+			dataArgs = append(dataArgs, "--table", t)
+		}
+		data, err := container.Exec(ctx, p.containerID, dataArgs)
+		if err != nil {
+			return "", fmt.Errorf("dump tracking rows failed: %w", err)
+		}
+		out += "\n" + psqlMetaCommand.ReplaceAllString(data, "")
+	}
+
+	// the dump empties the search path of its session, among other settings. The
+	// migrations following the baseline may run on the same connection.
+	return out + "\nRESET ALL;\n", nil
+}
+
+// applySQLSource applies src to the database at uri the way migrations are applied.
+func applySQLSource(ctx context.Context, uri, name, src string) error {
+	conn, err := dbConnect(ctx, uri)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	return applySource(ctx, conn, name, src)
+}
+
+// existingTables returns the ones of names, each a table name or schema and name,
+// that exist in the database of conn, in the order of names.
+func existingTables(ctx context.Context, conn *sql.DB, names []string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		var table sql.NullString
+		if err := conn.QueryRowContext(ctx, "select to_regclass($1)::text", name).Scan(&table); err != nil {
+			return nil, fmt.Errorf("look up table %s failed: %w", name, err)
+		}
+		if table.Valid && !seen[table.String] {
+			seen[table.String] = true
+			out = append(out, table.String)
+		}
+	}
+	return out, nil
+}
+
+// sameDatabases returns an error naming what differs between the schemas of a and
+// b, or between the rows of tables.
+func sameDatabases(ctx context.Context, a, b *sql.DB, tables []string) error {
+	sa, err := ReadSchema(ctx, a, nil, "")
+	if err != nil {
+		return err
+	}
+	sb, err := ReadSchema(ctx, b, nil, "")
+	if err != nil {
+		return err
+	}
+
+	if changes := DiffSchemas(sa, sb); len(changes) > 0 {
+		lines := make([]string, 0, len(changes))
+		for _, c := range changes {
+			name := c.Name
+			if c.Table != "" {
+				name = c.Table + "." + c.Name
+			}
+			line := c.Action + " " + c.Kind + " " + name
+			if c.Attribute != "" {
+				line += " " + c.Attribute
+			}
+			lines = append(lines, line)
+		}
+		return fmt.Errorf("%d schema differences: %s", len(changes), strings.Join(lines, ", "))
+	}
+
+	for _, t := range tables {
+		// tables are names to_regclass printed, quoted where needed
+		query := fmt.Sprintf("select count(*), coalesce(md5(string_agg(t::text, ',' order by t::text)), '') from %s t", t)
+
+		var countA, countB int64
+		var sumA, sumB string
+		if err := a.QueryRowContext(ctx, query).Scan(&countA, &sumA); err != nil {
+			return fmt.Errorf("read rows of %s failed: %w", t, err)
+		}
+		if err := b.QueryRowContext(ctx, query).Scan(&countB, &sumB); err != nil {
+			return fmt.Errorf("read rows of %s failed: %w", t, err)
+		}
+		if countA != countB || sumA != sumB {
+			return fmt.Errorf("the rows of %s differ, %d rows after the migrations and %d after the baseline", t, countA, countB)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package pg
+
+import "testing"
+
+func TestPsqlMetaCommand(t *testing.T) {
+	dump := "--\n-- PostgreSQL database dump\n--\n\n\\restrict abc123\n\nSET statement_timeout = 0;\nCREATE TABLE public.users (id bigint);\n\n\\unrestrict abc123\n"
+	want := "--\n-- PostgreSQL database dump\n--\n\n\nSET statement_timeout = 0;\nCREATE TABLE public.users (id bigint);\n\n"
+
+	if got := psqlMetaCommand.ReplaceAllString(dump, ""); got != want {
+		t.Fatalf("expected the psql meta commands to be removed, got:\n%s", got)
+	}
+}
@@ -0,0 +1,248 @@
+package pg
+
+import (
+	"strings"
+)
+
+// statement is a single sql statement together with where it starts in the file it
+// was read from, so that a failure can be reported against the source.
+type statement struct {
+	sql string
+	// offset is the byte offset of the statement in the file
+	offset int
+	// line is the line the statement starts on, counting from 1
+	line int
+}
+
+// splitStatements splits the content of a sql file into its statements. Postgres is
+// happy to run a whole file in one go, but statements that refuse to run inside a
+// transaction block have to be sent one at a time.
+//
+// Semicolons inside string literals, quoted identifiers, dollar quoted bodies and
+// comments do not end a statement. Comments and blank space between statements are
+// dropped, a statement starts at its first token.
+func splitStatements(src string) []statement {
+	var (
+		out   []statement
+		start = -1
+		line  = 1
+		// line the current statement starts on
+		startLine int
+	)
+
+	// flush ends the current statement right before end
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		if s := strings.TrimSpace(src[start:end]); s != "" {
+			out = append(out, statement{sql: s, offset: start, line: startLine})
+		}
+		start = -1
+	}
+
+	// begin marks i as the start of a statement, unless one is already running
+	begin := func(i int) {
+		if start < 0 {
+			start = i
+			startLine = line
+		}
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+
+		switch {
+		case c == '\n':
+			line++
+			i++
+
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+
+		case c == ';':
+			flush(i)
+			i++
+
+		case c == '-' && strings.HasPrefix(src[i:], "--"):
+			// a line comment runs until the end of the line, the newline itself
+			// is left for the loop to count.
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			i += end
+
+		case c == '/' && strings.HasPrefix(src[i:], "/*"):
+			end := skipBlockComment(src, i)
+			line += strings.Count(src[i:end], "\n")
+			i = end
+
+		case c == '\'':
+			begin(i)
+			end := skipString(src, i, isEscapeString(src, i))
+			line += strings.Count(src[i:end], "\n")
+			i = end
+
+		case c == '"':
+			begin(i)
+			end := skipQuoted(src, i, '"')
+			line += strings.Count(src[i:end], "\n")
+			i = end
+
+		case c == '$':
+			begin(i)
+			tag, ok := dollarTag(src, i)
+			if !ok {
+				i++
+				continue
+			}
+
+			// the body runs until the same tag shows up again
+			end := strings.Index(src[i+len(tag):], tag)
+			if end < 0 {
+				end = len(src)
+			} else {
+				end = i + len(tag) + end + len(tag)
+			}
+			line += strings.Count(src[i:end], "\n")
+			i = end
+
+		default:
+			begin(i)
+			i++
+		}
+	}
+
+	flush(len(src))
+	return out
+}
+
+// skipBlockComment returns the offset right after the block comment starting at i.
+// Postgres block comments nest.
+func skipBlockComment(src string, i int) int {
+	depth := 0
+	for i < len(src) {
+		switch {
+		case strings.HasPrefix(src[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(src[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(src)
+}
+
+// skipString returns the offset right after the string literal starting at i. A
+// doubled quote is part of the literal, a backslash escapes the next character in
+// escape strings, E'...', only.
+func skipString(src string, i int, backslashEscapes bool) int {
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			if backslashEscapes {
+				i++
+			}
+		case '\'':
+			if i+1 < len(src) && src[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// skipQuoted returns the offset right after the quoted identifier starting at i.
+func skipQuoted(src string, i int, quote byte) int {
+	for i++; i < len(src); i++ {
+		if src[i] != quote {
+			continue
+		}
+		if i+1 < len(src) && src[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(src)
+}
+
+// isEscapeString reports whether the string literal starting at i is an escape
+// string, E'...'.
+func isEscapeString(src string, i int) bool {
+	if i == 0 || (src[i-1] != 'e' && src[i-1] != 'E') {
+		return false
+	}
+	return i == 1 || !isIdentChar(src[i-2])
+}
+
+// dollarTag returns the $tag$ opening a dollar quoted body at i. A dollar sign that
+// is part of an identifier or a positional parameter such as $1 opens nothing.
+func dollarTag(src string, i int) (string, bool) {
+	if i > 0 && isIdentChar(src[i-1]) {
+		return "", false
+	}
+
+	j := i + 1
+	for ; j < len(src) && src[j] != '$'; j++ {
+		c := src[j]
+		if !isIdentChar(c) || (j == i+1 && c >= '0' && c <= '9') {
+			return "", false
+		}
+	}
+
+	if j >= len(src) {
+		return "", false
+	}
+	return src[i : j+1], true
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// noTransactionMarkers are the header comments asking for a file to be applied
+// outside of a transaction, compared case insensitively. Next to dbctl's own, the
+// markers of goose, sql-migrate and dbmate are honoured so that existing migrations
+// work unchanged. golang-migrate has no per file marker of its own, its files take
+// dbctl's.
+var noTransactionMarkers = []string{
+	"dbctl:no-transaction",
+	"+goose no transaction",
+	"+migrate up notransaction",
+	"migrate:up transaction:false",
+}
+
+// noTransaction reports whether the header of a sql file, the comments it starts
+// with, asks for the file to be applied outside of a transaction. Statements such as
+// CREATE INDEX CONCURRENTLY or VACUUM refuse to run inside one.
+func noTransaction(src string) bool {
+	for _, l := range strings.Split(src, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+
+		// the header ends with the first line that is not a comment
+		if !strings.HasPrefix(l, "--") {
+			return false
+		}
+
+		comment := strings.Join(strings.Fields(strings.ToLower(strings.TrimPrefix(l, "--"))), " ")
+		for _, m := range noTransactionMarkers {
+			if comment == m || strings.HasPrefix(comment, m+" ") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package pg
+
+import (
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	src := `-- +goose NO TRANSACTION
+create index concurrently idx_a on a (id);
+
+/* a; commented out; statement */
+insert into a (name) values ('semi;colon'), ('it''s; fine');
+create function f() returns int as $$
+begin
+	return 1; -- not the end
+end;
+$$ language plpgsql;
+create function g() returns text as $body$ select '$$;' $body$ language sql;
+select E'escaped \' quote;', "odd;name" from a -- trailing; comment
+;
+select $1::int;   `
+
+	got := splitStatements(src)
+
+	want := []struct {
+		prefix string
+		line   int
+	}{
+		{"create index concurrently idx_a", 2},
+		{"insert into a (name) values ('semi;colon'), ('it''s; fine')", 5},
+		{"create function f()", 6},
+		{"create function g()", 11},
+		{`select E'escaped \' quote;', "odd;name" from a`, 12},
+		{"select $1::int", 14},
+	}
+
+	if len(got) != len(want) {
+		for _, s := range got {
+			t.Logf("line %d: %q", s.line, s.sql)
+		}
+		t.Fatalf("expected %d statements, got %d", len(want), len(got))
+	}
+
+	for i, w := range want {
+		if len(got[i].sql) < len(w.prefix) || got[i].sql[:len(w.prefix)] != w.prefix {
+			t.Fatalf("statement %d: expected it to start with %q, got %q", i+1, w.prefix, got[i].sql)
+		}
+		if got[i].line != w.line {
+			t.Fatalf("statement %d: expected line %d, got %d", i+1, w.line, got[i].line)
+		}
+		if src[got[i].offset:got[i].offset+len(w.prefix)] != w.prefix {
+			t.Fatalf("statement %d: offset %d does not point at the statement", i+1, got[i].offset)
+		}
+	}
+
+	if body := got[2].sql; body[len(body)-len("language plpgsql"):] != "language plpgsql" {
+		t.Fatalf("dollar quoted body was split: %q", body)
+	}
+}
+
+func TestSplitStatementsNestedComments(t *testing.T) {
+	got := splitStatements("/* outer /* inner; */ still; comment */ select 1; select 2")
+	if len(got) != 2 || got[0].sql != "select 1" || got[1].sql != "select 2" {
+		t.Fatalf("unexpected statements: %+v", got)
+	}
+}
+
+func TestNoTransaction(t *testing.T) {
+	yes := []string{
+		"-- dbctl:no-transaction\ncreate index concurrently i on t (c);",
+		"\n-- +goose Up\n-- +goose NO TRANSACTION\nvacuum;",
+		"-- +migrate Up notransaction\nvacuum;",
+		"-- migrate:up transaction:false\nvacuum;",
+		"--   DBCTL:NO-TRANSACTION  \nvacuum;",
+	}
+	for _, src := range yes {
+		if !noTransaction(src) {
+			t.Fatalf("expected %q to be applied outside a transaction", src)
+		}
+	}
+
+	no := []string{
+		"create table t (c int);",
+		"create table t (c int);\n-- dbctl:no-transaction",
+		"-- +goose Up\ncreate table t (c int);",
+		"-- dbctl:no-transactions-please is not a thing\n",
+	}
+	for _, src := range no {
+		if noTransaction(src) {
+			t.Fatalf("expected %q to be applied in a transaction", src)
+		}
+	}
+}
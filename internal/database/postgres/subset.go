@@ -0,0 +1,551 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
+	"gopkg.in/yaml.v3"
+)
+
+// SubsetRequest asks for a subset of the rows of a source database.
+type SubsetRequest struct {
+	// Source is the uri of the database to take the rows from
+	Source string
+	// Roots are the rows the subset starts from, a table and an optional
+	// condition such as `orders where created_at > now() - interval '7 days'`
+	Roots []string
+	// Masks scrub the values of some columns
+	Masks SubsetMasks
+	// Seed seeds the fake values of masks, the same seed masks the same way
+	Seed int64
+	// Format is ExportSQL or ExportCSV
+	Format string
+	// Dir is the directory the fixtures are written to
+	Dir string
+}
+
+// SubsetMasks are the masks of the columns of tables, by table and column.
+type SubsetMasks map[string]map[string]ColumnMask
+
+// ColumnMask replaces the values of a column in a subset, one of its fields is set.
+// NULL values are kept as they are.
+type ColumnMask struct {
+	// Fake is a kind of fake data of fixture templates: name, firstName, lastName,
+	// username, email, company, city, word, sentence, uuid, timestamp or date.
+	// Usernames and emails are numbered to stay unique.
+	Fake string `yaml:"fake"`
+	// Regex is a regular expression the values match
+	Regex string `yaml:"regex"`
+	// Value replaces every value
+	Value *string `yaml:"value"`
+	// Null replaces every value with NULL
+	Null bool `yaml:"null"`
+	// SQL is an expression computing the value from the source row, such as
+	// `left(phone, 3) || '****'`
+	SQL string `yaml:"sql"`
+}
+
+// ReadSubsetMasks reads the masks of a yaml or json file such as:
+//
+//	users:
+//	  email:
+//	    fake: email
+//	  phone:
+//	    sql: left(phone, 3) || '****'
+//	  notes:
+//	    null: true
+func ReadSubsetMasks(path string) (SubsetMasks, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read masks failed: %w", err)
+	}
+
+	var out SubsetMasks
+	if err := yaml.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("read masks %s failed: %w", path, err)
+	}
+	for table, columns := range out {
+		for column, m := range columns {
+			if err := m.validate(); err != nil {
+				return nil, fmt.Errorf("mask of %s.%s: %w", table, column, err)
+			}
+		}
+	}
+	return out, nil
+}
+
+// fakeKinds are the kinds of fake data a mask can take, the helpers of templates
+// taking no arguments.
+var fakeKinds = map[string]func(g *fixtures.Generator, n int) string{
+	"name":      func(g *fixtures.Generator, _ int) string { return g.Name() },
+	"firstName": func(g *fixtures.Generator, _ int) string { return g.FirstName() },
+	"lastName":  func(g *fixtures.Generator, _ int) string { return g.LastName() },
+	"username":  func(g *fixtures.Generator, n int) string { return g.Username(n) },
+	"email":     func(g *fixtures.Generator, n int) string { return g.Email(n) },
+	"company":   func(g *fixtures.Generator, _ int) string { return g.Company() },
+	"city":      func(g *fixtures.Generator, _ int) string { return g.City() },
+	"word":      func(g *fixtures.Generator, _ int) string { return g.Word() },
+	"sentence":  func(g *fixtures.Generator, _ int) string { return g.Sentence() },
+	"uuid":      func(g *fixtures.Generator, _ int) string { return g.UUID() },
+	"timestamp": func(g *fixtures.Generator, _ int) string { return g.Timestamp() },
+	"date":      func(g *fixtures.Generator, _ int) string { return g.Date() },
+}
+
+func (m ColumnMask) validate() error {
+	set := 0
+	for _, ok := range []bool{m.Fake != "", m.Regex != "", m.Value != nil, m.Null, m.SQL != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("set one of fake, regex, value, null and sql")
+	}
+
+	if m.Fake != "" && fakeKinds[m.Fake] == nil {
+		kinds := make([]string, 0, len(fakeKinds))
+		for k := range fakeKinds {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		return fmt.Errorf("unknown fake %q, can be %s", m.Fake, strings.Join(kinds, ", "))
+	}
+	if m.Regex != "" {
+		if _, err := regexp.Compile(m.Regex); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+	return nil
+}
+
+// tableMask masks the rows of a table. A nil mask leaves them as they are.
+type tableMask struct {
+	columns map[string]ColumnMask
+	// keys are the columns of the primary key and of foreign keys, from or to the
+	// table, which masking would break the subset on
+	keys map[string]bool
+	g    *fixtures.Generator
+	rows int
+}
+
+// check returns an error naming a masked column the table does not have, or one
+// of its keys.
+func (m *tableMask) check(table string, columns []exportColumn) error {
+	if m == nil {
+		return nil
+	}
+
+	exported := map[string]bool{}
+	for _, c := range columns {
+		exported[c.name] = true
+	}
+	for name := range m.columns {
+		if !exported[name] {
+			return fmt.Errorf("table %s has no column %q to mask", table, name)
+		}
+		if m.keys[name] {
+			return fmt.Errorf("column %q of %s is part of a key, masking it would break the subset", name, table)
+		}
+	}
+	return nil
+}
+
+// selectExpr is what the value of column is read from, the expression of its
+// mask for a mask in SQL.
+func (m *tableMask) selectExpr(column string) string {
+	if m != nil {
+		if mask, ok := m.columns[column]; ok && mask.SQL != "" {
+			return "(" + mask.SQL + ")"
+		}
+	}
+	return quoteIdentifier(column)
+}
+
+// apply masks the values of row, read as columns.
+func (m *tableMask) apply(columns []exportColumn, row []sql.NullString) error {
+	if m == nil {
+		return nil
+	}
+
+	m.rows++
+	for i, c := range columns {
+		mask, ok := m.columns[c.name]
+		if !ok || !row[i].Valid {
+			continue
+		}
+
+		switch {
+		case mask.Null:
+			row[i] = sql.NullString{}
+		case mask.Value != nil:
+			row[i].String = *mask.Value
+		case mask.Fake != "":
+			row[i].String = fakeKinds[mask.Fake](m.g, m.rows)
+		case mask.Regex != "":
+			v, err := m.g.Regex(mask.Regex)
+			if err != nil {
+				return fmt.Errorf("mask %s: %w", c.name, err)
+			}
+			row[i].String = v
+		}
+	}
+	return nil
+}
+
+// subsetForeignKey is a foreign key between tables of the source database.
+type subsetForeignKey struct {
+	child, parent            int64
+	childName, parentName    string
+	childKind, parentKind    string
+	childColumns, parentCols []string
+}
+
+// join is the condition joining the rows of the child, as c, to the rows of the
+// parent they refer to, as p.
+func (fk subsetForeignKey) join() string {
+	parts := make([]string, 0, len(fk.childColumns))
+	for i := range fk.childColumns {
+		parts = append(parts, fmt.Sprintf("p.%s = c.%s", quoteIdentifier(fk.parentCols[i]), quoteIdentifier(fk.childColumns[i])))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// subsetRows are the rows of a table taken into a subset, by ctid. The ctid of a
+// row is stable within the snapshot the subset is read in.
+type subsetRows struct {
+	table exportTable
+	rows  map[string]bool
+	// expanded are the rows whose referring rows are taken as well
+	expanded map[string]bool
+}
+
+// subsetStep is a batch of rows of a table new to the subset, whose references are
+// to be followed.
+type subsetStep struct {
+	oid   int64
+	ctids []string
+	down  bool
+}
+
+// rootCondition splits a root into its table and condition.
+var rootCondition = regexp.MustCompile(`(?is)^\s*(.+?)(?:\s+where\s+(.+?))?\s*$`)
+
+// Subset takes the rows of the roots from the source database, then follows
+// foreign keys both ways: the rows they refer to, and the rows referring to them,
+// are taken, and so on. Rows are only followed to the rows referring to them from
+// the roots down, the rows a row refers to do not bring in every other row
+// referring to them as well, or a subset of orders would bring in every order of
+// their customers.
+//
+// The subset is read in one transaction and written like Export writes a database,
+// with the columns of masks scrubbed. It holds every row its rows refer to, it
+// loads without breaking a foreign key.
+func Subset(ctx context.Context, req SubsetRequest) ([]ExportedTable, error) {
+	if req.Format == "" {
+		req.Format = ExportSQL
+	}
+	if req.Format != ExportSQL && req.Format != ExportCSV {
+		return nil, fmt.Errorf("unknown export format %q, can be %s or %s", req.Format, ExportSQL, ExportCSV)
+	}
+	if len(req.Roots) == 0 {
+		return nil, errors.New("a subset takes at least one root")
+	}
+
+	conn, err := dbConnect(ctx, req.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	fks, err := subsetForeignKeys(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := map[int64]*subsetRows{}
+	var order []int64
+	add := func(oid int64, name, kind string) (*subsetRows, error) {
+		if t, ok := tables[oid]; ok {
+			return t, nil
+		}
+		// the ctid of a row is only unique within a partition
+		if kind == "p" {
+			return nil, fmt.Errorf("table %s is partitioned, a subset can not follow its rows", name)
+		}
+		t := &subsetRows{table: exportTable{oid: oid, name: name}, rows: map[string]bool{}, expanded: map[string]bool{}}
+		tables[oid] = t
+		order = append(order, oid)
+		return t, nil
+	}
+
+	var queue []subsetStep
+	for _, root := range req.Roots {
+		m := rootCondition.FindStringSubmatch(root)
+		if m == nil {
+			return nil, fmt.Errorf("invalid root %q", root)
+		}
+
+		var oid int64
+		var name, kind string
+		err := tx.QueryRowContext(ctx, "select c.oid::bigint, c.oid::regclass::text, c.relkind::text from pg_class c where c.oid = to_regclass($1)", m[1]).
+			Scan(&oid, &name, &kind)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("table %s of root %q does not exist", m[1], root)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("look up table %s failed: %w", m[1], err)
+		}
+
+		t, err := add(oid, name, kind)
+		if err != nil {
+			return nil, err
+		}
+
+		query := "select ctid::text from " + name
+		if m[2] != "" {
+			query += " where " + m[2]
+		}
+		ctids, err := queryStrings(ctx, tx, query)
+		if err != nil {
+			return nil, fmt.Errorf("read rows of root %q failed: %w", root, err)
+		}
+		if step := t.take(ctids, true); step != nil {
+			queue = append(queue, *step)
+		}
+	}
+
+	for len(queue) > 0 {
+		step := queue[0]
+		queue = queue[1:]
+
+		for _, fk := range fks {
+			// the rows the rows of the step refer to, always
+			if fk.child == step.oid {
+				query := fmt.Sprintf("select distinct p.ctid::text from %s p join %s c on %s where c.ctid = any($1::tid[])",
+					fk.parentName, fk.childName, fk.join())
+				next, err := follow(ctx, tx, add, query, step, fk.parent, fk.parentName, fk.parentKind, false)
+				if err != nil {
+					return nil, err
+				}
+				queue = append(queue, next...)
+			}
+
+			// the rows referring to the rows of the step, from the roots down
+			if fk.parent == step.oid && step.down {
+				query := fmt.Sprintf("select distinct c.ctid::text from %s c join %s p on %s where p.ctid = any($1::tid[])",
+					fk.childName, fk.parentName, fk.join())
+				next, err := follow(ctx, tx, add, query, step, fk.child, fk.childName, fk.childKind, true)
+				if err != nil {
+					return nil, err
+				}
+				queue = append(queue, next...)
+			}
+		}
+	}
+
+	masks, err := subsetMasks(ctx, tx, req.Masks, req.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	oids := make([]int64, 0, len(order))
+	for _, oid := range order {
+		if len(tables[oid].rows) > 0 {
+			oids = append(oids, oid)
+		}
+	}
+
+	deps, err := foreignKeys(ctx, tx, oids)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(req.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create subset directory failed: %w", err)
+	}
+
+	out := make([]ExportedTable, 0, len(oids))
+	for n, i := range orderByDependencies(oids, deps) {
+		t := tables[oids[i]]
+		file := filepath.Join(req.Dir, fmt.Sprintf("%03d_%s.%s", n+1, exportFileName(t.table.name), req.Format))
+
+		rows, err := exportRows(ctx, tx, t.table, ctidCondition(t.rows), file, req.Format, masks[t.table.oid])
+		if err != nil {
+			return nil, fmt.Errorf("write %s failed: %w", t.table.name, err)
+		}
+		out = append(out, ExportedTable{Table: t.table.name, File: file, Rows: rows})
+	}
+	return out, tx.Commit()
+}
+
+// follow reads the rows query finds from the rows of step, in the table of oid, and
+// returns the step following the ones new to the subset.
+func follow(ctx context.Context, tx *sql.Tx, add func(int64, string, string) (*subsetRows, error),
+	query string, step subsetStep, oid int64, name, kind string, down bool) ([]subsetStep, error) {
+	t, err := add(oid, name, kind)
+	if err != nil {
+		return nil, err
+	}
+	ctids, err := queryStrings(ctx, tx, query, pq.Array(step.ctids))
+	if err != nil {
+		return nil, fmt.Errorf("follow the foreign keys of %s failed: %w", name, err)
+	}
+	if next := t.take(ctids, down); next != nil {
+		return []subsetStep{*next}, nil
+	}
+	return nil, nil
+}
+
+// take adds ctids to the rows of the table, returning the step following the ones
+// new to it, or to its expanded rows when down.
+func (t *subsetRows) take(ctids []string, down bool) *subsetStep {
+	var fresh []string
+	for _, c := range ctids {
+		if down {
+			if t.expanded[c] {
+				continue
+			}
+			t.expanded[c] = true
+		} else if t.rows[c] {
+			continue
+		}
+		t.rows[c] = true
+		fresh = append(fresh, c)
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+	return &subsetStep{oid: t.table.oid, ctids: fresh, down: down}
+}
+
+// ctidCondition is the condition picking the rows of ctids, sorted for the query to
+// be the same every time.
+func ctidCondition(ctids map[string]bool) string {
+	list := make([]string, 0, len(ctids))
+	for c := range ctids {
+		list = append(list, `"`+c+`"`)
+	}
+	sort.Strings(list)
+	return fmt.Sprintf("ctid = any(%s::tid[])", quoteLiteral("{"+strings.Join(list, ",")+"}"))
+}
+
+// subsetForeignKeys reads the foreign keys of the source database. The ones a
+// partitioned table passes down to its partitions are read once, on the table.
+func subsetForeignKeys(ctx context.Context, tx *sql.Tx) ([]subsetForeignKey, error) {
+	rows, err := tx.QueryContext(ctx, `
+		select c.conrelid::bigint, c.conrelid::regclass::text, cr.relkind::text,
+		       c.confrelid::bigint, c.confrelid::regclass::text, pr.relkind::text,
+		       array(select a.attname from unnest(c.conkey) with ordinality k(n, i)
+		             join pg_attribute a on a.attrelid = c.conrelid and a.attnum = k.n order by k.i),
+		       array(select a.attname from unnest(c.confkey) with ordinality k(n, i)
+		             join pg_attribute a on a.attrelid = c.confrelid and a.attnum = k.n order by k.i)
+		from pg_constraint c
+		join pg_class cr on cr.oid = c.conrelid
+		join pg_class pr on pr.oid = c.confrelid
+		where c.contype = 'f' and c.conparentid = 0
+		order by c.conrelid, c.conname`)
+	if err != nil {
+		return nil, fmt.Errorf("reading the foreign keys failed: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var out []subsetForeignKey
+	for rows.Next() {
+		var fk subsetForeignKey
+		if err := rows.Scan(&fk.child, &fk.childName, &fk.childKind, &fk.parent, &fk.parentName, &fk.parentKind,
+			pq.Array(&fk.childColumns), pq.Array(&fk.parentCols)); err != nil {
+			return nil, err
+		}
+		out = append(out, fk)
+	}
+	return out, rows.Err()
+}
+
+// subsetMasks resolves the tables of masks, and reads the keys their columns may
+// not be part of. Masks of tables without rows in the subset are left unused, the
+// same masks can go with any root.
+func subsetMasks(ctx context.Context, tx *sql.Tx, masks SubsetMasks, seed int64) (map[int64]*tableMask, error) {
+	g := fixtures.NewGenerator(seed)
+
+	tables := make([]string, 0, len(masks))
+	for table := range masks {
+		tables = append(tables, table)
+	}
+	// errors name the same table every time
+	sort.Strings(tables)
+
+	out := make(map[int64]*tableMask, len(masks))
+	for _, table := range tables {
+		var oid int64
+		var name string
+		err := tx.QueryRowContext(ctx, "select c.oid::bigint, c.oid::regclass::text from pg_class c where c.oid = to_regclass($1)", table).
+			Scan(&oid, &name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("masked table %s does not exist", table)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("look up table %s failed: %w", table, err)
+		}
+
+		keys, err := queryStrings(ctx, tx, `
+			select distinct a.attname
+			from pg_constraint c
+			join pg_attribute a on a.attrelid = $1
+			  and a.attnum = any(case when c.conrelid = $1 then c.conkey else c.confkey end)
+			where (c.conrelid = $1 and c.contype in ('p', 'f')) or (c.confrelid = $1 and c.contype = 'f')`, oid)
+		if err != nil {
+			return nil, fmt.Errorf("read keys of %s failed: %w", name, err)
+		}
+
+		m := &tableMask{columns: masks[table], keys: map[string]bool{}, g: g}
+		for _, k := range keys {
+			m.keys[k] = true
+		}
+		out[oid] = m
+	}
+	return out, nil
+}
+
+// LoadFixtures applies the fixtures at path to db, by name or uri, the database of
+// the instance when empty, the way fixtures are applied to a new database.
+func (p *Postgres) LoadFixtures(ctx context.Context, db, path string) error {
+	name, err := p.databaseName(db)
+	if err != nil {
+		return err
+	}
+	target, err := p.database(name)
+	if err != nil {
+		return err
+	}
+
+	files, err := getFixtureFiles(path)
+	if err != nil {
+		return fmt.Errorf("read fixtures failed: %w", err)
+	}
+	return applyFixtures(ctx, nil, path, files, target.URI(), 0)
+}
@@ -0,0 +1,87 @@
+package pg
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/mirzakhany/dbctl/internal/fixtures"
+)
+
+func TestRootCondition(t *testing.T) {
+	cases := []struct {
+		in, table, condition string
+	}{
+		{"orders", "orders", ""},
+		{"orders where created_at > now() - interval '7 days'", "orders", "created_at > now() - interval '7 days'"},
+		{"  billing.invoices WHERE paid  ", "billing.invoices", "paid"},
+	}
+
+	for _, tc := range cases {
+		m := rootCondition.FindStringSubmatch(tc.in)
+		if m == nil || m[1] != tc.table || m[2] != tc.condition {
+			t.Fatalf("%q: expected %q and %q, got %q", tc.in, tc.table, tc.condition, m)
+		}
+	}
+}
+
+func TestColumnMaskValidate(t *testing.T) {
+	value := "redacted"
+	for _, m := range []ColumnMask{{Fake: "email"}, {Regex: `\d{3}`}, {Value: &value}, {Null: true}, {SQL: "left(phone, 3)"}} {
+		if err := m.validate(); err != nil {
+			t.Fatalf("%+v: unexpected error: %v", m, err)
+		}
+	}
+
+	for _, m := range []ColumnMask{{}, {Fake: "email", Null: true}, {Fake: "ssn"}, {Regex: "("}} {
+		if err := m.validate(); err == nil {
+			t.Fatalf("%+v: expected an error", m)
+		}
+	}
+}
+
+func TestTableMask(t *testing.T) {
+	value := "redacted"
+	m := &tableMask{
+		columns: map[string]ColumnMask{"email": {Fake: "email"}, "notes": {Value: &value}, "phone": {SQL: "left(phone, 3)"}},
+		keys:    map[string]bool{"id": true},
+		g:       fixtures.NewGenerator(1),
+	}
+	columns := []exportColumn{{name: "id"}, {name: "email"}, {name: "notes"}, {name: "phone"}}
+
+	if err := m.check("users", columns); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := m.selectExpr("phone"); got != "(left(phone, 3))" {
+		t.Fatalf("expected the expression of the mask, got %s", got)
+	}
+	if got := m.selectExpr("email"); got != `"email"` {
+		t.Fatalf("expected the column, got %s", got)
+	}
+
+	row := []sql.NullString{{String: "1", Valid: true}, {String: "ada@example.com", Valid: true}, {}, {String: "555", Valid: true}}
+	if err := m.apply(columns, row); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if row[0].String != "1" || row[3].String != "555" {
+		t.Fatalf("expected the id and the SQL masked column to be kept, got %v", row)
+	}
+	if row[1].String == "ada@example.com" || !row[1].Valid {
+		t.Fatalf("expected a fake email, got %v", row[1])
+	}
+	// a NULL is not a value to scrub
+	if row[2].Valid {
+		t.Fatalf("expected NULL to stay NULL, got %v", row[2])
+	}
+
+	m.columns["id"] = ColumnMask{Null: true}
+	if err := m.check("users", columns); err == nil {
+		t.Fatal("expected a mask on a key to be rejected")
+	}
+}
+
+func TestCtidCondition(t *testing.T) {
+	got := ctidCondition(map[string]bool{"(0,2)": true, "(0,1)": true})
+	if want := `ctid = any('{"(0,1)","(0,2)"}'::tid[])`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
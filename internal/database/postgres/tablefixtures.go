@@ -0,0 +1,620 @@
+package pg
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
+	"gopkg.in/yaml.v3"
+)
+
+// tableFixtureExts are the extensions of the fixtures holding the rows of a table,
+// rather than SQL to run.
+var tableFixtureExts = []string{".csv", ".json", ".yaml", ".yml"}
+
+// isTableFixture reports whether file holds the rows of a table, or renders into them.
+func isTableFixture(file string) bool {
+	return fixtures.HasExt(file, tableFixtureExts...)
+}
+
+// tableFixture is the content of a csv, json or yaml fixture: rows of the table it
+// is named after, or the one its header names.
+type tableFixture struct {
+	file  string
+	table string
+
+	// columns are in the order they first appear in, rows hold a value per column
+	// they set; a column a row leaves out takes its default.
+	columns []string
+	rows    []map[string]any
+}
+
+// readTableFixture reads the rows of a csv, json or yaml fixture. A csv file names
+// its table on a first line such as `# table: accounting.invoices`, json and yaml
+// ones with an object holding `table` and `rows` instead of a plain list of rows.
+// Templates are rendered with seed first.
+func readTableFixture(file string, seed int64) (*tableFixture, error) {
+	b, err := fixtures.ReadFile(file, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &tableFixture{file: file}
+	switch fixtures.Ext(file) {
+	case ".csv":
+		err = f.readCSV(b)
+	case ".json":
+		err = f.readJSON(b)
+	default:
+		err = f.readYAML(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if f.table == "" {
+		base := filepath.Base(fixtures.Name(file))
+		f.table = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return f, nil
+}
+
+func (f *tableFixture) readCSV(b []byte) error {
+	// the table is named on the first line only, a # further down is data
+	if line, rest, _ := bytes.Cut(b, []byte("\n")); bytes.HasPrefix(bytes.TrimSpace(line), []byte("#")) {
+		f.table = headerTable(string(bytes.TrimLeft(bytes.TrimSpace(line), "#")))
+		b = rest
+	}
+
+	r := csv.NewReader(bytes.NewReader(b))
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("no header row naming the columns")
+		}
+		return err
+	}
+
+	for i, col := range header {
+		// spreadsheets save a byte order mark in front of the first cell
+		col = strings.TrimSpace(strings.TrimPrefix(col, "\ufeff"))
+		if col == "" {
+			return fmt.Errorf("column %d of the header row has no name", i+1)
+		}
+		header[i] = col
+	}
+	f.columns = header
+
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// a spreadsheet can not tell an empty cell from an empty string, both are
+		// loaded as NULL
+		row := make(map[string]any, len(header))
+		for i, v := range record {
+			if v == "" {
+				row[header[i]] = nil
+				continue
+			}
+			row[header[i]] = v
+		}
+		f.rows = append(f.rows, row)
+	}
+}
+
+// headerTable returns the table named by a csv header line such as `table: users`.
+func headerTable(line string) string {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok || !strings.EqualFold(strings.TrimSpace(key), "table") {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+func (f *tableFixture) readJSON(b []byte) error {
+	// numbers are kept as written, ids beyond 2^53 would lose digits as floats
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var content any
+	if err := d.Decode(&content); err != nil {
+		return err
+	}
+	return f.readRows(content)
+}
+
+func (f *tableFixture) readYAML(b []byte) error {
+	var content any
+	if err := yaml.Unmarshal(b, &content); err != nil {
+		return err
+	}
+	return f.readRows(content)
+}
+
+func (f *tableFixture) readRows(content any) error {
+	list, ok := content.([]any)
+	if !ok {
+		doc, isDoc := content.(map[string]any)
+		if !isDoc {
+			return errors.New("expected a list of rows, or an object with table and rows")
+		}
+
+		table, _ := doc["table"].(string)
+		f.table = table
+
+		if list, ok = doc["rows"].([]any); !ok && doc["rows"] != nil {
+			return errors.New("rows is not a list of rows")
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, item := range list {
+		row, ok := item.(map[string]any)
+		if !ok {
+			return fmt.Errorf("row %d is not an object of column values", i+1)
+		}
+
+		for col := range row {
+			if !seen[col] {
+				seen[col] = true
+				f.columns = append(f.columns, col)
+			}
+		}
+		f.rows = append(f.rows, row)
+	}
+
+	// maps have no order, the columns are loaded in the same order every time
+	sort.Strings(f.columns)
+	return nil
+}
+
+// tableColumn is a column of the table a fixture is loaded into.
+type tableColumn struct {
+	name string
+	// typ is the name of the type, category its type category: A for arrays
+	typ      string
+	category string
+}
+
+func (c tableColumn) isJSON() bool {
+	return c.typ == "json" || c.typ == "jsonb"
+}
+
+// loadedTable is a table fixture resolved against the database.
+type loadedTable struct {
+	fixture *tableFixture
+	oid     int64
+	schema  string
+	name    string
+	columns map[string]tableColumn
+}
+
+func (t *loadedTable) qualifiedName() string {
+	return quoteIdentifier(t.schema) + "." + quoteIdentifier(t.name)
+}
+
+// applyTableFixtures loads the rows of csv, json and yaml fixtures with COPY, in
+// one transaction. Tables are loaded in the order their foreign keys need, the
+// sequences of their columns are moved past the loaded ids afterwards.
+func applyTableFixtures(ctx context.Context, conn *sql.DB, root string, files []string, seed int64) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	tables := make([]*loadedTable, 0, len(files))
+	for _, file := range files {
+		fixture, err := readTableFixture(file, seed)
+		if err != nil {
+			return fmt.Errorf("reading %s failed: %w", displayName(root, file), err)
+		}
+
+		table, err := resolveTable(ctx, tx, fixture)
+		if err != nil {
+			return fmt.Errorf("loading %s failed: %w", displayName(root, file), err)
+		}
+		tables = append(tables, table)
+	}
+
+	ordered, err := loadOrder(ctx, tx, tables)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range ordered {
+		if err := copyRows(ctx, tx, table); err != nil {
+			return fmt.Errorf("loading %s failed: %w", displayName(root, table.fixture.file), err)
+		}
+	}
+
+	for _, table := range ordered {
+		if err := resetSequences(ctx, tx, table.oid, table.qualifiedName()); err != nil {
+			return fmt.Errorf("resetting the sequences of %s failed: %w", table.qualifiedName(), err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// resolveTable finds the table of a fixture and checks every column of the fixture
+// against it. Columns are matched by name, ignoring case when nothing matches
+// exactly, spreadsheets tend to capitalize their headers.
+func resolveTable(ctx context.Context, tx *sql.Tx, fixture *tableFixture) (*loadedTable, error) {
+	t := &loadedTable{fixture: fixture, columns: make(map[string]tableColumn)}
+
+	// the name is parsed like in SQL, quote it in the header to keep its case
+	err := tx.QueryRowContext(ctx, `
+		select c.oid, n.nspname, c.relname
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		where c.oid = to_regclass($1)`, fixture.table).Scan(&t.oid, &t.schema, &t.name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("table %s does not exist", fixture.table)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		select a.attname, t.typname, t.typcategory
+		from pg_attribute a join pg_type t on t.oid = a.atttypid
+		where a.attrelid = $1 and a.attnum > 0 and not a.attisdropped`, t.oid)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	existing := make(map[string]tableColumn)
+	folded := make(map[string]tableColumn)
+	for rows.Next() {
+		var c tableColumn
+		if err := rows.Scan(&c.name, &c.typ, &c.category); err != nil {
+			return nil, err
+		}
+		existing[c.name] = c
+		folded[strings.ToLower(c.name)] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, col := range fixture.columns {
+		c, ok := existing[col]
+		if !ok {
+			if c, ok = folded[strings.ToLower(col)]; !ok {
+				return nil, fmt.Errorf("table %s has no column %q", t.qualifiedName(), col)
+			}
+		}
+		t.columns[col] = c
+	}
+	return t, nil
+}
+
+// loadOrder orders tables so that every table comes after the ones its foreign keys
+// refer to, tables that do not depend on each other keep the order of their files.
+// Tables referring to each other in a cycle are loaded in the order of their files.
+func loadOrder(ctx context.Context, tx *sql.Tx, tables []*loadedTable) ([]*loadedTable, error) {
+	oids := make([]int64, 0, len(tables))
+	for _, t := range tables {
+		oids = append(oids, t.oid)
+	}
+
+	deps, err := foreignKeys(ctx, tx, oids)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := make([]*loadedTable, 0, len(tables))
+	for _, i := range orderByDependencies(oids, deps) {
+		ordered = append(ordered, tables[i])
+	}
+	return ordered, nil
+}
+
+// foreignKeys returns the foreign keys between the tables of oids, as pairs of the
+// oid of a table and the oid of the table it refers to.
+func foreignKeys(ctx context.Context, tx *sql.Tx, oids []int64) ([][2]int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+		select conrelid::bigint, confrelid::bigint
+		from pg_constraint
+		where contype = 'f' and conrelid = any($1::oid[]) and confrelid = any($1::oid[])`, pq.Array(oids))
+	if err != nil {
+		return nil, fmt.Errorf("reading the foreign keys failed: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var deps [][2]int64
+	for rows.Next() {
+		var child, parent int64
+		if err := rows.Scan(&child, &parent); err != nil {
+			return nil, err
+		}
+		deps = append(deps, [2]int64{child, parent})
+	}
+	return deps, rows.Err()
+}
+
+// orderByDependencies sorts tables topologically by deps, pairs of the oid of a
+// table and the oid of a table it refers to. It returns the indexes of oids in the
+// order to load them in, an oid can be there more than once.
+func orderByDependencies(oids []int64, deps [][2]int64) []int {
+	parents := make(map[int64]map[int64]bool)
+	for _, d := range deps {
+		// a table referring to itself is loaded in one COPY, rows in file order
+		if d[0] == d[1] {
+			continue
+		}
+		if parents[d[0]] == nil {
+			parents[d[0]] = make(map[int64]bool)
+		}
+		parents[d[0]][d[1]] = true
+	}
+
+	done := make(map[int64]bool)
+	added := make([]bool, len(oids))
+	out := make([]int, 0, len(oids))
+	for len(out) < len(oids) {
+		// the first table that is ready, or the first one left when the rest
+		// refer to each other in a cycle: its rows are loaded in file order and the
+		// foreign keys report whichever row comes too early
+		next := -1
+		for i, oid := range oids {
+			if added[i] {
+				continue
+			}
+			if next == -1 {
+				next = i
+			}
+			// the same table in several files, loaded one after the other
+			if done[oid] || ready(parents[oid], done) {
+				next = i
+				break
+			}
+		}
+
+		done[oids[next]] = true
+		added[next] = true
+		out = append(out, next)
+	}
+	return out
+}
+
+func ready(parents map[int64]bool, done map[int64]bool) bool {
+	for p := range parents {
+		if !done[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// copyRows copies the rows of the fixture of t into it. Rows setting the same
+// columns are copied together, a column a row leaves out keeps its default that way.
+func copyRows(ctx context.Context, tx *sql.Tx, t *loadedTable) error {
+	var batch []map[string]any
+	var batchColumns []string
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() {
+			batch = nil
+		}()
+		return copyBatch(ctx, tx, t, batchColumns, batch)
+	}
+
+	for _, row := range t.fixture.rows {
+		columns := make([]string, 0, len(row))
+		for _, col := range t.fixture.columns {
+			if _, ok := row[col]; ok {
+				columns = append(columns, col)
+			}
+		}
+
+		if !equalColumns(columns, batchColumns) {
+			if err := flush(); err != nil {
+				return err
+			}
+			batchColumns = columns
+		}
+		batch = append(batch, row)
+	}
+	return flush()
+}
+
+func copyBatch(ctx context.Context, tx *sql.Tx, t *loadedTable, columns []string, rows []map[string]any) error {
+	names := make([]string, 0, len(columns))
+	for _, col := range columns {
+		names = append(names, t.columns[col].name)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema(t.schema, t.name, names...))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	for i, row := range rows {
+		values := make([]any, 0, len(columns))
+		for _, col := range columns {
+			v, err := copyValue(row[col], t.columns[col])
+			if err != nil {
+				return fmt.Errorf("row %d, column %s: %w", i+1, col, err)
+			}
+			values = append(values, v)
+		}
+
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return err
+		}
+	}
+
+	// the rows are only sent, and checked, once COPY is told they are all there
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+// copyValue turns a value read from a fixture into one COPY takes: objects become
+// json, lists become json or an array depending on the column.
+func copyValue(v any, col tableColumn) (any, error) {
+	switch value := v.(type) {
+	case map[string]any:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case []any:
+		if col.isJSON() {
+			b, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			return string(b), nil
+		}
+		if col.category != "A" {
+			return nil, fmt.Errorf("a list can not be loaded into column %s of type %s", col.name, col.typ)
+		}
+		return pq.GenericArray{A: value}.Value()
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		// a json column takes true, not t
+		if col.isJSON() {
+			return fmt.Sprint(value), nil
+		}
+		return value, nil
+	}
+	return v, nil
+}
+
+// resetSequences moves the sequences owned by the columns of the table past the
+// largest value loaded, so that the rows inserted after the fixtures do not collide
+// with them.
+func resetSequences(ctx context.Context, tx *sql.Tx, oid int64, table string) error {
+	rows, err := tx.QueryContext(ctx, `
+		select a.attname, pg_get_serial_sequence($1, a.attname)
+		from pg_attribute a
+		where a.attrelid = $2 and a.attnum > 0 and not a.attisdropped
+		  and pg_get_serial_sequence($1, a.attname) is not null`, table, oid)
+	if err != nil {
+		return err
+	}
+
+	type sequence struct{ column, name string }
+	var sequences []sequence
+	for rows.Next() {
+		var s sequence
+		if err := rows.Scan(&s.column, &s.name); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		sequences = append(sequences, s)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range sequences {
+		// false makes nextval return the value itself, 1 on an empty table
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("select setval(%s, coalesce(max(%s), 0) + 1, false) from %s",
+			quoteLiteral(s.name), quoteIdentifier(s.column), table)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func equalColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fixtureRuns splits files into runs of consecutive fixtures of the same kind, table
+// fixtures or SQL ones, keeping their order.
+func fixtureRuns(files []string) [][]string {
+	var runs [][]string
+	for i, f := range files {
+		if i > 0 && isTableFixture(f) == isTableFixture(files[i-1]) {
+			runs[len(runs)-1] = append(runs[len(runs)-1], f)
+			continue
+		}
+		runs = append(runs, []string{f})
+	}
+	return runs
+}
+
+// applyFixtures applies the given fixtures in the order of their paths, so that a
+// SQL file can build on the rows of the table fixtures sorted before it and the
+// other way around. Each run of consecutive table fixtures is loaded in the order of
+// the foreign keys of its tables. Templates are rendered with seed.
+func applyFixtures(ctx context.Context, conn *sql.DB, root string, files []string, uri string, seed int64) error {
+	if conn == nil {
+		var err error
+		conn, err = dbConnect(ctx, uri)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+	}
+
+	for _, run := range fixtureRuns(files) {
+		if isTableFixture(run[0]) {
+			if err := applyTableFixtures(ctx, conn, root, run, seed); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, f := range run {
+			b, err := fixtures.ReadFile(f, seed)
+			if err != nil {
+				return fmt.Errorf("read file (%s) failed: %w", f, err)
+			}
+
+			if err := applySource(ctx, conn, displayName(root, f), string(b)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package pg
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mirzakhany/dbctl/internal/fixtures"
+)
+
+func TestReadTableFixture(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"users.csv":    "\ufeffid, Name ,tags\n1,alice,\"{a,b}\"\n2,,\n",
+		"invoices.csv": "# table: accounting.invoices\nid,total\n1,9.5\n",
+		"orders.json":  `[{"id": 12345678901234567, "meta": {"paid": true}}, {"id": 2}]`,
+		"items.yaml":   "table: shop.items\nrows:\n  - id: 1\n    tags: [x, y]\n",
+		"empty.yml":    "table: things\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file    string
+		table   string
+		columns []string
+		rows    []map[string]any
+	}{
+		{
+			file:    "users.csv",
+			table:   "users",
+			columns: []string{"id", "Name", "tags"},
+			rows: []map[string]any{
+				{"id": "1", "Name": "alice", "tags": "{a,b}"},
+				{"id": "2", "Name": nil, "tags": nil},
+			},
+		},
+		{
+			file:    "invoices.csv",
+			table:   "accounting.invoices",
+			columns: []string{"id", "total"},
+			rows:    []map[string]any{{"id": "1", "total": "9.5"}},
+		},
+		{
+			file:    "orders.json",
+			table:   "orders",
+			columns: []string{"id", "meta"},
+			rows: []map[string]any{
+				{"id": json.Number("12345678901234567"), "meta": map[string]any{"paid": true}},
+				{"id": json.Number("2")},
+			},
+		},
+		{
+			file:    "items.yaml",
+			table:   "shop.items",
+			columns: []string{"id", "tags"},
+			rows:    []map[string]any{{"id": 1, "tags": []any{"x", "y"}}},
+		},
+		{
+			file:  "empty.yml",
+			table: "things",
+		},
+	}
+
+	for _, tt := range tests {
+		f, err := readTableFixture(filepath.Join(dir, tt.file), fixtures.DefaultSeed)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.file, err)
+		}
+		if f.table != tt.table {
+			t.Fatalf("%s: expected table %q, got %q", tt.file, tt.table, f.table)
+		}
+		if !reflect.DeepEqual(f.columns, tt.columns) {
+			t.Fatalf("%s: expected columns %v, got %v", tt.file, tt.columns, f.columns)
+		}
+		if !reflect.DeepEqual(f.rows, tt.rows) {
+			t.Fatalf("%s: expected rows %v, got %v", tt.file, tt.rows, f.rows)
+		}
+	}
+}
+
+func TestCopyValue(t *testing.T) {
+	jsonb := tableColumn{name: "meta", typ: "jsonb", category: "U"}
+	array := tableColumn{name: "tags", typ: "_text", category: "A"}
+	text := tableColumn{name: "name", typ: "text", category: "S"}
+
+	tests := []struct {
+		value any
+		col   tableColumn
+		want  any
+	}{
+		{value: map[string]any{"paid": true}, col: jsonb, want: `{"paid":true}`},
+		{value: []any{"x", "y"}, col: jsonb, want: `["x","y"]`},
+		{value: []any{"x", "y z"}, col: array, want: `{"x","y z"}`},
+		{value: json.Number("42"), col: text, want: "42"},
+		{value: true, col: jsonb, want: "true"},
+		{value: nil, col: text, want: nil},
+	}
+
+	for _, tt := range tests {
+		got, err := copyValue(tt.value, tt.col)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tt.value, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%v: expected %#v, got %#v", tt.value, tt.want, got)
+		}
+	}
+
+	if _, err := copyValue([]any{"x"}, text); err == nil {
+		t.Fatalf("expected a list loaded into a text column to fail")
+	}
+}
+
+func TestOrderByDependencies(t *testing.T) {
+	// files sorted by name: order_items (2) refers to orders (3) and items (1),
+	// orders to users (4), users to itself
+	oids := []int64{1, 2, 3, 4}
+	deps := [][2]int64{{2, 3}, {2, 1}, {3, 4}, {4, 4}}
+
+	got := orderByDependencies(oids, deps)
+	want := []int{0, 3, 2, 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected order %v, got %v", want, got)
+	}
+
+	// a cycle falls back to the order of the files
+	got = orderByDependencies([]int64{1, 2}, [][2]int64{{1, 2}, {2, 1}})
+	if want := []int{0, 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected a cycle to keep the file order %v, got %v", want, got)
+	}
+
+	// the same table in two files is loaded twice
+	got = orderByDependencies([]int64{2, 1, 2}, [][2]int64{{2, 1}})
+	if want := []int{1, 0, 2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected order %v, got %v", want, got)
+	}
+}
+
+func TestFixtureRuns(t *testing.T) {
+	runs := fixtureRuns([]string{"01_users.csv", "02_orders.yaml", "03_roles.sql", "04_grants.sql", "05_items.json"})
+
+	want := [][]string{{"01_users.csv", "02_orders.yaml"}, {"03_roles.sql", "04_grants.sql"}, {"05_items.json"}}
+	if !reflect.DeepEqual(runs, want) {
+		t.Fatalf("expected %v, got %v", want, runs)
+	}
+
+	if runs := fixtureRuns(nil); len(runs) != 0 {
+		t.Fatalf("expected no runs, got %v", runs)
+	}
+}
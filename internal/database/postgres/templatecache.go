@@ -0,0 +1,356 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// TemplateCacheMount is where the template cache of the host is mounted in the
+// postgres container. Templates are dumped and restored by postgres itself, through
+// COPY ... TO PROGRAM, so that it works the same for the api server, which runs in a
+// container of its own and sees neither the cache nor the docker socket.
+const TemplateCacheMount = "/var/lib/dbctl/templates"
+
+// cachedTemplate is the template cache entry of a template: the dump of its
+// database and its details, named after the hash of its migrations.
+type cachedTemplate struct {
+	dump string
+	meta string
+}
+
+func cachedTemplateOf(template string) cachedTemplate {
+	base := TemplateCacheMount + "/" + strings.TrimPrefix(template, TemplatePrefix)
+	return cachedTemplate{dump: base + ".dump", meta: base + ".json"}
+}
+
+// templateCacheEnabled reports whether the instance was started with the template
+// cache mounted. Looking at files of the server takes a superuser, which is what
+// dumping and restoring takes as well.
+func templateCacheEnabled(ctx context.Context, conn *sql.DB) bool {
+	var mounted bool
+	err := conn.QueryRowContext(ctx, "select pg_stat_file($1, true) is not null", TemplateCacheMount).Scan(&mounted)
+	return err == nil && mounted
+}
+
+// runProgram runs the shell command cmd in the postgres container, with input as
+// its standard input.
+func runProgram(ctx context.Context, conn *sql.DB, cmd, input string) error {
+	// COPY takes no parameters, both have to be literals
+	_, err := conn.ExecContext(ctx, fmt.Sprintf("copy (select %s) to program %s", quoteLiteral(input), quoteLiteral(cmd)))
+	return err
+}
+
+// shellQuote quotes s as a single word for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// cacheTemplateInBackground dumps template to the template cache, through a clone
+// of it made for the dump and dropped afterwards. It runs once the request that
+// built template is done with it, on a connection of its own, until Stop cancels
+// it.
+func (p *Postgres) cacheTemplateInBackground(template string, meta templateMeta) {
+	defer p.caching.Done()
+
+	ctx := p.cachingCtx
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		logger.Warn(fmt.Sprintf("caching template %q failed: %v", template, err))
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	db := "dbctl_cache_" + strings.TrimPrefix(template, TemplatePrefix)
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("drop database if exists %s", quoteIdentifier(db))); err != nil {
+		logger.Warn(fmt.Sprintf("caching template %q failed: %v", template, err))
+		return
+	}
+	if err := p.createDatabaseWithTemplate(ctx, conn, db, template); err != nil {
+		// pruned already, there is nothing to cache
+		if !errors.Is(err, errDatabaseNotExists) {
+			logger.Warn(fmt.Sprintf("caching template %q failed: %v", template, err))
+		}
+		return
+	}
+	defer func() {
+		// the clone goes even when the dump was cancelled
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, _ = conn.ExecContext(ctx, fmt.Sprintf("drop database if exists %s", quoteIdentifier(db)))
+	}()
+
+	if err := p.cacheTemplate(ctx, conn, template, db, meta); err != nil {
+		logger.Warn(err.Error())
+	}
+}
+
+// waitForCaching waits for the templates being cached, for as long as ctx allows.
+// The dumps still running then are cancelled and cleaned up, the container must not
+// go while they hold a clone or half written files.
+func (p *Postgres) waitForCaching(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		p.caching.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		p.cancelCaching()
+		<-done
+	}
+}
+
+// cacheTemplate dumps db, a database holding exactly what template does, to the
+// template cache. It is dumped rather than template itself because postgres refuses
+// to clone a database anyone is connected to, requests cloning template would fail
+// for as long as the dump takes.
+func (p *Postgres) cacheTemplate(ctx context.Context, conn *sql.DB, template, db string, meta templateMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	// every file is written under a name of its own and renamed into place, so that
+	// neither a concurrent dump nor an export ever sees half of one. The details are
+	// sent base64 encoded, COPY would escape the backslashes of the json otherwise.
+	entry := cachedTemplateOf(template)
+	cmd := fmt.Sprintf("umask 022 && base64 -d > %[1]s.$$.tmp && pg_dump -Fc -U %[3]s -d %[4]s -f %[2]s.$$.tmp && mv %[2]s.$$.tmp %[2]s && mv %[1]s.$$.tmp %[1]s",
+		shellQuote(entry.meta), shellQuote(entry.dump), shellQuote(p.cfg.user), shellQuote(db))
+
+	if err := runProgram(ctx, conn, cmd, base64.StdEncoding.EncodeToString(b)); err != nil {
+		// ctx may be cancelled already, the files are removed all the same
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = runProgram(cleanupCtx, conn, fmt.Sprintf("rm -f %s.*.tmp %s.*.tmp", shellQuote(entry.meta), shellQuote(entry.dump)), "")
+		return fmt.Errorf("caching template %q failed: %w", template, err)
+	}
+	return nil
+}
+
+// restoreTemplate restores template from the template cache, it reports whether
+// the cache held it. The callers hold the lock of template.
+func (p *Postgres) restoreTemplate(ctx context.Context, conn *sql.DB, template string) (bool, error) {
+	entry := cachedTemplateOf(template)
+
+	var cached bool
+	if err := conn.QueryRowContext(ctx, "select pg_stat_file($1, true) is not null", entry.dump).Scan(&cached); err != nil || !cached {
+		return false, nil
+	}
+
+	// the dump is restored under another name and renamed once complete, a request
+	// must never clone a template that is half restored.
+	staging := "dbctl_restore_" + strings.TrimPrefix(template, TemplatePrefix)
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("drop database if exists %s", quoteIdentifier(staging))); err != nil {
+		return false, err
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("create database %s template template0", quoteIdentifier(staging))); err != nil {
+		return false, fmt.Errorf("restoring template %q failed: %w", template, err)
+	}
+
+	restored := false
+	defer func() {
+		if !restored {
+			_, _ = conn.ExecContext(context.Background(), fmt.Sprintf("drop database if exists %s", quoteIdentifier(staging)))
+		}
+	}()
+
+	cmd := fmt.Sprintf("pg_restore --exit-on-error -U %s -d %s %s",
+		shellQuote(p.cfg.user), shellQuote(staging), shellQuote(entry.dump))
+	if err := runProgram(ctx, conn, cmd, ""); err != nil {
+		return false, fmt.Errorf("restoring template %q failed: %w", template, err)
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("alter database %s rename to %s",
+		quoteIdentifier(staging), quoteIdentifier(template))); err != nil {
+		return false, fmt.Errorf("restoring template %q failed: %w", template, err)
+	}
+	restored = true
+
+	// a cache entry without its details still restores, it only lacks them
+	var comment string
+	if err := conn.QueryRowContext(ctx, "select pg_read_file($1)", entry.meta).Scan(&comment); err != nil {
+		logger.Debug("reading the details of cached template", template, "failed:", err)
+	}
+
+	meta := parseTemplateMeta(comment)
+	if meta.CreatedAt.IsZero() {
+		meta.CreatedAt = time.Now().UTC()
+	}
+	if err := writeTemplateMeta(ctx, conn, template, meta); err != nil {
+		logger.Debug("storing the details of template", template, "failed:", err)
+	}
+	return true, nil
+}
+
+// uncacheTemplate removes template from the template cache, when the instance has one.
+func uncacheTemplate(ctx context.Context, conn *sql.DB, template string) error {
+	if !templateCacheEnabled(ctx, conn) {
+		return nil
+	}
+
+	entry := cachedTemplateOf(template)
+	if err := runProgram(ctx, conn, fmt.Sprintf("rm -f %s %s", shellQuote(entry.dump), shellQuote(entry.meta)), ""); err != nil {
+		return fmt.Errorf("removing template %q from the cache failed: %w", template, err)
+	}
+	return nil
+}
+
+// restoreCachedPrefix restores the template of the longest of prefixes the template
+// cache holds, when it is longer than the one of index built, the index of prefixes
+// longestTemplate found. It returns the index of the template there is now.
+func (p *Postgres) restoreCachedPrefix(ctx context.Context, conn *sql.DB, prefixes []string, built int) int {
+	if !templateCacheEnabled(ctx, conn) {
+		return built
+	}
+
+	for i := len(prefixes) - 1; i > built; i-- {
+		restored, err := p.restoreCachedTemplate(ctx, conn, prefixes[i])
+		if err != nil {
+			// a broken cache entry costs a rebuild of its template, nothing more
+			logger.Warn(err.Error())
+			continue
+		}
+		if restored {
+			logger.Info("Restored the template of earlier migrations from the cache")
+			return i
+		}
+	}
+	return built
+}
+
+// restoreCachedTemplate restores template from the template cache, unless a
+// concurrent request restored or built it first. The caller may hold the lock of a
+// template of more migrations, never of fewer, so locks are always taken in the
+// same order.
+func (p *Postgres) restoreCachedTemplate(ctx context.Context, conn *sql.DB, template string) (bool, error) {
+	if cached, err := templateCached(ctx, conn, template); err != nil || !cached {
+		return false, err
+	}
+
+	unlock, err := p.lockTemplate(ctx, conn, template)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if i, err := longestTemplate(ctx, conn, []string{template}); err != nil || i == 0 {
+		return i == 0, err
+	}
+	return p.restoreTemplate(ctx, conn, template)
+}
+
+// templateCached reports whether the template cache holds template.
+func templateCached(ctx context.Context, conn *sql.DB, template string) (bool, error) {
+	var cached bool
+	err := conn.QueryRowContext(ctx, "select pg_stat_file($1, true) is not null", cachedTemplateOf(template).dump).Scan(&cached)
+	return cached, err
+}
+
+// postgresUID is the user the postgres server runs as in the alpine images dbctl
+// starts, the owner of the template cache directory it writes to.
+const postgresUID = 70
+
+// templateCacheDir is the directory of dir the templates of instances running image
+// are cached in. A dump is only restored by the version of postgres that wrote it,
+// pg_restore of an older one refuses a newer dump, and the extensions of one image
+// may not exist in another.
+func templateCacheDir(dir, image string) string {
+	key := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, image)
+	return filepath.Join(dir, key)
+}
+
+// prepareTemplateCache creates dir for the postgres container to write to, owned by
+// the user postgres runs as, and reports whether it can be mounted. Only root may
+// give a directory away; a directory postgres can not write to is left unmounted,
+// and the templates are built again, rather than warned about on every start.
+// Docker desktop maps the owner of bind mounts itself and needs nothing.
+func prepareTemplateCache(dir string) (bool, error) {
+	// the cache is bind mounted, docker takes absolute paths only
+	if !filepath.IsAbs(dir) {
+		return false, fmt.Errorf("template cache %s is not an absolute path", dir)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false, fmt.Errorf("create template cache %s failed: %w", dir, err)
+	}
+
+	if err := giveToPostgres(dir, true); err != nil && runtime.GOOS == "linux" && !ownedBy(dir, postgresUID) {
+		logger.Debug(fmt.Sprintf("template cache %s is not mounted, postgres can not write to it: %v", dir, err))
+		return false, nil
+	}
+	return true, nil
+}
+
+// OwnTemplateCache gives what dir, the template cache, holds to the user postgres
+// runs as, the way the containers write it, so that imported dumps can be replaced
+// and removed by them. Only root may give files away, for anyone else it does
+// nothing and the instances leave the directories they can not write to unmounted.
+func OwnTemplateCache(dir string) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipDir
+			}
+			return err
+		}
+
+		// the root holds a directory per image and stays with the user
+		if p == dir {
+			return nil
+		}
+		return giveToPostgres(p, d.IsDir())
+	})
+	if err != nil {
+		return fmt.Errorf("own template cache %s failed: %w", dir, err)
+	}
+	return nil
+}
+
+// giveToPostgres hands path to the user postgres runs as, readable by all.
+func giveToPostgres(path string, dir bool) error {
+	if err := os.Chown(path, postgresUID, postgresUID); err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0o644)
+	if dir {
+		mode = 0o755
+	}
+	return os.Chmod(path, mode)
+}
+
+// ownedBy reports whether the user uid owns path.
+func ownedBy(path string, uid int) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == uid
+}
@@ -0,0 +1,73 @@
+package pg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplateCacheDir(t *testing.T) {
+	got := templateCacheDir("/cache/templates", "postgis/postgis:14-3.2-alpine")
+	if got != "/cache/templates/postgis_postgis_14-3.2-alpine" {
+		t.Fatalf("unexpected cache directory %s", got)
+	}
+
+	// a dump of one version of postgres is never restored by another
+	if templateCacheDir("/cache", "postgis/postgis:13-3.2-alpine") == templateCacheDir("/cache", "postgis/postgis:14-3.2-alpine") {
+		t.Fatal("expected images to be cached apart")
+	}
+}
+
+func TestCachedTemplateOf(t *testing.T) {
+	entry := cachedTemplateOf(TemplatePrefix + "0a1b")
+	if entry.dump != TemplateCacheMount+"/0a1b.dump" || entry.meta != TemplateCacheMount+"/0a1b.json" {
+		t.Fatalf("unexpected cache entry %+v", entry)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if got := shellQuote("it's"); got != `'it'"'"'s'` {
+		t.Fatalf("unexpected quoting: %s", got)
+	}
+}
+
+func TestOwnTemplateCache(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("only root may give files away")
+	}
+
+	dir := t.TempDir()
+	image := filepath.Join(dir, "postgres_14-alpine")
+	if err := os.MkdirAll(image, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	dump := filepath.Join(image, "0a1b.dump")
+	if err := os.WriteFile(dump, []byte("dump"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := OwnTemplateCache(dir); err != nil {
+		t.Fatalf("own template cache failed: %v", err)
+	}
+
+	// postgres writes to the directory of the image and removes what it holds
+	if !ownedBy(image, postgresUID) || !ownedBy(dump, postgresUID) {
+		t.Fatal("expected the imported cache to be given to postgres")
+	}
+	if ownedBy(dir, postgresUID) {
+		t.Fatal("expected the root of the cache to stay with the user")
+	}
+
+	info, err := os.Stat(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o644 {
+		t.Fatalf("unexpected mode %v", info.Mode().Perm())
+	}
+
+	// a cache never imported is nothing to own
+	if err := OwnTemplateCache(filepath.Join(dir, "missing")); err != nil {
+		t.Fatalf("own missing template cache failed: %v", err)
+	}
+}
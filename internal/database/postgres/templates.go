@@ -0,0 +1,436 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TemplatePrefix starts the name of every template built from the migrations sent to
+// CreateDB, the hash of the migrations makes up the rest of it.
+const TemplatePrefix = "dbctl_tpl_"
+
+// ErrTemplateNotFound is returned when no template matches a given hash.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Template is a template database built from a set of migrations.
+type Template struct {
+	Name string
+	Hash string
+	// Size is the size of the database on disk, in bytes
+	Size int64
+
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	// Hits counts the databases created from the template
+	Hits int
+	// Files are the migrations the template was built from, relative to the
+	// directory they were read from
+	Files []string
+	// Base is the hash of the template this one was cloned from before the rest of
+	// its migrations were applied, empty when it was built from scratch
+	Base string
+}
+
+// templateMeta is what dbctl knows about a template. It is kept as the comment of
+// the template database, that way it lives exactly as long as the template does and
+// survives restarts of the api server.
+type templateMeta struct {
+	CreatedAt time.Time `json:"created_at"`
+	Files     []string  `json:"files"`
+	Base      string    `json:"base,omitempty"`
+}
+
+// writeTemplateMeta stores meta as the comment of the template database name.
+func writeTemplateMeta(ctx context.Context, conn *sql.DB, name string, meta templateMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	// COMMENT takes no parameters, the value has to be a literal
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("comment on database %s is %s",
+		quoteIdentifier(name), quoteLiteral(string(b)))); err != nil {
+		return fmt.Errorf("store template details failed: %w", err)
+	}
+	return nil
+}
+
+// readTemplateMeta returns what is known about the template database name. A
+// template built by an older dbctl has no comment, it comes back empty.
+func readTemplateMeta(ctx context.Context, conn *sql.DB, name string) (templateMeta, error) {
+	var comment sql.NullString
+	err := conn.QueryRowContext(ctx,
+		"select shobj_description(oid, 'pg_database') from pg_database where datname = $1", name).Scan(&comment)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return templateMeta{}, errDatabaseNotExists
+		}
+		return templateMeta{}, err
+	}
+
+	return parseTemplateMeta(comment.String), nil
+}
+
+// parseTemplateMeta reads a template comment, anything unreadable is taken as no
+// details at all rather than as a reason to fail.
+func parseTemplateMeta(comment string) templateMeta {
+	var meta templateMeta
+	if comment != "" {
+		_ = json.Unmarshal([]byte(comment), &meta)
+	}
+	return meta
+}
+
+// TemplatesDatabase keeps the uses of the templates, next to the databases of the
+// instance rather than in them, like StatsDatabase. Counting in the comment of the
+// template would read and rewrite it, losing the hits of requests counting at the
+// same time and making them wait on each other.
+const TemplatesDatabase = "dbctl_templates"
+
+// recordTemplateHit counts a database created from the template name, conn being
+// connected to the database of the instance.
+func (p *Postgres) recordTemplateHit(ctx context.Context, conn *sql.DB, name string) error {
+	if err := ensureDatabase(ctx, conn, TemplatesDatabase); err != nil {
+		return err
+	}
+
+	db, err := p.connectTo(ctx, TemplatesDatabase)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	const count = `insert into hits (template, hits, last_used_at) values ($1, 1, now())
+		on conflict (template) do update set hits = hits.hits + 1, last_used_at = excluded.last_used_at`
+
+	_, err = db.ExecContext(ctx, count, name)
+	if !isUndefinedTable(err) {
+		return err
+	}
+
+	// the first hit on the instance, a request counting at the same time may have
+	// created the table already
+	if _, err := db.ExecContext(ctx, `create table if not exists hits (
+		template text primary key,
+		hits bigint not null default 0,
+		last_used_at timestamptz not null
+	)`); err != nil && !isDuplicateObject(err) {
+		return err
+	}
+	_, err = db.ExecContext(ctx, count, name)
+	return err
+}
+
+// templateHit is the use of a template counted by recordTemplateHit.
+type templateHit struct {
+	hits     int
+	lastUsed time.Time
+}
+
+// templateHits returns the uses of the templates counted by recordTemplateHit, by
+// template name, none before the first one.
+func (p *Postgres) templateHits(ctx context.Context, conn *sql.DB) (map[string]templateHit, error) {
+	db, err := p.connectTemplates(ctx, conn)
+	if err != nil || db == nil {
+		return nil, err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	rows, err := db.QueryContext(ctx, "select template, hits, last_used_at from hits")
+	if err != nil {
+		if isUndefinedTable(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	out := make(map[string]templateHit)
+	for rows.Next() {
+		var (
+			name string
+			hit  templateHit
+		)
+		if err := rows.Scan(&name, &hit.hits, &hit.lastUsed); err != nil {
+			return nil, err
+		}
+		out[name] = hit
+	}
+	return out, rows.Err()
+}
+
+// connectTemplates connects to TemplatesDatabase, nil when it does not exist yet.
+func (p *Postgres) connectTemplates(ctx context.Context, conn *sql.DB) (*sql.DB, error) {
+	var exists bool
+	if err := conn.QueryRowContext(ctx, "select exists(select from pg_database where datname = $1)", TemplatesDatabase).Scan(&exists); err != nil || !exists {
+		return nil, err
+	}
+	return p.connectTo(ctx, TemplatesDatabase)
+}
+
+// forgetTemplateHits removes the uses counted of the template name.
+func (p *Postgres) forgetTemplateHits(ctx context.Context, conn *sql.DB, name string) error {
+	db, err := p.connectTemplates(ctx, conn)
+	if err != nil || db == nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	if _, err := db.ExecContext(ctx, "delete from hits where template = $1", name); err != nil && !isUndefinedTable(err) {
+		return err
+	}
+	return nil
+}
+
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P01"
+}
+
+// isDuplicateObject reports whether err is postgres refusing to create a table that
+// another session created at the same time.
+func isDuplicateObject(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "42P07" || pqErr.Code == "23505")
+}
+
+// Templates returns the templates built on this instance, most recently used first.
+func (p *Postgres) Templates(ctx context.Context) ([]Template, error) {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	return p.listTemplates(ctx, conn)
+}
+
+func (p *Postgres) listTemplates(ctx context.Context, conn *sql.DB) ([]Template, error) {
+	rows, err := conn.QueryContext(ctx, `
+		select datname, pg_database_size(oid), coalesce(shobj_description(oid, 'pg_database'), '')
+		from pg_database
+		where left(datname, length($1)) = $1`, TemplatePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("list templates failed: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	hits, err := p.templateHits(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("list templates failed: %w", err)
+	}
+
+	var out []Template
+	for rows.Next() {
+		var (
+			t       Template
+			comment string
+		)
+		if err := rows.Scan(&t.Name, &t.Size, &comment); err != nil {
+			return nil, err
+		}
+
+		meta := parseTemplateMeta(comment)
+		t.Hash = strings.TrimPrefix(t.Name, TemplatePrefix)
+		t.CreatedAt = meta.CreatedAt
+		if h, ok := hits[t.Name]; ok {
+			t.Hits = h.hits
+			t.LastUsedAt = h.lastUsed.UTC()
+		}
+		t.Files = meta.Files
+		t.Base = strings.TrimPrefix(meta.Base, TemplatePrefix)
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].lastActive().After(out[j].lastActive())
+	})
+	return out, nil
+}
+
+// longestTemplate returns the index of the last of names a template database exists
+// for, or -1 when there is none.
+func longestTemplate(ctx context.Context, conn *sql.DB, names []string) (int, error) {
+	if len(names) == 0 {
+		return -1, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, "select datname from pg_database where datname = any($1)", pq.Array(names))
+	if err != nil {
+		return -1, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return -1, err
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return -1, err
+	}
+
+	for i := len(names) - 1; i >= 0; i-- {
+		if existing[names[i]] {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// lastActive is the last time the template was used, or built when it never was.
+func (t Template) lastActive() time.Time {
+	if t.LastUsedAt.After(t.CreatedAt) {
+		return t.LastUsedAt
+	}
+	return t.CreatedAt
+}
+
+// Template returns the template with the given hash. A unique prefix of the hash is
+// enough, the way docker takes a short container id.
+func (p *Postgres) Template(ctx context.Context, hash string) (*Template, error) {
+	templates, err := p.Templates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return findTemplate(templates, hash)
+}
+
+func findTemplate(templates []Template, hash string) (*Template, error) {
+	hash = strings.TrimPrefix(strings.TrimSpace(hash), TemplatePrefix)
+	if hash == "" {
+		return nil, fmt.Errorf("%w: no hash given", ErrTemplateNotFound)
+	}
+
+	var found []Template
+	for _, t := range templates {
+		if t.Hash == hash {
+			return &t, nil
+		}
+		if strings.HasPrefix(t.Hash, hash) {
+			found = append(found, t)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%w: no template matches %q", ErrTemplateNotFound, hash)
+	case 1:
+		return &found[0], nil
+	default:
+		return nil, fmt.Errorf("%q matches %d templates, give more of the hash", hash, len(found))
+	}
+}
+
+// RemoveTemplate drops the template with the given hash, or unique prefix of it.
+// The next request sending its migrations builds it again.
+func (p *Postgres) RemoveTemplate(ctx context.Context, hash string) (*Template, error) {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	templates, err := p.listTemplates(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := findTemplate(templates, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, p.dropTemplate(ctx, conn, t.Name)
+}
+
+// PruneTemplates drops the templates that are not among the keep most recently used
+// ones and, when olderThan is set, have not been used for at least that long. It
+// returns the templates it dropped.
+func (p *Postgres) PruneTemplates(ctx context.Context, keep int, olderThan time.Duration) ([]Template, error) {
+	conn, err := dbConnect(ctx, p.URI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	templates, err := p.listTemplates(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []Template
+	for _, t := range pruneCandidates(templates, keep, olderThan, time.Now()) {
+		if err := p.dropTemplate(ctx, conn, t.Name); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, t)
+	}
+	return pruned, nil
+}
+
+// pruneCandidates picks the templates to prune from templates, which are sorted
+// most recently used first.
+func pruneCandidates(templates []Template, keep int, olderThan time.Duration, now time.Time) []Template {
+	var out []Template
+	for i, t := range templates {
+		if i < keep {
+			continue
+		}
+		if olderThan > 0 && now.Sub(t.lastActive()) < olderThan {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+func (p *Postgres) dropTemplate(ctx context.Context, conn *sql.DB, name string) error {
+	if !strings.HasPrefix(name, TemplatePrefix) {
+		return fmt.Errorf("%q is not a dbctl template", name)
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("drop database if exists %s", quoteIdentifier(name))); err != nil {
+		return fmt.Errorf("drop template %q failed: %w", name, err)
+	}
+
+	// a template built again with the same migrations starts counting from zero
+	if err := p.forgetTemplateHits(ctx, conn, name); err != nil {
+		return fmt.Errorf("drop template %q failed: %w", name, err)
+	}
+
+	// or the next start of the instance restores it
+	return uncacheTemplate(ctx, conn, name)
+}
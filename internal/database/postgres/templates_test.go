@@ -0,0 +1,92 @@
+package pg
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPruneCandidates(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	// most recently used first, the way listTemplates sorts them
+	templates := []Template{
+		{Name: "dbctl_tpl_a", CreatedAt: now.Add(-30 * day), LastUsedAt: now.Add(-time.Hour)},
+		{Name: "dbctl_tpl_b", CreatedAt: now.Add(-2 * day)},
+		{Name: "dbctl_tpl_c", CreatedAt: now.Add(-30 * day), LastUsedAt: now.Add(-10 * day)},
+		{Name: "dbctl_tpl_d", CreatedAt: now.Add(-40 * day)},
+	}
+
+	names := func(in []Template) []string {
+		var out []string
+		for _, t := range in {
+			out = append(out, t.Name)
+		}
+		return out
+	}
+
+	cases := []struct {
+		keep      int
+		olderThan time.Duration
+		want      []string
+	}{
+		{keep: 2, want: []string{"dbctl_tpl_c", "dbctl_tpl_d"}},
+		{olderThan: 7 * day, want: []string{"dbctl_tpl_c", "dbctl_tpl_d"}},
+		{keep: 3, olderThan: 7 * day, want: []string{"dbctl_tpl_d"}},
+		{keep: 10, want: nil},
+	}
+
+	for _, tc := range cases {
+		got := names(pruneCandidates(templates, tc.keep, tc.olderThan, now))
+		if len(got) != len(tc.want) {
+			t.Fatalf("keep %d, older than %s: expected %v, got %v", tc.keep, tc.olderThan, tc.want, got)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("keep %d, older than %s: expected %v, got %v", tc.keep, tc.olderThan, tc.want, got)
+			}
+		}
+	}
+}
+
+func TestFindTemplate(t *testing.T) {
+	templates := []Template{
+		{Name: "dbctl_tpl_abc123", Hash: "abc123"},
+		{Name: "dbctl_tpl_abd456", Hash: "abd456"},
+	}
+
+	for _, hash := range []string{"abc123", "abc", "dbctl_tpl_abc1"} {
+		got, err := findTemplate(templates, hash)
+		if err != nil {
+			t.Fatalf("%q: %v", hash, err)
+		}
+		if got.Name != "dbctl_tpl_abc123" {
+			t.Fatalf("%q: found %s", hash, got.Name)
+		}
+	}
+
+	if _, err := findTemplate(templates, "ab"); err == nil {
+		t.Fatal("expected an ambiguous prefix to be rejected")
+	}
+
+	if _, err := findTemplate(templates, "fff"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+func TestTemplateMetaSurvivesAsAComment(t *testing.T) {
+	// unreadable comments, such as one a user put on the database, are ignored
+	if meta := parseTemplateMeta("built by hand"); meta.Files != nil || !meta.CreatedAt.IsZero() {
+		t.Fatalf("expected no details, got %+v", meta)
+	}
+
+	meta := parseTemplateMeta(`{"created_at":"2024-05-10T12:00:00Z","files":["001_init.up.sql"]}`)
+	if len(meta.Files) != 1 || meta.CreatedAt.IsZero() {
+		t.Fatalf("unexpected details: %+v", meta)
+	}
+
+	if got := quoteLiteral(`{"name":"it's"}`); got != `'{"name":"it''s"}'` {
+		t.Fatalf("unexpected literal: %s", got)
+	}
+}
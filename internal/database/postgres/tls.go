@@ -0,0 +1,60 @@
+package pg
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+
+	"github.com/mirzakhany/dbctl/internal/certs"
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// tlsArgs are the settings of an instance started with TLS. The clients it hands
+// databases out to connect with it, dbctl itself keeps connecting without, which
+// the default pg_hba.conf of the image allows.
+func tlsArgs() []string {
+	return []string{
+		"-c", "ssl=on",
+		"-c", "ssl_cert_file=" + path.Join(certs.Path, certs.ServerCertFile),
+		"-c", "ssl_key_file=" + path.Join(certs.Path, certs.ServerKeyFile),
+		"-c", "ssl_ca_file=" + path.Join(certs.Path, certs.CAFile),
+	}
+}
+
+// clientURI is uri as it is handed out: reachable by the caller and, on an instance
+// started with TLS, verifying the server with the authority of the instance and
+// presenting the certificate of the client when there is one.
+func (p *Postgres) clientURI(uri string) string {
+	uri = hostURI(uri)
+	if p.cfg.certs == nil {
+		return uri
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	q := u.Query()
+	q.Set("sslmode", "verify-full")
+	q.Set("sslrootcert", filepath.Join(p.cfg.certs.Dir, certs.CAFile))
+	if p.cfg.certs.ClientCert {
+		q.Set("sslcert", filepath.Join(p.cfg.certs.Dir, certs.ClientCertFile))
+		q.Set("sslkey", filepath.Join(p.cfg.certs.Dir, certs.ClientKeyFile))
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// logCertificates tells where the certificates of an instance started with TLS
+// are, for the clients not given a uri by dbctl.
+func (p *Postgres) logCertificates() {
+	if p.cfg.certs == nil {
+		return
+	}
+	logger.Info("Connections are verified with the certificate authority at " + filepath.Join(p.cfg.certs.Dir, certs.CAFile))
+	if p.cfg.certs.ClientCert {
+		logger.Info("The certificate of the client is at " + filepath.Join(p.cfg.certs.Dir, certs.ClientCertFile) +
+			", its key at " + filepath.Join(p.cfg.certs.Dir, certs.ClientKeyFile))
+	}
+}
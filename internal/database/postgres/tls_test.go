@@ -0,0 +1,40 @@
+package pg
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+)
+
+func TestClientURI(t *testing.T) {
+	p, err := New(WithHost("postgres", "secret", "dbctl_1", 15432))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := p.clientURI(p.URI()); got != p.URI() {
+		t.Fatalf("uri of an instance without tls changed to %q", got)
+	}
+
+	p.cfg.certs = &database.TLS{Dir: "/cache/tls/dbctl_pg_1", CA: "ca", ClientCert: true}
+	u, err := url.Parse(p.clientURI(p.URI()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := u.Query()
+	for key, want := range map[string]string{
+		"sslmode":     "verify-full",
+		"sslrootcert": "/cache/tls/dbctl_pg_1/ca.pem",
+		"sslcert":     "/cache/tls/dbctl_pg_1/client.pem",
+		"sslkey":      "/cache/tls/dbctl_pg_1/client-key.pem",
+	} {
+		if got := q.Get(key); got != want {
+			t.Fatalf("%s is %q, want %q", key, got, want)
+		}
+	}
+	if u.Path != "/dbctl_1" {
+		t.Fatalf("unexpected database %q", u.Path)
+	}
+}
@@ -0,0 +1,380 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
+)
+
+var _ database.Asserter = (*Redis)(nil)
+
+// AssertDB compares the keys of the golden files in req.Dir with the ones of the
+// database, or rewrites the files with them when req.Update is set. Golden files
+// are fixtures of redis commands building the keys, compared on their type and
+// value; expiries are not compared. Keys matching a pattern of req.Ignore are left
+// out.
+func (p *Redis) AssertDB(ctx context.Context, req database.AssertRequest) ([]database.TableDiff, error) {
+	index, err := p.databaseIndex(req.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := getFiles(req.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read golden files failed: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no golden files in %s", req.Dir)
+	}
+
+	conn, err := p.dial(ctx, p.adminURI())
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis failed: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := conn.Do("SELECT", index); err != nil {
+		return nil, fmt.Errorf("select database %d failed: %w", index, err)
+	}
+
+	var out []database.TableDiff
+	for _, file := range files {
+		display := goldenName(req.Dir, file)
+		if fixtures.Ext(file) == ".lua" {
+			return nil, fmt.Errorf("golden file %s is a script, only commands can be compared", display)
+		}
+		if req.Update && fixtures.IsTemplate(file) {
+			return nil, fmt.Errorf("golden file %s is a template, it can not be rewritten", display)
+		}
+
+		diff, err := assertKeys(conn, req, file, index)
+		if err != nil {
+			return nil, fmt.Errorf("compare %s failed: %w", display, err)
+		}
+		if diff != nil {
+			diff.File = display
+			out = append(out, *diff)
+		}
+	}
+	return out, nil
+}
+
+func assertKeys(conn redis.Conn, req database.AssertRequest, file string, index int) (*database.TableDiff, error) {
+	content, err := fixtures.ReadFile(file, fixtures.DefaultSeed)
+	if err != nil {
+		return nil, err
+	}
+
+	golden, keys, err := goldenKeys(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var expected, actual []database.Row
+	var kept []string
+	for _, key := range keys {
+		if database.IgnoredKey(req.Ignore, key) {
+			continue
+		}
+		kept = append(kept, key)
+		expected = append(expected, golden[key].row(key))
+
+		current, err := readKey(conn, key)
+		if err != nil {
+			return nil, fmt.Errorf("read %s failed: %w", key, err)
+		}
+		if current != nil {
+			actual = append(actual, current.row(key))
+		}
+	}
+
+	if req.Update {
+		return nil, writeGolden(conn, file, kept, index)
+	}
+
+	rows := database.CompareRows(expected, actual, []string{"key"})
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &database.TableDiff{Table: fmt.Sprintf("database %d", index), Key: []string{"key"}, Rows: rows}, nil
+}
+
+// keyValue is the value of a key, built by the commands of a golden file or read
+// from the database.
+type keyValue struct {
+	typ  string
+	str  string
+	list []string
+	set  map[string]bool
+	hash map[string]string
+	zset map[string]float64
+}
+
+// row returns the key as it is compared: its type and its value, a string as it is
+// and the other types as json. Sets are sorted, sorted sets ordered by score.
+func (v *keyValue) row(key string) database.Row {
+	var value any
+	switch v.typ {
+	case "string":
+		return database.Row{"key": key, "type": v.typ, "value": v.str}
+	case "list":
+		value = v.list
+	case "set":
+		members := make([]string, 0, len(v.set))
+		for m := range v.set {
+			members = append(members, m)
+		}
+		sort.Strings(members)
+		value = members
+	case "hash":
+		value = v.hash
+	case "zset":
+		members := make([]string, 0, len(v.zset))
+		for m := range v.zset {
+			members = append(members, m)
+		}
+		sort.Slice(members, func(i, j int) bool {
+			if v.zset[members[i]] != v.zset[members[j]] {
+				return v.zset[members[i]] < v.zset[members[j]]
+			}
+			return members[i] < members[j]
+		})
+		scored := make([][2]string, 0, len(members))
+		for _, m := range members {
+			scored = append(scored, [2]string{m, strconv.FormatFloat(v.zset[m], 'g', -1, 64)})
+		}
+		value = scored
+	}
+
+	b, _ := json.Marshal(value)
+	return database.Row{"key": key, "type": v.typ, "value": string(b)}
+}
+
+// goldenKeys runs the commands of a golden file on a model of the keys, rather than
+// on a database, and returns the keys in the order they are first written.
+func goldenKeys(content string) (map[string]*keyValue, []string, error) {
+	keys := map[string]*keyValue{}
+	var order []string
+
+	get := func(key, typ string) (*keyValue, error) {
+		v, ok := keys[key]
+		if !ok {
+			v = &keyValue{typ: typ, set: map[string]bool{}, hash: map[string]string{}, zset: map[string]float64{}}
+			keys[key] = v
+			order = append(order, key)
+		}
+		if v.typ != typ {
+			return nil, fmt.Errorf("key %s is a %s, not a %s", key, v.typ, typ)
+		}
+		return v, nil
+	}
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		args, err := splitCommand(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if err := goldenCommand(strings.ToUpper(args[0]), args[1:], keys, get); err != nil {
+			return nil, nil, fmt.Errorf("line %d (%s): %w", i+1, args[0], err)
+		}
+	}
+
+	// a key deleted again is not in the golden file, one written again is there once
+	var out []string
+	seen := map[string]bool{}
+	for _, key := range order {
+		if _, ok := keys[key]; ok && !seen[key] {
+			seen[key] = true
+			out = append(out, key)
+		}
+	}
+	return keys, out, nil
+}
+
+// goldenCommand applies a command of a golden file to keys. Only the commands
+// building keys are taken, along with the ones setting their expiry, which is not
+// compared.
+func goldenCommand(command string, args []string, keys map[string]*keyValue, get func(key, typ string) (*keyValue, error)) error {
+	switch command {
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT", "PERSIST":
+		return nil
+	case "DEL", "UNLINK":
+		for _, key := range args {
+			delete(keys, key)
+		}
+		return nil
+	case "SET", "MSET", "RPUSH", "LPUSH", "SADD", "HSET", "HMSET", "ZADD":
+	default:
+		return fmt.Errorf("%s can not be compared, golden files build keys with SET, MSET, RPUSH, LPUSH, SADD, HSET and ZADD", command)
+	}
+
+	if len(args) < 2 {
+		return errors.New("wrong number of arguments")
+	}
+	key, values := args[0], args[1:]
+
+	switch command {
+	case "SET", "MSET":
+		if command == "MSET" && len(args)%2 != 0 {
+			return errors.New("wrong number of arguments")
+		}
+		pairs := args
+		if command == "SET" {
+			// the options of SET are expiries and conditions, none of them compared
+			pairs = args[:2]
+		}
+		for j := 0; j+1 < len(pairs); j += 2 {
+			delete(keys, pairs[j])
+			v, err := get(pairs[j], "string")
+			if err != nil {
+				return err
+			}
+			v.str = pairs[j+1]
+		}
+	case "RPUSH", "LPUSH":
+		v, err := get(key, "list")
+		if err != nil {
+			return err
+		}
+		for _, item := range values {
+			if command == "LPUSH" {
+				v.list = append([]string{item}, v.list...)
+				continue
+			}
+			v.list = append(v.list, item)
+		}
+	case "SADD":
+		v, err := get(key, "set")
+		if err != nil {
+			return err
+		}
+		for _, m := range values {
+			v.set[m] = true
+		}
+	case "HSET", "HMSET":
+		if len(values)%2 != 0 {
+			return errors.New("wrong number of arguments")
+		}
+		v, err := get(key, "hash")
+		if err != nil {
+			return err
+		}
+		for j := 0; j < len(values); j += 2 {
+			v.hash[values[j]] = values[j+1]
+		}
+	case "ZADD":
+		if len(values)%2 != 0 {
+			return errors.New("wrong number of arguments, options of ZADD can not be compared")
+		}
+		v, err := get(key, "zset")
+		if err != nil {
+			return err
+		}
+		for j := 0; j < len(values); j += 2 {
+			score, err := strconv.ParseFloat(values[j], 64)
+			if err != nil {
+				return fmt.Errorf("score %q is not a number", values[j])
+			}
+			v.zset[values[j+1]] = score
+		}
+	}
+	return nil
+}
+
+// readKey reads key from the database, nil when it does not exist. A key of a type
+// golden files can not build is compared by its type.
+func readKey(conn redis.Conn, key string) (*keyValue, error) {
+	typ, err := redis.String(conn.Do("TYPE", key))
+	if err != nil {
+		return nil, err
+	}
+
+	v := &keyValue{typ: typ, set: map[string]bool{}, hash: map[string]string{}, zset: map[string]float64{}}
+	switch typ {
+	case "none":
+		return nil, nil
+	case "string":
+		if v.str, err = redis.String(conn.Do("GET", key)); err == redis.ErrNil {
+			return nil, nil
+		}
+	case "list":
+		v.list, err = redis.Strings(conn.Do("LRANGE", key, 0, -1))
+	case "set":
+		var members []string
+		members, err = redis.Strings(conn.Do("SMEMBERS", key))
+		for _, m := range members {
+			v.set[m] = true
+		}
+	case "hash":
+		v.hash, err = redis.StringMap(conn.Do("HGETALL", key))
+	case "zset":
+		var reply []string
+		reply, err = redis.Strings(conn.Do("ZRANGE", key, 0, -1, "WITHSCORES"))
+		for i := 0; err == nil && i+1 < len(reply); i += 2 {
+			v.zset[reply[i]], err = strconv.ParseFloat(reply[i+1], 64)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// writeGolden rewrites the golden file at file with the commands building keys, the
+// way Export writes them. Keys no longer in the database are left out.
+func writeGolden(conn redis.Conn, file string, keys []string, index int) error {
+	var b strings.Builder
+	for _, key := range keys {
+		typ, err := redis.String(conn.Do("TYPE", key))
+		if err != nil {
+			return fmt.Errorf("read type of %s failed: %w", key, err)
+		}
+
+		commands, err := keyCommands(conn, key, typ)
+		if err != nil {
+			return fmt.Errorf("read %s failed: %w", key, err)
+		}
+		for _, c := range commands {
+			b.WriteString(c + "\n")
+		}
+	}
+
+	content := fmt.Sprintf("# golden keys of database %d, written by dbctl assert --update.\n\n%s", index, b.String())
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		return fmt.Errorf("write %s failed: %w", file, err)
+	}
+	return nil
+}
+
+// goldenName is the path of a golden file within dir.
+func goldenName(dir, file string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return file
+	}
+	rel, err := filepath.Rel(abs, file)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return filepath.Base(file)
+	}
+	return filepath.ToSlash(rel)
+}
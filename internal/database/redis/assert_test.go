@@ -0,0 +1,50 @@
+package redis
+
+import "testing"
+
+func TestGoldenKeys(t *testing.T) {
+	content := `# golden keys
+SET greeting "hello world" EX 60
+RPUSH queue b c
+LPUSH queue a
+SADD tags go redis go
+HSET user:1 name Alice city Paris
+ZADD scores 2 bob 1 alice
+SET temporary 1
+DEL temporary
+PEXPIRE queue 1000
+`
+
+	keys, order, err := goldenKeys(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"greeting", "queue", "tags", "user:1", "scores"}; len(order) != len(want) {
+		t.Fatalf("unexpected keys %v", order)
+	}
+
+	for key, want := range map[string]string{
+		"greeting": "hello world",
+		"queue":    `["a","b","c"]`,
+		"tags":     `["go","redis"]`,
+		"user:1":   `{"city":"Paris","name":"Alice"}`,
+		"scores":   `[["alice","1"],["bob","2"]]`,
+	} {
+		if got := keys[key].row(key)["value"]; got != want {
+			t.Fatalf("unexpected value of %s: %v", key, got)
+		}
+	}
+}
+
+func TestGoldenKeysRejectsUnknownCommands(t *testing.T) {
+	for _, content := range []string{
+		"INCR counter",
+		"SET greeting hello\nHSET greeting name Alice",
+		"ZADD scores NX 1 alice",
+	} {
+		if _, _, err := goldenKeys(content); err == nil {
+			t.Fatalf("expected an error for %q", content)
+		}
+	}
+}
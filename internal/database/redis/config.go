@@ -1,11 +1,14 @@
 package redis
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"strconv"
 	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database"
 )
 
 type config struct {
@@ -22,6 +25,16 @@ type config struct {
 	logger io.Writer
 
 	fixtureFiles []string
+
+	// seed seeds the random source of the fixtures written as templates
+	seed int64
+
+	// tls starts the instance with TLS, with the certificate of a client too when
+	// tlsClientCert is set
+	tls           bool
+	tlsClientCert bool
+	// certs are the certificates of an instance started with TLS
+	certs *database.TLS
 }
 
 // WithFixtures applies the selected fixtures to config
@@ -36,6 +49,15 @@ func WithFixtures(path string) Option {
 	}
 }
 
+// WithSeed seeds the random source of the fixtures written as templates, the same
+// seed renders them into the same data.
+func WithSeed(seed int64) Option {
+	return func(c *config) error {
+		c.seed = seed
+		return nil
+	}
+}
+
 var (
 	supportedDockerVersions = map[string]string{
 		"7.0.4": "redis:7.0.4-bullseye",
@@ -89,6 +111,42 @@ func WithURI(uri string) Option {
 	}
 }
 
+// WithInstance applies the connection details of a running instance to config.
+// Instances started by an older dbctl carry none, the defaults stay in place for
+// those.
+func WithInstance(i *database.Instance) Option {
+	return func(c *config) error {
+		if i == nil {
+			return nil
+		}
+		if i.Port != 0 {
+			c.port = i.Port
+		}
+		if i.User != "" {
+			c.user = i.User
+		}
+		if i.Pass != "" {
+			c.pass = i.Pass
+		}
+		c.certs = i.TLS
+		return nil
+	}
+}
+
+// WithTLS starts the instance with TLS alone, with certificates generated for it
+// and a certificate of a client too when clientCert is set. Its uris are rediss
+// ones.
+func WithTLS(enabled, clientCert bool) Option {
+	return func(c *config) error {
+		if clientCert && !enabled {
+			return errors.New("a client certificate takes tls")
+		}
+		c.tls = enabled
+		c.tlsClientCert = clientCert
+		return nil
+	}
+}
+
 func WithLabel(label string) Option {
 	return func(c *config) error {
 		c.label = label
@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// KeySpace is what the keys of a database tell about it, redis has no schema.
+type KeySpace struct {
+	Database int              `json:"database"`
+	Keys     int64            `json:"keys"`
+	Types    map[string]int64 `json:"types"`
+	Patterns []Pattern        `json:"patterns"`
+}
+
+// Pattern counts the keys of a type that only differ in their ids, such as
+// user:* for user:1 and user:2.
+type Pattern struct {
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"`
+	Count   int64  `json:"count"`
+}
+
+// scanCount is the COUNT hint of SCAN, the number of keys typed at a time.
+const scanCount = 1000
+
+// KeySpace scans the keys of db, a database index or uri, the database of the
+// instance when empty.
+func (p *Redis) KeySpace(ctx context.Context, db string) (*KeySpace, error) {
+	index, err := p.databaseIndex(db)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.dial(ctx, p.adminURI())
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis failed: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := conn.Do("SELECT", index); err != nil {
+		return nil, fmt.Errorf("select database %d failed: %w", index, err)
+	}
+
+	ks := &KeySpace{Database: index, Types: map[string]int64{}}
+	patterns := map[[2]string]int64{}
+
+	cursor := "0"
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "COUNT", scanCount))
+		if err != nil {
+			return nil, fmt.Errorf("scan keys failed: %w", err)
+		}
+		if len(reply) != 2 {
+			return nil, fmt.Errorf("scan keys failed: unexpected reply %v", reply)
+		}
+
+		if cursor, err = redis.String(reply[0], nil); err != nil {
+			return nil, fmt.Errorf("scan keys failed: %w", err)
+		}
+		keys, err := redis.Strings(reply[1], nil)
+		if err != nil {
+			return nil, fmt.Errorf("scan keys failed: %w", err)
+		}
+
+		// the types of a batch are asked for in one round trip
+		for _, key := range keys {
+			if err := conn.Send("TYPE", key); err != nil {
+				return nil, fmt.Errorf("read key types failed: %w", err)
+			}
+		}
+		if err := conn.Flush(); err != nil {
+			return nil, fmt.Errorf("read key types failed: %w", err)
+		}
+		for _, key := range keys {
+			typ, err := redis.String(conn.Receive())
+			if err != nil {
+				return nil, fmt.Errorf("read type of %s failed: %w", key, err)
+			}
+			// a key expired between SCAN and TYPE
+			if typ == "none" {
+				continue
+			}
+
+			ks.Keys++
+			ks.Types[typ]++
+			patterns[[2]string{patternOf(key), typ}]++
+		}
+
+		if cursor == "0" {
+			break
+		}
+	}
+
+	ks.Patterns = make([]Pattern, 0, len(patterns))
+	for k, count := range patterns {
+		ks.Patterns = append(ks.Patterns, Pattern{Pattern: k[0], Type: k[1], Count: count})
+	}
+	sort.Slice(ks.Patterns, func(i, j int) bool {
+		a, b := ks.Patterns[i], ks.Patterns[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Pattern != b.Pattern {
+			return a.Pattern < b.Pattern
+		}
+		return a.Type < b.Type
+	})
+	return ks, nil
+}
+
+var idSegment = regexp.MustCompile(`^(?:\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// patternOf replaces the parts of key that look like ids, numbers, uuids and long
+// hex strings, with a *: session:9f86d081884c7d65 and session:1 both are session:*.
+func patternOf(key string) string {
+	parts := strings.Split(key, ":")
+	for i, part := range parts {
+		if idSegment.MatchString(part) {
+			parts[i] = "*"
+		}
+	}
+	return strings.Join(parts, ":")
+}
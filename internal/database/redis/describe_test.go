@@ -0,0 +1,21 @@
+package redis
+
+import "testing"
+
+func TestPatternOf(t *testing.T) {
+	tests := map[string]string{
+		"user:1":                                     "user:*",
+		"user:42:sessions":                           "user:*:sessions",
+		"order:3f2b9c1e-8a4d-4e6f-9b7a-1c2d3e4f5a6b": "order:*",
+		"session:9f86d081884c7d65":                   "session:*",
+		"config":                                     "config",
+		"cache:beef":                                 "cache:beef",
+		"v2:feature:flags":                           "v2:feature:flags",
+	}
+
+	for key, want := range tests {
+		if got := patternOf(key); got != want {
+			t.Fatalf("%s: expected %s, got %s", key, want, got)
+		}
+	}
+}
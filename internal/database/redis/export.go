@@ -0,0 +1,343 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// exportBatch is the number of members, fields or items a command of an export
+// adds at a time.
+const exportBatch = 100
+
+// ExportRequest picks what Export writes.
+type ExportRequest struct {
+	// DB is the database to export, by index or uri, the database of the instance
+	// when empty.
+	DB string
+	// Patterns are the glob-style patterns of the keys to export, every key when
+	// empty.
+	Patterns []string
+	// Dir is the directory the fixtures are written to.
+	Dir string
+}
+
+// Exported is what Export wrote.
+type Exported struct {
+	Database int
+	// File is empty for a database without keys to export.
+	File  string
+	Keys  int64
+	Types map[string]int64
+}
+
+// Export writes the keys of a database as a fixture of redis commands, one per
+// line, the way fixtures are applied. Keys with an expiry are given the time they
+// had left to live. Keys of types the commands can not build, such as the ones of
+// modules, are left out with a warning.
+func (p *Redis) Export(ctx context.Context, req ExportRequest) (*Exported, error) {
+	index, err := p.databaseIndex(req.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.dial(ctx, p.adminURI())
+	if err != nil {
+		return nil, fmt.Errorf("connect to redis failed: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := conn.Do("SELECT", index); err != nil {
+		return nil, fmt.Errorf("select database %d failed: %w", index, err)
+	}
+
+	keys, err := scanKeys(conn, req.Patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Exported{Database: index, Types: map[string]int64{}}
+	var b strings.Builder
+	for _, key := range keys {
+		typ, err := redis.String(conn.Do("TYPE", key))
+		if err != nil {
+			return nil, fmt.Errorf("read type of %s failed: %w", key, err)
+		}
+
+		commands, err := keyCommands(conn, key, typ)
+		if err != nil {
+			return nil, fmt.Errorf("export %s failed: %w", key, err)
+		}
+		// a key expired since it was scanned
+		if len(commands) == 0 {
+			continue
+		}
+
+		ttl, err := redis.Int64(conn.Do("PTTL", key))
+		if err != nil {
+			return nil, fmt.Errorf("read expiry of %s failed: %w", key, err)
+		}
+		if ttl > 0 {
+			commands = append(commands, commandLine("PEXPIRE", []byte(key), []byte(strconv.FormatInt(ttl, 10))))
+		}
+
+		for _, c := range commands {
+			b.WriteString(c + "\n")
+		}
+		out.Keys++
+		out.Types[typ]++
+	}
+
+	if out.Keys == 0 {
+		return out, nil
+	}
+
+	if err := os.MkdirAll(req.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create export directory failed: %w", err)
+	}
+	out.File = filepath.Join(req.Dir, fmt.Sprintf("db%d.redis", index))
+	content := fmt.Sprintf("# %d keys of database %d, written by dbctl export.\n\n%s", out.Keys, index, b.String())
+	if err := os.WriteFile(out.File, []byte(content), 0o644); err != nil {
+		return nil, fmt.Errorf("write %s failed: %w", out.File, err)
+	}
+	return out, nil
+}
+
+// scanKeys returns the keys matching any of patterns, every key when empty, sorted
+// so that exporting the same keys writes the same file.
+func scanKeys(conn redis.Conn, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		cursor := "0"
+		for {
+			reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", scanCount))
+			if err != nil {
+				return nil, fmt.Errorf("scan keys failed: %w", err)
+			}
+			if len(reply) != 2 {
+				return nil, fmt.Errorf("scan keys failed: unexpected reply %v", reply)
+			}
+
+			if cursor, err = redis.String(reply[0], nil); err != nil {
+				return nil, fmt.Errorf("scan keys failed: %w", err)
+			}
+			keys, err := redis.Strings(reply[1], nil)
+			if err != nil {
+				return nil, fmt.Errorf("scan keys failed: %w", err)
+			}
+			for _, k := range keys {
+				seen[k] = true
+			}
+
+			if cursor == "0" {
+				break
+			}
+		}
+	}
+
+	out := make([]string, 0, len(seen))
+	for k := range seen {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// keyCommands returns the command lines building key, none when it no longer
+// exists or is of a type they can not build.
+func keyCommands(conn redis.Conn, key, typ string) ([]string, error) {
+	k := []byte(key)
+	if typ != "none" && !writable(key, k) {
+		return nil, nil
+	}
+
+	switch typ {
+	case "none":
+		return nil, nil
+	case "string":
+		v, err := redis.Bytes(conn.Do("GET", key))
+		if err == redis.ErrNil {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !writable(key, v) {
+			return nil, nil
+		}
+		return []string{commandLine("SET", k, v)}, nil
+	case "list":
+		items, err := redis.ByteSlices(conn.Do("LRANGE", key, 0, -1))
+		if err != nil {
+			return nil, err
+		}
+		if !writable(key, items...) {
+			return nil, nil
+		}
+		return batchCommands("RPUSH", k, items, 1), nil
+	case "set":
+		members, err := redis.ByteSlices(conn.Do("SMEMBERS", key))
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(members, func(i, j int) bool {
+			return string(members[i]) < string(members[j])
+		})
+		if !writable(key, members...) {
+			return nil, nil
+		}
+		return batchCommands("SADD", k, members, 1), nil
+	case "hash":
+		fields, err := redis.ByteSlices(conn.Do("HGETALL", key))
+		if err != nil {
+			return nil, err
+		}
+		if !writable(key, fields...) {
+			return nil, nil
+		}
+		return batchCommands("HSET", k, fields, 2), nil
+	case "zset":
+		reply, err := redis.ByteSlices(conn.Do("ZRANGE", key, 0, -1, "WITHSCORES"))
+		if err != nil {
+			return nil, err
+		}
+		// ZADD takes the score before the member
+		for i := 0; i+1 < len(reply); i += 2 {
+			reply[i], reply[i+1] = reply[i+1], reply[i]
+		}
+		if !writable(key, reply...) {
+			return nil, nil
+		}
+		return batchCommands("ZADD", k, reply, 2), nil
+	case "stream":
+		entries, err := redis.Values(conn.Do("XRANGE", key, "-", "+"))
+		if err != nil {
+			return nil, err
+		}
+		out := make([]string, 0, len(entries))
+		for _, e := range entries {
+			entry, err := redis.Values(e, nil)
+			if err != nil || len(entry) != 2 {
+				return nil, fmt.Errorf("unexpected stream entry %v", e)
+			}
+			id, err := redis.Bytes(entry[0], nil)
+			if err != nil {
+				return nil, err
+			}
+			fields, err := redis.ByteSlices(entry[1], nil)
+			if err != nil {
+				return nil, err
+			}
+			args := append([][]byte{k, id}, fields...)
+			if !writable(key, args...) {
+				return nil, nil
+			}
+			out = append(out, commandLine("XADD", args...))
+		}
+		return out, nil
+	default:
+		logger.Warn(fmt.Sprintf("key %s of type %s can not be exported as commands, it is left out", key, typ))
+		return nil, nil
+	}
+}
+
+// batchCommands returns the commands adding values to key, exportBatch groups of
+// size values at a time.
+func batchCommands(command string, key []byte, values [][]byte, size int) []string {
+	var out []string
+	step := exportBatch * size
+	for start := 0; start < len(values); start += step {
+		end := start + step
+		if end > len(values) {
+			end = len(values)
+		}
+		out = append(out, commandLine(command, append([][]byte{key}, values[start:end]...)...))
+	}
+	return out
+}
+
+// commandLine writes a command line applyCommands runs as the command with args.
+func commandLine(command string, args ...[]byte) string {
+	parts := make([]string, 0, len(args)+1)
+	parts = append(parts, command)
+	for _, a := range args {
+		parts = append(parts, quoteArg(a))
+	}
+	return strings.Join(parts, " ")
+}
+
+// writable reports whether values can be written as arguments of a command line,
+// and warns that key is left out when they can not. A fixture holds a command per
+// line of text, a value with a line break or bytes that are not utf-8 does not fit.
+// A carriage return counts as a line break: editors and git rewrite line endings,
+// and a value ending in one would come back without it.
+func writable(key string, values ...[]byte) bool {
+	for _, v := range values {
+		if !utf8.Valid(v) || bytes.IndexFunc(v, isLineBreak) != -1 {
+			logger.Warn(fmt.Sprintf("key %s holds a line break or binary data, which a fixture of commands can not hold, it is left out", key))
+			return false
+		}
+	}
+	return true
+}
+
+// isLineBreak reports whether r ends a line, for a fixture or the editor it is
+// opened in.
+func isLineBreak(r rune) bool {
+	switch r {
+	case '\n', '\r', '\v', '\f', '\u0085', '\u2028', '\u2029':
+		return true
+	}
+	return false
+}
+
+// quoteArg returns arg as splitCommand reads it back: as it is when it holds no
+// space or quote, quoted otherwise. A quoted value is taken as it is, up to its
+// closing quote, and quoted values next to each other make up one argument: a
+// double quote is written within single quotes and the rest within double ones.
+func quoteArg(arg []byte) string {
+	s := string(arg)
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '\''
+	}) == -1 {
+		return s
+	}
+
+	var b strings.Builder
+	var quote rune
+	for _, r := range s {
+		want := '"'
+		if r == '"' {
+			want = '\''
+		}
+		if quote != want {
+			if quote != 0 {
+				b.WriteRune(quote)
+			}
+			quote = want
+			b.WriteRune(quote)
+		}
+		b.WriteRune(r)
+	}
+	if quote == 0 {
+		return `""`
+	}
+	b.WriteRune(quote)
+	return b.String()
+}
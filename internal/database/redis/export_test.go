@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuoteArg(t *testing.T) {
+	cases := map[string]string{
+		"user:1":      "user:1",
+		"hello world": `"hello world"`,
+		"":            `""`,
+		"it's":        `"it's"`,
+		"C:\\tmp":     `C:\tmp`,
+		"héllo":       "héllo",
+		`say "hi"`:    `"say "'"'"hi"'"'`,
+		" padded ":    `" padded "`,
+		"\tindented":  "\"\tindented\"",
+		"trailing\t":  "\"trailing\t\"",
+		"\u00a0nbsp":  "\"\u00a0nbsp\"",
+	}
+
+	for in, want := range cases {
+		got := quoteArg([]byte(in))
+		if got != want {
+			t.Fatalf("%q: expected %s, got %s", in, want, got)
+		}
+
+		// what an export writes is read back as the value, by a fixture trimming
+		// its lines, even when the value is the last argument of one
+		args, err := splitCommand(strings.TrimSpace("SET key " + got))
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if len(args) != 3 || args[2] != in {
+			t.Fatalf("%q: read back as %q", in, args)
+		}
+	}
+}
+
+func TestWritable(t *testing.T) {
+	if !writable("user:1", []byte("Ada Lovelace"), []byte("tab\there")) {
+		t.Fatal("expected text to be writable")
+	}
+	if writable("note", []byte("line\nbreak")) {
+		t.Fatal("expected a line break not to be writable")
+	}
+	if writable("raw", []byte("\x00\xff")) {
+		t.Fatal("expected binary data not to be writable")
+	}
+
+	// a fixture rewritten with other line endings would lose them
+	for _, v := range []string{"windows\r", "carriage\rreturn", "form\ffeed", "line\u2028separator"} {
+		if writable("note", []byte(v)) {
+			t.Fatalf("expected %q not to be writable", v)
+		}
+	}
+}
+
+func TestBatchCommands(t *testing.T) {
+	fields := make([][]byte, 0, 2*(exportBatch+1))
+	for i := 0; i < exportBatch+1; i++ {
+		fields = append(fields, []byte("field"), []byte("value"))
+	}
+
+	commands := batchCommands("HSET", []byte("user:1"), fields, 2)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 commands, got %d", len(commands))
+	}
+	if want := "HSET user:1 field value"; commands[1] != want {
+		t.Fatalf("expected the last field on its own, got %s", commands[1])
+	}
+}
@@ -10,8 +10,8 @@ import (
 	"unicode"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
 	"github.com/mirzakhany/dbctl/internal/logger"
-	"github.com/mirzakhany/dbctl/internal/utils"
 )
 
 // applyFixtures loads the given files into the database the connection is on.
@@ -20,7 +20,10 @@ import (
 //
 //	.lua           evaluated as a script, the way redis-cli --eval does
 //	anything else  one redis command per line, in redis-cli syntax
-func applyFixtures(conn redis.Conn, files []string) error {
+//
+// Templates, such as users.redis.tmpl, are rendered with seed and applied as the
+// file they render into.
+func applyFixtures(conn redis.Conn, files []string, seed int64) error {
 	if len(files) == 0 {
 		return nil
 	}
@@ -28,12 +31,12 @@ func applyFixtures(conn redis.Conn, files []string) error {
 	logger.Info(fmt.Sprintf("Applying %d fixture files ...", len(files)))
 
 	for _, f := range files {
-		content, err := os.ReadFile(f)
+		content, err := fixtures.ReadFile(f, seed)
 		if err != nil {
 			return fmt.Errorf("read fixture file (%s) failed: %w", f, err)
 		}
 
-		if strings.EqualFold(filepath.Ext(f), ".lua") {
+		if fixtures.Ext(f) == ".lua" {
 			if _, err := redis.NewScript(0, string(content)).Do(conn); err != nil && !isNil(err) {
 				return fmt.Errorf("applying fixture file (%s) failed: %w", f, err)
 			}
@@ -157,7 +160,7 @@ func getFiles(path string) ([]string, error) {
 		}
 
 		// a fixtures directory can hold a readme next to the fixtures
-		if d.IsDir() || !utils.OneOf(strings.ToLower(filepath.Ext(d.Name())), ".redis", ".txt", ".lua") {
+		if d.IsDir() || !fixtures.HasExt(d.Name(), ".redis", ".txt", ".lua") {
 			return nil
 		}
 
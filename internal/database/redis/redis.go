@@ -15,8 +15,10 @@ import (
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/mirzakhany/dbctl/internal/certs"
 	"github.com/mirzakhany/dbctl/internal/container"
 	"github.com/mirzakhany/dbctl/internal/database"
+	"github.com/mirzakhany/dbctl/internal/fixtures"
 	"github.com/mirzakhany/dbctl/internal/logger"
 	"github.com/mirzakhany/dbctl/internal/utils"
 )
@@ -52,6 +54,7 @@ func New(options ...Option) (*Redis, error) {
 		user:    DefaultUser,
 		port:    DefaultPort,
 		version: "7.0.4",
+		seed:    fixtures.DefaultSeed,
 	}}
 
 	for _, o := range options {
@@ -69,7 +72,7 @@ const indexKeyPrefix = "dbctl:db:"
 
 // CreateDB creates a new database
 func (p *Redis) CreateDB(ctx context.Context, req *database.CreateDBRequest) (*database.CreateDBResponse, error) {
-	conn, err := redis.DialURLContext(ctx, p.adminURI())
+	conn, err := p.dial(ctx, p.adminURI())
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +90,7 @@ func (p *Redis) CreateDB(ctx context.Context, req *database.CreateDBRequest) (*d
 	if err != nil {
 		return nil, err
 	}
+	newDB.cfg.certs = p.cfg.certs
 
 	if req != nil && req.Fixtures != "" {
 		files, err := getFiles(req.Fixtures)
@@ -99,7 +103,7 @@ func (p *Redis) CreateDB(ctx context.Context, req *database.CreateDBRequest) (*d
 		}
 	}
 
-	return &database.CreateDBResponse{URI: hostURI(newDB.URI())}, nil
+	return &database.CreateDBResponse{URI: hostURI(newDB.URI()), CA: p.cfg.certs.Authority()}, nil
 }
 
 // applyFixturesTo loads the fixture files into the database the uri points at.
@@ -108,7 +112,7 @@ func (p *Redis) applyFixturesTo(ctx context.Context, uri string, files []string)
 		return nil
 	}
 
-	conn, err := redis.DialURLContext(ctx, uri)
+	conn, err := p.dial(ctx, uri)
 	if err != nil {
 		return err
 	}
@@ -116,7 +120,7 @@ func (p *Redis) applyFixturesTo(ctx context.Context, uri string, files []string)
 		_ = conn.Close()
 	}()
 
-	return applyFixtures(conn, files)
+	return applyFixtures(conn, files, p.cfg.seed)
 }
 
 // acquireDBIndex claims the first unused redis database index. Redis exposes a
@@ -200,7 +204,7 @@ func (p *Redis) RemoveDB(ctx context.Context, uri string) error {
 		redis.call("DEL", ARGV[2] .. dbIndex)
 	`)
 
-	conn, err := redis.DialURLContext(ctx, p.adminURI())
+	conn, err := p.dial(ctx, p.adminURI())
 	if err != nil {
 		return err
 	}
@@ -230,7 +234,9 @@ func (p *Redis) Start(ctx context.Context, detach bool) error {
 
 	closeFunc, err := p.startUsingDocker(ctx, 20*time.Second)
 	if err != nil {
-		_ = closeFunc(ctx)
+		if closeFunc != nil {
+			_ = closeFunc(ctx)
+		}
 		return err
 	}
 
@@ -242,6 +248,7 @@ func (p *Redis) Start(ctx context.Context, detach bool) error {
 
 	// print connection url
 	log.Printf("Database uri is: %q\n", p.URI())
+	p.logCertificates()
 
 	// detach and stop cli if asked
 	p.cfg.detached = detach
@@ -262,7 +269,10 @@ func (p *Redis) Start(ctx context.Context, detach bool) error {
 
 // Stop stops the database
 func (p *Redis) Stop(ctx context.Context) error {
-	return container.TerminateByID(ctx, p.containerID)
+	if err := container.TerminateByID(ctx, p.containerID); err != nil {
+		return err
+	}
+	return certs.Remove(p.cfg.certs)
 }
 
 // WaitForStart waits for database to boot up
@@ -275,7 +285,7 @@ func (p *Redis) WaitForStart(ctx context.Context, timeout time.Duration) error {
 	defer cancel()
 
 	for range ticker.C {
-		conn, err := redis.DialURLContext(ctx, p.noAuthURI())
+		conn, err := p.dial(ctx, p.noAuthURI())
 		if err != nil {
 			if err == context.DeadlineExceeded {
 				return err
@@ -308,6 +318,23 @@ func Instances(ctx context.Context, label string) ([]database.Info, error) {
 	return out, nil
 }
 
+// Running returns a controller for the running redis instance, the one carrying
+// the given label when there are several.
+func Running(ctx context.Context, label string) (*Redis, error) {
+	instance, err := database.FindInstance(ctx, database.TypeRedis, label)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := New(WithInstance(instance))
+	if err != nil {
+		return nil, err
+	}
+
+	db.containerID = instance.ID
+	return db, nil
+}
+
 func (p *Redis) startUsingDocker(ctx context.Context, timeout time.Duration) (func(ctx context.Context) error, error) {
 	var rnd, err = rand.Int(rand.Reader, big.NewInt(20))
 	if err != nil {
@@ -342,17 +369,37 @@ func (p *Redis) startUsingDocker(ctx context.Context, timeout time.Duration) (fu
 		req.Labels[container.LabelCustom] = p.cfg.label
 	}
 
-	pg, err := container.Run(ctx, req)
+	if p.cfg.tls {
+		clientName := ""
+		if p.cfg.tlsClientCert {
+			clientName = "dbctl"
+			if p.cfg.user != "" {
+				clientName = p.cfg.user
+			}
+		}
+		if p.cfg.certs, err = certs.New(req.Name, clientName); err != nil {
+			return nil, err
+		}
+		req.Cmd = certs.Command("redis", append(req.Cmd, tlsArgs()...))
+		req.Mounts = append(req.Mounts, certs.Mount(p.cfg.certs))
+		for k, v := range database.TLSLabels(p.cfg.certs) {
+			req.Labels[k] = v
+		}
+	}
+
+	rs, err := container.Run(ctx, req)
 	if err != nil {
+		_ = certs.Remove(p.cfg.certs)
 		return nil, err
 	}
+	p.containerID = rs.ID
 
 	closeFunc := func(ctx context.Context) error {
-		return pg.Terminate(ctx)
+		return p.Stop(ctx)
 	}
 
 	if err := p.WaitForStart(ctx, timeout); err != nil {
-		return nil, err
+		return closeFunc, err
 	}
 
 	return closeFunc, p.setAuth(ctx, p.noAuthURI())
@@ -367,7 +414,7 @@ func (p *Redis) noAuthURI() string {
 	}
 
 	return (&url.URL{
-		Scheme: "redis",
+		Scheme: p.scheme(),
 		Host:   net.JoinHostPort(addr, strconv.Itoa(int(p.cfg.port))),
 		Path:   "0",
 	}).String()
@@ -382,6 +429,7 @@ func (p *Redis) adminURI() string {
 		// the options used here never fail, fall back to this instance's uri.
 		return p.URI()
 	}
+	admin.cfg.certs = p.cfg.certs
 	return admin.URI()
 }
 
@@ -402,7 +450,7 @@ func (p *Redis) URI() string {
 	}
 
 	return (&url.URL{
-		Scheme: "redis",
+		Scheme: p.scheme(),
 		User:   userInfo,
 		Host:   host,
 		Path:   strconv.Itoa(p.cfg.dbIndex),
@@ -414,7 +462,7 @@ func (p *Redis) setAuth(ctx context.Context, url string) error {
 		return nil
 	}
 
-	conn, err := redis.DialURLContext(ctx, url)
+	conn, err := p.dial(ctx, url)
 	if err != nil {
 		return err
 	}
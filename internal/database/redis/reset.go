@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database"
+)
+
+var _ database.Resetter = (*Redis)(nil)
+
+// ResetDB flushes the database at uri and loads the fixtures again.
+func (p *Redis) ResetDB(ctx context.Context, uri, fixtures string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+
+	dbIndex, err := strconv.Atoi(strings.TrimPrefix(u.Path, "/"))
+	if err != nil {
+		return fmt.Errorf("uri %q does not contain a database index: %w", uri, err)
+	}
+
+	// index 0 is dbctl's own bookkeeping database, it is never handed out
+	if dbIndex == 0 {
+		return fmt.Errorf("database %d is not handed out by dbctl, it can not be reset", dbIndex)
+	}
+
+	db, err := New(WithHost(p.cfg.user, p.cfg.pass, dbIndex, p.cfg.port))
+	if err != nil {
+		return err
+	}
+	db.cfg.certs = p.cfg.certs
+
+	conn, err := p.dial(ctx, db.URI())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	if _, err := conn.Do("FLUSHDB"); err != nil {
+		return fmt.Errorf("flush database failed: %w", err)
+	}
+
+	if fixtures == "" {
+		return nil
+	}
+
+	files, err := getFiles(fixtures)
+	if err != nil {
+		return fmt.Errorf("read fixtures failed: %w", err)
+	}
+	return p.applyFixturesTo(ctx, db.URI(), files)
+}
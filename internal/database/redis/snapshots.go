@@ -0,0 +1,315 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mirzakhany/dbctl/internal/database"
+)
+
+var _ database.Snapshotter = (*Redis)(nil)
+
+// snapshotKeyPrefix names the hash, in index 0, that tells where a snapshot is
+// kept. Snapshots are kept in database indexes claimed like the ones CreateDB hands
+// out, so that they are never handed out while in use.
+const snapshotKeyPrefix = "dbctl:snapshot:"
+
+// reservedKeyPrefix starts every key dbctl keeps for itself in index 0. They are
+// left out of snapshots and left alone by restores, index 0 is also where the data
+// of an instance started with `dbctl start redis` lives.
+const reservedKeyPrefix = "dbctl:"
+
+// copyScript copies the keys of one database index to another with DUMP and
+// RESTORE, their expiry included. With ARGV[4] set the destination is emptied
+// first. Running as a script, the copy is taken while no one writes.
+var copyScript = redis.NewScript(0, `
+	local src = tonumber(ARGV[1])
+	local dst = tonumber(ARGV[2])
+	local reserved = ARGV[3]
+
+	local function skip(index, key)
+		return index == 0 and string.sub(key, 1, #reserved) == reserved
+	end
+
+	if ARGV[4] == "1" then
+		redis.call("SELECT", dst)
+		if dst == 0 then
+			for _, key in ipairs(redis.call("KEYS", "*")) do
+				if not skip(0, key) then
+					redis.call("DEL", key)
+				end
+			end
+		else
+			redis.call("FLUSHDB")
+		end
+	end
+
+	redis.call("SELECT", src)
+	local copied = 0
+	for _, key in ipairs(redis.call("KEYS", "*")) do
+		if not skip(src, key) then
+			redis.call("SELECT", src)
+			local ttl = redis.call("PTTL", key)
+			if ttl ~= -2 then
+				local value = redis.call("DUMP", key)
+				if ttl < 0 then
+					ttl = 0
+				end
+				redis.call("SELECT", dst)
+				redis.call("RESTORE", key, ttl, value, "REPLACE")
+				copied = copied + 1
+			end
+		end
+	end
+
+	redis.call("SELECT", 0)
+	return copied
+`)
+
+// CreateSnapshot copies the database index db to a snapshot called name.
+func (p *Redis) CreateSnapshot(ctx context.Context, name, db string) (*database.Snapshot, error) {
+	if err := database.ValidateSnapshotName(name); err != nil {
+		return nil, err
+	}
+
+	source, err := p.databaseIndex(db)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.dial(ctx, p.adminURI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	index, err := p.acquireDBIndex(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// claiming the name last keeps a failed snapshot from leaving it taken
+	release := func() {
+		_, _ = conn.Do("DEL", indexKeyPrefix+strconv.Itoa(index))
+	}
+
+	if _, err := copyScript.Do(conn, source, index, reservedKeyPrefix, "0"); err != nil {
+		release()
+		return nil, fmt.Errorf("snapshot of database %d failed: %w", source, err)
+	}
+
+	created := time.Now().UTC()
+	claimed, err := redis.Bool(conn.Do("HSETNX", snapshotKeyPrefix+name, "index", index))
+	if err != nil || !claimed {
+		_, _ = conn.Do("SELECT", index)
+		_, _ = conn.Do("FLUSHDB")
+		_, _ = conn.Do("SELECT", 0)
+		release()
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %q, remove it first", database.ErrSnapshotExists, name)
+	}
+
+	if _, err := conn.Do("HSET", snapshotKeyPrefix+name,
+		"source", source, "created_at", created.Format(time.RFC3339Nano)); err != nil {
+		return nil, err
+	}
+
+	return &database.Snapshot{Name: name, Type: database.TypeRedis, Source: strconv.Itoa(source), CreatedAt: created}, nil
+}
+
+// RestoreSnapshot replaces the keys of the database index db with the ones of the
+// snapshot called name.
+func (p *Redis) RestoreSnapshot(ctx context.Context, name, db string) error {
+	conn, err := p.dial(ctx, p.adminURI())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	snapshot, index, err := findSnapshot(conn, name)
+	if err != nil {
+		return err
+	}
+
+	target := snapshot.Source
+	if db != "" {
+		target = db
+	}
+
+	dst, err := p.databaseIndex(target)
+	if err != nil {
+		return err
+	}
+
+	if _, err := copyScript.Do(conn, index, dst, reservedKeyPrefix, "1"); err != nil {
+		return fmt.Errorf("restore snapshot %q failed: %w", name, err)
+	}
+	return nil
+}
+
+// BranchSnapshot copies the snapshot called name to a database index of its own.
+func (p *Redis) BranchSnapshot(ctx context.Context, name string) (*database.CreateDBResponse, error) {
+	conn, err := p.dial(ctx, p.adminURI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_, index, err := findSnapshot(conn, name)
+	if err != nil {
+		return nil, err
+	}
+
+	dbIndex, err := p.acquireDBIndex(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	newDB, err := New(WithHost(p.cfg.user, p.cfg.pass, dbIndex, p.cfg.port))
+	if err != nil {
+		return nil, err
+	}
+	newDB.cfg.certs = p.cfg.certs
+
+	if _, err := copyScript.Do(conn, index, dbIndex, reservedKeyPrefix, "0"); err != nil {
+		_ = p.RemoveDB(ctx, newDB.URI())
+		return nil, fmt.Errorf("branch snapshot %q failed: %w", name, err)
+	}
+
+	return &database.CreateDBResponse{URI: hostURI(newDB.URI()), CA: p.cfg.certs.Authority()}, nil
+}
+
+// Snapshots returns the snapshots of this instance, sorted by name.
+func (p *Redis) Snapshots(ctx context.Context) ([]database.Snapshot, error) {
+	conn, err := p.dial(ctx, p.adminURI())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var out []database.Snapshot
+	cursor := 0
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", snapshotKeyPrefix+"*", "COUNT", 100))
+		if err != nil {
+			return nil, err
+		}
+
+		if cursor, err = redis.Int(values[0], nil); err != nil {
+			return nil, err
+		}
+
+		keys, err := redis.Strings(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			s, _, err := findSnapshot(conn, strings.TrimPrefix(key, snapshotKeyPrefix))
+			if err != nil {
+				if errors.Is(err, database.ErrSnapshotNotFound) {
+					continue
+				}
+				return nil, err
+			}
+			out = append(out, *s)
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// RemoveSnapshot empties the database index holding the snapshot called name and
+// releases it.
+func (p *Redis) RemoveSnapshot(ctx context.Context, name string) error {
+	conn, err := p.dial(ctx, p.adminURI())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_, index, err := findSnapshot(conn, name)
+	if err != nil {
+		return err
+	}
+
+	snapshotDB, err := New(WithHost(p.cfg.user, p.cfg.pass, index, p.cfg.port))
+	if err != nil {
+		return err
+	}
+
+	if err := p.RemoveDB(ctx, snapshotDB.URI()); err != nil {
+		return err
+	}
+
+	_, err = conn.Do("DEL", snapshotKeyPrefix+name)
+	return err
+}
+
+// findSnapshot returns the snapshot called name and the database index keeping it.
+func findSnapshot(conn redis.Conn, name string) (*database.Snapshot, int, error) {
+	fields, err := redis.StringMap(conn.Do("HGETALL", snapshotKeyPrefix+name))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	index, err := strconv.Atoi(fields["index"])
+	if err != nil || index < 1 {
+		return nil, 0, fmt.Errorf("%w: no redis snapshot called %q", database.ErrSnapshotNotFound, name)
+	}
+
+	s := &database.Snapshot{Name: name, Type: database.TypeRedis, Source: fields["source"]}
+	if t, err := time.Parse(time.RFC3339Nano, fields["created_at"]); err == nil {
+		s.CreatedAt = t
+	}
+	return s, index, nil
+}
+
+// databaseIndex is the database index db stands for, either an index or a
+// connection uri. The index of the instance is used when db is empty.
+func (p *Redis) databaseIndex(db string) (int, error) {
+	if db == "" {
+		return p.cfg.dbIndex, nil
+	}
+
+	if strings.Contains(db, "://") {
+		u, err := url.Parse(db)
+		if err != nil {
+			return 0, fmt.Errorf("parse database uri failed: %w", err)
+		}
+		db = strings.TrimPrefix(u.Path, "/")
+		if db == "" {
+			return 0, nil
+		}
+	}
+
+	index, err := strconv.Atoi(db)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("%q is not a redis database index", db)
+	}
+	return index, nil
+}
@@ -0,0 +1,35 @@
+package redis
+
+import "testing"
+
+func TestDatabaseIndex(t *testing.T) {
+	p, err := New(WithHost(DefaultUser, DefaultPass, 3, DefaultPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the index of the instance is used when no database is named
+	ok := map[string]int{
+		"":                                3,
+		"5":                               5,
+		"redis://:pass@localhost:6379/7":  7,
+		"redis://:pass@localhost:6379":    0,
+		"redis://:pass@localhost:6379/12": 12,
+	}
+
+	for in, want := range ok {
+		got, err := p.databaseIndex(in)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("%q: expected index %d, got %d", in, want, got)
+		}
+	}
+
+	for _, in := range []string{"cache", "-1", "redis://localhost:6379/cache"} {
+		if got, err := p.databaseIndex(in); err == nil {
+			t.Fatalf("expected %q to be rejected, got %d", in, got)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"path"
+	"path/filepath"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mirzakhany/dbctl/internal/certs"
+	"github.com/mirzakhany/dbctl/internal/logger"
+)
+
+// tlsArgs are the settings of an instance started with TLS. It only listens with
+// TLS, and takes the certificates of clients when they present one.
+func tlsArgs() []string {
+	return []string{
+		"--port", "0",
+		"--tls-port", "6379",
+		"--tls-cert-file", path.Join(certs.Path, certs.ServerCertFile),
+		"--tls-key-file", path.Join(certs.Path, certs.ServerKeyFile),
+		"--tls-ca-cert-file", path.Join(certs.Path, certs.CAFile),
+		"--tls-auth-clients", "optional",
+	}
+}
+
+// scheme is the scheme of the uris of the instance, rediss for one started with
+// TLS.
+func (p *Redis) scheme() string {
+	if p.cfg.certs != nil {
+		return "rediss"
+	}
+	return "redis"
+}
+
+// dial connects to uri, verifying the instance with its authority when it was
+// started with TLS.
+func (p *Redis) dial(ctx context.Context, uri string) (redis.Conn, error) {
+	if p.cfg.certs == nil {
+		return redis.DialURLContext(ctx, uri)
+	}
+
+	pool, err := certs.Pool(p.cfg.certs.CA)
+	if err != nil {
+		return nil, err
+	}
+	return redis.DialURLContext(ctx, uri, redis.DialTLSConfig(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}))
+}
+
+// logCertificates tells where the certificates of an instance started with TLS
+// are, clients of redis take them apart from the uri.
+func (p *Redis) logCertificates() {
+	if p.cfg.certs == nil {
+		return
+	}
+	logger.Info("Connections are verified with the certificate authority at " + filepath.Join(p.cfg.certs.Dir, certs.CAFile))
+	if p.cfg.certs.ClientCert {
+		logger.Info("The certificate of the client is at " + filepath.Join(p.cfg.certs.Dir, certs.ClientCertFile) +
+			", its key at " + filepath.Join(p.cfg.certs.Dir, certs.ClientKeyFile))
+	}
+}
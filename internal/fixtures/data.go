@@ -0,0 +1,37 @@
+package fixtures
+
+// the values the fake data is drawn from, plain enough to read in a failing test.
+var (
+	firstNames = []string{
+		"Alice", "Amir", "Ana", "Ben", "Carlos", "Chen", "Chloe", "Daniel", "Darius", "Elena",
+		"Emma", "Fatima", "Felix", "Grace", "Hana", "Hugo", "Ivan", "Jack", "Julia", "Kai",
+		"Laila", "Leo", "Lucas", "Maria", "Mateo", "Mia", "Nadia", "Noah", "Olivia", "Omar",
+		"Priya", "Ravi", "Reza", "Sara", "Sofia", "Tom", "Yara", "Yuki", "Zoe", "Zainab",
+	}
+
+	lastNames = []string{
+		"Ahmadi", "Andersen", "Brown", "Costa", "Dubois", "Fischer", "Garcia", "Hansen", "Ito", "Jensen",
+		"Kim", "Kowalski", "Larsen", "Lee", "Lopez", "Martin", "Meyer", "Moreau", "Nakamura", "Nguyen",
+		"Novak", "O'Brien", "Patel", "Petrov", "Rossi", "Santos", "Schmidt", "Silva", "Smith", "Tanaka",
+		"Taylor", "Wagner", "Wang", "Weber", "Williams", "Wilson", "Yilmaz", "Zhang",
+	}
+
+	companies = []string{
+		"Acme", "Blue Harbor", "Brightline", "Cedar Labs", "Copperfield", "Evergreen Foods", "Globex",
+		"Initech", "Northwind", "Orbital Systems", "Pinecone", "Quantum Freight", "Redwood Health",
+		"Silverline", "Stark Logistics", "Umbrella Retail", "Vandelay Industries", "Wayfarer Travel",
+	}
+
+	cities = []string{
+		"Amsterdam", "Berlin", "Buenos Aires", "Cairo", "Cape Town", "Istanbul", "Lisbon", "London",
+		"Madrid", "Montreal", "Mumbai", "Nairobi", "Osaka", "Paris", "Seoul", "Singapore", "Stockholm",
+		"Sydney", "Tehran", "Toronto", "Vienna", "Warsaw",
+	}
+
+	words = []string{
+		"account", "amber", "anchor", "basket", "bright", "bridge", "candle", "canvas", "cloud", "coffee",
+		"delta", "garden", "harbor", "island", "jacket", "kettle", "lantern", "marble", "meadow", "number",
+		"ocean", "orbit", "paper", "pepper", "planet", "quiet", "river", "rocket", "silver", "simple",
+		"stone", "summer", "ticket", "timber", "velvet", "window", "winter", "yellow",
+	}
+)
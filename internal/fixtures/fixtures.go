@@ -0,0 +1,281 @@
+// Package fixtures renders the fixture files written as go templates, the ones
+// ending in .tmpl, into the fixtures they generate: users.sql.tmpl renders into the
+// SQL of users.sql, orders.json.tmpl into the documents of orders.json.
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Suffix marks a fixture file as a template.
+const Suffix = ".tmpl"
+
+// DefaultSeed seeds the random source of the templates unless another seed is
+// given, the same fixtures render into the same data on every run.
+const DefaultSeed int64 = 1
+
+// IsTemplate reports whether the fixture at path is a template.
+func IsTemplate(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), Suffix)
+}
+
+// Name returns the name of the file the fixture at path renders into, path itself
+// when it is not a template.
+func Name(path string) string {
+	if !IsTemplate(path) {
+		return path
+	}
+	return path[:len(path)-len(Suffix)]
+}
+
+// Ext returns the extension of the file the fixture at path renders into, the one
+// that tells how it is applied.
+func Ext(path string) string {
+	return strings.ToLower(filepath.Ext(Name(path)))
+}
+
+// HasExt reports whether the fixture at path renders into a file of one of exts,
+// given lower case with their dot.
+func HasExt(path string, exts ...string) bool {
+	ext := Ext(path)
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadFile reads the fixture at path, rendered with seed when it is a template.
+func ReadFile(path string, seed int64) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsTemplate(path) {
+		return b, nil
+	}
+	return Render(filepath.Base(path), b, seed)
+}
+
+// Render executes the template src called name. Every template gets a random source
+// of its own, seeded from seed and its name: the data of a file does not change when
+// another file is added, and two files generating users do not generate the same ones.
+func Render(name string, src []byte, seed int64) ([]byte, error) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+
+	g := NewGenerator(seed ^ int64(h.Sum64()))
+
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(g.funcs()).Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("parse template failed: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, nil); err != nil {
+		return nil, fmt.Errorf("render template failed: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// Generator draws fake data from a seeded random source, the helpers of templates
+// are its methods.
+type Generator struct {
+	rnd *rand.Rand
+}
+
+// NewGenerator returns a generator drawing from a random source seeded with seed.
+func NewGenerator(seed int64) *Generator {
+	return &Generator{rnd: rand.New(rand.NewSource(seed))}
+}
+
+// Rand returns the random source of the generator, for the data it has no helper for.
+func (g *Generator) Rand() *rand.Rand {
+	return g.rnd
+}
+
+// fakeEpoch and fakeSpan bound the generated timestamps. They are fixed rather than
+// relative to now, so that the same seed gives the same data tomorrow.
+var (
+	fakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fakeSpan  = 5 * 365 * 24 * time.Hour
+)
+
+func (g *Generator) funcs() template.FuncMap {
+	return template.FuncMap{
+		"seq":       seq,
+		"int":       g.Int,
+		"float":     g.Float,
+		"bool":      g.Bool,
+		"pick":      g.Pick,
+		"firstName": g.FirstName,
+		"lastName":  g.LastName,
+		"name":      g.Name,
+		"username":  g.Username,
+		"email":     g.Email,
+		"company":   g.Company,
+		"city":      g.City,
+		"word":      g.Word,
+		"sentence":  g.Sentence,
+		"uuid":      g.UUID,
+		"timestamp": g.Timestamp,
+		"date":      g.Date,
+		"regex":     g.Regex,
+		"quote":     quote,
+		"json":      toJSON,
+	}
+}
+
+// seq returns 1 to n, to number the rows of a loop: {{range $i := seq 1000}}.
+func seq(n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = i + 1
+	}
+	return out
+}
+
+// Int returns an integer in [min, max].
+func (g *Generator) Int(min, max int) (int, error) {
+	if max < min {
+		return 0, fmt.Errorf("int: max %d is less than min %d", max, min)
+	}
+	return min + g.rnd.Intn(max-min+1), nil
+}
+
+// Float returns a number in [min, max) rounded to cents, such as a price.
+func (g *Generator) Float(min, max float64) (float64, error) {
+	if max < min {
+		return 0, fmt.Errorf("float: max %v is less than min %v", max, min)
+	}
+	v := min + g.rnd.Float64()*(max-min)
+	return float64(int64(v*100)) / 100, nil
+}
+
+// Bool returns true or false, as often one as the other.
+func (g *Generator) Bool() bool {
+	return g.rnd.Intn(2) == 1
+}
+
+// Pick returns one of values.
+func (g *Generator) Pick(values ...any) (any, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("pick: no values to pick from")
+	}
+	return values[g.rnd.Intn(len(values))], nil
+}
+
+// FirstName returns a first name, such as Alice.
+func (g *Generator) FirstName() string {
+	return firstNames[g.rnd.Intn(len(firstNames))]
+}
+
+// LastName returns a last name, some of them with an apostrophe such as O'Brien.
+func (g *Generator) LastName() string {
+	return lastNames[g.rnd.Intn(len(lastNames))]
+}
+
+// Name returns a first and a last name, such as Alice Smith.
+func (g *Generator) Name() string {
+	return g.FirstName() + " " + g.LastName()
+}
+
+// Username returns a user name, made unique by the value given, such as the index
+// of a loop: {{username $i}}.
+func (g *Generator) Username(unique ...any) string {
+	return strings.ToLower(g.FirstName()) + "_" + strings.ToLower(g.LastName()) + UniqueSuffix(unique...)
+}
+
+// Email returns an email address at example.com, made unique by the value given,
+// such as the index of a loop: {{email $i}}.
+func (g *Generator) Email(unique ...any) string {
+	local := strings.ToLower(g.FirstName()) + "." + strings.ToLower(g.LastName())
+	return strings.ReplaceAll(local, "'", "") + UniqueSuffix(unique...) + "@example.com"
+}
+
+// UniqueSuffix is what makes a generated value unique: the values given, such as
+// the index of a loop, written one after the other.
+func UniqueSuffix(unique ...any) string {
+	var b strings.Builder
+	for _, v := range unique {
+		fmt.Fprint(&b, v)
+	}
+	return b.String()
+}
+
+// Company returns the name of a company.
+func (g *Generator) Company() string {
+	return companies[g.rnd.Intn(len(companies))]
+}
+
+// City returns the name of a city.
+func (g *Generator) City() string {
+	return cities[g.rnd.Intn(len(cities))]
+}
+
+// Word returns a lower case word, the ones Sentence is made of.
+func (g *Generator) Word() string {
+	return words[g.rnd.Intn(len(words))]
+}
+
+// Sentence returns a sentence of 4 to 12 words.
+func (g *Generator) Sentence() string {
+	n := 4 + g.rnd.Intn(9)
+	out := make([]string, n)
+	for i := range out {
+		out[i] = g.Word()
+	}
+	return strings.ToUpper(out[0][:1]) + strings.Join(out, " ")[1:] + "."
+}
+
+// UUID returns a version 4 uuid drawn from the random source of the generator,
+// unlike the ones of a uuid library that would differ on every run.
+func (g *Generator) UUID() string {
+	var b [16]byte
+	_, _ = g.rnd.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Time returns a time between 2020 and 2025, to the second.
+func (g *Generator) Time() time.Time {
+	return fakeEpoch.Add(time.Duration(g.rnd.Int63n(int64(fakeSpan)))).Truncate(time.Second)
+}
+
+// Timestamp returns a time between 2020 and 2025 in RFC 3339, which postgres,
+// mongodb's extended json and most parsers read.
+func (g *Generator) Timestamp() string {
+	return g.Time().Format(time.RFC3339)
+}
+
+// Date returns a date between 2020 and 2025 as yyyy-mm-dd.
+func (g *Generator) Date() string {
+	return g.Time().Format("2006-01-02")
+}
+
+// quote returns v as an SQL string literal, names such as O'Brien break a plain
+// '{{name}}'.
+func quote(v any) string {
+	return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", "''") + "'"
+}
+
+// toJSON returns v as json, a string quoted and escaped for a json or csv fixture.
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
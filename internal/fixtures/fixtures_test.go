@@ -0,0 +1,115 @@
+package fixtures
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		path string
+		name string
+		ext  string
+	}{
+		{path: "fixtures/users.sql.tmpl", name: "fixtures/users.sql", ext: ".sql"},
+		{path: "fixtures/users.JSON.TMPL", name: "fixtures/users.JSON", ext: ".json"},
+		{path: "fixtures/users.sql", name: "fixtures/users.sql", ext: ".sql"},
+		{path: "fixtures/users.tmpl", name: "fixtures/users", ext: ""},
+	}
+
+	for _, tt := range tests {
+		if got := Name(tt.path); got != tt.name {
+			t.Fatalf("%s: expected name %q, got %q", tt.path, tt.name, got)
+		}
+		if got := Ext(tt.path); got != tt.ext {
+			t.Fatalf("%s: expected ext %q, got %q", tt.path, tt.ext, got)
+		}
+	}
+
+	if !HasExt("users.csv.tmpl", ".sql", ".csv") || HasExt("readme.md.tmpl", ".sql", ".csv") {
+		t.Fatalf("expected HasExt to look at the extension before .tmpl")
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := []byte(`{{range $i := seq 3}}insert into users (id, name, email, ref) values ({{$i}}, {{quote name}}, {{quote (email $i)}}, '{{uuid}}');
+{{end}}`)
+
+	first, err := Render("users.sql.tmpl", src, 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if lines := strings.Count(string(first), "\n"); lines != 3 {
+		t.Fatalf("expected 3 rows, got %d:\n%s", lines, first)
+	}
+	if !regexp.MustCompile(`'[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}'`).Match(first) {
+		t.Fatalf("expected a version 4 uuid in:\n%s", first)
+	}
+	if !strings.Contains(string(first), "3@example.com'") {
+		t.Fatalf("expected the emails to end with the loop index:\n%s", first)
+	}
+
+	again, err := Render("users.sql.tmpl", src, 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(again) != string(first) {
+		t.Fatalf("expected the same seed to render the same data, got:\n%s\nand:\n%s", first, again)
+	}
+
+	other, err := Render("users.sql.tmpl", src, 43)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(other) == string(first) {
+		t.Fatalf("expected another seed to render other data")
+	}
+
+	renamed, err := Render("admins.sql.tmpl", src, 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(renamed) == string(first) {
+		t.Fatalf("expected another file to render other data with the same seed")
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	if _, err := Render("bad.sql.tmpl", []byte("{{int 5 1}}"), DefaultSeed); err == nil {
+		t.Fatalf("expected an error for int with max less than min")
+	}
+	if _, err := Render("bad.sql.tmpl", []byte("{{unknown}}"), DefaultSeed); err == nil {
+		t.Fatalf("expected an error for an unknown function")
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := quote("O'Brien"); got != "'O''Brien'" {
+		t.Fatalf("expected 'O''Brien', got %s", got)
+	}
+}
+
+func TestRegex(t *testing.T) {
+	g := NewGenerator(DefaultSeed)
+
+	patterns := []string{
+		`[a-z]{5,10}@acme\.test`,
+		`^(GB|NL|DE)[0-9]{2} ?[A-Z]{4}$`,
+		`\d{3}-\d+`,
+		`[^a-z]x*`,
+	}
+	for _, pattern := range patterns {
+		re := regexp.MustCompile("^(?:" + pattern + ")$")
+		for i := 0; i < 50; i++ {
+			s, err := g.Regex(pattern)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", pattern, err)
+			}
+			if !re.MatchString(s) {
+				t.Fatalf("%s: generated %q, which does not match", pattern, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package fixtures
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// maxRepeat bounds the repetitions of *, + and open ranges such as {3,}.
+const maxRepeat = 8
+
+// Regex returns a string matching pattern, such as an email of a given domain:
+// {{regex "[a-z]{5,10}@acme\\.test"}}. Anchors and word boundaries are ignored,
+// the whole string matches.
+func (g *Generator) Regex(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", fmt.Errorf("regex: %w", err)
+	}
+
+	var b strings.Builder
+	if err := g.regex(&b, re.Simplify()); err != nil {
+		return "", fmt.Errorf("regex %q: %w", pattern, err)
+	}
+	return b.String(), nil
+}
+
+func (g *Generator) regex(b *strings.Builder, re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		b.WriteRune(g.classRune(re.Rune))
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		b.WriteRune(rune('a' + g.rnd.Intn(26)))
+	case syntax.OpCapture:
+		return g.regex(b, re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := g.regex(b, sub); err != nil {
+				return err
+			}
+		}
+	case syntax.OpAlternate:
+		return g.regex(b, re.Sub[g.rnd.Intn(len(re.Sub))])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			min, max = 0, -1
+		case syntax.OpPlus:
+			min, max = 1, -1
+		case syntax.OpQuest:
+			min, max = 0, 1
+		}
+		if max < 0 {
+			max = min + maxRepeat
+		}
+		for i := min + g.rnd.Intn(max-min+1); i > 0; i-- {
+			if err := g.regex(b, re.Sub[0]); err != nil {
+				return err
+			}
+		}
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+	default:
+		return fmt.Errorf("%s is not supported", re)
+	}
+	return nil
+}
+
+// classRune picks a rune of a character class, given as pairs of ranges. Classes
+// such as [^a] span most of unicode, their printable ascii part is picked from.
+func (g *Generator) classRune(ranges []rune) rune {
+	var printable []rune
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		if lo < ' ' {
+			lo = ' '
+		}
+		if hi > '~' {
+			hi = '~'
+		}
+		if lo <= hi {
+			printable = append(printable, lo, hi)
+		}
+	}
+	if len(printable) > 0 {
+		ranges = printable
+	}
+
+	if len(ranges) == 0 {
+		return 'a'
+	}
+
+	var total int
+	for i := 0; i+1 < len(ranges); i += 2 {
+		total += int(ranges[i+1]-ranges[i]) + 1
+	}
+
+	n := g.rnd.Intn(total)
+	for i := 0; i+1 < len(ranges); i += 2 {
+		size := int(ranges[i+1]-ranges[i]) + 1
+		if n < size {
+			return ranges[i] + rune(n)
+		}
+		n -= size
+	}
+	return ranges[0]
+}
@@ -0,0 +1,73 @@
+package schemadoc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+)
+
+// Diff writes the changes between two postgres schemas as text, one change per
+// line, or as json.
+func Diff(w io.Writer, changes []pg.Change, format string) error {
+	switch format {
+	case FormatText:
+		if len(changes) == 0 {
+			_, _ = fmt.Fprintln(w, "No schema changes")
+			return nil
+		}
+		for _, c := range changes {
+			_, _ = fmt.Fprintln(w, changeLine(c))
+		}
+	case FormatJSON:
+		if changes == nil {
+			changes = []pg.Change{}
+		}
+		return writeJSON(w, changes)
+	default:
+		return fmt.Errorf("unknown format %q, can be text or json", format)
+	}
+	return nil
+}
+
+var changeMarks = map[string]string{
+	pg.ChangeAdded:   "+",
+	pg.ChangeRemoved: "-",
+	pg.ChangeChanged: "~",
+}
+
+// changeLine writes a change the way a reviewer reads it. Functions span many lines,
+// only their json carries their definitions.
+func changeLine(c pg.Change) string {
+	name := c.Name
+	if c.Table != "" {
+		name = c.Table + "." + c.Name
+	}
+	line := changeMarks[c.Action] + " " + c.Kind + " " + name
+
+	switch {
+	case c.Kind == "function" && c.Action == pg.ChangeChanged:
+		return line + ": definition changed"
+	case c.Kind == "function":
+		return line
+	case c.Action == pg.ChangeChanged:
+		return line + " " + c.Attribute + ": " + orNone(c.From) + " -> " + orNone(c.To)
+	case c.From != "":
+		return line + ": " + oneLine(c.From)
+	case c.To != "":
+		return line + ": " + oneLine(c.To)
+	}
+	return line
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return oneLine(s)
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
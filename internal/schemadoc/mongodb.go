@@ -0,0 +1,100 @@
+package schemadoc
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mirzakhany/dbctl/internal/database/mongodb"
+	"github.com/mirzakhany/dbctl/internal/table"
+)
+
+// MongoDB writes the collections of s in format.
+func MongoDB(w io.Writer, s *mongodb.Schema, format string) error {
+	switch format {
+	case FormatText:
+		mongoText(w, s)
+	case FormatJSON:
+		return writeJSON(w, s)
+	case FormatMarkdown:
+		mongoMarkdown(w, s)
+	case FormatMermaid, FormatDot:
+		return noDiagram(format, "mongodb")
+	default:
+		return CheckFormat(format)
+	}
+	return nil
+}
+
+func mongoText(w io.Writer, s *mongodb.Schema) {
+	if len(s.Collections) == 0 {
+		_, _ = fmt.Fprintf(w, "No collections found in %s\n", s.Database)
+		return
+	}
+
+	for i, c := range s.Collections {
+		if i > 0 {
+			_, _ = fmt.Fprintln(w)
+		}
+
+		if c.Type == "view" {
+			_, _ = fmt.Fprintf(w, "View %s on %s\n", c.Name, c.ViewOn)
+			_, _ = fmt.Fprintf(w, "Pipeline: %s\n", c.Pipeline)
+			continue
+		}
+
+		_, _ = fmt.Fprintf(w, "%s %s, %d documents\n", title(c.Type), c.Name, c.Documents)
+		tbl := table.New(w)
+		tbl.AddRow("Index", "Keys", "Options")
+		for _, i := range c.Indexes {
+			tbl.AddRow(i.Name, i.Keys, indexOptions(i))
+		}
+		tbl.Print()
+
+		if c.Validator != "" {
+			_, _ = fmt.Fprintf(w, "Validator: %s\n", c.Validator)
+		}
+	}
+}
+
+func mongoMarkdown(w io.Writer, s *mongodb.Schema) {
+	_, _ = fmt.Fprintf(w, "# Database %s\n", s.Database)
+
+	for _, c := range s.Collections {
+		_, _ = fmt.Fprintf(w, "\n## %s\n\n", c.Name)
+
+		if c.Type == "view" {
+			_, _ = fmt.Fprintf(w, "_view_ on %s: %s\n", code(c.ViewOn), code(c.Pipeline))
+			continue
+		}
+		if c.Type != "collection" {
+			_, _ = fmt.Fprintf(w, "_%s_\n\n", c.Type)
+		}
+		_, _ = fmt.Fprintf(w, "%d documents\n\n", c.Documents)
+
+		rows := make([][]string, 0, len(c.Indexes))
+		for _, i := range c.Indexes {
+			rows = append(rows, []string{code(i.Name), code(i.Keys), indexOptions(i)})
+		}
+		markdownTable(w, []string{"Index", "Keys", "Options"}, rows)
+
+		if c.Validator != "" {
+			_, _ = fmt.Fprintf(w, "\n**Validator**\n\n```json\n%s\n```\n", c.Validator)
+		}
+	}
+}
+
+func indexOptions(i mongodb.Index) string {
+	var opts []string
+	if i.Unique {
+		opts = append(opts, "unique")
+	}
+	if i.Sparse {
+		opts = append(opts, "sparse")
+	}
+	if i.TTL > 0 {
+		opts = append(opts, "ttl "+strconv.FormatInt(i.TTL, 10)+"s")
+	}
+	return strings.Join(opts, ", ")
+}
@@ -0,0 +1,293 @@
+package schemadoc
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	"github.com/mirzakhany/dbctl/internal/table"
+)
+
+// Postgres writes the tables of s in format.
+func Postgres(w io.Writer, s *pg.Schema, format string) error {
+	switch format {
+	case FormatText:
+		postgresText(w, s)
+	case FormatJSON:
+		return writeJSON(w, s)
+	case FormatMarkdown:
+		postgresMarkdown(w, s)
+	case FormatMermaid:
+		postgresMermaid(w, s)
+	case FormatDot:
+		postgresDot(w, s)
+	default:
+		return CheckFormat(format)
+	}
+	return nil
+}
+
+func postgresText(w io.Writer, s *pg.Schema) {
+	if len(s.Tables) == 0 {
+		_, _ = fmt.Fprintf(w, "No tables found in %s\n", s.Database)
+		return
+	}
+
+	for i, t := range s.Tables {
+		if i > 0 {
+			_, _ = fmt.Fprintln(w)
+		}
+
+		_, _ = fmt.Fprintf(w, "%s %s\n", title(t.Kind), t.FullName())
+		if t.Comment != "" {
+			_, _ = fmt.Fprintln(w, t.Comment)
+		}
+
+		tbl := table.New(w)
+		tbl.AddRow("Column", "Type", "Nullable", "Default", "Comment")
+		for _, c := range t.Columns {
+			tbl.AddRow(c.Name, c.Type, yesNo(c.Nullable), c.Default, c.Comment)
+		}
+		tbl.Print()
+
+		writeList := func(title string, items []string) {
+			if len(items) == 0 {
+				return
+			}
+			_, _ = fmt.Fprintf(w, "%s:\n", title)
+			for _, item := range items {
+				_, _ = fmt.Fprintf(w, "    %s\n", item)
+			}
+		}
+		writeList("Indexes", indexLines(t, func(name, def string) string { return name + " " + def }))
+		writeList("Foreign keys", foreignKeyLines(t, func(name, def string) string { return name + " " + def }))
+		writeList("Constraints", constraintLines(t, func(name, def string) string { return name + " " + def }))
+	}
+}
+
+func postgresMarkdown(w io.Writer, s *pg.Schema) {
+	_, _ = fmt.Fprintf(w, "# Database %s\n", s.Database)
+
+	for _, t := range s.Tables {
+		_, _ = fmt.Fprintf(w, "\n## %s\n\n", t.FullName())
+		if t.Kind != "table" {
+			_, _ = fmt.Fprintf(w, "_%s_\n\n", t.Kind)
+		}
+		if t.Comment != "" {
+			_, _ = fmt.Fprintf(w, "%s\n\n", t.Comment)
+		}
+
+		rows := make([][]string, 0, len(t.Columns))
+		for _, c := range t.Columns {
+			def := c.Default
+			if def != "" {
+				def = code(def)
+			}
+			rows = append(rows, []string{code(c.Name), c.Type, yesNo(c.Nullable), def, c.Comment})
+		}
+		markdownTable(w, []string{"Column", "Type", "Nullable", "Default", "Comment"}, rows)
+
+		writeList := func(title string, items []string) {
+			if len(items) == 0 {
+				return
+			}
+			_, _ = fmt.Fprintf(w, "\n**%s**\n\n", title)
+			for _, item := range items {
+				_, _ = fmt.Fprintf(w, "- %s\n", item)
+			}
+		}
+		item := func(name, def string) string { return code(name) + ": " + code(def) }
+		writeList("Indexes", indexLines(t, item))
+		writeList("Foreign keys", foreignKeyLines(t, item))
+		writeList("Constraints", constraintLines(t, item))
+	}
+}
+
+func indexLines(t pg.Table, line func(name, def string) string) []string {
+	out := make([]string, 0, len(t.Indexes))
+	for _, i := range t.Indexes {
+		out = append(out, line(i.Name, i.Definition))
+	}
+	return out
+}
+
+func foreignKeyLines(t pg.Table, line func(name, def string) string) []string {
+	out := make([]string, 0, len(t.ForeignKeys))
+	for _, fk := range t.ForeignKeys {
+		out = append(out, line(fk.Name, fk.Definition))
+	}
+	return out
+}
+
+// constraintLines leaves out the primary key, its index is listed already.
+func constraintLines(t pg.Table, line func(name, def string) string) []string {
+	var out []string
+	for _, c := range t.Constraints {
+		if c.Type == "primary key" {
+			continue
+		}
+		out = append(out, line(c.Name, c.Definition))
+	}
+	return out
+}
+
+// postgresMermaid draws an entity relationship diagram. Tables of the public schema
+// are called by their name, the ones of other schemas by schema and name.
+func postgresMermaid(w io.Writer, s *pg.Schema) {
+	_, _ = fmt.Fprintln(w, "erDiagram")
+
+	for _, t := range s.Tables {
+		_, _ = fmt.Fprintf(w, "    %s {\n", mermaidName(t.Schema, t.Name))
+		for _, c := range t.Columns {
+			line := mermaidType(c.Type) + " " + mermaidName("", c.Name)
+			if keys := columnKeys(t, c.Name); len(keys) > 0 {
+				line += " " + strings.Join(keys, ", ")
+			}
+			if c.Comment != "" {
+				line += ` "` + strings.ReplaceAll(c.Comment, `"`, "'") + `"`
+			}
+			_, _ = fmt.Fprintf(w, "        %s\n", line)
+		}
+		_, _ = fmt.Fprintln(w, "    }")
+	}
+
+	for _, t := range s.Tables {
+		for _, fk := range t.ForeignKeys {
+			// a reference made of nullable columns may be missing
+			rel := "}o--||"
+			if nullable(t, fk.Columns) {
+				rel = "}o--o|"
+			}
+			_, _ = fmt.Fprintf(w, "    %s %s %s : %q\n",
+				mermaidName(t.Schema, t.Name), rel, mermaidName(fk.RefSchema, fk.RefTable), strings.Join(fk.Columns, ", "))
+		}
+	}
+}
+
+var (
+	mermaidNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+	mermaidTypeChars = regexp.MustCompile(`[^A-Za-z0-9_()\[\]]+`)
+)
+
+// mermaidName is a name mermaid takes for an entity or an attribute, which have
+// to be words.
+func mermaidName(schema, name string) string {
+	if schema != "" && schema != "public" {
+		name = schema + "_" + name
+	}
+	return mermaidNameChars.ReplaceAllString(name, "_")
+}
+
+// mermaidType is a type mermaid takes, character varying(255) turns into
+// character_varying(255) and numeric(10,2) into numeric(10_2).
+func mermaidType(typ string) string {
+	return mermaidTypeChars.ReplaceAllString(typ, "_")
+}
+
+// columnKeys returns the keys column is part of, as mermaid marks them.
+func columnKeys(t pg.Table, column string) []string {
+	var keys []string
+	if contains(t.PrimaryKey, column) {
+		keys = append(keys, "PK")
+	}
+	for _, fk := range t.ForeignKeys {
+		if contains(fk.Columns, column) {
+			keys = append(keys, "FK")
+			break
+		}
+	}
+	// a column is unique on its own when a unique index is made of it alone
+	for _, i := range t.Indexes {
+		if i.Unique && !i.Primary && strings.HasSuffix(i.Definition, "("+quoteIfNeeded(column)+")") {
+			keys = append(keys, "UK")
+			break
+		}
+	}
+	return keys
+}
+
+var plainIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// quoteIfNeeded quotes column the way pg_get_indexdef prints it, close enough to
+// find a column in an index definition.
+func quoteIfNeeded(column string) string {
+	if plainIdentifier.MatchString(column) {
+		return column
+	}
+	return `"` + strings.ReplaceAll(column, `"`, `""`) + `"`
+}
+
+func nullable(t pg.Table, columns []string) bool {
+	for _, c := range t.Columns {
+		if c.Nullable && contains(columns, c.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// postgresDot draws the tables as graphviz records, with an edge from the columns
+// of each foreign key to the columns it refers to.
+func postgresDot(w io.Writer, s *pg.Schema) {
+	_, _ = fmt.Fprintf(w, "digraph %q {\n", s.Database)
+	_, _ = fmt.Fprintln(w, "    rankdir=LR;")
+	_, _ = fmt.Fprintln(w, `    node [shape=plaintext, fontname="Helvetica"];`)
+
+	columns := map[string][]pg.Column{}
+	for _, t := range s.Tables {
+		columns[t.FullName()] = t.Columns
+
+		var b strings.Builder
+		b.WriteString(`<table border="0" cellborder="1" cellspacing="0" cellpadding="4">`)
+		_, _ = fmt.Fprintf(&b, `<tr><td bgcolor="lightgrey"><b>%s</b></td></tr>`, html.EscapeString(t.FullName()))
+		for i, c := range t.Columns {
+			name := html.EscapeString(c.Name)
+			if contains(t.PrimaryKey, c.Name) {
+				name = "<u>" + name + "</u>"
+			}
+			_, _ = fmt.Fprintf(&b, `<tr><td port="c%d" align="left">%s <i>%s</i></td></tr>`, i, name, html.EscapeString(c.Type))
+		}
+		b.WriteString(`</table>`)
+
+		_, _ = fmt.Fprintf(w, "    %q [label=<%s>];\n", t.FullName(), b.String())
+	}
+
+	for _, t := range s.Tables {
+		for _, fk := range t.ForeignKeys {
+			from := fmt.Sprintf("%q", t.FullName())
+			if i := columnIndex(t.Columns, fk.Columns[0]); i >= 0 {
+				from += fmt.Sprintf(":c%d", i)
+			}
+
+			// the referred table may be left out by the table pattern
+			ref := fk.RefSchema + "." + fk.RefTable
+			to := fmt.Sprintf("%q", ref)
+			if i := columnIndex(columns[ref], fk.RefColumns[0]); i >= 0 {
+				to += fmt.Sprintf(":c%d", i)
+			}
+			_, _ = fmt.Fprintf(w, "    %s -> %s [tooltip=%q];\n", from, to, fk.Name)
+		}
+	}
+	_, _ = fmt.Fprintln(w, "}")
+}
+
+func columnIndex(columns []pg.Column, name string) int {
+	for i, c := range columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
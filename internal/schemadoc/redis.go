@@ -0,0 +1,80 @@
+package schemadoc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	rs "github.com/mirzakhany/dbctl/internal/database/redis"
+	"github.com/mirzakhany/dbctl/internal/table"
+)
+
+// Redis writes the keys of ks, counted by type and pattern, in format.
+func Redis(w io.Writer, ks *rs.KeySpace, format string) error {
+	switch format {
+	case FormatText:
+		_, _ = fmt.Fprintf(w, "Database %d, %d keys\n", ks.Database, ks.Keys)
+		if ks.Keys == 0 {
+			return nil
+		}
+
+		tbl := table.New(w)
+		tbl.AddRow("Type", "Keys")
+		for _, row := range typeRows(ks) {
+			tbl.AddRow(row...)
+		}
+		tbl.Print()
+
+		tbl = table.New(w)
+		tbl.AddRow("Pattern", "Type", "Keys")
+		for _, row := range patternRows(ks) {
+			tbl.AddRow(row...)
+		}
+		tbl.Print()
+	case FormatJSON:
+		return writeJSON(w, ks)
+	case FormatMarkdown:
+		_, _ = fmt.Fprintf(w, "# Database %d\n\n%d keys\n", ks.Database, ks.Keys)
+		if ks.Keys == 0 {
+			return nil
+		}
+
+		_, _ = fmt.Fprint(w, "\n## Types\n\n")
+		markdownTable(w, []string{"Type", "Keys"}, typeRows(ks))
+
+		rows := patternRows(ks)
+		for _, row := range rows {
+			row[0] = code(row[0])
+		}
+		_, _ = fmt.Fprint(w, "\n## Patterns\n\n")
+		markdownTable(w, []string{"Pattern", "Type", "Keys"}, rows)
+	case FormatMermaid, FormatDot:
+		return noDiagram(format, "redis")
+	default:
+		return CheckFormat(format)
+	}
+	return nil
+}
+
+func typeRows(ks *rs.KeySpace) [][]string {
+	types := make([]string, 0, len(ks.Types))
+	for typ := range ks.Types {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	rows := make([][]string, 0, len(types))
+	for _, typ := range types {
+		rows = append(rows, []string{typ, strconv.FormatInt(ks.Types[typ], 10)})
+	}
+	return rows
+}
+
+func patternRows(ks *rs.KeySpace) [][]string {
+	rows := make([][]string, 0, len(ks.Patterns))
+	for _, p := range ks.Patterns {
+		rows = append(rows, []string{p.Pattern, p.Type, strconv.FormatInt(p.Count, 10)})
+	}
+	return rows
+}
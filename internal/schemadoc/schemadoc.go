@@ -0,0 +1,90 @@
+// Package schemadoc writes what describe reads of a database, its tables,
+// collections or keys, for people to read in a terminal, for tools as json, and as
+// Markdown or diagrams to keep as the documentation of a schema.
+package schemadoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The formats the schema of a database is written in.
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+	FormatMermaid  = "mermaid"
+	FormatDot      = "dot"
+)
+
+// CheckFormat returns an error when format is not one schemas are written in, so
+// that a typo is caught before an instance is started or connected to.
+func CheckFormat(format string) error {
+	switch format {
+	case FormatText, FormatJSON, FormatMarkdown, FormatMermaid, FormatDot:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, can be text, json, markdown, mermaid or dot", format)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// noDiagram is the error of the diagram formats for databases without relations.
+func noDiagram(format, what string) error {
+	return fmt.Errorf("%s has no relations to draw as %s, use text, json or markdown", what, format)
+}
+
+// cell escapes s for a cell of a Markdown table.
+func cell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	s = strings.ReplaceAll(s, "\r\n", "<br>")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// code returns s as inline code of Markdown, fenced with more backticks than it
+// holds in a row.
+func code(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+func markdownTable(w io.Writer, header []string, rows [][]string) {
+	_, _ = fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+	_, _ = fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(header)))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, c := range row {
+			cells[i] = cell(c)
+		}
+		_, _ = fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+	}
+}
+
+// title upper cases the first letter of s, the kinds of tables and collections
+// are ascii words.
+func title(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
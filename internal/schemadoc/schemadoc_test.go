@@ -0,0 +1,126 @@
+package schemadoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mirzakhany/dbctl/internal/database/mongodb"
+	pg "github.com/mirzakhany/dbctl/internal/database/postgres"
+	rs "github.com/mirzakhany/dbctl/internal/database/redis"
+)
+
+func testSchema() *pg.Schema {
+	return &pg.Schema{
+		Database: "shop",
+		Tables: []pg.Table{
+			{
+				Schema: "public", Name: "orders", Kind: "table",
+				Columns: []pg.Column{
+					{Name: "id", Type: "bigint", Default: "nextval('orders_id_seq'::regclass)"},
+					{Name: "user_id", Type: "bigint", Nullable: true},
+					{Name: "total", Type: "numeric(10,2)", Comment: `in "cents" | euros`},
+				},
+				PrimaryKey: []string{"id"},
+				Indexes: []pg.Index{
+					{Name: "orders_pkey", Definition: "CREATE UNIQUE INDEX orders_pkey ON public.orders USING btree (id)", Unique: true, Primary: true},
+				},
+				ForeignKeys: []pg.ForeignKey{
+					{Name: "orders_user_id_fkey", Columns: []string{"user_id"}, RefSchema: "auth", RefTable: "users", RefColumns: []string{"id"},
+						Definition: "FOREIGN KEY (user_id) REFERENCES auth.users(id)"},
+				},
+				Constraints: []pg.Constraint{{Name: "orders_pkey", Type: "primary key", Definition: "PRIMARY KEY (id)"}},
+			},
+			{
+				Schema: "auth", Name: "users", Kind: "table",
+				Columns: []pg.Column{
+					{Name: "id", Type: "bigint"},
+					{Name: "email", Type: "character varying(255)"},
+				},
+				PrimaryKey: []string{"id"},
+				Indexes: []pg.Index{
+					{Name: "users_email_key", Definition: "CREATE UNIQUE INDEX users_email_key ON auth.users USING btree (email)", Unique: true},
+				},
+			},
+		},
+	}
+}
+
+func TestPostgres(t *testing.T) {
+	s := testSchema()
+
+	var out bytes.Buffer
+	if err := Postgres(&out, s, FormatMermaid); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"    orders {\n",
+		"    auth_users {\n",
+		"        bigint id PK\n",
+		"        numeric(10_2) total \"in 'cents' | euros\"\n",
+		"        character_varying(255) email UK\n",
+		"        bigint user_id FK\n",
+		"    orders }o--o| auth_users : \"user_id\"\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected mermaid to contain %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := Postgres(&out, s, FormatMarkdown); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), `| in "cents" \| euros |`) {
+		t.Fatalf("expected the pipe of a comment to be escaped:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "PRIMARY KEY (id)") {
+		t.Fatalf("expected the primary key constraint to be left out, its index is listed:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := Postgres(&out, s, FormatDot); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), `"public.orders":c1 -> "auth.users":c0`) {
+		t.Fatalf("expected an edge from orders.user_id to users.id:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := Postgres(&out, s, FormatJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var back pg.Schema
+	if err := json.Unmarshal(out.Bytes(), &back); err != nil || len(back.Tables) != 2 {
+		t.Fatalf("expected json to read back into the schema, got %v:\n%s", err, out.String())
+	}
+
+	if err := Postgres(&out, s, "yaml"); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+}
+
+func TestNoDiagrams(t *testing.T) {
+	var out bytes.Buffer
+	if err := MongoDB(&out, &mongodb.Schema{Database: "shop"}, FormatMermaid); err == nil {
+		t.Fatalf("expected an error drawing mongodb as a diagram")
+	}
+	if err := Redis(&out, &rs.KeySpace{}, FormatDot); err == nil {
+		t.Fatalf("expected an error drawing redis as a diagram")
+	}
+}
+
+func TestCode(t *testing.T) {
+	tests := map[string]string{
+		"id":         "`id`",
+		"a`b":        "``a`b``",
+		"`quoted`":   "`` `quoted` ``",
+		"multi\nrow": "`multi row`",
+	}
+	for in, want := range tests {
+		if got := code(in); got != want {
+			t.Fatalf("%q: expected %s, got %s", in, want, got)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package utils
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestGetListHash(t *testing.T) {
 	list := []string{"a", "b", "c"}
@@ -13,3 +16,27 @@ func TestGetListHash(t *testing.T) {
 		t.Fatalf("expected dcd229f9224c1d8a1b514239d207f5be800d6a78001e5f550263db0fd05ff979, got %s", hash)
 	}
 }
+
+func TestParseAge(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"7d":    7 * 24 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+		"1.5d":  36 * time.Hour,
+		"12h":   12 * time.Hour,
+		" 30m ": 30 * time.Minute,
+	} {
+		got, err := ParseAge(in)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("%q: expected %s, got %s", in, want, got)
+		}
+	}
+
+	for _, in := range []string{"", "d", "-1d", "soon"} {
+		if _, err := ParseAge(in); err == nil {
+			t.Fatalf("expected %q to be rejected", in)
+		}
+	}
+}
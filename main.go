@@ -8,8 +8,19 @@ import (
 	"os"
 
 	"github.com/mirzakhany/dbctl/cmd"
+	"github.com/mirzakhany/dbctl/cmd/assert"
+	"github.com/mirzakhany/dbctl/cmd/cache"
 	"github.com/mirzakhany/dbctl/cmd/describe"
+	"github.com/mirzakhany/dbctl/cmd/diff"
+	"github.com/mirzakhany/dbctl/cmd/export"
+	"github.com/mirzakhany/dbctl/cmd/logs"
+	"github.com/mirzakhany/dbctl/cmd/report"
+	"github.com/mirzakhany/dbctl/cmd/seed"
+	"github.com/mirzakhany/dbctl/cmd/snapshot"
+	"github.com/mirzakhany/dbctl/cmd/squash"
 	"github.com/mirzakhany/dbctl/cmd/start"
+	"github.com/mirzakhany/dbctl/cmd/subset"
+	"github.com/mirzakhany/dbctl/cmd/templates"
 	"github.com/mirzakhany/dbctl/cmd/testing"
 )
 
@@ -26,6 +37,17 @@ func main() {
 	root.AddCommand(cmd.GetSelfUpdateCmd(version))
 	root.AddCommand(cmd.GetTestingAPIServerCmd())
 	root.AddCommand(describe.GetDescribeCmd())
+	root.AddCommand(templates.GetTemplatesCmd())
+	root.AddCommand(cache.GetCacheCmd())
+	root.AddCommand(snapshot.GetSnapshotCmd())
+	root.AddCommand(seed.GetSeedCmd())
+	root.AddCommand(diff.GetDiffCmd())
+	root.AddCommand(squash.GetSquashCmd())
+	root.AddCommand(export.GetExportCmd())
+	root.AddCommand(assert.GetAssertCmd())
+	root.AddCommand(subset.GetSubsetCmd())
+	root.AddCommand(logs.GetLogsCmd())
+	root.AddCommand(report.GetReportCmd())
 
 	// testing is able to run multiple commands includes starting the dbctl api server
 	root.AddCommand(testing.GetStartTestingCmd(root))